@@ -0,0 +1,71 @@
+package mflag
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	// prefixAliases maps short prefixes to the prefixes they stand for.
+	prefixAliases = make(map[string]string)
+	// flagAliases maps the names of alias flags to the flags they alias.
+	flagAliases = make(map[string]string)
+)
+
+// AliasPrefix makes every flag below prefix also available below alias, so
+// AliasPrefix("db", "database") accepts --db-host as an alias for
+// --database-host. Keys given to --set may use the alias too.
+// It should be called before Parse.
+func AliasPrefix(alias, prefix string) {
+	prefixAliases[alias] = prefix
+}
+
+// resolveAlias replaces a leading alias prefix of key by the prefix it
+// stands for.
+func resolveAlias(key string) string {
+	for alias, prefix := range prefixAliases {
+		if key == alias {
+			return prefix
+		}
+		if rest, ok := strings.CutPrefix(key, alias+"."); ok {
+			return prefix + "." + rest
+		}
+	}
+	return key
+}
+
+// registerAliasFlags adds alias flags for every generated flag whose key
+// lies below an aliased prefix. Alias flags share the flag.Value of the flag
+// they alias.
+func registerAliasFlags(fs *flag.FlagSet) []error {
+	if len(prefixAliases) == 0 {
+		return nil
+	}
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(flagKeys)) {
+		key := flagKeys[name]
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		for _, alias := range slices.Sorted(maps.Keys(prefixAliases)) {
+			prefix := prefixAliases[alias]
+			rest, ok := strings.CutPrefix(key, prefix+".")
+			if !ok {
+				continue
+			}
+			aliasName := flagNameMapper(alias + "." + rest)
+			if fs.Lookup(aliasName) != nil {
+				errs = append(errs, fmt.Errorf("alias flag %q for key %q collides with an existing flag", aliasName, key))
+				continue
+			}
+			fs.Var(f.Value, aliasName, fmt.Sprintf("alias for --%s", name))
+			flagKeys[aliasName] = key
+			flagAliases[aliasName] = name
+		}
+	}
+	return errs
+}
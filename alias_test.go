@@ -0,0 +1,44 @@
+package mflag
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAliasPrefix(t *testing.T) {
+	testReset(t)
+
+	AliasPrefix("db", "database")
+	SetDefault("database.host", "localhost")
+	SetDefault("database.port", 5432)
+	SetDefault("database.pool.size", 10)
+	os.Args = []string{"test", "--db-host=db.internal", "--database-port=6543", "--set=db.pool.size=20"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if v := GetString("database.host"); v != "db.internal" {
+		t.Errorf("Expected database.host to be set via its alias, got %q", v)
+	}
+	if v := GetInt("database.port"); v != 6543 {
+		t.Errorf("Expected database.port to be 6543, got %d", v)
+	}
+	if v := GetInt("database.pool.size"); v != 20 {
+		t.Errorf("Expected database.pool.size to be set via --set alias, got %d", v)
+	}
+	if IsSet("db.host") {
+		t.Error("Expected alias keys not to exist in the configuration")
+	}
+}
+
+func TestAliasPrefix_Collision(t *testing.T) {
+	testReset(t)
+
+	AliasPrefix("db", "database")
+	SetDefault("database.host", "localhost")
+	SetDefault("db.host", "other")
+	if err := ParseWithError(); err == nil || !strings.Contains(err.Error(), "collides") {
+		t.Errorf("Expected an alias collision error, got: %v", err)
+	}
+}
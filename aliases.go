@@ -0,0 +1,104 @@
+package mflag
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultAliasBudget is the default of SetAliasBudget.
+const defaultAliasBudget = 1_000_000
+
+// mergeKey is the YAML merge key, as in "<<: *base".
+const mergeKey = "<<"
+
+// aliasBudget is the budget set with SetAliasBudget.
+var aliasBudget = defaultAliasBudget
+
+// SetAliasBudget sets how many values the aliases of a YAML config file,
+// such as *base, may expand to in total. Files exceeding it fail to load
+// with ErrInitFailed, which guards against "billion laughs" documents whose
+// few lines of nested aliases expand to billions of values. The default of
+// one million leaves room for configurations that lean heavily on anchors.
+// It should be called before Init.
+func SetAliasBudget(n int) {
+	aliasBudget = n
+}
+
+// decodeYAML decodes the YAML document content into out, as yaml.Unmarshal
+// does, once it has checked that its aliases fit in the alias budget.
+func decodeYAML(content []byte, out interface{}) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return err
+	}
+	expanded := 0
+	sizes := make(map[*yaml.Node]int)
+	if _, err := aliasExpansion(&doc, sizes, &expanded); err != nil {
+		return err
+	}
+	return doc.Decode(out)
+}
+
+// aliasExpansion returns the number of values n stands for once its aliases
+// are expanded, adding the values of the aliases to expanded. sizes
+// memoizes the size of anchored nodes, -1 while they are being measured.
+func aliasExpansion(n *yaml.Node, sizes map[*yaml.Node]int, expanded *int) (int, error) {
+	if n.Kind == yaml.AliasNode {
+		size, ok := sizes[n.Alias]
+		switch {
+		case size < 0:
+			return 0, fmt.Errorf("alias *%s refers to a value containing it", n.Value)
+		case !ok:
+			sizes[n.Alias] = -1
+			var err error
+			if size, err = aliasExpansion(n.Alias, sizes, new(int)); err != nil {
+				return 0, err
+			}
+			sizes[n.Alias] = size
+		}
+		*expanded += size
+		if *expanded > aliasBudget {
+			return 0, fmt.Errorf("aliases expand to more than %d values, see SetAliasBudget", aliasBudget)
+		}
+		return size, nil
+	}
+	size := 1
+	for _, child := range n.Content {
+		s, err := aliasExpansion(child, sizes, expanded)
+		if err != nil {
+			return 0, err
+		}
+		size += s
+	}
+	return size, nil
+}
+
+// applyMergeKey merges the maps held by the merge key of m into m, for
+// parsers that leave "<<" keys to the application. Keys of m take
+// precedence, then the maps in the order they are listed, as in YAML.
+func applyMergeKey(m map[string]interface{}) {
+	var sources []map[string]interface{}
+	switch v := m[mergeKey].(type) {
+	case map[string]interface{}:
+		sources = []map[string]interface{}{v}
+	case []interface{}:
+		for _, item := range v {
+			source, ok := item.(map[string]interface{})
+			if !ok {
+				return // Not a merge: an ordinary key called "<<".
+			}
+			sources = append(sources, source)
+		}
+	default:
+		return
+	}
+	delete(m, mergeKey)
+	for _, source := range sources {
+		for k, v := range source {
+			if _, ok := m[k]; !ok {
+				m[k] = v
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLAnchors(t *testing.T) {
+	testReset(t)
+	if err := Init(createTempYAML(t, `
+base: &base
+  host: db.internal
+  port: 5432
+  tags: &tags [a, b]
+primary:
+  <<: *base
+  port: 6432
+replicas:
+  - <<: [*base]
+    host: replica-1
+extra: *tags
+`)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--primary-host=db-2"}
+	Parse()
+
+	if got := GetString("primary.host"); got != "db-2" {
+		t.Errorf("Expected the flag to override a merged key, got %q", got)
+	}
+	if got := GetInt("primary.port"); got != 6432 {
+		t.Errorf("Expected the explicit key to win over the merge, got %d", got)
+	}
+	if got := GetString("base.host"); got != "db.internal" {
+		t.Errorf("Expected the anchor to be unaffected by the flag, got %q", got)
+	}
+	if got := GetString("replicas.0.host"); got != "replica-1" {
+		t.Errorf("Expected replica-1, got %q", got)
+	}
+	if got := GetInt("replicas.0.port"); got != 5432 {
+		t.Errorf("Expected the merged port, got %d", got)
+	}
+	if got := GetStringSlice("extra"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Expected the aliased list, got %v", got)
+	}
+	if IsSet("primary.<<") {
+		t.Error("Expected no merge key in the configuration")
+	}
+}
+
+func TestYAMLAnchors_MergeKeyFromProvider(t *testing.T) {
+	testReset(t)
+	p := providerFunc(func(context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"db": map[interface{}]interface{}{
+				"<<":   map[interface{}]interface{}{"host": "base", "port": 1},
+				"port": 2,
+			},
+		}, nil
+	})
+	if err := InitContext(context.Background(), p); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetString("db.host"); got != "base" {
+		t.Errorf("Expected the merged host, got %q", got)
+	}
+	if got := GetInt("db.port"); got != 2 {
+		t.Errorf("Expected the explicit port, got %d", got)
+	}
+}
+
+func TestYAMLAnchors_Budget(t *testing.T) {
+	testReset(t)
+	var bomb strings.Builder
+	bomb.WriteString("a: &a [x, x, x, x, x, x, x, x, x]\n")
+	for prev, name := 'a', 'b'; name <= 'i'; prev, name = name, name+1 {
+		bomb.WriteString(string(name) + ": &" + string(name) + " [")
+		for i := 0; i < 9; i++ {
+			if i > 0 {
+				bomb.WriteString(", ")
+			}
+			bomb.WriteString("*" + string(prev))
+		}
+		bomb.WriteString("]\n")
+	}
+	err := Init(createTempYAML(t, bomb.String()))
+	if !errors.Is(err, ErrInitFailed) || !strings.Contains(err.Error(), "aliases expand") {
+		t.Errorf("Expected the alias budget to be exceeded, got %v", err)
+	}
+
+	testReset(t)
+	SetAliasBudget(3)
+	err = Init(createTempYAML(t, "base: &base {a: 1, b: 2}\nx: *base\ny: *base\n"))
+	if !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed with a small budget, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package mflag
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// archiveManifest is the name of the file listing the config files of an
+// archive in merge order.
+const archiveManifest = "manifest.yaml"
+
+// Defaults of SetArchiveLimits.
+const (
+	defaultArchiveFileLimit  = 16 << 20
+	defaultArchiveTotalLimit = 64 << 20
+)
+
+// archiveFileLimit and archiveTotalLimit are the limits set with
+// SetArchiveLimits.
+var (
+	archiveFileLimit  int64 = defaultArchiveFileLimit
+	archiveTotalLimit int64 = defaultArchiveTotalLimit
+)
+
+// SetArchiveLimits sets how many bytes a file of an archive may hold once
+// decompressed, and how many all its files may hold together. Archives
+// exceeding either fail to load with ErrInitFailed, which guards against
+// "zip bombs" whose few kilobytes decompress to gigabytes. The defaults of
+// 16 MiB per file and 64 MiB in total leave room for large bundles.
+// It should be called before InitArchive.
+func SetArchiveLimits(perFile, total int64) {
+	archiveFileLimit, archiveTotalLimit = perFile, total
+}
+
+// InitArchive loads configuration from a bundle of config files in a tar
+// archive, optionally gzipped as with .tgz, or a zip archive, such as a
+// release bundle or an artifact pulled from an OCI registry. A manifest.yaml
+// at the root of the archive lists the files to merge, later files
+// overriding earlier ones:
+//
+//	files:
+//	  - base.yaml
+//	  - regions/eu.yaml
+//
+// Without a manifest, the config files of the archive are merged in lexical
+// order of their paths, as InitDir does for a directory. As with InitDir,
+// each file gets its migrations, conditional blocks and scoped overrides
+// applied before it is merged. As with Init, a missing archive is not an
+// error unless RequireConfigFile was called.
+// It should be called after setting defaults and before parsing flags.
+func InitArchive(path string) error {
+	return InitContext(context.Background(), Archive(path))
+}
+
+// Archive returns a Provider loading the archive at path, as InitArchive
+// does. Environment variables and a leading ~ in path are expanded when the
+// archive is loaded.
+func Archive(path string) Provider {
+	return archiveProvider{path: path}
+}
+
+type archiveProvider struct {
+	path string
+}
+
+func (p archiveProvider) Load(ctx context.Context) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filename, err := expandPath(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInitFailed, err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) && !requireConfigFile {
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("%w: failed to read config archive %s: %w", ErrInitFailed, filename, err)
+	}
+	data, format, err := loadArchive(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInitFailed, filename, err)
+	}
+	recordFileUsed(ctx, filename, format, content, fileKeys(data))
+	return data, nil
+}
+
+// isArchiveName reports whether name has the extension of an archive
+// Archive can load.
+func isArchiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".tar", ".tgz", ".tar.gz", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadArchive merges the config files of the archive content, each with
+// its migrations, conditional blocks and scoped overrides applied as
+// InitDir applies them. It returns the merged values and the format of the
+// archive.
+func loadArchive(content []byte) (map[string]interface{}, string, error) {
+	files, format, err := readArchive(content)
+	if err != nil {
+		return nil, format, err
+	}
+
+	var order []string
+	if manifest, ok := files[archiveManifest]; ok {
+		var parsed struct {
+			Files []string `yaml:"files"`
+		}
+		if err := yaml.Unmarshal(manifest, &parsed); err != nil {
+			return nil, format, fmt.Errorf("invalid %s: %w", archiveManifest, err)
+		}
+		for _, name := range parsed.Files {
+			name = path.Clean(strings.TrimPrefix(name, "./"))
+			if _, ok := files[name]; !ok {
+				return nil, format, fmt.Errorf("%s lists %q, which is not in the archive", archiveManifest, name)
+			}
+			order = append(order, name)
+		}
+	} else {
+		for name := range files {
+			if !strings.HasPrefix(path.Base(name), ".") && isConfigExt(path.Ext(name)) {
+				order = append(order, name)
+			}
+		}
+		slices.Sort(order)
+	}
+
+	data := make(map[string]interface{})
+	for _, name := range order {
+		m := newManager()
+		if _, err := m.parse(name, "", files[name]); err != nil {
+			return nil, format, fmt.Errorf("%s: %w", name, err)
+		}
+		layer, err := prepareLayer(m.data, data)
+		if err != nil {
+			return nil, format, fmt.Errorf("%s: %w", name, err)
+		}
+		data = overlayMaps(data, layer)
+	}
+	return data, format, nil
+}
+
+// readArchive returns the content of the regular files of a tar, gzipped
+// tar or zip archive by cleaned path, and the format of the archive.
+func readArchive(content []byte) (map[string][]byte, string, error) {
+	files := make(map[string][]byte)
+	remaining := archiveTotalLimit
+	switch {
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, "zip", err
+		}
+		for _, f := range r.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, "zip", err
+			}
+			b, err := readArchived(rc, f.Name, &remaining)
+			rc.Close()
+			if err != nil {
+				return nil, "zip", err
+			}
+			files[path.Clean(f.Name)] = b
+		}
+		return files, "zip", nil
+	case bytes.HasPrefix(content, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, "tgz", err
+		}
+		defer gz.Close()
+		return files, "tgz", readTar(tar.NewReader(gz), files, &remaining)
+	}
+	return files, "tar", readTar(tar.NewReader(bytes.NewReader(content)), files, &remaining)
+}
+
+// readTar adds the regular files of r to files, taking their size from
+// remaining.
+func readTar(r *tar.Reader, files map[string][]byte, remaining *int64) error {
+	for {
+		hdr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := readArchived(r, hdr.Name, remaining)
+		if err != nil {
+			return err
+		}
+		files[path.Clean(hdr.Name)] = b
+	}
+}
+
+// readArchived reads the file name of an archive from r, within the limits
+// set with SetArchiveLimits, and takes its size from remaining, the number
+// of bytes the archive may still hold.
+func readArchived(r io.Reader, name string, remaining *int64) ([]byte, error) {
+	limit := min(archiveFileLimit, *remaining)
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		if limit == archiveFileLimit {
+			return nil, fmt.Errorf("%s exceeds the limit of %d bytes per file", name, archiveFileLimit)
+		}
+		return nil, fmt.Errorf("the archive exceeds the limit of %d bytes in total", archiveTotalLimit)
+	}
+	*remaining -= int64(len(b))
+	return b, nil
+}
@@ -0,0 +1,77 @@
+package mflag
+
+import (
+	"reflect"
+	"slices"
+	"time"
+)
+
+// AuditEvent records a change of the effective value of a key.
+type AuditEvent struct {
+	Key string
+	// Old and New are the values before and after the change, nil when the
+	// key was not set. Values of secret keys are masked.
+	Old, New interface{}
+	// Source is where the new value comes from: "flag", "file", "remote"
+	// or "default".
+	Source string
+	Time   time.Time
+}
+
+// auditSink is the function set with SetAuditSink.
+var auditSink func(AuditEvent)
+
+// SetAuditSink registers a function receiving an AuditEvent for every
+// change of an effective value, for compliance records: one per key that
+// Parse sets to something other than its default, and one per key changed
+// by Reload. sink is called synchronously, so it should hand events off to
+// slow destinations rather than write them itself.
+func SetAuditSink(sink func(AuditEvent)) {
+	auditSink = sink
+}
+
+// auditChanges reports the differences between old and next to the audit
+// sink. source returns where the value of a key of next comes from.
+func auditChanges(old, next *mapManager, source func(key string) string) {
+	if auditSink == nil {
+		return
+	}
+	now := time.Now()
+	for _, c := range diff(old, next) {
+		auditSink(AuditEvent{Key: c.Key, Old: c.Old, New: c.New, Source: source(c.Key), Time: now})
+	}
+}
+
+// Change is a difference between two configurations.
+type Change struct {
+	Key string
+	// Old and New are the values of the key, nil when it is not set. Values
+	// of secret keys are masked.
+	Old, New interface{}
+}
+
+// diff returns the keys whose values differ between old and next, sorted.
+func diff(old, next *mapManager) []Change {
+	var changes []Change
+	keys := append(old.AllKeys(), next.AllKeys()...)
+	slices.Sort(keys)
+	for _, key := range slices.Compact(keys) {
+		before, after := old.Get(key), next.Get(key)
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+		if old.isSecret(key) || next.isSecret(key) {
+			before, after = maskSet(before), maskSet(after)
+		}
+		changes = append(changes, Change{Key: key, Old: before, New: after})
+	}
+	return changes
+}
+
+// maskSet returns secretMask for set values and nil otherwise.
+func maskSet(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return secretMask
+}
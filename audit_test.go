@@ -0,0 +1,54 @@
+package mflag
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAuditSink(t *testing.T) {
+	testReset(t)
+	var events []AuditEvent
+	SetAuditSink(func(e AuditEvent) { events = append(events, e) })
+	SetDefault("port", 80)
+	SetDefault("host", "localhost")
+	MarkSecret("password")
+	configPath := createTempYAML(t, "port: 8080\npassword: hunter2\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--host=example.com"}
+	Parse()
+
+	summarize := func() [][3]interface{} {
+		var got [][3]interface{}
+		for _, e := range events {
+			if e.Time.IsZero() {
+				t.Errorf("Expected a timestamp for %q", e.Key)
+			}
+			got = append(got, [3]interface{}{e.Key, e.New, e.Source})
+		}
+		events = nil
+		return got
+	}
+	want := [][3]interface{}{
+		{"host", "example.com", "flag"},
+		{"password", secretMask, "file"},
+		{"port", 8080, "file"},
+	}
+	if got := summarize(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected events after Parse:\n got %v\nwant %v", got, want)
+	}
+
+	if err := os.WriteFile(configPath, []byte("port: 9090\npassword: hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	want = [][3]interface{}{{"port", 9090, "file"}}
+	if got := summarize(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected events after Reload:\n got %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package mflag
+
+import (
+	"flag"
+	"maps"
+	"slices"
+)
+
+// boundFlags holds the names of the flag.CommandLine flags bound with
+// BindStandardFlag.
+var boundFlags = make(map[string]bool)
+
+// BindStandardFlag feeds a flag the application defined itself on
+// flag.CommandLine, e.g. with flag.String("mode", ...), into the
+// configuration under the key of the same name. When the flag is set on the
+// command line, its value takes precedence like any other flag; otherwise its
+// default is used as the key's default, unless the key has one already.
+// mflag does not generate a flag of its own for a bound key.
+// It should be called before Parse.
+func BindStandardFlag(name string) {
+	boundFlags[name] = true
+}
+
+// bindStandardFlags makes the bound flags available on fs, applies their
+// defaults to the defaults layer and maps them to their keys.
+// If fs is not flag.CommandLine, the flags are added to fs sharing their
+// flag.Value, so parsing fs also sets the application's variables.
+func bindStandardFlags(fs *flag.FlagSet) {
+	for _, name := range slices.Sorted(maps.Keys(boundFlags)) {
+		f := flag.CommandLine.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if fs != flag.CommandLine && fs.Lookup(name) == nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+		if !defaults.Has(name) {
+			defaults.SetValue(name, flagValue(f))
+		}
+	}
+}
+
+// flagValue returns the current value of f, as a typed value if its
+// flag.Value implements flag.Getter.
+func flagValue(f *flag.Flag) interface{} {
+	if getter, ok := f.Value.(flag.Getter); ok {
+		return getter.Get()
+	}
+	return f.Value.String()
+}
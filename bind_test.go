@@ -0,0 +1,97 @@
+package mflag
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBindStandardFlag(t *testing.T) {
+	for _, withError := range []bool{false, true} {
+		testReset(t)
+
+		mode := flag.String("mode", "dev", "run mode")
+		workers := flag.Int("workers", 1, "number of workers")
+		BindStandardFlag("mode")
+		BindStandardFlag("workers")
+		configPath := createTempYAML(t, "mode: staging\nworkers: 4\n")
+		if err := Init(configPath); err != nil {
+			t.Fatalf("Init() failed: %v", err)
+		}
+		os.Args = []string{"test", "--mode=prod"}
+
+		if withError {
+			if err := ParseWithError(); err != nil {
+				t.Fatalf("ParseWithError() failed: %v", err)
+			}
+		} else {
+			Parse()
+		}
+
+		if v := GetString("mode"); v != "prod" {
+			t.Errorf("Expected the explicitly set flag to win, got mode %q", v)
+		}
+		if *mode != "prod" {
+			t.Errorf("Expected the application's variable to be set, got %q", *mode)
+		}
+		if v := GetInt("workers"); v != 4 {
+			t.Errorf("Expected the config file to win over the flag default, got workers %d", v)
+		}
+		if *workers != 1 {
+			t.Errorf("Expected the unset flag to keep its default, got %d", *workers)
+		}
+	}
+}
+
+func TestBindStandardFlag_DefaultUsedWhenUnconfigured(t *testing.T) {
+	testReset(t)
+
+	flag.Duration("grace", 0, "grace period")
+	BindStandardFlag("grace")
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if !IsSet("grace") {
+		t.Error("Expected the flag default to be used as the key's default")
+	}
+}
+
+func TestStandardFlagCollision(t *testing.T) {
+	testReset(t)
+
+	flag.String("mode", "dev", "run mode")
+	SetDefault("mode", "staging")
+	if err := parse(flag.CommandLine, nil); err == nil || !strings.Contains(err.Error(), "BindStandardFlag") {
+		t.Errorf("Expected a collision error suggesting BindStandardFlag, got: %v", err)
+	}
+}
+
+func TestParseWithError_WithCommandLine(t *testing.T) {
+	testReset(t)
+
+	verbose := flag.Bool("library-verbose", false, "a flag registered by a library")
+	SetDefault("port", 8080)
+	os.Args = []string{"test", "--library-verbose", "--port=9090"}
+
+	if err := ParseWithError(WithCommandLine()); err != nil {
+		t.Fatalf("ParseWithError(WithCommandLine()) failed: %v", err)
+	}
+	if !*verbose {
+		t.Error("Expected the library flag to be parsed")
+	}
+	if !flag.Parsed() {
+		t.Error("Expected flag.Parsed() to report true")
+	}
+	if v := GetInt("port"); v != 9090 {
+		t.Errorf("Expected port to be 9090, got %d", v)
+	}
+
+	testReset(t)
+	os.Args = []string{"test", "--unknown"}
+	flag.CommandLine.SetOutput(io.Discard)
+	if err := ParseWithError(WithCommandLine()); err == nil {
+		t.Error("Expected an error for an unknown flag instead of exiting")
+	}
+}
@@ -0,0 +1,30 @@
+package mflag
+
+// Builder assembles a configuration in memory, without files, flags or the
+// package-level state, for fixtures in unit tests:
+//
+//	cfg := mflag.Build().
+//		Set("server.addr", ":8080").
+//		Set("server.timeout", 5*time.Second).
+//		Reader()
+//	srv := NewServer(cfg)
+type Builder struct {
+	m *mapManager
+}
+
+// Build returns an empty Builder.
+func Build() *Builder {
+	return &Builder{m: newManager()}
+}
+
+// Set sets key, in dot notation, to value and returns b.
+func (b *Builder) Set(key string, value interface{}) *Builder {
+	b.m.SetValue(key, value)
+	return b
+}
+
+// Reader returns the configuration built so far. Later calls to Set do not
+// change it.
+func (b *Builder) Reader() *Section {
+	return newSection("", convertMap(b.m.data))
+}
@@ -0,0 +1,83 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// childConfigEnv is the environment variable with which CommandWithConfig
+// passes the path of the configuration file to the child, and from which
+// Init reads it.
+const childConfigEnv = "MFLAG_CONFIG_FILE"
+
+// CommandWithConfig returns an exec.Cmd running name with args, as
+// exec.CommandContext does, that passes the effective configuration to the
+// child, for supervisors and plugin hosts whose children are built with
+// mflag too:
+//
+//   - if SetEnvPrefix was called with a prefix, the configuration is passed
+//     as environment variables named after it, see ExportEnv, which the
+//     child reads with the same prefix;
+//   - otherwise it is written to a temporary YAML file, readable by its
+//     owner only and encrypted if SetSnapshotKey was called, whose path is
+//     given to the child in the MFLAG_CONFIG_FILE environment variable.
+//     Init and InitOptional load that file in place of their own.
+//
+// The file holds the secrets of the configuration in plaintext unless
+// encrypted, so call cleanup to remove it once the child is done with it,
+// after Wait at the latest:
+//
+//	cmd, cleanup := mflag.CommandWithConfig(ctx, "./plugin", "serve")
+//	defer cleanup()
+//	err := cmd.Run()
+//
+// If the file cannot be written, the error is reported by the Start, Run
+// or Output methods of the command.
+// Must be called after Parse.
+func CommandWithConfig(ctx context.Context, name string, args ...string) (cmd *exec.Cmd, cleanup func()) {
+	mustBeParsed()
+	cmd = exec.CommandContext(ctx, name, args...)
+	if envAuto && envPrefix != "" {
+		ExportEnvTo(cmd, envPrefix)
+		return cmd, func() {}
+	}
+
+	path, err := writeChildConfig()
+	if err != nil {
+		cmd.Err = errors.Join(cmd.Err, err)
+		return cmd, func() {}
+	}
+	cmd.Env = append(cmd.Environ(), childConfigEnv+"="+path)
+	return cmd, func() { os.Remove(path) }
+}
+
+// writeChildConfig writes the effective configuration to a new temporary
+// file and returns its path.
+func writeChildConfig() (string, error) {
+	f, err := os.CreateTemp("", "mflag-*.yaml")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	f.Close()
+	if err := writeSnapshot(path, finalConfig.data); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// parentConfig returns the path of the configuration file passed by a
+// parent process with CommandWithConfig, if any. The variable is removed
+// from the environment, so that the children of the process do not look
+// for a file that its parent may remove.
+func parentConfig() (string, bool) {
+	path, ok := os.LookupEnv(childConfigEnv)
+	if !ok || path == "" {
+		return "", false
+	}
+	os.Unsetenv(childConfigEnv)
+	return path, true
+}
@@ -0,0 +1,65 @@
+package mflag
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCommandWithConfig(t *testing.T) {
+	testReset(t)
+	SetDefault("db.host", "localhost")
+	os.Args = []string{"test", "--db-host=db.internal"}
+	Parse()
+
+	cmd, cleanup := CommandWithConfig(context.Background(), "./plugin", "serve")
+	if cmd.Err != nil {
+		t.Fatalf("CommandWithConfig() failed: %v", cmd.Err)
+	}
+	if !slices.Equal(cmd.Args, []string{"./plugin", "serve"}) {
+		t.Errorf("Args = %v, want the arguments unchanged", cmd.Args)
+	}
+	var path string
+	for _, kv := range cmd.Env {
+		if value, ok := strings.CutPrefix(kv, childConfigEnv+"="); ok {
+			path = value
+		}
+	}
+	if path == "" {
+		t.Fatalf("Env = %v, want the path of the file in %s", cmd.Env, childConfigEnv)
+	}
+
+	// The child loads the file in place of its own.
+	testReset(t)
+	SetDefault("db.host", "localhost")
+	t.Setenv(childConfigEnv, path)
+	if err := Init(createTempYAML(t, "db:\n  host: other\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetString("db.host"); got != "db.internal" {
+		t.Errorf("db.host = %q in the child, want %q", got, "db.internal")
+	}
+	if _, ok := os.LookupEnv(childConfigEnv); ok {
+		t.Errorf("Expected %s to be removed from the environment", childConfigEnv)
+	}
+
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected cleanup to remove the file, got %v", err)
+	}
+
+	testReset(t)
+	SetEnvPrefix("MYAPP")
+	SetDefault("db.host", "localhost")
+	os.Args = []string{"test", "--db-host=db.internal"}
+	Parse()
+	cmd, cleanup = CommandWithConfig(context.Background(), "./plugin", "serve")
+	defer cleanup()
+	if len(cmd.Args) != 2 || !slices.Contains(cmd.Env, "MYAPP_DB_HOST=db.internal") {
+		t.Errorf("Args = %v, Env = %v, want the configuration in the environment", cmd.Args, cmd.Env)
+	}
+}
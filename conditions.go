@@ -0,0 +1,291 @@
+package mflag
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// conditionsKey is the key of the conditional blocks in a configuration.
+const conditionsKey = "when"
+
+// applyConditions applies the conditional blocks of data, so that one
+// config file can serve several environments:
+//
+//	replicas: 1
+//	when:
+//	  - if: environment == "prod"
+//	    then:
+//	      replicas: 5
+//	  - if: $REGION == "eu-west-1" && environment != "dev"
+//	    then:
+//	      endpoint: https://eu.example.com
+//
+// A "when" key holding a list of maps with an "if" key is replaced by the
+// "then" maps of the blocks whose condition holds, merged over the map that
+// holds it in order. It may appear in any map. Conditions compare keys of
+// the configuration, which default to the values set with SetDefault,
+// $VARIABLES of the environment and quoted, numeric or boolean literals with
+// == and !=, combined with && and ||. A key or variable on its own holds if
+// it is set to anything but "", "false" or "0". Keys missing from data are
+// looked up in base, the values merged below data, if not nil.
+func applyConditions(data, base map[string]interface{}) (map[string]interface{}, error) {
+	root := &mapManager{data: data, shared: true}
+	below := &mapManager{data: base, shared: true}
+	lookup := func(key string) string {
+		if v := root.Get(key); v != nil {
+			return fmt.Sprint(v)
+		}
+		if v := below.Get(key); v != nil {
+			return fmt.Sprint(v)
+		}
+		if v := defaults.Get(key); v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	data, _, err := conditionsIn(data, "", root, lookup)
+	return data, err
+}
+
+// conditionsIn applies the conditional blocks of m, at key, and of the maps
+// it holds, reporting whether there were any. m is copied rather than
+// modified. root is updated as blocks are applied, so that later conditions
+// see the values set by earlier blocks.
+func conditionsIn(m map[string]interface{}, key string, root *mapManager, lookup func(string) string) (map[string]interface{}, bool, error) {
+	blocks, changed := conditionalBlocks(m[conditionsKey])
+	if changed {
+		m = copyMap(m)
+		delete(m, conditionsKey)
+		for i, block := range blocks {
+			at := joinKey(key, fmt.Sprintf("%s.%d", conditionsKey, i))
+			expr, ok := block["if"].(string)
+			if !ok {
+				return nil, false, fmt.Errorf("%q: condition must be a string", at)
+			}
+			holds, err := evalCondition(expr, lookup)
+			if err != nil {
+				return nil, false, fmt.Errorf("%q: %w", at, err)
+			}
+			if !holds || block["then"] == nil {
+				continue
+			}
+			then, ok := block["then"].(map[string]interface{})
+			if !ok {
+				return nil, false, fmt.Errorf("%q: then must be a map", at)
+			}
+			m = overlayMaps(m, then)
+			setAt(root, key, m)
+		}
+	}
+
+	for k, v := range m {
+		nested, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		applied, ok, err := conditionsIn(nested, joinKey(key, k), root, lookup)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			continue
+		}
+		if !changed {
+			m, changed = copyMap(m), true
+		}
+		m[k] = applied
+	}
+	return m, changed, nil
+}
+
+// conditionalBlocks returns the blocks of v if it is a list of maps with an
+// "if" key. Other values of a "when" key are ordinary values.
+func conditionalBlocks(v interface{}) ([]map[string]interface{}, bool) {
+	items, ok := v.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+	blocks := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if _, ok := block["if"]; !ok {
+			return nil, false
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, true
+}
+
+// joinKey returns the key of child below parent.
+func joinKey(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
+
+// setAt replaces the map at key in root with m.
+func setAt(root *mapManager, key string, m map[string]interface{}) {
+	if key == "" {
+		root.data = m
+		return
+	}
+	root.SetValue(key, m)
+}
+
+// evalCondition evaluates the condition expr, looking up keys with lookup.
+func evalCondition(expr string, lookup func(string) string) (bool, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	if len(tokens) == 0 {
+		return false, fmt.Errorf("empty condition")
+	}
+	p := &conditionParser{tokens: tokens, lookup: lookup}
+	holds, err := p.or()
+	if err != nil {
+		return false, err
+	}
+	if p.pos < len(p.tokens) {
+		return false, fmt.Errorf("unexpected %q in condition %q", p.tokens[p.pos].text, expr)
+	}
+	return holds, nil
+}
+
+// conditionToken is a token of a condition. Quoted literals have their
+// quotes removed.
+type conditionToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeCondition splits expr into operators, quoted literals and words.
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in condition %q", expr)
+			}
+			tokens = append(tokens, conditionToken{text: expr[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.HasPrefix(expr[i:], "=="), strings.HasPrefix(expr[i:], "!="),
+			strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, conditionToken{text: expr[i : i+2]})
+			i += 2
+		default:
+			end := i
+			for end < len(expr) && isConditionWordByte(expr[end]) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q in condition %q", c, expr)
+			}
+			tokens = append(tokens, conditionToken{text: expr[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// isConditionWordByte reports whether c can be part of a key, variable or
+// literal in a condition.
+func isConditionWordByte(c byte) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))) ||
+		strings.IndexByte("._-${}:/+", c) >= 0
+}
+
+// conditionParser evaluates the tokens of a condition.
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+	lookup func(string) string
+}
+
+// or evaluates operands of && joined by ||.
+func (p *conditionParser) or() (bool, error) {
+	holds, err := p.and()
+	for err == nil && p.accept("||") {
+		var next bool
+		next, err = p.and()
+		holds = holds || next
+	}
+	return holds, err
+}
+
+// and evaluates comparisons joined by &&.
+func (p *conditionParser) and() (bool, error) {
+	holds, err := p.comparison()
+	for err == nil && p.accept("&&") {
+		var next bool
+		next, err = p.comparison()
+		holds = holds && next
+	}
+	return holds, err
+}
+
+// comparison evaluates an operand, or two operands compared with == or !=.
+func (p *conditionParser) comparison() (bool, error) {
+	left, err := p.operand()
+	if err != nil {
+		return false, err
+	}
+	var equal bool
+	switch {
+	case p.accept("=="):
+		equal = true
+	case p.accept("!="):
+	default:
+		return left != "" && left != "false" && left != "0", nil
+	}
+	right, err := p.operand()
+	if err != nil {
+		return false, err
+	}
+	return (left == right) == equal, nil
+}
+
+// operand returns the value of the next token.
+func (p *conditionParser) operand() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("condition ends unexpectedly")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch {
+	case tok.quoted:
+		return tok.text, nil
+	case tok.text == "==" || tok.text == "!=" || tok.text == "&&" || tok.text == "||":
+		return "", fmt.Errorf("unexpected %q in condition", tok.text)
+	case strings.HasPrefix(tok.text, "$"):
+		name := strings.TrimSuffix(strings.TrimPrefix(tok.text[1:], "{"), "}")
+		return os.Getenv(name), nil
+	case tok.text == "true" || tok.text == "false":
+		return tok.text, nil
+	}
+	if _, err := strconv.ParseFloat(tok.text, 64); err == nil {
+		return tok.text, nil
+	}
+	return p.lookup(tok.text), nil
+}
+
+// accept consumes the next token if it is the operator op.
+func (p *conditionParser) accept(op string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && p.tokens[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
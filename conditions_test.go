@@ -0,0 +1,108 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	testReset(t)
+	t.Setenv("TEST_MFLAG_REGION", "eu-west-1")
+	SetDefault("environment", "dev")
+	SetDefault("replicas", 1)
+	SetDefault("endpoint", "https://example.com")
+	if err := Init(createTempYAML(t, `
+environment: prod
+when:
+  - if: environment == "prod"
+    then:
+      replicas: 5
+      database: {pool: 20}
+  - if: $TEST_MFLAG_REGION == 'eu-west-1' && environment != "dev"
+    then:
+      endpoint: https://eu.example.com
+  - if: replicas == 1 || debug
+    then:
+      level: debug
+database:
+  host: db
+  when:
+    - if: database.pool == 20
+      then:
+        timeout: 5s
+`)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := GetInt("replicas"); got != 5 {
+		t.Errorf("Expected the prod block to apply, got %d replicas", got)
+	}
+	if got := GetString("endpoint"); got != "https://eu.example.com" {
+		t.Errorf("Expected the region block to apply, got %q", got)
+	}
+	if IsSet("level") {
+		t.Error("Expected the block with a false condition not to apply")
+	}
+	want := map[string]interface{}{"host": "db", "pool": 20, "timeout": "5s"}
+	if got := Sub("database").m.data; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the nested block to apply, got %v", got)
+	}
+	if IsSet("when") || IsSet("database.when") {
+		t.Error("Expected the conditional blocks to be removed")
+	}
+}
+
+func TestConditions_Errors(t *testing.T) {
+	for name, content := range map[string]string{
+		"syntax":       "when:\n  - if: environment ==\n    then: {a: 1}\n",
+		"unterminated": "when:\n  - if: environment == \"prod\n    then: {a: 1}\n",
+		"then":         "when:\n  - if: \"true\"\n    then: [1]\n",
+	} {
+		testReset(t)
+		if err := Init(createTempYAML(t, content)); !errors.Is(err, ErrInitFailed) {
+			t.Errorf("%s: expected ErrInitFailed, got %v", name, err)
+		}
+	}
+
+	testReset(t)
+	if err := Init(createTempYAML(t, "when: [monday, friday]\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetStringSlice("when"); len(got) != 2 {
+		t.Errorf("Expected an ordinary when key to be kept, got %v", got)
+	}
+}
+
+func TestEvalCondition(t *testing.T) {
+	lookup := func(key string) string {
+		return map[string]string{"env": "prod", "count": "3", "on": "true"}[key]
+	}
+	for expr, want := range map[string]bool{
+		`env == "prod"`:                    true,
+		`env != 'prod'`:                    false,
+		`count == 3`:                       true,
+		`on`:                               true,
+		`missing`:                          false,
+		`missing == ""`:                    true,
+		`env == "dev" || count == 3`:       true,
+		`env == "prod" && count == 4`:      false,
+		`"a && b" == "a && b"`:             true,
+		`env == "dev" || on && count == 3`: true,
+	} {
+		got, err := evalCondition(expr, lookup)
+		if err != nil || got != want {
+			t.Errorf("evalCondition(%q) = %v, %v, want %v", expr, got, err, want)
+		}
+	}
+	for _, expr := range []string{"", "== x", "env ==", "env == prod extra", "env = x"} {
+		if _, err := evalCondition(expr, lookup); err == nil {
+			t.Errorf("Expected an error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package mflag
+
+// conflictHook is the function set with OnConflict.
+var conflictHook func(key string, dst, src interface{}) interface{}
+
+// OnConflict sets a function resolving the values of keys set in two
+// layers, for domain-specific merging such as taking the highest of two
+// rate limits or the union of two lists:
+//
+//	mflag.OnConflict(func(key string, dst, src interface{}) interface{} {
+//		if key == "allowed_ips" {
+//			return union(dst, src)
+//		}
+//		return src
+//	})
+//
+// dst is the value of the lower layer and src the value of the layer
+// merged over it, in the order of Layers; fn returns the merged value, and
+// returning src keeps the usual precedence. fn is called for the keys
+// whose values are not both maps, as maps are merged key by key, and may
+// be called several times for the same key, so it must not modify dst or
+// src nor have side effects. A nil fn restores the usual precedence.
+// It should be called before Parse.
+func OnConflict(fn func(key string, dst, src interface{}) interface{}) {
+	conflictHook = fn
+}
+
+// overlayConflicts merges upper over lower as overlayMaps does, resolving
+// the values of the keys below prefix set in both with conflictHook.
+func overlayConflicts(prefix string, lower, upper map[string]interface{}) map[string]interface{} {
+	if len(upper) == 0 && lower != nil {
+		return lower
+	}
+	if len(lower) == 0 && upper != nil {
+		return upper
+	}
+	res := copyMap(lower)
+	for key, upperVal := range upper {
+		lowerVal, ok := lower[key]
+		if !ok {
+			res[key] = upperVal
+			continue
+		}
+		lowerMap, lowerIsMap := lowerVal.(map[string]interface{})
+		upperMap, upperIsMap := upperVal.(map[string]interface{})
+		switch {
+		case lowerIsMap && upperIsMap:
+			res[key] = overlayConflicts(joinKey(prefix, key), lowerMap, upperMap)
+		case upperIsMap:
+			// Maps replace values, or set the items of lists by index.
+			res[key] = overlayValue(lowerVal, upperVal)
+		default:
+			res[key] = conflictHook(joinKey(prefix, key), lowerVal, upperVal)
+		}
+	}
+	return res
+}
@@ -0,0 +1,122 @@
+package mflag
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// countFlags maps the short names of counting flags to their keys.
+var countFlags = make(map[string]string)
+
+// DeclareCount binds a counting flag to an integer key, such as "verbosity".
+// Every occurrence of the short flag on the command line increments the
+// value, so -v -v and -vv both yield 2. The key keeps its regular flag,
+// e.g. --verbosity=2. If the key has no default, it defaults to 0.
+// It should be called before Parse.
+func DeclareCount(key string, short string) {
+	if defaults.Get(key) == nil {
+		SetDefault(key, 0)
+	}
+	countFlags[short] = key
+}
+
+// countValue is the flag.Value of counting flags. It behaves as a boolean
+// flag, so that it can be given without a value, and counts its occurrences.
+type countValue struct {
+	n int
+}
+
+func (v *countValue) String() string {
+	if v == nil {
+		return "0"
+	}
+	return strconv.Itoa(v.n)
+}
+
+func (v *countValue) Set(s string) error {
+	if b, err := strconv.ParseBool(s); err == nil {
+		if b {
+			v.n++
+		} else {
+			v.n = 0
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("expected a bool or a count, got %q", s)
+	}
+	v.n = n
+	return nil
+}
+
+func (v *countValue) Get() interface{} {
+	return v.n
+}
+
+func (v *countValue) IsBoolFlag() bool {
+	return true
+}
+
+// registerCountFlags adds the counting flags declared with DeclareCount to fs.
+func registerCountFlags(fs *flag.FlagSet) []error {
+	var errs []error
+	for _, short := range slices.Sorted(maps.Keys(countFlags)) {
+		key := countFlags[short]
+		if fs.Lookup(short) != nil {
+			errs = append(errs, fmt.Errorf("counting flag %q for key %q is already defined", short, key))
+			continue
+		}
+		flagKeys[short] = key
+		fs.Var(&countValue{}, short, fmt.Sprintf("increment '%s' (repeatable, e.g. -%s)", key, strings.Repeat(short, 3)))
+	}
+	return errs
+}
+
+// expandCountFlags rewrites repeated single-letter counting flags, such as
+// -vvv, into separate occurrences (-v -v -v) the flag package understands.
+// The values of the flags of fs that take one are left untouched, as are
+// the arguments from a "--" terminator or the first argument that is not a
+// flag on.
+func expandCountFlags(fs *flag.FlagSet, args []string) []string {
+	if len(countFlags) == 0 {
+		return args
+	}
+	expanded := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !isFlag(arg) {
+			return append(expanded, args[i:]...)
+		}
+		if short, n := repeatedShortFlag(arg); n > 1 {
+			for range n {
+				expanded = append(expanded, "-"+short)
+			}
+			continue
+		}
+		expanded = append(expanded, arg)
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if f := fs.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			expanded = append(expanded, args[i])
+		}
+	}
+	return expanded
+}
+
+// repeatedShortFlag reports whether arg is a single-letter counting flag
+// repeated n times, such as -vvv.
+func repeatedShortFlag(arg string) (short string, n int) {
+	if len(arg) < 3 || arg[0] != '-' || arg[1] == '-' {
+		return "", 0
+	}
+	short = arg[1:2]
+	if _, ok := countFlags[short]; !ok || strings.Trim(arg[1:], short) != "" {
+		return "", 0
+	}
+	return short, len(arg) - 1
+}
@@ -0,0 +1,54 @@
+package mflag
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCountFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"test"}, 0},
+		{[]string{"test", "-v"}, 1},
+		{[]string{"test", "-v", "-v"}, 2},
+		{[]string{"test", "-vvv"}, 3},
+		{[]string{"test", "-vv", "-v"}, 3},
+		{[]string{"test", "--verbosity=5"}, 5},
+	}
+	for _, tt := range tests {
+		testReset(t)
+		DeclareCount("verbosity", "v")
+		os.Args = tt.args
+		if err := ParseWithError(); err != nil {
+			t.Fatalf("ParseWithError(%v) failed: %v", tt.args, err)
+		}
+		if got := GetInt("verbosity"); got != tt.want {
+			t.Errorf("ParseWithError(%v): expected verbosity %d, got %d", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestExpandCountFlags(t *testing.T) {
+	testReset(t)
+	DeclareCount("verbosity", "v")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("pattern", "", "")
+	got := expandCountFlags(fs, []string{"-vvv", "-vx", "--vv", "-v", "--", "-vv"})
+	want := []string{"-v", "-v", "-v", "-vx", "--vv", "-v", "--", "-vv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Flag values and the arguments from the first positional one on are
+	// left untouched.
+	got = expandCountFlags(fs, []string{"--pattern", "-vv", "-vv", "grep", "-vv"})
+	want = []string{"--pattern", "-vv", "-v", "-v", "grep", "-vv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,95 @@
+package mflag
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	start := time.Date(2024, time.January, 15, 10, 7, 30, 0, time.UTC) // A Monday.
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"30 0 9 * * 1", time.Date(2024, 1, 22, 9, 0, 30, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)}, // The 13th or a Friday.
+		{"@daily", time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(start); !got.Equal(tt.want) {
+			t.Errorf("ParseCron(%q).Next() = %v, expected %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * jan-xyz *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestGetCron(t *testing.T) {
+	testReset(t)
+	DeclareKey("jobs.cleanup", Cron)
+	configPath := createTempYAML(t, "jobs:\n  cleanup: \"0 3 * * *\"\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	s := GetCron("jobs.cleanup")
+	if s == nil {
+		t.Fatal("Expected a schedule")
+	}
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got := s.Next(from); !got.Equal(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected next run %v", got)
+	}
+	if GetCron("jobs.missing") != nil {
+		t.Error("Expected nil for a missing key")
+	}
+
+	testReset(t)
+	DeclareKey("jobs.cleanup", Cron)
+	configPath = createTempYAML(t, "jobs:\n  cleanup: \"0 25 * * *\"\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected an invalid schedule to fail Parse, got %v", err)
+	}
+
+	// A custom parser replaces the built-in syntax.
+	testReset(t)
+	SetCronParser(func(spec string) (Schedule, error) {
+		d, err := time.ParseDuration(spec)
+		return everySchedule(d), err
+	})
+	DeclareKey("jobs.cleanup", Cron)
+	configPath = createTempYAML(t, "jobs:\n  cleanup: 90m\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+	if got := GetCron("jobs.cleanup").Next(from); !got.Equal(from.Add(90 * time.Minute)) {
+		t.Errorf("Expected the custom parser to be used, got %v", got)
+	}
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
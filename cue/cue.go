@@ -0,0 +1,91 @@
+// Package cue integrates CUE with mflag: values can be loaded from .cue
+// files, and the merged configuration can be validated against a CUE
+// definition, which gives both types and constraints in one artifact. It is
+// a separate module so that mflag itself does not depend on the CUE
+// libraries.
+//
+//	validate, err := cue.Validator("schema.cue", "#Config")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	mflag.AddValidator(validate)
+//
+// with schema.cue holding, for example:
+//
+//	#Config: {
+//		port:  int & >0 & <65536
+//		level: "debug" | "info" | "warn"
+//		...
+//	}
+package cue
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	cuelang "cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/hypedn/mflag"
+)
+
+// File returns a provider reading the values of the CUE file at path, which
+// must all be concrete. It is mflag.File with the CUE format, so the path is
+// expanded, RequireConfigFile applies and the file is recorded in
+// mflag.ConfigFilesUsed. File registers Unmarshal for the ".cue" extension.
+func File(path string) mflag.Provider {
+	registerOnce.Do(func() {
+		mflag.RegisterFormat(".cue", Unmarshal)
+	})
+	return mflag.File(path, mflag.WithFormat(".cue"))
+}
+
+var registerOnce sync.Once
+
+// Unmarshal parses the CUE document src into nested maps. Its values must
+// all be concrete. Registering it with mflag.RegisterFormat(".cue",
+// cue.Unmarshal) lets Init read CUE files.
+func Unmarshal(src []byte) (map[string]interface{}, error) {
+	v := cuecontext.New().CompileBytes(src, cuelang.Filename("config.cue"))
+	if err := v.Validate(cuelang.Concrete(true)); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse cue: %w", mflag.ErrInitFailed, err)
+	}
+	values := make(map[string]interface{})
+	if err := v.Decode(&values); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode cue: %w", mflag.ErrInitFailed, err)
+	}
+	return values, nil
+}
+
+// Validator compiles the CUE file at path and returns a function checking
+// a configuration against its definition, such as "#Config", for use with
+// mflag.AddValidator. An empty definition checks against the whole file.
+// Definitions are closed, so keys they do not list are rejected unless the
+// definition allows more with "...".
+func Validator(path, definition string) (func(settings map[string]interface{}) error, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read schema %s: %w", mflag.ErrInitFailed, path, err)
+	}
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(src, cuelang.Filename(path))
+	if definition != "" {
+		schema = schema.LookupPath(cuelang.ParsePath(definition))
+	}
+	if err := schema.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to compile schema %s: %w", mflag.ErrInitFailed, path, err)
+	}
+
+	// A cue context is not safe for concurrent use, and the schema can only
+	// be unified with values of its own context.
+	var mu sync.Mutex
+	return func(settings map[string]interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		v := schema.Unify(ctx.Encode(settings))
+		if err := v.Validate(cuelang.Concrete(true)); err != nil {
+			return fmt.Errorf("%w: %w", mflag.ErrInvalidValue, err)
+		}
+		return nil
+	}, nil
+}
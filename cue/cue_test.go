@@ -0,0 +1,105 @@
+package cue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hypedn/mflag"
+)
+
+// writeFile writes content to name in a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile(t *testing.T) {
+	path := writeFile(t, "config.cue", `
+port: 8080
+name: "app"
+tags: ["a", "b"]
+database: host: "localhost"
+`)
+	got, err := File(path).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"port":     int64(8080),
+		"name":     "app",
+		"tags":     []string{"a", "b"},
+		"database": map[string]interface{}{"host": "localhost"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %#v, want %#v", got, want)
+	}
+
+	if _, err := File(writeFile(t, "open.cue", "port: int\n")).Load(context.Background()); !errors.Is(err, mflag.ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for values that are not concrete, got %v", err)
+	}
+	data, err := File(filepath.Join(t.TempDir(), "missing.cue")).Load(context.Background())
+	if err != nil || len(data) != 0 {
+		t.Errorf("Expected no values for a missing file, got %v, %v", data, err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	schema := writeFile(t, "schema.cue", `
+#Config: {
+	port:  int & >0 & <65536
+	level: "debug" | "info" | *"warn"
+	database?: host: string
+}
+`)
+	validate, err := Validator(schema, "#Config")
+	if err != nil {
+		t.Fatalf("Validator() failed: %v", err)
+	}
+
+	valid := map[string]interface{}{"port": 8080, "level": "info", "database": map[string]interface{}{"host": "db"}}
+	if err := validate(valid); err != nil {
+		t.Errorf("Expected a valid configuration, got %v", err)
+	}
+	for name, settings := range map[string]map[string]interface{}{
+		"out of range": {"port": 70000, "level": "info"},
+		"not allowed":  {"port": 80, "level": "trace"},
+		"unknown key":  {"port": 80, "level": "info", "extra": true},
+		"missing key":  {"level": "info"},
+	} {
+		if err := validate(settings); !errors.Is(err, mflag.ErrInvalidValue) {
+			t.Errorf("%s: expected ErrInvalidValue, got %v", name, err)
+		}
+	}
+
+	if _, err := Validator(schema, "#Missing"); !errors.Is(err, mflag.ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for a missing definition, got %v", err)
+	}
+}
+
+func TestValidator_Parse(t *testing.T) {
+	args := os.Args
+	mflag.Reset()
+	t.Cleanup(func() {
+		os.Args = args
+		mflag.Reset()
+	})
+
+	validate, err := Validator(writeFile(t, "schema.cue", "port: int & <1024\n"), "")
+	if err != nil {
+		t.Fatalf("Validator() failed: %v", err)
+	}
+	mflag.SetDefault("port", 80)
+	mflag.AddValidator(validate)
+	os.Args = []string{"test", "--port=8080"}
+	if err := mflag.ParseWithError(); !errors.Is(err, mflag.ErrInvalidValue) {
+		t.Errorf("Expected Parse to fail validation, got %v", err)
+	}
+}
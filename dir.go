@@ -0,0 +1,72 @@
+package mflag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InitDir loads every config file in dir, the drop-in pattern of
+// directories such as /etc/app/conf.d, merging them in lexical order of
+// their names so that later files override earlier ones, e.g.
+// "10-base.yaml" then "50-local.yaml". Files ending in .yaml, .yml or .json
+// are loaded, and files with an extension added with RegisterFormat; other
+// files, hidden files and subdirectories are ignored. Migrations,
+// conditional blocks and scoped overrides are applied to each file before
+// it is merged, and conditions see the values of earlier files. As with
+// Init, a missing directory is not an error unless RequireConfigFile was
+// called.
+// It should be called after setting defaults and before parsing flags.
+func InitDir(dir string) error {
+	return InitContext(context.Background(), Dir(dir))
+}
+
+// Dir returns a Provider merging the config files in the directory at path,
+// as InitDir does. Environment variables and a leading ~ in path are
+// expanded when the directory is loaded.
+func Dir(path string) Provider {
+	return dirProvider{path: path}
+}
+
+type dirProvider struct {
+	path string
+}
+
+func (p dirProvider) Load(ctx context.Context) (map[string]interface{}, error) {
+	dir, err := expandPath(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInitFailed, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) && !requireConfigFile {
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("%w: failed to read config directory %s: %w", ErrInitFailed, dir, err)
+	}
+
+	// ReadDir sorts the entries by name.
+	data := make(map[string]interface{})
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !isConfigExt(filepath.Ext(name)) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, name)
+		m := newManager()
+		if err := m.loadFile(ctx, path, ""); err != nil {
+			return nil, err
+		}
+		layer, err := prepareLayer(m.data, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInitFailed, path, err)
+		}
+		data = overlayMaps(data, layer)
+	}
+	return data, nil
+}
@@ -0,0 +1,120 @@
+package mflag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DocFormat is the output format of GenerateDocs.
+type DocFormat int
+
+const (
+	// Markdown renders the keys as a Markdown table.
+	Markdown DocFormat = iota + 1
+	// Man renders the keys as a CONFIGURATION section of a manual page in
+	// roff, to be included in the page of the application.
+	Man
+)
+
+// GenerateDocs writes documentation of the keys returned by Keys to w in
+// format: their flags, types, defaults, descriptions and whether they are
+// required, so that user documentation is generated from the declarations
+// the application makes anyway.
+func GenerateDocs(w io.Writer, format DocFormat) error {
+	var b strings.Builder
+	switch format {
+	case Markdown:
+		writeMarkdownDocs(&b, Keys())
+	case Man:
+		writeManDocs(&b, Keys())
+	default:
+		return fmt.Errorf("unknown documentation format %d", format)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMarkdownDocs writes keys as a Markdown table.
+func writeMarkdownDocs(b *strings.Builder, keys []KeyInfo) {
+	b.WriteString("| Key | Flag | Type | Default | Description |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, k := range keys {
+		description := k.Description
+		if len(k.Allowed) > 0 {
+			description = strings.TrimSpace(description + " One of: " + strings.Join(k.Allowed, ", ") + ".")
+		}
+		if k.Env != "" {
+			description = strings.TrimSpace(description + " Environment variable: `" + k.Env + "`.")
+		}
+		if k.Required {
+			description = strings.TrimSpace("**Required.** " + description)
+		}
+		def := docDefault(k)
+		if def != "" {
+			def = "`" + def + "`"
+		}
+		fmt.Fprintf(b, "| `%s` | `--%s` | %s | %s | %s |\n",
+			k.Key, k.Flag, k.Type, markdownCell(def), markdownCell(description))
+	}
+}
+
+// markdownCell escapes s for a cell of a Markdown table.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// writeManDocs writes keys as a roff section of a manual page.
+func writeManDocs(b *strings.Builder, keys []KeyInfo) {
+	b.WriteString(".SH CONFIGURATION\n")
+	b.WriteString("Every key can be set in the configuration file or with its flag.\n")
+	for _, k := range keys {
+		fmt.Fprintf(b, ".TP\n.B %s \\fI%s\\fR\n", roff("--"+k.Flag), roff(k.Type))
+		var lines []string
+		if k.Description != "" {
+			lines = append(lines, roff(k.Description))
+		}
+		lines = append(lines, "Configuration key: "+roff(k.Key)+".")
+		if len(k.Allowed) > 0 {
+			lines = append(lines, "One of: "+roff(strings.Join(k.Allowed, ", "))+".")
+		}
+		if k.Env != "" {
+			lines = append(lines, "Environment variable: "+roff(k.Env)+".")
+		}
+		if def := docDefault(k); def != "" {
+			lines = append(lines, "Default: "+roff(def)+".")
+		}
+		if k.Required {
+			lines = append(lines, "Required.")
+		}
+		b.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+}
+
+// roff escapes s for a line of roff text.
+func roff(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	s = strings.ReplaceAll(s, "\n", " ")
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// docDefault formats the default of k, or returns "" if it has none.
+func docDefault(k KeyInfo) string {
+	if k.Default == nil {
+		return ""
+	}
+	if k.Secret {
+		return secretMask
+	}
+	b, err := json.Marshal(k.Default)
+	if err != nil {
+		return fmt.Sprintf("%v", k.Default)
+	}
+	return string(b)
+}
@@ -0,0 +1,47 @@
+package mflag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDocs(t *testing.T) {
+	testReset(t)
+	SetDefault("server.port", 8080)
+	Describe("server.port", "Port to listen on | TCP.")
+	SetDefaultEnum("level", "info", "debug", "info")
+	DeclareKey("token", String)
+	MarkRequired("token")
+
+	var buf bytes.Buffer
+	if err := GenerateDocs(&buf, Markdown); err != nil {
+		t.Fatalf("GenerateDocs() failed: %v", err)
+	}
+	want := "| Key | Flag | Type | Default | Description |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| `level` | `--level` | string | `\"info\"` | One of: debug, info. |\n" +
+		"| `server.port` | `--server-port` | int | `8080` | Port to listen on \\| TCP. |\n" +
+		"| `token` | `--token` | string |  | **Required.** |\n"
+	if got := buf.String(); got != want {
+		t.Errorf("GenerateDocs(Markdown) =\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := GenerateDocs(&buf, Man); err != nil {
+		t.Fatalf("GenerateDocs() failed: %v", err)
+	}
+	for _, s := range []string{
+		".SH CONFIGURATION\n",
+		".TP\n.B \\-\\-server\\-port \\fIint\\fR\nPort to listen on | TCP.\nConfiguration key: server.port.\nDefault: 8080.\n",
+		".B \\-\\-token \\fIstring\\fR\nConfiguration key: token.\nRequired.\n",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected man page to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+
+	if err := GenerateDocs(&buf, DocFormat(0)); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,36 @@
+package mflag
+
+import (
+	"context"
+	"fmt"
+)
+
+// appliedFile holds the values of the configuration source that were last
+// applied, by Init, by a complete Reload or by Promote. It is guarded by
+// reloadMu.
+var appliedFile = newManager()
+
+// Drifted loads the configuration source given to Init or InitContext again
+// and reports how it differs from the values last applied, without applying
+// anything, so that a health check can flag a file changed on disk but not
+// reloaded. Keys are compared as found in the source, before file
+// references and encrypted values are resolved. The files loaded are not
+// recorded for ConfigFilesUsed.
+// Must be called after Parse.
+func Drifted(ctx context.Context) (bool, []Change, error) {
+	mustBeParsed()
+	if source == nil {
+		return false, nil, fmt.Errorf("%w: nothing to compare, Init was not called", ErrInitFailed)
+	}
+	reloadMu.Lock()
+	applied := appliedFile
+	reloadMu.Unlock()
+	data, err := load(context.WithValue(ctx, unrecorded{}, true), source)
+	if err != nil {
+		return false, nil, err
+	}
+	current := newManager()
+	current.data = convertMap(data)
+	changes := diff(applied, current)
+	return len(changes) > 0, changes, nil
+}
@@ -0,0 +1,60 @@
+package mflag
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDrifted(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, "port: 8080\nname: app\npassword: old\n")
+	MarkSecret("password")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+	used := ConfigFilesUsed()
+
+	drifted, changes, err := Drifted(context.Background())
+	if err != nil || drifted || len(changes) != 0 {
+		t.Fatalf("Expected no drift, got %v, %v, %v", drifted, changes, err)
+	}
+
+	if err := os.WriteFile(configPath, []byte("port: 9090\npassword: new\nlevel: debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	drifted, changes, err = Drifted(context.Background())
+	if err != nil || !drifted {
+		t.Fatalf("Expected drift, got %v, %v", drifted, err)
+	}
+	want := []Change{
+		{Key: "level", New: "debug"},
+		{Key: "name", Old: "app"},
+		{Key: "password", Old: maskSet("old"), New: maskSet("new")},
+		{Key: "port", Old: 8080, New: 9090},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+	if GetInt("port") != 8080 {
+		t.Error("Expected Drifted not to apply the changes")
+	}
+	if got := ConfigFilesUsed(); !reflect.DeepEqual(got, used) {
+		t.Errorf("Expected Drifted not to record the file, got %+v, want %+v", got, used)
+	}
+
+	// A partial Reload applies the file once promoted.
+	SetReloadPolicy(ReloadPolicy{Percent: 50})
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if drifted, _, _ := Drifted(context.Background()); !drifted {
+		t.Error("Expected drift before Promote")
+	}
+	Promote()
+	if drifted, changes, _ := Drifted(context.Background()); drifted {
+		t.Errorf("Expected no drift after Promote, got %+v", changes)
+	}
+}
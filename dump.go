@@ -0,0 +1,95 @@
+package mflag
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// dumpConfigFlagName is the name of the built-in flag printing the config.
+const dumpConfigFlagName = "dump-config"
+
+// dumpConfigEnabled reports whether EnableDumpConfig was called.
+var dumpConfigEnabled = false
+
+// EnableDumpConfig registers a built-in --dump-config flag which prints the
+// fully merged configuration, along with the source of every value, and
+// exits. Values of keys marked with MarkSecret are masked.
+// It should be called before Parse.
+func EnableDumpConfig() {
+	dumpConfigEnabled = true
+}
+
+// registerDumpConfigFlag adds the --dump-config flag to fs if enabled.
+func registerDumpConfigFlag(fs *flag.FlagSet) *bool {
+	if !dumpConfigEnabled || fs.Lookup(dumpConfigFlagName) != nil {
+		return nil
+	}
+	builtinFlags[dumpConfigFlagName] = true
+	return fs.Bool(dumpConfigFlagName, false, "print the effective configuration and exit")
+}
+
+// printConfig writes every key of the merged configuration to w, one per
+// line, as "key: value # source".
+func printConfig(w io.Writer) {
+	for _, key := range finalConfig.AllKeys() {
+		fmt.Fprintf(w, "%s: %s # %s\n", key, displayValue(key, finalConfig.Get(key)), sourceOf(key))
+	}
+}
+
+// sourceOf returns where the value of key comes from: "set", "flag",
+// "file", "remote" or "default".
+func sourceOf(key string) string {
+	return sourceIn(config, key)
+}
+
+// sourceIn is like sourceOf, with file as the configuration source layer.
+// Layers added with AddLayer are reported by name.
+func sourceIn(file *mapManager, key string) string {
+	if assigned.Has(key) {
+		return "set"
+	}
+	for _, name := range slices.Backward(layerOrder) {
+		layer := layerManager(name)
+		if name == fileLayer {
+			layer = file
+		}
+		if !layer.Has(key) {
+			continue
+		}
+		switch name {
+		case flagsLayer:
+			return "flag"
+		case fileLayer:
+			switch source.(type) {
+			case fileProvider, dirProvider, archiveProvider, nil:
+				return "file"
+			}
+			return "remote"
+		case envLayer:
+			return "env"
+		case defaultsLayer:
+			return "default"
+		}
+		return name
+	}
+	return "unknown"
+}
+
+// displayValue formats the value of key for printing, masking secrets.
+func displayValue(key string, value interface{}) string {
+	if isSecret(key) {
+		return secretMask
+	}
+	if d, ok := value.(time.Duration); ok {
+		return d.String()
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
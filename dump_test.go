@@ -0,0 +1,43 @@
+package mflag
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDumpConfigFlag(t *testing.T) {
+	testReset(t)
+
+	var buf bytes.Buffer
+	stdout = &buf
+	EnableDumpConfig()
+	MarkSecret("db.password")
+	SetDefault("port", 8080)
+	SetDefault("db.password", "hunter2")
+	SetDefault("db.timeout", "5s")
+	configPath := createTempYAML(t, `db: {host: config.host}`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--port=9090", "--dump-config"}
+
+	if err := ParseWithError(); !errors.Is(err, ErrExitRequested) {
+		t.Fatalf("Expected ErrExitRequested, got: %v", err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		`db.host: "config.host" # file`,
+		`db.password: ****** # default`,
+		`port: 9090 # flag`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected dump to contain %q, got:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("Expected secret to be masked, got:\n%s", out)
+	}
+}
@@ -0,0 +1,124 @@
+package mflag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeclareDuration declares key as a duration whose bare numbers are counted
+// in unit, so that "timeout: 30" means 30 seconds after
+// DeclareDuration("timeout", time.Second) instead of 30 nanoseconds. Values
+// with a unit, such as "1m30s", are parsed as usual. The unit applies to the
+// config file, the environment, --set and the key's flag alike.
+// It should be called before Parse.
+func DeclareDuration(key string, unit time.Duration) {
+	s := specFor(key)
+	s.typ = Duration
+	s.unit = unit
+}
+
+// Unit declares the key as a duration whose bare numbers are counted in
+// unit, see DeclareDuration.
+func Unit(unit time.Duration) KeyOption {
+	return func(_ string, s *keySpec) {
+		s.typ = Duration
+		s.unit = unit
+	}
+}
+
+// durationUnit returns the unit declared for key, or 0 if there is none.
+func durationUnit(key string) time.Duration {
+	if s, ok := specs[key]; ok {
+		return s.unit
+	}
+	return 0
+}
+
+// scaleDuration returns the duration v stands for if it is a bare number
+// counted in unit.
+func scaleDuration(v interface{}, unit time.Duration) (time.Duration, bool) {
+	var n float64
+	switch val := v.(type) {
+	case int:
+		n = float64(val)
+	case int64:
+		n = float64(val)
+	case uint64:
+		n = float64(val)
+	case float64:
+		n = val
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return 0, false
+		}
+		n = f
+	default:
+		return 0, false
+	}
+	return time.Duration(n * float64(unit)), true
+}
+
+// applyDurationUnits replaces the bare numbers of the keys declared with
+// DeclareDuration in m with the durations they stand for.
+func applyDurationUnits(m *mapManager) {
+	for key, s := range specs {
+		if s.unit == 0 {
+			continue
+		}
+		if d, ok := scaleDuration(m.Get(key), s.unit); ok {
+			m.SetValue(key, d)
+		}
+	}
+}
+
+// parseKey parses raw as a value of key, as parseAs does for the type of
+// the key, counting bare numbers in the unit of duration keys and parsing
+// the items of lists of numbers or booleans as such.
+func parseKey(key, raw string) (interface{}, error) {
+	if unit := durationUnit(key); unit != 0 {
+		if d, ok := scaleDuration(raw, unit); ok {
+			return d, nil
+		}
+	}
+	if items, ok := defaults.Get(key).([]interface{}); ok && len(items) > 0 && typeOf(items[0]) != String {
+		return parseList(raw, typeOf(items[0]))
+	}
+	return parseAs(raw, keyType(key))
+}
+
+// durationValue is the flag.Value of a duration key declared with a unit.
+// It accepts bare numbers, counted in the unit, as well as durations.
+type durationValue struct {
+	d    time.Duration
+	unit time.Duration
+}
+
+// String returns the duration.
+func (v *durationValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.d.String()
+}
+
+// Set parses s as a bare number counted in the unit, or as a duration.
+func (v *durationValue) Set(s string) error {
+	if d, ok := scaleDuration(s, v.unit); ok {
+		v.d = d
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	v.d = d
+	return nil
+}
+
+// Get returns the duration.
+func (v *durationValue) Get() interface{} {
+	return v.d
+}
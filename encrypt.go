@@ -0,0 +1,184 @@
+package mflag
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// decryptionKeyEnv holds the base64-encoded decryption key.
+	decryptionKeyEnv = "MFLAG_DECRYPTION_KEY"
+	// decryptionKeyFileEnv holds the path of a file containing the
+	// base64-encoded decryption key.
+	decryptionKeyFileEnv = "MFLAG_DECRYPTION_KEY_FILE"
+)
+
+// decryptionKey is the key set with SetDecryptionKey.
+var decryptionKey []byte
+
+// SetDecryptionKey sets the AES-256 key (32 bytes) used to decrypt values of
+// the form ENC[AES256_GCM,data:...,iv:...,tag:...,type:...]. Without it, the
+// key is read base64-encoded from the MFLAG_DECRYPTION_KEY environment
+// variable or from the file named by MFLAG_DECRYPTION_KEY_FILE.
+//
+// Encrypted values let secrets live in git next to the rest of the
+// configuration. They are decrypted by Parse, and their keys are treated as
+// secrets (see MarkSecret). Use EncryptValue to produce them.
+// Files encrypted as a whole with sops are not supported; decrypt them with
+// sops before loading them.
+func SetDecryptionKey(key []byte) {
+	decryptionKey = key
+}
+
+// EncryptValue encrypts value for key with the decryption key, returning an
+// ENC[...] string to put in a config file. Ciphertexts are bound to their
+// key, so they cannot be moved to another key. Strings, bools, integers and
+// floats keep their type when decrypted.
+func EncryptValue(key string, value interface{}) (string, error) {
+	aead, err := newAEAD()
+	if err != nil {
+		return "", err
+	}
+	var typ, plaintext string
+	switch v := value.(type) {
+	case string:
+		typ, plaintext = "str", v
+	case bool:
+		typ, plaintext = "bool", strconv.FormatBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		typ, plaintext = "int", fmt.Sprintf("%d", v)
+	case float64:
+		typ, plaintext = "float", strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return "", fmt.Errorf("cannot encrypt value of type %T", value)
+	}
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nil, iv, []byte(plaintext), []byte(key))
+	data, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", enc(data), enc(iv), enc(tag), typ), nil
+}
+
+// isEncrypted reports whether s is an ENC[...] value.
+func isEncrypted(s string) bool {
+	return strings.HasPrefix(s, "ENC[") && strings.HasSuffix(s, "]")
+}
+
+// decryptValues decrypts every ENC[...] value of the merged configuration m
+// and marks its key as secret in m.
+func decryptValues(m *mapManager) error {
+	var aead cipher.AEAD
+	var errs []error
+	for _, key := range m.AllKeys() {
+		s, ok := m.Get(key).(string)
+		if !ok || !isEncrypted(s) {
+			continue
+		}
+		if aead == nil {
+			var err error
+			if aead, err = newAEAD(); err != nil {
+				return err
+			}
+		}
+		value, err := decryptValue(aead, key, s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %q: %w", ErrDecryptionFailed, key, err))
+			continue
+		}
+		m.SetValue(key, value)
+		m.markSecret(key)
+	}
+	return errors.Join(errs...)
+}
+
+// decryptValue decrypts a single ENC[...] value of key.
+func decryptValue(aead cipher.AEAD, key, s string) (interface{}, error) {
+	fields := make(map[string]string)
+	parts := strings.Split(s[len("ENC["):len(s)-1], ",")
+	if parts[0] != "AES256_GCM" {
+		return nil, fmt.Errorf("unsupported cipher %q", parts[0])
+	}
+	for _, part := range parts[1:] {
+		name, value, _ := strings.Cut(part, ":")
+		fields[name] = value
+	}
+	var raw [3][]byte
+	for i, name := range []string{"data", "iv", "tag"} {
+		b, err := base64.StdEncoding.DecodeString(fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		raw[i] = b
+	}
+	data, iv, tag := raw[0], raw[1], raw[2]
+	if len(iv) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid iv length %d", len(iv))
+	}
+	plaintext, err := aead.Open(nil, iv, append(data, tag...), []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	switch fields["type"] {
+	case "", "str":
+		return string(plaintext), nil
+	case "bool":
+		return strconv.ParseBool(string(plaintext))
+	case "int":
+		return strconv.Atoi(string(plaintext))
+	case "float":
+		return strconv.ParseFloat(string(plaintext), 64)
+	}
+	return nil, fmt.Errorf("unsupported type %q", fields["type"])
+}
+
+// newAEAD returns the AES-GCM cipher for the configured decryption key.
+func newAEAD() (cipher.AEAD, error) {
+	key, err := loadDecryptionKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: decryption key must be 32 bytes, got %d", ErrDecryptionFailed, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// loadDecryptionKey returns the key set with SetDecryptionKey or, lacking
+// one, the key from the environment.
+func loadDecryptionKey() ([]byte, error) {
+	if decryptionKey != nil {
+		return decryptionKey, nil
+	}
+	encoded := os.Getenv(decryptionKeyEnv)
+	if path := os.Getenv(decryptionKeyFileEnv); encoded == "" && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read decryption key file: %w", err)
+		}
+		encoded = strings.TrimSpace(string(content))
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("no decryption key: use SetDecryptionKey or set %s", decryptionKeyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 decryption key: %w", err)
+	}
+	return key, nil
+}
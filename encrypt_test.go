@@ -0,0 +1,119 @@
+package mflag
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedValues(t *testing.T) {
+	testReset(t)
+	key := bytes.Repeat([]byte{7}, 32)
+	SetDecryptionKey(key)
+
+	password, err := EncryptValue("db.password", "s3cret")
+	if err != nil {
+		t.Fatalf("EncryptValue() failed: %v", err)
+	}
+	port, err := EncryptValue("db.port", 5432)
+	if err != nil {
+		t.Fatalf("EncryptValue() failed: %v", err)
+	}
+	configPath := createTempYAML(t, fmt.Sprintf("db:\n  password: %s\n  port: %s\n", password, port))
+
+	// Load the key from a file this time, as a deployment would.
+	Reset()
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(decryptionKeyFileEnv, keyFile)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got := GetString("db.password"); got != "s3cret" {
+		t.Errorf("Expected decrypted password, got %q", got)
+	}
+	if got := GetInt("db.port"); got != 5432 {
+		t.Errorf("Expected decrypted port 5432, got %d", got)
+	}
+	var out bytes.Buffer
+	printConfig(&out)
+	if strings.Contains(out.String(), "s3cret") {
+		t.Errorf("Expected decrypted values to be masked, got:\n%s", out.String())
+	}
+}
+
+func TestEncryptedValues_Errors(t *testing.T) {
+	testReset(t)
+	SetDecryptionKey(bytes.Repeat([]byte{1}, 32))
+	value, err := EncryptValue("api.token", "abc")
+	if err != nil {
+		t.Fatalf("EncryptValue() failed: %v", err)
+	}
+
+	// A ciphertext moved to another key must not decrypt.
+	configPath := createTempYAML(t, "other:\n  token: "+value+"\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("Expected ErrDecryptionFailed for a moved value, got %v", err)
+	}
+
+	testReset(t)
+	t.Setenv(decryptionKeyEnv, "")
+	t.Setenv(decryptionKeyFileEnv, "")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("Expected ErrDecryptionFailed without a key, got %v", err)
+	}
+
+	testReset(t)
+	sopsPath := createTempYAML(t, "a: ENC[AES256_GCM,data:x,iv:y,tag:z,type:str]\nsops:\n  version: 3.8.1\n")
+	if err := Init(sopsPath); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected sops files to be rejected, got %v", err)
+	}
+}
+
+func TestEncryptedValues_Reload(t *testing.T) {
+	testReset(t)
+	SetDecryptionKey(bytes.Repeat([]byte{7}, 32))
+	var events []AuditEvent
+	SetAuditSink(func(e AuditEvent) { events = append(events, e) })
+	configPath := createTempYAML(t, "token: plain\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	token, err := EncryptValue("token", "s3cret")
+	if err != nil {
+		t.Fatalf("EncryptValue() failed: %v", err)
+	}
+	if err := os.WriteFile(configPath, []byte("token: "+token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	events = nil
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if len(events) != 1 || events[0].New != secretMask {
+		t.Errorf("Expected the decrypted value to be masked, got %v", events)
+	}
+	if isSecret("token") {
+		t.Error("Expected Reload to leave the configuration of the getters untouched")
+	}
+}
@@ -0,0 +1,59 @@
+package mflag
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// SetDefaultEnum sets a default value for a key that may only take one of the
+// allowed values. Values outside the allowed set are rejected by Parse, and
+// the allowed values are listed in the usage text of the key's flag.
+// It should be called before Init and Parse.
+func SetDefaultEnum(key string, value string, allowed ...string) {
+	SetDefault(key, value)
+	specFor(key).allowed = allowed
+}
+
+// GetEnum returns the value associated with the key as a string, checking it
+// against the allowed values. If no allowed values are given, the ones
+// declared with SetDefaultEnum are used.
+// Must be called after Parse.
+func GetEnum(key string, allowed ...string) (string, error) {
+	mustBeParsed()
+	if len(allowed) == 0 {
+		if s, ok := specs[key]; ok {
+			allowed = s.allowed
+		}
+	}
+	value := finalConfig.GetString(key)
+	if err := checkEnum(key, value, allowed); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// checkEnum returns an error if value is not one of allowed.
+// An empty allowed list accepts any value.
+func checkEnum(key, value string, allowed []string) error {
+	if len(allowed) == 0 || slices.Contains(allowed, value) {
+		return nil
+	}
+	return fmt.Errorf("%w %q for %q: must be one of %s", ErrInvalidValue, value, key, strings.Join(allowed, ", "))
+}
+
+// validateEnums checks every enum key of m.
+func validateEnums(m *mapManager) []error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(specs)) {
+		s := specs[key]
+		if len(s.allowed) == 0 || !m.IsSet(key) {
+			continue
+		}
+		if err := checkEnum(key, m.GetString(key), s.allowed); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
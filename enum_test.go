@@ -0,0 +1,52 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnum(t *testing.T) {
+	testReset(t)
+
+	SetDefaultEnum("log.format", "json", "json", "text")
+	os.Args = []string{"test", "--log-format=text"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if v, err := GetEnum("log.format"); err != nil || v != "text" {
+		t.Errorf("Expected GetEnum to return 'text', got %q (err: %v)", v, err)
+	}
+	if _, err := GetEnum("log.format", "json", "logfmt"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue for explicit allowed values, got: %v", err)
+	}
+}
+
+func TestEnum_InvalidValueRejectedAtParse(t *testing.T) {
+	testReset(t)
+
+	SetDefaultEnum("log.format", "json", "json", "text")
+	configPath := createTempYAML(t, `log: {format: xml}`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	err := ParseWithError()
+	if !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("Expected ParseWithError to fail with ErrInvalidValue, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "json, text") {
+		t.Errorf("Expected error to list the allowed values, got: %v", err)
+	}
+}
+
+func TestEnum_Usage(t *testing.T) {
+	testReset(t)
+
+	SetDefaultEnum("log.format", "json", "json", "text")
+	if usage := usageFor("log.format"); !strings.Contains(usage, "(one of: json, text)") {
+		t.Errorf("Expected usage to list the allowed values, got: %q", usage)
+	}
+}
@@ -0,0 +1,300 @@
+package mflag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// envConfig holds the values read from the environment, forming the
+	// "env" layer.
+	envConfig = newManager()
+	// envAuto reports whether keys are bound to environment variables
+	// automatically, by SetEnvPrefix or SetEnvNameMapper.
+	envAuto bool
+	// envPrefix is the prefix set with SetEnvPrefix.
+	envPrefix string
+	// envNameMapper is the function set with SetEnvNameMapper.
+	envNameMapper = defaultEnvName
+)
+
+// envFoldCase reports whether environment variable names are case
+// insensitive, as on Windows, where PATH and Path are the same variable.
+// os.LookupEnv already ignores case there; only prefixes matched against
+// the names of os.Environ need folding.
+var envFoldCase = runtime.GOOS == "windows"
+
+// envReplacer replaces the separators of keys by underscores.
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// defaultEnvName is the default environment variable name mapper: the key
+// in upper case with its separators replaced by underscores, after the
+// prefix set with SetEnvPrefix.
+func defaultEnvName(key string) string {
+	return envName(envPrefix, key)
+}
+
+// envName returns the environment variable named after key and prefix.
+func envName(prefix, key string) string {
+	name := strings.ToUpper(envReplacer.Replace(key))
+	if prefix != "" {
+		name = prefix + "_" + name
+	}
+	return name
+}
+
+// SetEnvPrefix reads every key with a default or a declared type from an
+// environment variable named after the key and prefix: with
+// SetEnvPrefix("APP"), "database.max-conns" is read from
+// APP_DATABASE_MAX_CONNS. Keys bound with Env or BindEnv are read from their
+// own variables instead. An empty prefix binds keys to variables without a
+// prefix.
+// It should be called before Parse.
+func SetEnvPrefix(prefix string) {
+	envAuto = true
+	envPrefix = prefix
+}
+
+// SetEnvNameMapper sets the function naming the environment variable every
+// key with a default or a declared type is read from, binding keys
+// automatically as SetEnvPrefix does. Keys for which mapper returns an
+// empty string are not bound. Keys bound with Env or BindEnv keep their own
+// variables. A nil mapper restores the default naming of SetEnvPrefix.
+// It should be called before Parse.
+func SetEnvNameMapper(mapper func(key string) string) {
+	if mapper == nil {
+		mapper = defaultEnvName
+	}
+	envAuto = true
+	envNameMapper = mapper
+}
+
+// BindEnv reads key from the first of the environment variables names that
+// is set, overriding the automatic name, so that keys can follow the names
+// operators already export:
+//
+//	mflag.BindEnv("database.host", "PGHOST")
+//	mflag.BindEnv("database.password", "PGPASSWORD", "POSTGRES_PASSWORD")
+//
+// BindEnv without names restores the automatic name. It is the same as
+// registering the key with the Env option.
+// It should be called before Parse.
+func BindEnv(key string, names ...string) {
+	specFor(key).env = names
+}
+
+// envNames returns the environment variables key is read from, in order of
+// preference.
+func envNames(key string) []string {
+	if s, ok := specs[key]; ok && len(s.env) > 0 {
+		return s.env
+	}
+	if !envAuto {
+		return nil
+	}
+	if name := envNameMapper(key); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// envKeys returns the keys that may be read from the environment, sorted.
+func envKeys() []string {
+	var keys []string
+	for key, s := range specs {
+		if len(s.env) > 0 || envAuto && (s.typ != 0 || s.registered) {
+			keys = append(keys, key)
+		}
+	}
+	if envAuto {
+		keys = append(keys, defaults.AllKeys()...)
+		keys = append(keys, slices.Collect(maps.Keys(defaultFuncs))...)
+		collectMapKeys("", defaults.data, &keys)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// collectMapKeys adds the keys of the maps nested in data to keys.
+func collectMapKeys(prefix string, data map[string]interface{}, keys *[]string) {
+	for key, value := range data {
+		if nested, ok := value.(map[string]interface{}); ok {
+			*keys = append(*keys, joinKey(prefix, key))
+			collectMapKeys(joinKey(prefix, key), nested, keys)
+		}
+	}
+}
+
+// loadEnv reads the environment variables keys are bound to into
+// envConfig. Names are matched case insensitively on Windows. Lists are
+// given as JSON or split on the slice separator, and maps as JSON. The
+// entries of maps may also be given one by one, as variables named after
+// the map followed by "__" and the entry, with "__" separating nested
+// entries: APP_LABELS__TEAM sets "labels.team" when "labels" is bound to
+// APP_LABELS. Variables with invalid values are skipped and reported.
+func loadEnv() error {
+	envConfig = newManager()
+	keys := envKeys()
+	var errs []error
+	for _, key := range keys {
+		for _, name := range envNames(key) {
+			raw, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := setEnvValue(key, name, raw); err != nil {
+				errs = append(errs, err)
+			}
+			break
+		}
+	}
+
+	environ := os.Environ()
+	slices.Sort(environ)
+	for _, key := range keys {
+		if keyType(key) != StringMap {
+			continue
+		}
+		for _, name := range envNames(key) {
+			for _, v := range environ {
+				variable, raw, _ := strings.Cut(v, "=")
+				entry, ok := cutEnvPrefix(variable, name+"__")
+				if !ok || entry == "" {
+					continue
+				}
+				entryKey := key + "." + strings.ToLower(strings.ReplaceAll(entry, "__", "."))
+				if err := setEnvValue(entryKey, variable, raw); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ExportEnv returns the merged configuration as environment variables, as
+// "NAME=value" pairs sorted by key, so that a process can pass its
+// effective configuration to the processes it spawns. Variables are named
+// as with SetEnvPrefix(prefix): "database.host" becomes
+// MYAPP_DATABASE_HOST with the prefix "MYAPP". Lists are written as JSON,
+// and entries of maps, such as "labels.team" of a map "labels" with a
+// default or declared as StringMap, one by one as MYAPP_LABELS__TEAM, so a
+// child calling SetEnvPrefix with the same prefix, and declaring the same
+// keys, reads the values back unchanged. Secret values are included.
+// Must be called after Parse.
+func ExportEnv(prefix string) []string {
+	mustBeParsed()
+	var env []string
+	for _, key := range finalConfig.AllKeys() {
+		value := finalConfig.Get(key)
+		if value == nil {
+			continue
+		}
+		name := envName(prefix, key)
+		if mapKey, entry, ok := envMapEntry(key); ok {
+			name = envName(prefix, mapKey) + "__" + strings.ToUpper(strings.ReplaceAll(entry, ".", "__"))
+		}
+		env = append(env, name+"="+envString(value))
+	}
+	return env
+}
+
+// envMapEntry returns the map key is an entry of, and the entry, if key is
+// not declared itself, so that loadEnv reads it as an entry of the nearest
+// parent with a default map or declared as StringMap.
+func envMapEntry(key string) (mapKey, entry string, ok bool) {
+	if isEnvDeclared(key) {
+		return "", "", false
+	}
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key[:i], ".") {
+		if parent := key[:i]; isEnvDeclared(parent) && keyType(parent) == StringMap {
+			return parent, key[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// isEnvDeclared reports whether key has a default or a declared type, as
+// the keys SetEnvPrefix reads from the environment.
+func isEnvDeclared(key string) bool {
+	if s, ok := specs[key]; ok && (s.typ != 0 || s.registered) {
+		return true
+	}
+	_, hasFunc := defaultFuncs[key]
+	return hasFunc || defaults.Get(key) != nil
+}
+
+// ExportEnvTo adds the variables returned by ExportEnv(prefix) to the
+// environment of cmd, which inherits the environment of the current
+// process if cmd.Env is nil, as exec.Cmd does.
+// Must be called after Parse.
+func ExportEnvTo(cmd *exec.Cmd, prefix string) {
+	env := ExportEnv(prefix)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+}
+
+// envString formats value as loadEnv reads it.
+func envString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Duration:
+		return v.String()
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Slice {
+		if b, err := json.Marshal(value); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// cutEnvPrefix returns name without prefix, ignoring case where names are
+// case insensitive, and reports whether name starts with prefix.
+func cutEnvPrefix(name, prefix string) (string, bool) {
+	if len(name) < len(prefix) {
+		return "", false
+	}
+	head, rest := name[:len(prefix)], name[len(prefix):]
+	if head == prefix || envFoldCase && strings.EqualFold(head, prefix) {
+		return rest, true
+	}
+	return "", false
+}
+
+// envValue normalizes raw, the value of an environment variable. On Plan 9,
+// lists such as $path are stored with their items separated by NUL bytes,
+// which become the slice separator.
+func envValue(raw string) string {
+	if runtime.GOOS != "plan9" || !strings.Contains(raw, "\x00") {
+		return raw
+	}
+	sep := sliceSeparator
+	if sep == "" {
+		sep = ","
+	}
+	return strings.ReplaceAll(strings.TrimSuffix(raw, "\x00"), "\x00", sep)
+}
+
+// setEnvValue sets key to raw, read from the environment variable name.
+func setEnvValue(key, name, raw string) error {
+	raw = envValue(raw)
+	value, err := parseKey(key, raw)
+	if err != nil {
+		return fmt.Errorf("%w %q for %q from $%s: %w", ErrInvalidValue, raw, key, name, err)
+	}
+	envConfig.SetValue(key, value)
+	return nil
+}
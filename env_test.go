@@ -0,0 +1,207 @@
+package mflag
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetEnvPrefix(t *testing.T) {
+	testReset(t)
+	SetEnvPrefix("TEST_MFLAG")
+	SetDefault("database.host", "localhost")
+	SetDefault("database.max-conns", 10)
+	SetDefault("database.user", "app")
+	BindEnv("database.password", "TEST_PGPASSWORD", "TEST_POSTGRES_PASSWORD")
+	DeclareKey("token", String)
+	t.Setenv("TEST_MFLAG_DATABASE_MAX_CONNS", "20")
+	t.Setenv("TEST_MFLAG_TOKEN", "abc")
+	t.Setenv("TEST_POSTGRES_PASSWORD", "hunter2")
+	BindEnv("database.host", "TEST_PGHOST")
+	t.Setenv("TEST_PGHOST", "db.internal")
+	t.Setenv("TEST_MFLAG_DATABASE_HOST", "ignored")
+
+	os.Args = []string{"test", "--database-user=admin"}
+	Parse()
+
+	tests := map[string]interface{}{
+		"database.host":      "db.internal",
+		"database.max-conns": 20,
+		"database.user":      "admin",
+		"database.password":  "hunter2",
+		"token":              "abc",
+	}
+	for key, want := range tests {
+		if got := finalConfig.Get(key); got != want {
+			t.Errorf("%q = %v, want %v", key, got, want)
+		}
+	}
+	if got := sourceOf("database.max-conns"); got != "env" {
+		t.Errorf("Expected source env, got %q", got)
+	}
+	for _, k := range Keys() {
+		if k.Key == "database.user" && k.Env != "TEST_MFLAG_DATABASE_USER" {
+			t.Errorf("Expected the automatic name in the key info, got %q", k.Env)
+		}
+	}
+}
+
+func TestSetEnvNameMapper(t *testing.T) {
+	testReset(t)
+	SetDefault("server.port", 80)
+	SetDefault("internal.debug", false)
+	SetEnvNameMapper(func(key string) string {
+		if key == "internal" || strings.HasPrefix(key, "internal.") {
+			return ""
+		}
+		return "TEST_" + strings.ToUpper(strings.ReplaceAll(key, ".", "__"))
+	})
+	t.Setenv("TEST_SERVER__PORT", "8080")
+	t.Setenv("TEST_INTERNAL__DEBUG", "true")
+
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetInt("server.port"); got != 8080 {
+		t.Errorf("Expected the mapped variable, got %d", got)
+	}
+	if GetBool("internal.debug") {
+		t.Error("Expected a key mapped to no name not to be read")
+	}
+}
+
+func TestLoadEnv_ListsAndMaps(t *testing.T) {
+	testReset(t)
+	SetEnvPrefix("TEST_MFLAG")
+	SetDefault("hosts", []string{"a"})
+	SetDefault("ports", []interface{}{80})
+	SetDefault("labels", map[string]interface{}{})
+	SetDefault("limits", map[string]interface{}{"cpu": 1, "memory": "1Gi"})
+	DeclareKey("annotations", StringMap)
+	t.Setenv("TEST_MFLAG_HOSTS", "b, c")
+	t.Setenv("TEST_MFLAG_PORTS", "8080,8443")
+	t.Setenv("TEST_MFLAG_LABELS", `{"team": "core", "tier": "web"}`)
+	t.Setenv("TEST_MFLAG_LABELS__TIER", "api")
+	t.Setenv("TEST_MFLAG_LABELS__ROUTE__ZONE", "eu")
+	t.Setenv("TEST_MFLAG_LIMITS__CPU", "4")
+	t.Setenv("TEST_MFLAG_ANNOTATIONS", "owner=ops,slack=#ops")
+
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := GetStringSlice("hosts"); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("Expected the split list, got %q", got)
+	}
+	if got := finalConfig.Get("ports"); !reflect.DeepEqual(got, []interface{}{8080, 8443}) {
+		t.Errorf("Expected a list of integers, got %#v", got)
+	}
+	want := map[string]string{"team": "core", "tier": "api", "route.zone": "eu"}
+	if got := GetStringMapString("labels"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the JSON map with its entries overridden, got %v", got)
+	}
+	if got := GetInt("limits.cpu"); got != 4 {
+		t.Errorf("Expected limits.cpu 4, got %d", got)
+	}
+	if got := GetString("limits.memory"); got != "1Gi" {
+		t.Errorf("Expected limits.memory to keep its default, got %q", got)
+	}
+	if got := GetStringMapString("annotations"); got["owner"] != "ops" || got["slack"] != "#ops" {
+		t.Errorf("Expected the key=value pairs, got %v", got)
+	}
+}
+
+func TestLoadEnv_FoldCase(t *testing.T) {
+	testReset(t)
+	defer func(fold bool) { envFoldCase = fold }(envFoldCase)
+	envFoldCase = true
+	SetEnvPrefix("TEST_MFLAG")
+	SetDefault("labels", map[string]interface{}{})
+	t.Setenv("test_mflag_labels__Team", "core")
+
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := finalConfig.GetString("labels.team"); got != "core" {
+		t.Errorf("labels.team = %q, want %q", got, "core")
+	}
+
+	testReset(t)
+	envFoldCase = false
+	SetEnvPrefix("TEST_MFLAG")
+	SetDefault("labels", map[string]interface{}{})
+	os.Args = []string{"test"}
+	Parse()
+	if got := finalConfig.GetString("labels.team"); got != "" {
+		t.Errorf("labels.team = %q without case folding, want none", got)
+	}
+}
+
+func TestExportEnv(t *testing.T) {
+	declare := func() {
+		SetDefault("db.host", "localhost")
+		SetDefault("db.timeout", 5*time.Second)
+		SetDefault("hosts", []string{"a"})
+		SetDefault("ports", []interface{}{80})
+		SetDefault("debug", false)
+		SetDefault("labels", map[string]interface{}{})
+	}
+	testReset(t)
+	declare()
+	os.Args = []string{"test", "--db-host=db.internal", "--hosts=b,c", "--ports=8080,8443", "--debug", "--db-timeout=1m",
+		"--set=labels.team=core", "--set=labels.cost.center=42"}
+	Parse()
+
+	env := ExportEnv("MYAPP")
+	want := []string{
+		"MYAPP_DB_HOST=db.internal",
+		"MYAPP_DB_TIMEOUT=1m0s",
+		"MYAPP_DEBUG=true",
+		`MYAPP_HOSTS=["b","c"]`,
+		"MYAPP_LABELS__COST__CENTER=42",
+		"MYAPP_LABELS__TEAM=core",
+		"MYAPP_PORTS=[8080,8443]",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Fatalf("ExportEnv() =\n%v\nwant\n%v", env, want)
+	}
+	cmd := exec.Command("child")
+	ExportEnvTo(cmd, "MYAPP")
+	if !slices.Contains(cmd.Env, "MYAPP_DB_HOST=db.internal") || len(cmd.Env) != len(os.Environ())+len(want) {
+		t.Errorf("ExportEnvTo() did not add the variables to the inherited environment")
+	}
+
+	// A child declaring the same keys reads the values back.
+	testReset(t)
+	declare()
+	SetEnvPrefix("MYAPP")
+	for _, v := range env {
+		name, value, _ := strings.Cut(v, "=")
+		t.Setenv(name, value)
+	}
+	os.Args = []string{"child"}
+	Parse()
+	if got := GetString("db.host"); got != "db.internal" {
+		t.Errorf("child db.host = %q", got)
+	}
+	if got := GetDuration("db.timeout"); got != time.Minute {
+		t.Errorf("child db.timeout = %v", got)
+	}
+	if !GetBool("debug") {
+		t.Error("child debug = false")
+	}
+	if got := GetStringSlice("hosts"); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("child hosts = %v", got)
+	}
+	if got := finalConfig.Get("ports"); !reflect.DeepEqual(got, []interface{}{8080, 8443}) {
+		t.Errorf("child ports = %#v", got)
+	}
+	if got := GetString("labels.team"); got != "core" {
+		t.Errorf("child labels.team = %q", got)
+	}
+	if got := GetString("labels.cost.center"); got != "42" {
+		t.Errorf("child labels.cost.center = %q", got)
+	}
+}
@@ -0,0 +1,43 @@
+package mflag
+
+import (
+	"expvar"
+	"time"
+)
+
+// expvarName is the name under which PublishExpvar publishes the configuration.
+const expvarName = "mflag"
+
+// PublishExpvar publishes the merged configuration as the "mflag" expvar, so
+// that it shows up in /debug/vars. Keys are flattened with dot notation and
+// values of keys marked with MarkSecret are masked. The published value is
+// computed on every read, so it always reflects the current configuration.
+// Calling it more than once has no effect.
+func PublishExpvar() {
+	if expvar.Get(expvarName) != nil {
+		return
+	}
+	expvar.Publish(expvarName, expvar.Func(func() any {
+		return maskedSettings()
+	}))
+}
+
+// maskedSettings returns the merged configuration as a flat map from keys to
+// values, with secrets masked and durations formatted as strings. It returns
+// an empty map before Parse.
+func maskedSettings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	if !parsed {
+		return settings
+	}
+	for _, key := range finalConfig.AllKeys() {
+		value := finalConfig.Get(key)
+		if isSecret(key) {
+			value = secretMask
+		} else if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		settings[key] = value
+	}
+	return settings
+}
@@ -0,0 +1,39 @@
+package mflag
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	testReset(t)
+
+	PublishExpvar()
+	PublishExpvar() // Must not panic.
+	v := expvar.Get("mflag")
+	if v == nil {
+		t.Fatal("Expected the mflag expvar to be published")
+	}
+	if got := v.String(); got != "{}" {
+		t.Errorf("Expected an empty map before Parse, got %s", got)
+	}
+
+	MarkSecret("db.password")
+	SetDefault("db.host", "localhost")
+	SetDefault("db.password", "hunter2")
+	SetDefault("timeout", 5*time.Second)
+	Parse()
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+		t.Fatalf("Failed to decode expvar: %v", err)
+	}
+	want := map[string]interface{}{"db.host": "localhost", "db.password": "******", "timeout": "5s"}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("Expected %q to be %v, got %v", key, value, got[key])
+		}
+	}
+}
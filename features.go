@@ -0,0 +1,225 @@
+package mflag
+
+import (
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// featuresKey is the key holding feature flags by default.
+const featuresKey = "features"
+
+// FeatureSet evaluates the feature flags configured below a key. Each
+// feature can be configured in one of the following ways:
+//
+//	features: [dark_mode, beta]           # listed features are enabled
+//	features: {dark_mode: true}           # enabled or disabled
+//	features: {dark_mode: {enabled: true, rollout: 25}}
+//
+// rollout is the percentage of stable IDs (users, tenants, ...) the feature
+// is enabled for; it defaults to 100. enabled defaults to true.
+type FeatureSet struct {
+	key string
+}
+
+// Features returns the feature flags configured under the "features" key.
+func Features() *FeatureSet {
+	return FeaturesAt(featuresKey)
+}
+
+// FeaturesAt returns the feature flags configured under the given key.
+func FeaturesAt(key string) *FeatureSet {
+	return &FeatureSet{key: key}
+}
+
+// Enabled reports whether the feature is enabled for everyone, i.e. it is
+// enabled with a rollout of 100%.
+// Must be called after Parse.
+func (f *FeatureSet) Enabled(name string) bool {
+	enabled, rollout := f.lookup(name)
+	return enabled && rollout >= 100
+}
+
+// EnabledFor reports whether the feature is enabled for the given stable ID.
+// The ID is hashed together with the feature name, so the decision is
+// deterministic for an ID, independent between features, and IDs enabled at
+// a given rollout stay enabled when the rollout increases.
+// Must be called after Parse.
+func (f *FeatureSet) EnabledFor(name, stableID string) bool {
+	enabled, rollout := f.lookup(name)
+	if !enabled || rollout <= 0 {
+		return false
+	}
+	return rollout >= 100 || float64(bucket(featureBucket, name, stableID)) < rollout*100
+}
+
+// lookup returns whether the feature is enabled and its rollout percentage.
+func (f *FeatureSet) lookup(name string) (enabled bool, rollout float64) {
+	mustBeParsed()
+	switch v := finalConfig.Get(f.key).(type) {
+	case []string, []interface{}, string:
+		for _, item := range finalConfig.getItems(f.key) {
+			if item == name {
+				return true, 100
+			}
+		}
+		return false, 0
+	case map[string]interface{}:
+		return parseFeature(v[name])
+	}
+	return false, 0
+}
+
+// parseFeature parses the configuration of a single feature.
+func parseFeature(v interface{}) (enabled bool, rollout float64) {
+	switch val := v.(type) {
+	case bool:
+		return val, 100
+	case string:
+		b, _ := castToBool(val)
+		return b, 100
+	case map[string]interface{}:
+		enabled, rollout = true, 100
+		if e, ok := val["enabled"]; ok {
+			enabled, _ = castToBool(e)
+		}
+		if r, ok := val["rollout"]; ok {
+			if s, ok := r.(string); ok {
+				r = strings.TrimSuffix(strings.TrimSpace(s), "%")
+			}
+			var err error
+			if rollout, err = castToFloat64(r); err != nil {
+				return false, 0
+			}
+		}
+		return enabled, rollout
+	}
+	return false, 0
+}
+
+// Purposes salting bucket, so that a feature, an experiment and the canary
+// of a reload sharing a name still get independent assignments.
+const (
+	featureBucket    = "feature"
+	experimentBucket = "experiment"
+	canaryBucket     = "canary"
+)
+
+// bucket deterministically maps a stable ID to one of 10000 buckets, salted
+// with purpose and name so that different features and experiments get
+// independent assignments.
+func bucket(purpose, name, stableID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(purpose))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(stableID))
+	return h.Sum32() % 10000
+}
+
+// experimentsKey is the key holding experiments by default.
+const experimentsKey = "experiments"
+
+// ExperimentSet assigns stable IDs to the variants of the experiments
+// configured below a key:
+//
+//	experiments:
+//	  checkout_button:
+//	    variants: {control: 50, green: 25, blue: 25}
+//	  onboarding:
+//	    enabled: false
+//	    variants: [{name: short, weight: 1}, {name: long, weight: 1}]
+//
+// Weights are relative to their sum. Variants given as a map are ordered
+// by name, variants given as a list keep their order. enabled defaults to
+// true.
+type ExperimentSet struct {
+	key string
+}
+
+// Experiments returns the experiments configured under the "experiments"
+// key.
+func Experiments() *ExperimentSet {
+	return ExperimentsAt(experimentsKey)
+}
+
+// ExperimentsAt returns the experiments configured under the given key.
+func ExperimentsAt(key string) *ExperimentSet {
+	return &ExperimentSet{key: key}
+}
+
+// Variant returns the variant of the experiment configured under the
+// "experiments" key assigned to stableID, see ExperimentSet.Variant.
+// Must be called after Parse.
+func Variant(experiment, stableID string) string {
+	return Experiments().Variant(experiment, stableID)
+}
+
+// Variant returns the variant of the experiment assigned to stableID, or ""
+// if the experiment is not configured, disabled or has no variant with a
+// positive weight. The ID is hashed together with the experiment name, so
+// the assignment is deterministic for an ID and independent between
+// experiments and from feature rollouts.
+// Must be called after Parse.
+func (e *ExperimentSet) Variant(experiment, stableID string) string {
+	mustBeParsed()
+	cfg, ok := finalConfig.Get(e.key + "." + experiment).(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if v, ok := cfg["enabled"]; ok {
+		if enabled, _ := castToBool(v); !enabled {
+			return ""
+		}
+	}
+	variants := parseVariants(cfg["variants"])
+	var total float64
+	for _, v := range variants {
+		total += v.weight
+	}
+	if total <= 0 {
+		return ""
+	}
+	point := float64(bucket(experimentBucket, experiment, stableID)) / 10000 * total
+	for _, v := range variants {
+		if point < v.weight {
+			return v.name
+		}
+		point -= v.weight
+	}
+	return variants[len(variants)-1].name
+}
+
+// variant is a variant of an experiment with its weight.
+type variant struct {
+	name   string
+	weight float64
+}
+
+// parseVariants parses the variants of an experiment, skipping those
+// without a positive weight.
+func parseVariants(v interface{}) []variant {
+	var variants []variant
+	add := func(name string, w interface{}) {
+		weight, err := castToFloat64(w)
+		if err == nil && weight > 0 && name != "" {
+			variants = append(variants, variant{name: name, weight: weight})
+		}
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, name := range slices.Sorted(maps.Keys(val)) {
+			add(name, val[name])
+		}
+	case []interface{}:
+		for _, item := range val {
+			if m, ok := item.(map[string]interface{}); ok {
+				name, _ := m["name"].(string)
+				add(name, m["weight"])
+			}
+		}
+	}
+	return variants
+}
@@ -0,0 +1,121 @@
+package mflag
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	testReset(t)
+
+	configPath := createTempYAML(t, `
+features:
+  dark_mode: true
+  legacy: false
+  new_checkout: {enabled: true, rollout: 25}
+  paused: {enabled: false, rollout: 100}
+  percent_string: {rollout: "50%"}
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	f := Features()
+	if !f.Enabled("dark_mode") || !f.EnabledFor("dark_mode", "user-1") {
+		t.Error("Expected dark_mode to be enabled for everyone")
+	}
+	if f.Enabled("legacy") || f.EnabledFor("legacy", "user-1") || f.EnabledFor("missing", "user-1") {
+		t.Error("Expected legacy and missing features to be disabled")
+	}
+	if f.Enabled("new_checkout") || f.EnabledFor("paused", "user-1") {
+		t.Error("Expected partially rolled out and paused features not to be enabled for everyone")
+	}
+
+	for name, want := range map[string]float64{"new_checkout": 0.25, "percent_string": 0.5} {
+		enabled := 0
+		for i := range 10000 {
+			id := fmt.Sprintf("user-%d", i)
+			if f.EnabledFor(name, id) {
+				enabled++
+			}
+			if f.EnabledFor(name, id) != f.EnabledFor(name, id) {
+				t.Fatalf("Expected EnabledFor(%q, %q) to be deterministic", name, id)
+			}
+		}
+		if ratio := float64(enabled) / 10000; ratio < want-0.03 || ratio > want+0.03 {
+			t.Errorf("Expected about %.0f%% of IDs to get %q, got %.1f%%", want*100, name, ratio*100)
+		}
+	}
+}
+
+func TestFeatures_List(t *testing.T) {
+	testReset(t)
+
+	SetDefault("features", []string{"dark_mode"})
+	Parse()
+
+	if !Features().Enabled("dark_mode") || Features().EnabledFor("beta", "user-1") {
+		t.Error("Expected listed features to be enabled and others disabled")
+	}
+}
+
+func TestVariant(t *testing.T) {
+	testReset(t)
+	if err := Init(createTempYAML(t, `
+experiments:
+  checkout_button:
+    variants: {control: 50, green: 25, blue: 25}
+  onboarding:
+    variants: [{name: short, weight: 1}, {name: long, weight: 3}]
+  paused:
+    enabled: false
+    variants: {a: 1}
+  empty:
+    variants: {a: 0}
+`)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	for experiment, want := range map[string]map[string]float64{
+		"checkout_button": {"control": 0.5, "green": 0.25, "blue": 0.25},
+		"onboarding":      {"short": 0.25, "long": 0.75},
+	} {
+		counts := make(map[string]int)
+		for i := range 10000 {
+			id := fmt.Sprintf("user-%d", i)
+			v := Variant(experiment, id)
+			if v != Variant(experiment, id) {
+				t.Fatalf("Expected Variant(%q, %q) to be deterministic", experiment, id)
+			}
+			counts[v]++
+		}
+		for name, share := range want {
+			if ratio := float64(counts[name]) / 10000; ratio < share-0.03 || ratio > share+0.03 {
+				t.Errorf("Expected about %.0f%% of IDs to get %s/%s, got %.1f%%", share*100, experiment, name, ratio*100)
+			}
+		}
+		if len(counts) != len(want) {
+			t.Errorf("Unexpected variants of %s: %v", experiment, counts)
+		}
+	}
+	for _, experiment := range []string{"paused", "empty", "missing"} {
+		if v := Variant(experiment, "user-1"); v != "" {
+			t.Errorf("Expected no variant for %s, got %q", experiment, v)
+		}
+	}
+
+	// A feature rolled out to half the IDs and an experiment split in half
+	// under the same name must not assign the same IDs.
+	same := 0
+	for i := range 10000 {
+		id := fmt.Sprintf("user-%d", i)
+		if bucket(featureBucket, "checkout_button", id) < 5000 == (bucket(experimentBucket, "checkout_button", id) < 5000) {
+			same++
+		}
+	}
+	if ratio := float64(same) / 10000; ratio > 0.53 {
+		t.Errorf("Expected independent feature and experiment buckets, %.1f%% of IDs agree", ratio*100)
+	}
+}
@@ -0,0 +1,160 @@
+package mflag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigFile describes a config file that was loaded.
+type ConfigFile struct {
+	Path     string
+	Format   string    // e.g. "yaml"
+	Checksum string    // hex-encoded SHA-256 of the content
+	ModTime  time.Time // modification time when it was loaded
+}
+
+var (
+	filesMu sync.Mutex
+	// filesUsed lists the files loaded since the last Init.
+	filesUsed []ConfigFile
+	// keyFiles maps the keys set by the files loaded since the last Init to
+	// the absolute path of the last file setting them.
+	keyFiles = make(map[string]string)
+)
+
+// ConfigFilesUsed returns the config files loaded by the last Init or
+// InitContext, in load order, so that startup logs can state exactly which
+// files make up the configuration. Files that do not exist are not listed.
+func ConfigFilesUsed() []ConfigFile {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	return slices.Clone(filesUsed)
+}
+
+// Fingerprint returns a stable hash of the merged configuration, as hex-
+// encoded SHA-256, so that operators can compare configurations across
+// replicas and deployment tooling can detect drift. It does not depend on
+// the order keys were loaded in, nor on the syntax of the sources. The
+// values of secrets are masked, so that the fingerprint can be logged and
+// shared without revealing them; changing a secret leaves it unchanged.
+// Must be called after Parse.
+func Fingerprint() string {
+	mustBeParsed()
+	return finalConfig.fingerprint()
+}
+
+// fingerprint hashes the canonical JSON encoding of m, whose map keys are
+// sorted, with secrets masked.
+func (m *mapManager) fingerprint() string {
+	data := m.maskSecrets(m.data, "")
+	content, err := json.Marshal(data)
+	if err != nil {
+		// Values that JSON cannot encode, such as complex numbers, are
+		// hashed through their Go syntax instead.
+		content = []byte(fmt.Sprintf("%#v", data))
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// maskSecrets returns a copy of node, the map at the key prefix, with the
+// values of secret keys replaced by secretMask.
+func (m *mapManager) maskSecrets(node map[string]interface{}, prefix string) map[string]interface{} {
+	masked := make(map[string]interface{}, len(node))
+	for k, v := range node {
+		key := prefix + k
+		if m.isSecret(key) {
+			masked[k] = secretMask
+		} else if child, ok := v.(map[string]interface{}); ok {
+			masked[k] = m.maskSecrets(child, key+".")
+		} else {
+			masked[k] = v
+		}
+	}
+	return masked
+}
+
+// resetFilesUsed forgets the files loaded so far.
+func resetFilesUsed() {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	filesUsed = nil
+	clear(keyFiles)
+}
+
+// unrecorded is the key of the context values marking loads whose files
+// are not recorded, such as those of Drifted.
+type unrecorded struct{}
+
+// recordFileUsed records that the file at path was loaded with content in
+// format, setting keys, unless ctx is marked as unrecorded. Loading a file
+// again replaces its entry.
+func recordFileUsed(ctx context.Context, path, format string, content []byte, keys []string) {
+	if ctx.Value(unrecorded{}) != nil {
+		return
+	}
+	f := ConfigFile{Path: path, Format: format}
+	if abs, err := filepath.Abs(path); err == nil {
+		f.Path = abs
+	}
+	sum := sha256.Sum256(content)
+	f.Checksum = hex.EncodeToString(sum[:])
+	if info, err := os.Stat(path); err == nil {
+		f.ModTime = info.ModTime()
+	}
+
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	for _, key := range keys {
+		keyFiles[key] = f.Path
+	}
+	i := slices.IndexFunc(filesUsed, func(used ConfigFile) bool { return used.Path == f.Path })
+	if i >= 0 {
+		filesUsed[i] = f
+		return
+	}
+	filesUsed = append(filesUsed, f)
+}
+
+// fileKeys returns the keys set by a file holding data, with its
+// conditional blocks and scoped overrides applied as load applies them, so
+// that keys set in a "when" or "overrides" block are attributed to it.
+// Conditions only see the values of the file and the defaults here.
+func fileKeys(data map[string]interface{}) []string {
+	applied, err := applyConditions(data, nil)
+	if err == nil {
+		applied, err = applyOverrides(applied)
+	}
+	if err != nil {
+		applied = data // load reports the error.
+	}
+	m := newManager()
+	m.data = applied
+	return m.AllKeys()
+}
+
+// fileOf returns the absolute path of the config file that set key, or of
+// the map holding it, or "" if no file did.
+func fileOf(key string) string {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	for {
+		if path, ok := keyFiles[key]; ok {
+			return path
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return ""
+		}
+		key = key[:i]
+	}
+}
@@ -0,0 +1,155 @@
+package mflag
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigFilesUsed(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, "name: app\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	files := ConfigFilesUsed()
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file, got %v", files)
+	}
+	f := files[0]
+	if f.Path != configPath || f.Format != "yaml" || len(f.Checksum) != 64 || f.ModTime.IsZero() {
+		t.Errorf("Unexpected file info %+v", f)
+	}
+
+	if err := Init(filepath.Join(t.TempDir(), "missing.yaml")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if files := ConfigFilesUsed(); len(files) != 0 {
+		t.Errorf("Expected missing files not to be listed, got %v", files)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := func(content string, args ...string) string {
+		testReset(t)
+		SetDefault("port", 8080)
+		MarkSecret("db.password")
+		if err := Init(createTempYAML(t, content)); err != nil {
+			t.Fatalf("Init() failed: %v", err)
+		}
+		os.Args = append([]string{"test"}, args...)
+		Parse()
+		return Fingerprint()
+	}
+
+	a := fingerprint("db: {host: a, port: 5432}\nname: x\n")
+	b := fingerprint("name: x\ndb:\n  port: 5432\n  host: a\n")
+	if a != b || len(a) != 64 {
+		t.Errorf("Expected equal configurations to have the same fingerprint, got %q and %q", a, b)
+	}
+	if c := fingerprint("name: x\ndb: {host: a, port: 5432}\n", "--port=9090"); c == a {
+		t.Error("Expected a flag override to change the fingerprint")
+	}
+
+	d := fingerprint("name: x\ndb: {host: a, port: 5432, password: hunter2}\n")
+	if e := fingerprint("name: x\ndb: {host: a, port: 5432, password: swordfish}\n"); d != e || d == a {
+		t.Errorf("Expected secrets to be masked but present, got %q and %q", d, e)
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	testReset(t)
+	SetDefault("log_file", "logs/app.log")
+	SetDefault("data_dir", "")
+	path := createTempYAML(t, "tls:\n  cert_file: certs/server.pem\n  ca_file: /etc/ssl/ca.pem\ndata_dir: data\nplugins: [a.so]\n")
+	if err := Init(path); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--data-dir=var/data"}
+	Parse()
+
+	dir := filepath.Dir(path)
+	tests := map[string]string{
+		"tls.cert_file": filepath.Join(dir, "certs", "server.pem"),
+		"tls.ca_file":   "/etc/ssl/ca.pem",
+		"log_file":      "logs/app.log",
+		"data_dir":      "var/data",
+		"plugins.0":     filepath.Join(dir, "a.so"),
+	}
+	for key, want := range tests {
+		if got := GetPath(key); got != want {
+			t.Errorf("GetPath(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if got, want := Sub("tls").GetPath("cert_file"), tests["tls.cert_file"]; got != want {
+		t.Errorf("Section.GetPath() = %q, want %q", got, want)
+	}
+}
+
+func TestGetPath_Blocks(t *testing.T) {
+	testReset(t)
+	SetScope("region", "eu-west-1")
+	path := createTempYAML(t, `
+mode: prod
+when:
+  - if: mode == "prod"
+    then:
+      log_file: logs/prod.log
+overrides:
+  region:
+    eu-west-1:
+      tls: {cert_file: certs/eu.pem}
+`)
+	if err := Init(path); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	dir := filepath.Dir(path)
+	for key, want := range map[string]string{
+		"log_file":      filepath.Join(dir, "logs", "prod.log"),
+		"tls.cert_file": filepath.Join(dir, "certs", "eu.pem"),
+	} {
+		if got := GetPath(key); got != want {
+			t.Errorf("GetPath(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestGetGlob(t *testing.T) {
+	testReset(t)
+	dir := t.TempDir()
+	for _, name := range []string{"conf.d/b.yaml", "conf.d/a.yaml", "conf.d/notes.txt", "certs/ca.pem"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := filepath.Join(dir, "app.yaml")
+	content := "include: conf.d/*.yaml\nrules:\n  files: [certs/*.pem, conf.d/a.yaml, conf.d/*.yaml, \"[\"]\n"
+	if err := os.WriteFile(config, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(config); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	want := []string{filepath.Join(dir, "conf.d", "a.yaml"), filepath.Join(dir, "conf.d", "b.yaml")}
+	if got := GetGlob("include"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetGlob(include) = %q, want %q", got, want)
+	}
+	want = append([]string{filepath.Join(dir, "certs", "ca.pem")}, want...)
+	if got := Sub("rules").GetGlob("files"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Section.GetGlob(files) = %q, want %q", got, want)
+	}
+	if got := GetGlob("missing"); got != nil {
+		t.Errorf("Expected no files for a missing key, got %q", got)
+	}
+}
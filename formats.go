@@ -0,0 +1,87 @@
+package mflag
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// UnmarshalFunc parses a configuration document into nested maps, as
+// yaml.Unmarshal does into a map[string]interface{}.
+type UnmarshalFunc func(data []byte) (map[string]interface{}, error)
+
+var (
+	formatsMu sync.RWMutex
+	// formats holds the formats registered with RegisterFormat by
+	// extension.
+	formats = make(map[string]UnmarshalFunc)
+)
+
+// RegisterFormat makes config files with the extension ext, such as
+// ".toml", be parsed with fn, so that applications can use any format
+// without mflag depending on its parser. Files with other extensions are
+// parsed as YAML, which includes JSON. Registering an extension again
+// replaces its format, including the built-in ".yaml", ".yml" and ".json".
+// Registrations are kept across Reset.
+func RegisterFormat(ext string, fn UnmarshalFunc) {
+	if fn == nil {
+		panic("mflag: RegisterFormat function is nil")
+	}
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[normalizeExt(ext)] = fn
+}
+
+// FileOption configures the provider returned by File.
+type FileOption func(*fileProvider)
+
+// WithFormat parses the file in the format registered for the extension
+// ext, whatever the extension of the file, e.g. for a file named "config"
+// holding TOML. Loading fails if ext is neither YAML, JSON nor registered.
+func WithFormat(ext string) FileOption {
+	return func(p *fileProvider) {
+		p.format = ext
+	}
+}
+
+// formatOf returns the name of the format a file at path is parsed in,
+// such as "yaml", and its parser, which is nil for YAML. format is the
+// extension selected with WithFormat, if any, and must be YAML, JSON or
+// registered; files with an unknown extension are parsed as YAML.
+func formatOf(path, format string) (string, UnmarshalFunc, error) {
+	explicit := format != ""
+	if !explicit {
+		format = filepath.Ext(path)
+	}
+	ext := normalizeExt(format)
+	formatsMu.RLock()
+	fn := formats[ext]
+	formatsMu.RUnlock()
+	if fn != nil {
+		return strings.TrimPrefix(ext, "."), fn, nil
+	}
+	if explicit && !isConfigExt(ext) {
+		return "", nil, fmt.Errorf("unknown format %q", format)
+	}
+	return "yaml", nil, nil
+}
+
+// normalizeExt returns ext in lower case with a leading dot.
+func normalizeExt(ext string) string {
+	return "." + strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+// isConfigExt reports whether files with the extension ext are config
+// files: YAML, JSON or a format added with RegisterFormat.
+func isConfigExt(ext string) bool {
+	ext = normalizeExt(ext)
+	switch ext {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	_, ok := formats[ext]
+	return ok
+}
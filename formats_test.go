@@ -0,0 +1,72 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseKeyValues parses lines of key=value pairs.
+func parseKeyValues(data []byte) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errors.New("expected key=value")
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+func TestRegisterFormat(t *testing.T) {
+	testReset(t)
+	RegisterFormat("KV", parseKeyValues)
+	t.Cleanup(func() {
+		formatsMu.Lock()
+		delete(formats, ".kv")
+		formatsMu.Unlock()
+	})
+
+	dir := t.TempDir()
+	kvPath := filepath.Join(dir, "config.kv")
+	if err := os.WriteFile(kvPath, []byte("name = app\nport = 9090\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	SetDefault("port", 8080)
+	if err := Init(kvPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+	if GetString("name") != "app" || GetInt("port") != 9090 {
+		t.Errorf("Expected values parsed as key=value, got %q and %d", GetString("name"), GetInt("port"))
+	}
+	if files := ConfigFilesUsed(); len(files) != 1 || files[0].Format != "kv" {
+		t.Errorf("Expected the format to be recorded, got %+v", files)
+	}
+
+	plain := filepath.Join(dir, "config")
+	if err := os.WriteFile(plain, []byte("name = other\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := File(plain, WithFormat(".kv")).Load(context.Background())
+	if err != nil || data["name"] != "other" {
+		t.Errorf("Expected the explicitly selected format to be used, got %v, %v", data, err)
+	}
+	if _, err := File(plain).Load(context.Background()); err == nil {
+		t.Error("Expected files without extension to be parsed as YAML")
+	}
+	if _, err := File(plain, WithFormat(".toml")).Load(context.Background()); !errors.Is(err, ErrInitFailed) || !strings.Contains(err.Error(), `unknown format ".toml"`) {
+		t.Errorf("Expected an error for an unknown explicit format, got %v", err)
+	}
+
+	if err := os.WriteFile(kvPath, []byte("invalid\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(kvPath); !errors.Is(err, ErrInitFailed) || !strings.Contains(err.Error(), "failed to parse kv") {
+		t.Errorf("Expected a parse error, got %v", err)
+	}
+}
@@ -0,0 +1,427 @@
+// Package gcpsm provides mflag providers reading secrets from Google Cloud
+// Secret Manager, authenticating with Application Default Credentials as
+// found by golang.org/x/oauth2/google, which covers service accounts, user
+// credentials, workload identity federation, service account impersonation
+// and the metadata server.
+//
+// Resolve replaces references in the values of another provider:
+//
+//	err := mflag.InitContext(ctx, gcpsm.Resolve(mflag.File("config.yaml")))
+//
+// where the file holds, for example:
+//
+//	database:
+//	  password: gcpsm://projects/my-project/secrets/db-password
+//
+// Prefix loads every secret of a project whose name has a given prefix.
+package gcpsm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hypedn/mflag"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// refPrefix marks values referencing a secret.
+	refPrefix = "gcpsm://"
+	// defaultEndpoint is the address of the Secret Manager API.
+	defaultEndpoint = "https://secretmanager.googleapis.com"
+	// defaultTTL is how long secrets are cached by default.
+	defaultTTL = 5 * time.Minute
+	// scope is the OAuth scope requested for access tokens.
+	scope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// Provider reads secrets from Secret Manager. It implements mflag.Provider.
+type Provider struct {
+	// Exactly one of inner and project is set.
+	inner   mflag.Provider
+	project string
+	prefix  string
+
+	ttl      time.Duration
+	interval time.Duration
+	endpoint string
+	client   *http.Client
+
+	setupOnce sync.Once
+	setupErr  error
+	tokens    oauth2.TokenSource
+
+	mu        sync.Mutex
+	cache     map[string]cached
+	resources []string
+}
+
+// cached is a secret value and when it was fetched.
+type cached struct {
+	value   string
+	fetched time.Time
+}
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithCacheTTL sets how long secret values are reused before Load fetches
+// them again. It defaults to five minutes; zero disables caching.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(p *Provider) {
+		p.ttl = ttl
+	}
+}
+
+// WithRefresh sets how often Watch fetches the secrets to detect changes.
+// It defaults to one minute.
+func WithRefresh(interval time.Duration) Option {
+	return func(p *Provider) {
+		p.interval = interval
+	}
+}
+
+// Resolve returns a provider loading the values of inner and replacing
+// every value of the form gcpsm://projects/PROJECT/secrets/NAME, optionally
+// followed by /versions/VERSION, with that version of the secret, or its
+// latest version. The secrets are returned as mflag.Secret values, so that
+// their keys are treated as secret.
+func Resolve(inner mflag.Provider, opts ...Option) *Provider {
+	return newProvider(opts, func(p *Provider) { p.inner = inner })
+}
+
+// Prefix returns a provider loading the latest version of every secret of
+// project whose name starts with prefix. The rest of the name is the key,
+// with double underscores denoting nesting, so that with the prefix "app-"
+// the secret "app-database__password" sets "database.password". All values
+// are returned as mflag.Secret values.
+func Prefix(project, prefix string, opts ...Option) *Provider {
+	return newProvider(opts, func(p *Provider) { p.project, p.prefix = project, prefix })
+}
+
+func newProvider(opts []Option, init func(*Provider)) *Provider {
+	p := &Provider{
+		ttl:      defaultTTL,
+		interval: time.Minute,
+		endpoint: defaultEndpoint,
+		client:   http.DefaultClient,
+		cache:    make(map[string]cached),
+	}
+	init(p)
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// setup finds the credentials used to authenticate.
+func (p *Provider) setup() error {
+	p.setupOnce.Do(func() {
+		if p.tokens != nil {
+			return
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, p.client)
+		if p.tokens, p.setupErr = google.DefaultTokenSource(ctx, scope); p.setupErr != nil {
+			p.setupErr = fmt.Errorf("gcpsm: %w", p.setupErr)
+		}
+	})
+	return p.setupErr
+}
+
+// Load returns the configuration values with the secrets they reference.
+func (p *Provider) Load(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.setup(); err != nil {
+		return nil, err
+	}
+	if p.inner == nil {
+		return p.loadPrefix(ctx)
+	}
+	data, err := p.inner.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resources []string
+	resolved, err := p.resolve(ctx, data, "", &resources)
+	if err != nil {
+		return nil, err
+	}
+	p.setResources(resources)
+	return resolved.(map[string]interface{}), nil
+}
+
+// resolve returns a copy of v, found at key, with references replaced by
+// the secrets they name, which it adds to resources.
+func (p *Provider) resolve(ctx context.Context, v interface{}, key string, resources *[]string) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			resolved, err := p.resolve(ctx, item, joinKey(key, k), resources)
+			if err != nil {
+				return nil, err
+			}
+			res[k] = resolved
+		}
+		return res, nil
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := p.resolve(ctx, item, joinKey(key, strconv.Itoa(i)), resources)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = resolved
+		}
+		return res, nil
+	case string:
+		ref, ok := strings.CutPrefix(v, refPrefix)
+		if !ok {
+			return v, nil
+		}
+		resource, err := versionName(ref)
+		if err != nil {
+			return nil, fmt.Errorf("%w for %q: %w", mflag.ErrInvalidValue, key, err)
+		}
+		value, err := p.access(ctx, resource, false)
+		if err != nil {
+			return nil, fmt.Errorf("gcpsm: resolving %q: %w", key, err)
+		}
+		*resources = append(*resources, resource)
+		return mflag.NewSecret(value), nil
+	}
+	return v, nil
+}
+
+// joinKey appends segment to the dotted key.
+func joinKey(key, segment string) string {
+	if key == "" {
+		return segment
+	}
+	return key + "." + segment
+}
+
+// versionName returns the name of the secret version a reference points
+// to, defaulting to the latest version.
+func versionName(ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	valid := len(parts) >= 4 && parts[0] == "projects" && parts[1] != "" && parts[2] == "secrets" && parts[3] != ""
+	switch {
+	case valid && len(parts) == 4:
+		return ref + "/versions/latest", nil
+	case valid && len(parts) == 6 && parts[4] == "versions" && parts[5] != "":
+		return ref, nil
+	}
+	return "", fmt.Errorf("expected %sprojects/PROJECT/secrets/NAME[/versions/VERSION], got %q", refPrefix, refPrefix+ref)
+}
+
+// loadPrefix loads the secrets whose names start with the prefix.
+func (p *Provider) loadPrefix(ctx context.Context) (map[string]interface{}, error) {
+	names, err := p.listSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{})
+	var resources []string
+	for _, name := range names {
+		resource := name + "/versions/latest"
+		value, err := p.access(ctx, resource, false)
+		if err != nil {
+			return nil, err
+		}
+		id := name[strings.LastIndex(name, "/")+1:]
+		path := strings.Split(strings.TrimPrefix(id, p.prefix), "__")
+		mflag.SetPath(data, path, mflag.NewSecret(value))
+		resources = append(resources, resource)
+	}
+	p.setResources(resources)
+	return data, nil
+}
+
+// listSecrets returns the names of the secrets of the project starting with
+// the prefix.
+func (p *Provider) listSecrets(ctx context.Context) ([]string, error) {
+	var names []string
+	pageToken := ""
+	for {
+		query := url.Values{"pageSize": {"250"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		var page struct {
+			Secrets []struct {
+				Name string `json:"name"`
+			} `json:"secrets"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		path := "/v1/projects/" + url.PathEscape(p.project) + "/secrets?" + query.Encode()
+		if err := p.get(ctx, path, &page); err != nil {
+			return nil, err
+		}
+		for _, s := range page.Secrets {
+			id := s.Name[strings.LastIndex(s.Name, "/")+1:]
+			if strings.HasPrefix(id, p.prefix) && id != p.prefix {
+				names = append(names, s.Name)
+			}
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// access returns the value of the secret version resource, from the cache
+// unless it is stale or fresh is set.
+func (p *Provider) access(ctx context.Context, resource string, fresh bool) (string, error) {
+	p.mu.Lock()
+	c, ok := p.cache[resource]
+	p.mu.Unlock()
+	if ok && !fresh && time.Since(c.fetched) < p.ttl {
+		return c.value, nil
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := p.get(ctx, "/v1/"+resource+":access", &version); err != nil {
+		return "", err
+	}
+	value, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("gcpsm: decoding %s: %w", resource, err)
+	}
+	p.mu.Lock()
+	p.cache[resource] = cached{value: string(value), fetched: time.Now()}
+	p.mu.Unlock()
+	return string(value), nil
+}
+
+// get sends an authenticated GET request for path and decodes the JSON
+// response into out.
+func (p *Provider) get(ctx context.Context, path string, out interface{}) error {
+	token, err := p.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("gcpsm: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+path, nil)
+	if err != nil {
+		return fmt.Errorf("gcpsm: %w", err)
+	}
+	token.SetAuthHeader(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gcpsm: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gcpsm: GET %s: %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gcpsm: decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// setResources records the secret versions the last Load read.
+func (p *Provider) setResources(resources []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resources = resources
+}
+
+// Watch fetches the secrets read by the last Load at the refresh interval,
+// and, for Prefix, lists the secrets again, sending an update whenever a
+// value changed or a secret was added or removed, or an error when fetching
+// failed, until ctx is done. It implements mflag.Watcher. Reloading after
+// an update reads the fetched values from the cache.
+func (p *Provider) Watch(ctx context.Context) <-chan mflag.Update {
+	updates := make(chan mflag.Update, 1)
+	go func() {
+		defer close(updates)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			changed, err := p.refresh(ctx)
+			if !changed && (err == nil || ctx.Err() != nil) {
+				continue
+			}
+			select {
+			case updates <- mflag.Update{Err: err}:
+			default:
+			}
+		}
+	}()
+	return updates
+}
+
+// refresh fetches the secrets and reports whether any of them changed.
+// Secrets that cannot be fetched keep their cached values.
+func (p *Provider) refresh(ctx context.Context) (bool, error) {
+	if err := p.setup(); err != nil {
+		return false, err
+	}
+	p.mu.Lock()
+	resources := slices.Clone(p.resources)
+	before := maps.Clone(p.cache)
+	p.mu.Unlock()
+
+	if p.inner == nil {
+		names, err := p.listSecrets(ctx)
+		if err != nil {
+			return false, err
+		}
+		current := make([]string, len(names))
+		for i, name := range names {
+			current[i] = name + "/versions/latest"
+		}
+		if !sameSet(current, resources) {
+			return true, nil
+		}
+	}
+	changed := false
+	var errs []error
+	for _, resource := range resources {
+		value, err := p.access(ctx, resource, true)
+		if err != nil {
+			errs = append(errs, err)
+		} else if value != before[resource].value {
+			changed = true
+		}
+	}
+	if changed {
+		return true, nil
+	}
+	return false, errors.Join(errs...)
+}
+
+// sameSet reports whether a and b hold the same elements.
+func sameSet(a, b []string) bool {
+	set := func(s []string) map[string]bool {
+		m := make(map[string]bool, len(s))
+		for _, v := range s {
+			m[v] = true
+		}
+		return m
+	}
+	return reflect.DeepEqual(set(a), set(b))
+}
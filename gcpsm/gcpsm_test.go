@@ -0,0 +1,167 @@
+package gcpsm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hypedn/mflag"
+	"golang.org/x/oauth2"
+)
+
+var _ mflag.Watcher = (*Provider)(nil)
+
+// mapProvider is an mflag.Provider returning fixed values.
+type mapProvider map[string]interface{}
+
+func (m mapProvider) Load(context.Context) (map[string]interface{}, error) {
+	return m, nil
+}
+
+// fakeAPI serves secrets from a map, counting accesses.
+type fakeAPI struct {
+	mu       sync.Mutex
+	secrets  map[string]string // secret name to latest value
+	accesses int
+}
+
+func (f *fakeAPI) set(name, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.secrets[name] = value
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), ":access"); ok {
+		name = name[:strings.Index(name, "/versions/")]
+		value, ok := f.secrets[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.accesses++
+		fmt.Fprintf(w, `{"payload": {"data": %q}}`, base64.StdEncoding.EncodeToString([]byte(value)))
+		return
+	}
+	var list struct {
+		Secrets []map[string]string `json:"secrets"`
+	}
+	for name := range f.secrets {
+		list.Secrets = append(list.Secrets, map[string]string{"name": name})
+	}
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func testProvider(t *testing.T, p *Provider) (*Provider, *fakeAPI) {
+	t.Helper()
+	api := &fakeAPI{secrets: map[string]string{
+		"projects/p/secrets/db-password":     "hunter2",
+		"projects/p/secrets/app-api_key":     "key",
+		"projects/p/secrets/app-db__user":    "admin",
+		"projects/p/secrets/other-something": "x",
+	}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	p.endpoint = srv.URL
+	p.tokens = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	return p, api
+}
+
+func TestResolve(t *testing.T) {
+	mflag.Reset()
+	t.Cleanup(mflag.Reset)
+	inner := mapProvider{
+		"name": "app",
+		"database": map[string]interface{}{
+			"password": "gcpsm://projects/p/secrets/db-password",
+		},
+		"keys": []interface{}{"gcpsm://projects/p/secrets/app-api_key/versions/3"},
+	}
+	p, api := testProvider(t, Resolve(inner))
+
+	data, err := p.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"name":     "app",
+		"database": map[string]interface{}{"password": mflag.NewSecret("hunter2")},
+		"keys":     []interface{}{mflag.NewSecret("key")},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Load() = %v, want %v", data, want)
+	}
+	if inner["database"].(map[string]interface{})["password"] != "gcpsm://projects/p/secrets/db-password" {
+		t.Error("Expected the values of the inner provider not to be modified")
+	}
+
+	if _, err := p.Load(context.Background()); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if api.accesses != 2 {
+		t.Errorf("Expected cached secrets to be reused, got %d accesses", api.accesses)
+	}
+
+	inner["bad"] = "gcpsm://projects/p/db-password"
+	if _, err := p.Load(context.Background()); err == nil {
+		t.Error("Expected an error for a malformed reference")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	mflag.Reset()
+	t.Cleanup(mflag.Reset)
+	p, _ := testProvider(t, Prefix("p", "app-"))
+	data, err := p.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"api_key": mflag.NewSecret("key"),
+		"db":      map[string]interface{}{"user": mflag.NewSecret("admin")},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Load() = %v, want %v", data, want)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	mflag.Reset()
+	t.Cleanup(mflag.Reset)
+	inner := mapProvider{"password": "gcpsm://projects/p/secrets/db-password"}
+	p, api := testProvider(t, Resolve(inner, WithRefresh(10*time.Millisecond)))
+	if _, err := p.Load(context.Background()); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := p.Watch(ctx)
+	api.set("projects/p/secrets/db-password", "rotated")
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change to be reported")
+	}
+	cancel()
+	for range changes {
+	}
+
+	data, err := p.Load(context.Background())
+	if err != nil || data["password"] != mflag.NewSecret("rotated") {
+		t.Errorf("Expected the refreshed value, got %v, %v", data, err)
+	}
+}
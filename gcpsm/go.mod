@@ -0,0 +1,13 @@
+module github.com/hypedn/mflag/gcpsm
+
+go 1.24
+
+require (
+	github.com/hypedn/mflag v0.0.0-20261016204951-551c88cf9f97
+	golang.org/x/oauth2 v0.30.0
+)
+
+require (
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,158 @@
+// Package hcl provides an mflag provider reading HashiCorp Configuration
+// Language files, for teams used to the configuration style of Terraform or
+// Nomad. It is a separate module so that mflag itself does not depend on the
+// HCL libraries.
+//
+// Attributes become keys and blocks become nested maps, with one level per
+// label:
+//
+//	port = 8080
+//
+//	database {
+//	  host = "localhost"
+//	}
+//
+//	output "kafka" {
+//	  brokers = ["a:9092", "b:9092"]
+//	}
+//
+// sets "port", "database.host" and "output.kafka.brokers". Blocks of the
+// same type without labels that are repeated become a list of maps.
+package hcl
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hypedn/mflag"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// File returns a provider reading the HCL file at path. It is mflag.File
+// with the HCL format, so the path is expanded, RequireConfigFile applies
+// and the file is recorded in mflag.ConfigFilesUsed. File registers
+// Unmarshal for the ".hcl" extension.
+func File(path string) mflag.Provider {
+	registerOnce.Do(func() {
+		mflag.RegisterFormat(".hcl", Unmarshal)
+	})
+	return mflag.File(path, mflag.WithFormat(".hcl"))
+}
+
+var registerOnce sync.Once
+
+// Unmarshal parses the HCL document src into nested maps. Registering it
+// with mflag.RegisterFormat(".hcl", hcl.Unmarshal) lets Init read HCL files.
+func Unmarshal(src []byte) (map[string]interface{}, error) {
+	return parse(src, "config.hcl")
+}
+
+// parse parses src, read from filename, into nested maps.
+func parse(src []byte, filename string) (map[string]interface{}, error) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%w: failed to parse hcl: %w", mflag.ErrInitFailed, diags)
+	}
+	values, err := bodyValues(file.Body.(*hclsyntax.Body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", mflag.ErrInitFailed, filename, err)
+	}
+	return values, nil
+}
+
+// bodyValues converts the attributes and blocks of body.
+func bodyValues(body *hclsyntax.Body) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(body.Attributes)+len(body.Blocks))
+	for name, attr := range body.Attributes {
+		v, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		values[name] = goValue(v)
+	}
+
+	for _, block := range body.Blocks {
+		content, err := bodyValues(block.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(block.Labels) == 0 {
+			switch existing := values[block.Type].(type) {
+			case nil:
+				values[block.Type] = content
+			case map[string]interface{}:
+				values[block.Type] = []interface{}{existing, content}
+			case []interface{}:
+				values[block.Type] = append(existing, content)
+			}
+			continue
+		}
+
+		parent := values
+		path := append([]string{block.Type}, block.Labels...)
+		for i, segment := range path {
+			if i == len(path)-1 {
+				if _, dup := parent[segment]; dup {
+					return nil, fmt.Errorf("%s: duplicate block %q %q", block.DefRange(), block.Type, block.Labels)
+				}
+				parent[segment] = content
+				break
+			}
+			next, ok := parent[segment].(map[string]interface{})
+			if !ok {
+				if parent[segment] != nil {
+					return nil, fmt.Errorf("%s: block %q conflicts with attribute %q", block.DefRange(), block.Type, segment)
+				}
+				next = make(map[string]interface{})
+				parent[segment] = next
+			}
+			parent = next
+		}
+	}
+	return values, nil
+}
+
+// goValue converts v to the types mflag uses for YAML values.
+func goValue(v cty.Value) interface{} {
+	if v.IsNull() || !v.IsKnown() {
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		return v.AsString()
+	case t == cty.Bool:
+		return v.True()
+	case t == cty.Number:
+		f := v.AsBigFloat()
+		if f.IsInt() {
+			if i, acc := f.Int64(); acc == big.Exact {
+				return int(i)
+			}
+			if u, acc := f.Uint64(); acc == big.Exact {
+				return u
+			}
+			return f.Text('f', -1)
+		}
+		n, _ := f.Float64()
+		return n
+	case t.IsListType() || t.IsTupleType() || t.IsSetType():
+		items := make([]interface{}, 0, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			_, item := it.Element()
+			items = append(items, goValue(item))
+		}
+		return items
+	case t.IsMapType() || t.IsObjectType():
+		m := make(map[string]interface{}, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			key, item := it.Element()
+			m[key.AsString()] = goValue(item)
+		}
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package hcl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hypedn/mflag"
+)
+
+func TestUnmarshal(t *testing.T) {
+	got, err := Unmarshal([]byte(`
+port    = 8080
+ratio   = 0.5
+debug   = true
+name    = "app"
+tags    = ["a", "b"]
+limits  = { cpu = 2 }
+timeout = "5s"
+big     = 18446744073709551615
+
+database {
+  host = "localhost"
+}
+
+output "kafka" {
+  brokers = ["a:9092"]
+}
+
+output "file" {
+  path = "/var/log/app"
+}
+
+rule {
+  match = "a"
+}
+
+rule {
+  match = "b"
+}
+`))
+	if err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"port":     8080,
+		"ratio":    0.5,
+		"debug":    true,
+		"name":     "app",
+		"tags":     []interface{}{"a", "b"},
+		"limits":   map[string]interface{}{"cpu": 2},
+		"timeout":  "5s",
+		"big":      uint64(18446744073709551615),
+		"database": map[string]interface{}{"host": "localhost"},
+		"output": map[string]interface{}{
+			"kafka": map[string]interface{}{"brokers": []interface{}{"a:9092"}},
+			"file":  map[string]interface{}{"path": "/var/log/app"},
+		},
+		"rule": []interface{}{
+			map[string]interface{}{"match": "a"},
+			map[string]interface{}{"match": "b"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	for name, src := range map[string]string{
+		"syntax":          `port = `,
+		"variable":        `port = var.port`,
+		"duplicate block": "output \"a\" {}\noutput \"a\" {}\n",
+	} {
+		if _, err := Unmarshal([]byte(src)); !errors.Is(err, mflag.ErrInitFailed) {
+			t.Errorf("%s: expected ErrInitFailed, got %v", name, err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	args := os.Args
+	mflag.Reset()
+	t.Cleanup(func() {
+		os.Args = args
+		mflag.Reset()
+	})
+	os.Args = []string{"test"}
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	if err := os.WriteFile(path, []byte("server {\n  port = 9090\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mflag.SetDefault("server.port", 8080)
+	if err := mflag.InitContext(context.Background(), File(path)); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	if err := mflag.ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got := mflag.GetInt("server.port"); got != 9090 {
+		t.Errorf("Expected the port from the HCL file, got %d", got)
+	}
+	if files := mflag.ConfigFilesUsed(); len(files) != 1 || files[0].Format != "hcl" {
+		t.Errorf("Expected the HCL file to be recorded, got %v", files)
+	}
+
+	data, err := File(filepath.Join(t.TempDir(), "missing.hcl")).Load(context.Background())
+	if err != nil || len(data) != 0 {
+		t.Errorf("Expected no values for a missing file, got %v, %v", data, err)
+	}
+}
@@ -0,0 +1,760 @@
+// Package jsonpath queries the merged configuration of mflag with JSONPath
+// expressions, for tooling and templates that need more than the key
+// patterns of mflag.GetAll:
+//
+//	hosts, err := jsonpath.Query("$.servers[?(@.region == 'eu')].host")
+//
+// It supports the root $, names as in .name or ['name'], wildcards as in .*
+// or [*], recursive descent as in ..host, indexes, slices and unions as in
+// [0], [-1], [1:3] or [0,2], and filters as in [?(@.port >= 8000 &&
+// @.tls)]. Filters compare paths relative to the current node (@) or to the
+// root ($) with ==, !=, <, <=, > and >=, combine them with &&, || and !,
+// and test a path alone for existence.
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hypedn/mflag"
+)
+
+// ErrInvalidPath is returned by Compile and Query for malformed expressions.
+var ErrInvalidPath = errors.New("jsonpath: invalid path")
+
+// Path is a compiled JSONPath expression.
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// step selects nodes below the nodes matched so far, or below them and all
+// their descendants if recursive.
+type step struct {
+	recursive bool
+	sel       selector
+}
+
+// selector appends the nodes it selects below node to out.
+type selector interface {
+	apply(root, node interface{}, out []interface{}) []interface{}
+}
+
+// Query returns the values of the merged configuration matching expr, in
+// document order, with the keys of maps sorted.
+// Must be called after mflag.Parse.
+func Query(expr string) ([]interface{}, error) {
+	return QueryReader(mflag.Snapshot(), expr)
+}
+
+// QueryReader returns the values of cfg matching expr, as Query does.
+func QueryReader(cfg mflag.Reader, expr string) ([]interface{}, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := cfg.UnmarshalKey("", &data); err != nil {
+		return nil, err
+	}
+	return p.Select(data), nil
+}
+
+// Compile parses expr, which must start with $.
+func Compile(expr string) (*Path, error) {
+	p := &parser{expr: expr}
+	p.skipSpace()
+	if !p.consume("$") {
+		return nil, p.errorf("expected $")
+	}
+	steps, err := p.steps()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(expr) {
+		return nil, p.errorf("unexpected %q", expr[p.pos:])
+	}
+	return &Path{expr: expr, steps: steps}, nil
+}
+
+// MustCompile is like Compile but panics if expr is invalid.
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the expression p was compiled from.
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Select returns the values of data matching p. data is made of maps,
+// lists and scalars as decoded from JSON or YAML into interface{}.
+func (p *Path) Select(data interface{}) []interface{} {
+	return selectSteps(p.steps, data, data)
+}
+
+// selectSteps returns the nodes below node matched by steps.
+func selectSteps(steps []step, root, node interface{}) []interface{} {
+	nodes := []interface{}{node}
+	for _, s := range steps {
+		var next []interface{}
+		for _, n := range nodes {
+			if !s.recursive {
+				next = s.sel.apply(root, n, next)
+				continue
+			}
+			for _, d := range descendants(n, nil) {
+				next = s.sel.apply(root, d, next)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// descendants appends node and the nodes below it to out, in document
+// order.
+func descendants(node interface{}, out []interface{}) []interface{} {
+	out = append(out, node)
+	for _, child := range children(node) {
+		out = descendants(child, out)
+	}
+	return out
+}
+
+// children returns the values of a map, sorted by key, or the items of a
+// list.
+func children(node interface{}) []interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		values := make([]interface{}, 0, len(n))
+		for _, key := range slices.Sorted(maps.Keys(n)) {
+			values = append(values, n[key])
+		}
+		return values
+	case []interface{}:
+		return n
+	}
+	return nil
+}
+
+// nameSelector selects the values of the keys of a map.
+type nameSelector []string
+
+func (s nameSelector) apply(_, node interface{}, out []interface{}) []interface{} {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return out
+	}
+	for _, name := range s {
+		if value, ok := m[name]; ok {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// wildcardSelector selects every child.
+type wildcardSelector struct{}
+
+func (wildcardSelector) apply(_, node interface{}, out []interface{}) []interface{} {
+	return append(out, children(node)...)
+}
+
+// indexSelector selects the items of a list at indexes, counted from the
+// end if negative.
+type indexSelector []int
+
+func (s indexSelector) apply(_, node interface{}, out []interface{}) []interface{} {
+	items, ok := node.([]interface{})
+	if !ok {
+		return out
+	}
+	for _, i := range s {
+		if i < 0 {
+			i += len(items)
+		}
+		if i >= 0 && i < len(items) {
+			out = append(out, items[i])
+		}
+	}
+	return out
+}
+
+// sliceSelector selects the items of a list from start to end, excluded,
+// every step items, as slices do in Python.
+type sliceSelector struct {
+	start, end *int
+	step       int
+}
+
+func (s sliceSelector) apply(_, node interface{}, out []interface{}) []interface{} {
+	items, ok := node.([]interface{})
+	if !ok || s.step == 0 {
+		return out
+	}
+	n := len(items)
+	bound := func(i *int, def, lo, hi int) int {
+		if i == nil {
+			return def
+		}
+		v := *i
+		if v < 0 {
+			v += n
+		}
+		return min(max(v, lo), hi)
+	}
+	if s.step > 0 {
+		for i := bound(s.start, 0, 0, n); i < bound(s.end, n, 0, n); i += s.step {
+			out = append(out, items[i])
+		}
+		return out
+	}
+	for i := bound(s.start, n-1, -1, n-1); i > bound(s.end, -1, -1, n-1); i += s.step {
+		out = append(out, items[i])
+	}
+	return out
+}
+
+// filterSelector selects the children for which a filter holds.
+type filterSelector struct {
+	filter filter
+}
+
+func (s filterSelector) apply(root, node interface{}, out []interface{}) []interface{} {
+	for _, child := range children(node) {
+		if s.filter.holds(root, child) {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// filter is a boolean expression of a filter selector.
+type filter interface {
+	holds(root, current interface{}) bool
+}
+
+type orFilter struct{ left, right filter }
+
+func (f orFilter) holds(root, current interface{}) bool {
+	return f.left.holds(root, current) || f.right.holds(root, current)
+}
+
+type andFilter struct{ left, right filter }
+
+func (f andFilter) holds(root, current interface{}) bool {
+	return f.left.holds(root, current) && f.right.holds(root, current)
+}
+
+type notFilter struct{ filter filter }
+
+func (f notFilter) holds(root, current interface{}) bool {
+	return !f.filter.holds(root, current)
+}
+
+// existsFilter holds if its path matches a node.
+type existsFilter struct{ path pathOperand }
+
+func (f existsFilter) holds(root, current interface{}) bool {
+	_, ok := f.path.value(root, current)
+	return ok
+}
+
+// compareFilter compares two operands.
+type compareFilter struct {
+	op          string
+	left, right operand
+}
+
+func (f compareFilter) holds(root, current interface{}) bool {
+	a, aok := f.left.value(root, current)
+	b, bok := f.right.value(root, current)
+	if !aok || !bok {
+		// A missing value only equals another missing value.
+		switch f.op {
+		case "==":
+			return aok == bok
+		case "!=":
+			return aok != bok
+		}
+		return false
+	}
+	switch f.op {
+	case "==":
+		return equal(a, b)
+	case "!=":
+		return !equal(a, b)
+	}
+	c, ok := order(a, b)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // ">="
+		return c >= 0
+	}
+}
+
+// operand is a value compared by a filter.
+type operand interface {
+	value(root, current interface{}) (interface{}, bool)
+}
+
+// literal is a string, number, boolean or null.
+type literal struct{ v interface{} }
+
+func (l literal) value(_, _ interface{}) (interface{}, bool) {
+	return l.v, true
+}
+
+// pathOperand is the first node matched by a path relative to the current
+// node, or to the root if root is set.
+type pathOperand struct {
+	root  bool
+	steps []step
+}
+
+func (p pathOperand) value(root, current interface{}) (interface{}, bool) {
+	start := current
+	if p.root {
+		start = root
+	}
+	nodes := selectSteps(p.steps, root, start)
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	return nodes[0], true
+}
+
+// number returns v as a float64 if it is a number.
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// equal reports whether a and b are equal, comparing numbers by value.
+func equal(a, b interface{}) bool {
+	x, aok := number(a)
+	y, bok := number(b)
+	if aok && bok {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// order compares two numbers or two strings, and reports false for other
+// values.
+func order(a, b interface{}) (int, bool) {
+	x, aok := number(a)
+	y, bok := number(b)
+	if aok && bok {
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	s, aok := a.(string)
+	t, bok := b.(string)
+	if aok && bok {
+		return strings.Compare(s, t), true
+	}
+	return 0, false
+}
+
+// parser parses an expression.
+type parser struct {
+	expr string
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at offset %d of %q", ErrInvalidPath, fmt.Sprintf(format, args...), p.pos, p.expr)
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.expr) {
+		return p.expr[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// consume skips s and reports whether the expression continues with it.
+func (p *parser) consume(s string) bool {
+	if strings.HasPrefix(p.expr[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// steps parses the steps following $ or @.
+func (p *parser) steps() ([]step, error) {
+	var steps []step
+	for {
+		var s step
+		var err error
+		switch {
+		case p.consume(".."):
+			s.recursive = true
+			if p.peek() == '[' {
+				s.sel, err = p.bracket()
+			} else {
+				s.sel, err = p.dotName()
+			}
+		case p.consume("."):
+			s.sel, err = p.dotName()
+		case p.peek() == '[':
+			s.sel, err = p.bracket()
+		default:
+			return steps, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, s)
+	}
+}
+
+// dotName parses the name or wildcard following a dot.
+func (p *parser) dotName() (selector, error) {
+	if p.consume("*") {
+		return wildcardSelector{}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.expr) && isNameByte(p.expr[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a name")
+	}
+	return nameSelector{p.expr[start:p.pos]}, nil
+}
+
+// isNameByte reports whether c may appear in a name following a dot. Keys
+// of configurations often contain dashes, which are allowed.
+func isNameByte(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// bracket parses a selector in brackets.
+func (p *parser) bracket() (selector, error) {
+	p.consume("[")
+	p.skipSpace()
+	var sel selector
+	var err error
+	switch c := p.peek(); {
+	case p.consume("*"):
+		sel = wildcardSelector{}
+	case p.consume("?"):
+		sel, err = p.filterSelector()
+	case c == '\'' || c == '"':
+		sel, err = p.names()
+	default:
+		sel, err = p.indexes()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume("]") {
+		return nil, p.errorf("expected ]")
+	}
+	return sel, nil
+}
+
+// names parses a list of quoted names.
+func (p *parser) names() (selector, error) {
+	var names nameSelector
+	for {
+		name, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		p.skipSpace()
+		if !p.consume(",") {
+			return names, nil
+		}
+		p.skipSpace()
+	}
+}
+
+// quoted parses a string in single or double quotes.
+func (p *parser) quoted() (string, error) {
+	quote := p.peek()
+	if quote != '\'' && quote != '"' {
+		return "", p.errorf("expected a quoted string")
+	}
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.expr) {
+		c := p.expr[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.expr):
+			c = p.expr[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// integer parses an optionally negative integer, reporting false if there
+// is none.
+func (p *parser) integer() (int, bool, error) {
+	start := p.pos
+	p.consume("-")
+	for p.pos < len(p.expr) && p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false, nil
+	}
+	i, err := strconv.Atoi(p.expr[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return 0, false, p.errorf("invalid index %q", p.expr[start:p.pos])
+	}
+	return i, true, nil
+}
+
+// indexes parses a list of indexes or a slice.
+func (p *parser) indexes() (selector, error) {
+	first, ok, err := p.integer()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() == ':' {
+		var s sliceSelector
+		if ok {
+			s.start = &first
+		}
+		return p.slice(s)
+	}
+	if !ok {
+		return nil, p.errorf("expected an index, a name, * or ?")
+	}
+	indexes := indexSelector{first}
+	for p.consume(",") {
+		p.skipSpace()
+		i, ok, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, p.errorf("expected an index")
+		}
+		indexes = append(indexes, i)
+		p.skipSpace()
+	}
+	return indexes, nil
+}
+
+// slice parses the end and step of a slice, after its start.
+func (p *parser) slice(s sliceSelector) (selector, error) {
+	s.step = 1
+	p.consume(":")
+	p.skipSpace()
+	end, ok, err := p.integer()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		s.end = &end
+	}
+	p.skipSpace()
+	if p.consume(":") {
+		p.skipSpace()
+		step, ok, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			s.step = step
+		}
+	}
+	return s, nil
+}
+
+// filterSelector parses a filter, after the question mark.
+func (p *parser) filterSelector() (selector, error) {
+	p.skipSpace()
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	return filterSelector{filter: f}, nil
+}
+
+func (p *parser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("||") {
+			return left, nil
+		}
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+}
+
+func (p *parser) and() (filter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("&&") {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+}
+
+func (p *parser) unary() (filter, error) {
+	p.skipSpace()
+	if p.peek() == '!' && !strings.HasPrefix(p.expr[p.pos:], "!=") {
+		p.pos++
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{f}, nil
+	}
+	if p.consume("(") {
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return f, nil
+	}
+	return p.comparison()
+}
+
+// comparisonOps are the comparison operators, longest first.
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *parser) comparison() (filter, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	for _, op := range comparisonOps {
+		if !p.consume(op) {
+			continue
+		}
+		p.skipSpace()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return compareFilter{op: op, left: left, right: right}, nil
+	}
+	path, ok := left.(pathOperand)
+	if !ok {
+		return nil, p.errorf("expected a comparison")
+	}
+	return existsFilter{path}, nil
+}
+
+func (p *parser) operand() (operand, error) {
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		steps, err := p.steps()
+		if err != nil {
+			return nil, err
+		}
+		return pathOperand{root: c == '$', steps: steps}, nil
+	case c == '\'' || c == '"':
+		s, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return literal{s}, nil
+	case p.consume("true"):
+		return literal{true}, nil
+	case p.consume("false"):
+		return literal{false}, nil
+	case p.consume("null"):
+		return literal{nil}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.expr) && strings.IndexByte("+-.0123456789eE", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a path or a literal")
+	}
+	text := p.expr[start:p.pos]
+	if i, err := strconv.Atoi(text); err == nil {
+		return literal{i}, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return literal{f}, nil
+}
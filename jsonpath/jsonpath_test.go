@@ -0,0 +1,87 @@
+package jsonpath
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hypedn/mflag"
+)
+
+func TestQueryReader(t *testing.T) {
+	cfg := mflag.Build().
+		Set("servers", []interface{}{
+			map[string]interface{}{"host": "eu-1", "region": "eu", "port": 443, "tls": true},
+			map[string]interface{}{"host": "us-1", "region": "us", "port": 8080},
+			map[string]interface{}{"host": "eu-2", "region": "eu", "port": 8443},
+		}).
+		Set("db.primary.host", "db-1").
+		Set("db.replica.host", "db-2").
+		Set("default_region", "eu").
+		Reader()
+
+	tests := []struct {
+		expr string
+		want []interface{}
+	}{
+		{"$.servers[?(@.region=='eu')].host", []interface{}{"eu-1", "eu-2"}},
+		{"$.servers[?(@.region == $.default_region && @.port > 1000)].host", []interface{}{"eu-2"}},
+		{"$.servers[?(@.tls)].host", []interface{}{"eu-1"}},
+		{"$.servers[?(!@.tls || @.port < 500)].host", []interface{}{"eu-1", "us-1", "eu-2"}},
+		{"$.servers[-1].host", []interface{}{"eu-2"}},
+		{"$.servers[0,2].port", []interface{}{443, 8443}},
+		{"$.servers[:2].host", []interface{}{"eu-1", "us-1"}},
+		{"$.servers[::-1].host", []interface{}{"eu-2", "us-1", "eu-1"}},
+		{"$.db.*.host", []interface{}{"db-1", "db-2"}},
+		{"$['db']['replica', 'primary'].host", []interface{}{"db-2", "db-1"}},
+		{"$..host", []interface{}{"db-1", "db-2", "eu-1", "us-1", "eu-2"}},
+		{"$.missing", nil},
+	}
+	for _, tt := range tests {
+		got, err := QueryReader(cfg, tt.expr)
+		if err != nil {
+			t.Errorf("QueryReader(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QueryReader(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"servers",
+		"$.",
+		"$.servers[",
+		"$.servers[?(@.region == )]",
+		"$.servers[?(@.region == 'eu']",
+		"$['unterminated]",
+		"$.servers[?('eu')]",
+		"$.servers junk",
+	} {
+		if _, err := Compile(expr); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Compile(%q) = %v, want ErrInvalidPath", expr, err)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	mflag.Reset()
+	t.Cleanup(mflag.Reset)
+	mflag.SetDefault("servers.eu.host", "eu.example.com")
+	mflag.SetDefault("servers.us.host", "us.example.com")
+	os.Args = []string{"test", "--servers-us-host=us-1.example.com"}
+	if err := mflag.ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	got, err := Query("$.servers.*.host")
+	if err != nil {
+		t.Fatalf("Query() failed: %v", err)
+	}
+	if want := []interface{}{"eu.example.com", "us-1.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Query() = %v, want %v", got, want)
+	}
+}
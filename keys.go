@@ -0,0 +1,230 @@
+package mflag
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"slices"
+	"strings"
+)
+
+// listConfigKeysFlagName is the name of the built-in flag listing the keys.
+const listConfigKeysFlagName = "list-config-keys"
+
+// listConfigKeysEnabled reports whether EnableListConfigKeys was called.
+var listConfigKeysEnabled = false
+
+// KeyInfo describes a declared configuration key.
+type KeyInfo struct {
+	Key         string      `json:"key"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required"`
+	Secret      bool        `json:"secret,omitempty"`
+	Allowed     []string    `json:"allowed,omitempty"`
+	Env         string      `json:"env,omitempty"`
+	Flag        string      `json:"flag"`
+}
+
+// Describe sets the description of a key, shown in the help message and
+// returned by Keys.
+// It should be called before Parse.
+func Describe(key, description string) {
+	specFor(key).description = description
+}
+
+// Keys returns the declared keys, sorted: keys with a default, and keys
+// declared with Register, DeclareKey, MarkRequired, SetDefaultEnum or
+// Describe.
+// Defaults of secret keys are masked. It lets tooling and documentation
+// generators introspect the configuration an application accepts.
+func Keys() []KeyInfo {
+	keys := defaults.AllKeys()
+	for key := range defaultFuncs {
+		keys = append(keys, key)
+	}
+	for key, s := range specs {
+		if s.registered || s.typ != 0 || s.required || len(s.allowed) > 0 || s.description != "" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	infos := make([]KeyInfo, 0, len(keys))
+	for _, key := range keys {
+		info := KeyInfo{
+			Key:     key,
+			Type:    keyType(key).String(),
+			Default: defaults.Get(key),
+			Secret:  isSecret(key),
+			Flag:    flagNameMapper(key),
+		}
+		if s, ok := specs[key]; ok {
+			info.Description = s.description
+			info.Required = s.required
+			info.Allowed = slices.Clone(s.allowed)
+		}
+		if names := envNames(key); len(names) > 0 {
+			info.Env = names[0]
+		}
+		if boundFlags[key] {
+			info.Flag = key
+		}
+		if info.Secret && info.Default != nil {
+			info.Default = secretMask
+		}
+		if d, ok := info.Default.(interface{ String() string }); ok {
+			info.Default = d.String()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// BindAll binds every declared key to a flag and to an environment variable
+// named after prefix, as SetEnvPrefix does, and returns the keys with the
+// names generated for them, so that a 12-factor service can declare its
+// settings once and log or document how each one is set:
+//
+//	mflag.SetDefault("db.host", "localhost")
+//	mflag.MarkRequired("db.password")
+//	for _, k := range mflag.BindAll("APP") {
+//		log.Printf("%s: $%s, --%s", k.Key, k.Env, k.Flag)
+//	}
+//
+// Keys without a default or a declared type, such as keys only marked
+// required, are declared as strings so that they get a flag and a
+// variable too. Keys declared after BindAll get a variable as well.
+// It should be called before Parse.
+func BindAll(prefix string) []KeyInfo {
+	SetEnvPrefix(prefix)
+	for _, info := range Keys() {
+		if _, ok := defaultFuncs[info.Key]; ok || info.Default != nil {
+			continue
+		}
+		if s := specFor(info.Key); s.typ == 0 {
+			s.typ = String
+		}
+	}
+	return Keys()
+}
+
+// EnableListConfigKeys registers a built-in --list-config-keys flag which
+// prints the keys returned by Keys as JSON and exits.
+// It should be called before Parse.
+func EnableListConfigKeys() {
+	listConfigKeysEnabled = true
+}
+
+// registerListConfigKeysFlag adds the --list-config-keys flag to fs if
+// enabled.
+func registerListConfigKeysFlag(fs *flag.FlagSet) *bool {
+	if !listConfigKeysEnabled || fs.Lookup(listConfigKeysFlagName) != nil {
+		return nil
+	}
+	builtinFlags[listConfigKeysFlagName] = true
+	return fs.Bool(listConfigKeysFlagName, false, "print the configuration keys as JSON and exit")
+}
+
+// printKeys writes the keys returned by Keys to w as indented JSON.
+func printKeys(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Keys())
+}
+
+// KeysOption filters or extends the keys returned by AllKeys and
+// AllKeyInfos.
+type KeysOption func(*keysOptions)
+
+type keysOptions struct {
+	sections bool
+	prefix   string
+}
+
+// WithSections includes the keys holding maps, such as "database" besides
+// "database.host", each listed before the keys below it. Empty maps are
+// included too.
+func WithSections() KeysOption {
+	return func(o *keysOptions) {
+		o.sections = true
+	}
+}
+
+// WithPrefix keeps the keys starting with prefix only, as KeysWithPrefix
+// does.
+func WithPrefix(prefix string) KeysOption {
+	return func(o *keysOptions) {
+		o.prefix = prefix
+	}
+}
+
+// ValueInfo describes a key of the merged configuration, as returned by
+// AllKeyInfos.
+type ValueInfo struct {
+	Key    string      `json:"key"`
+	Type   string      `json:"type"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// AllKeyInfos returns the keys of the merged configuration as AllKeys does,
+// with their type, their value and the layer it comes from: "set", "flag",
+// "env", "file", "remote", "default" or the name of a layer added with
+// AddLayer.
+// Values of secret keys are masked.
+// Must be called after Parse.
+func AllKeyInfos(opts ...KeysOption) []ValueInfo {
+	keys := AllKeys(opts...)
+	infos := make([]ValueInfo, 0, len(keys))
+	for _, key := range keys {
+		info := ValueInfo{
+			Key:    key,
+			Type:   keyType(key).String(),
+			Value:  finalConfig.Get(key),
+			Source: sourceOf(key),
+		}
+		if isSecret(key) && info.Value != nil {
+			info.Value = secretMask
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// selectKeys returns the keys of m selected by opts, ordered so that the
+// keys below a section follow it.
+func selectKeys(m *mapManager, opts []KeysOption) []string {
+	var o keysOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var keys []string
+	if o.sections {
+		collectSectionKeys("", m.data, &keys)
+	} else {
+		collectKeys("", m.data, &keys)
+	}
+	if o.prefix != "" {
+		keys = slices.DeleteFunc(keys, func(key string) bool {
+			return !strings.HasPrefix(key, o.prefix)
+		})
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return slices.Compare(strings.Split(a, "."), strings.Split(b, "."))
+	})
+	return keys
+}
+
+// collectSectionKeys is collectKeys also adding the keys holding maps.
+func collectSectionKeys(prefix string, data map[string]interface{}, keys *[]string) {
+	for key, value := range data {
+		fullKey := joinKey(prefix, key)
+		*keys = append(*keys, fullKey)
+		if nested, ok := value.(map[string]interface{}); ok {
+			collectSectionKeys(fullKey, nested, keys)
+		}
+	}
+}
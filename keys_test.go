@@ -0,0 +1,126 @@
+package mflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	testReset(t)
+	SetDefault("server.port", 8080)
+	SetDefault("timeout", 5*time.Second)
+	SetDefault("db.password", "hunter2")
+	MarkSecret("db.password")
+	SetDefaultEnum("level", "info", "debug", "info")
+	DeclareKey("token", String)
+	MarkRequired("token")
+	Describe("server.port", "port to listen on")
+
+	want := []KeyInfo{
+		{Key: "db.password", Type: "string", Default: secretMask, Secret: true, Flag: "db-password"},
+		{Key: "level", Type: "string", Default: "info", Allowed: []string{"debug", "info"}, Flag: "level"},
+		{Key: "server.port", Type: "int", Default: 8080, Description: "port to listen on", Flag: "server-port"},
+		{Key: "timeout", Type: "duration", Default: "5s", Flag: "timeout"},
+		{Key: "token", Type: "string", Required: true, Flag: "token"},
+	}
+	if got := Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestListConfigKeysFlag(t *testing.T) {
+	testReset(t)
+	var buf bytes.Buffer
+	stdout = &buf
+	EnableListConfigKeys()
+	SetDefault("port", 8080)
+	Describe("port", "port to listen on")
+	os.Args = []string{"test", "--list-config-keys"}
+
+	if err := ParseWithError(); !errors.Is(err, ErrExitRequested) {
+		t.Fatalf("Expected ErrExitRequested, got: %v", err)
+	}
+	var keys []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &keys); err != nil {
+		t.Fatalf("Expected JSON output, got %v:\n%s", err, buf.String())
+	}
+	if len(keys) != 1 || keys[0]["key"] != "port" || keys[0]["default"] != float64(8080) || keys[0]["required"] != false {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	if got := usageFor("port"); got != "port to listen on" {
+		t.Errorf("Expected the description as the usage of the flag, got %q", got)
+	}
+}
+
+func TestBindAll(t *testing.T) {
+	testReset(t)
+	SetDefault("db.host", "localhost")
+	SetDefault("db.max_conns", 10)
+	MarkRequired("db.password")
+	MarkSecret("db.password")
+
+	want := []KeyInfo{
+		{Key: "db.host", Type: "string", Default: "localhost", Env: "APP_DB_HOST", Flag: "db-host"},
+		{Key: "db.max_conns", Type: "int", Default: 10, Env: "APP_DB_MAX_CONNS", Flag: "db-max-conns"},
+		{Key: "db.password", Type: "string", Required: true, Secret: true, Env: "APP_DB_PASSWORD", Flag: "db-password"},
+	}
+	if got := BindAll("APP"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("BindAll() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	t.Setenv("APP_DB_PASSWORD", "hunter2")
+	t.Setenv("APP_DB_HOST", "db.internal")
+	os.Args = []string{"test", "--db-max-conns=20"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() = %v", err)
+	}
+	tests := map[string]interface{}{
+		"db.host":      "db.internal",
+		"db.max_conns": 20,
+		"db.password":  "hunter2",
+	}
+	for key, want := range tests {
+		if got := finalConfig.Get(key); got != want {
+			t.Errorf("%q = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestAllKeys_Options(t *testing.T) {
+	testReset(t)
+	SetDefault("db.host", "localhost")
+	SetDefault("db.password", "hunter2")
+	SetDefault("db-pool.size", 10)
+	SetDefault("labels", map[string]interface{}{})
+	MarkSecret("db.password")
+	t.Setenv("TEST_MFLAG_DB_HOST", "db.internal")
+	BindEnv("db.host", "TEST_MFLAG_DB_HOST")
+	os.Args = []string{"test", "--db-pool-size=20"}
+	Parse()
+
+	if got, want := AllKeys(), []string{"db.host", "db.password", "db-pool.size"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllKeys() = %v, want %v", got, want)
+	}
+	want := []string{"db", "db.host", "db.password", "db-pool", "db-pool.size", "labels"}
+	if got := AllKeys(WithSections()); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllKeys(WithSections()) = %v, want %v", got, want)
+	}
+	if got, want := AllKeys(WithPrefix("db.")), []string{"db.host", "db.password"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllKeys(WithPrefix()) = %v, want %v", got, want)
+	}
+
+	wantInfos := []ValueInfo{
+		{Key: "db.host", Type: "string", Value: "db.internal", Source: "env"},
+		{Key: "db.password", Type: "string", Value: secretMask, Source: "default"},
+		{Key: "db-pool.size", Type: "int", Value: 20, Source: "flag"},
+	}
+	if got := AllKeyInfos(); !reflect.DeepEqual(got, wantInfos) {
+		t.Errorf("AllKeyInfos() =\n%+v\nwant\n%+v", got, wantInfos)
+	}
+}
@@ -0,0 +1,285 @@
+// Package kubernetes provides mflag providers reading a ConfigMap or a Secret
+// through the Kubernetes API, for workloads that cannot mount them as files.
+// It authenticates with the service account of the pod it runs in, or uses
+// the client given with WithClient.
+//
+//	err := mflag.InitContext(ctx, kubernetes.ConfigMap("app", kubernetes.WithKey("config.yaml")))
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hypedn/mflag"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// namespaceFile is where Kubernetes mounts the namespace of the pod.
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Provider reads a ConfigMap or a Secret. It implements mflag.Provider.
+type Provider struct {
+	kind      string // "configmaps" or "secrets"
+	name      string
+	namespace string
+	key       string
+
+	// client is set from the in-cluster configuration when the provider
+	// is first used, unless given with WithClient.
+	client    k8s.Interface
+	setupOnce sync.Once
+	setupErr  error
+
+	mu              sync.Mutex
+	resourceVersion string
+}
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithNamespace reads the object from namespace rather than from the
+// namespace of the pod.
+func WithNamespace(namespace string) Option {
+	return func(p *Provider) {
+		p.namespace = namespace
+	}
+}
+
+// WithKey reads the configuration from the entry key of the object, holding
+// a YAML or JSON document. By default every entry of the object is a
+// configuration key, with dots in entry names denoting nesting.
+func WithKey(key string) Option {
+	return func(p *Provider) {
+		p.key = key
+	}
+}
+
+// WithClient reads the object with client rather than with a client for
+// the in-cluster configuration, for programs running outside the cluster
+// with a client built from a kubeconfig file. WithNamespace must be given
+// too outside a pod.
+func WithClient(client k8s.Interface) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// ConfigMap returns a provider reading the ConfigMap name.
+func ConfigMap(name string, opts ...Option) *Provider {
+	return newProvider("configmaps", name, opts)
+}
+
+// Secret returns a provider reading the Secret name. The service account
+// needs permission to get, and to watch for Watch, the Secret.
+func Secret(name string, opts ...Option) *Provider {
+	return newProvider("secrets", name, opts)
+}
+
+func newProvider(kind, name string, opts []Option) *Provider {
+	p := &Provider{kind: kind, name: name}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// setup creates the client for the in-cluster configuration and finds the
+// namespace of the pod, unless given.
+func (p *Provider) setup() error {
+	p.setupOnce.Do(func() {
+		if p.client == nil {
+			cfg, err := rest.InClusterConfig()
+			if err != nil {
+				p.setupErr = fmt.Errorf("kubernetes: %w", err)
+				return
+			}
+			if p.client, err = k8s.NewForConfig(cfg); err != nil {
+				p.setupErr = fmt.Errorf("kubernetes: %w", err)
+				return
+			}
+		}
+		if p.namespace == "" {
+			namespace, err := os.ReadFile(namespaceFile)
+			if err != nil {
+				p.setupErr = fmt.Errorf("kubernetes: no namespace given with WithNamespace: %w", err)
+				return
+			}
+			p.namespace = strings.TrimSpace(string(namespace))
+		}
+	})
+	return p.setupErr
+}
+
+// Load reads the object and returns its entries as configuration values.
+func (p *Provider) Load(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.setup(); err != nil {
+		return nil, err
+	}
+	entries, version, err := p.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: reading %s: %w", p, err)
+	}
+	p.mu.Lock()
+	p.resourceVersion = version
+	p.mu.Unlock()
+	return p.values(entries)
+}
+
+// get returns the entries and the resource version of the object.
+func (p *Provider) get(ctx context.Context) (map[string]string, string, error) {
+	entries := make(map[string]string)
+	if p.kind == "secrets" {
+		s, err := p.client.CoreV1().Secrets(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", err
+		}
+		for name, value := range s.Data {
+			entries[name] = string(value)
+		}
+		return entries, s.ResourceVersion, nil
+	}
+	cm, err := p.client.CoreV1().ConfigMaps(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	for name, value := range cm.Data {
+		entries[name] = value
+	}
+	for name, value := range cm.BinaryData {
+		entries[name] = string(value)
+	}
+	return entries, cm.ResourceVersion, nil
+}
+
+// values converts the entries of the object to configuration values.
+func (p *Provider) values(entries map[string]string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if p.key != "" {
+		doc, ok := entries[p.key]
+		if !ok {
+			return nil, fmt.Errorf("kubernetes: %s has no entry %q", p, p.key)
+		}
+		if err := yaml.Unmarshal([]byte(doc), &values); err != nil {
+			return nil, fmt.Errorf("kubernetes: parsing entry %q of %s: %w", p.key, p, err)
+		}
+		return values, nil
+	}
+	for name, value := range entries {
+		mflag.SetPath(values, strings.Split(name, "."), value)
+	}
+	return values, nil
+}
+
+// Watch watches the object and sends an update whenever it changes, or an
+// error when watching fails, until ctx is done. It implements
+// mflag.Watcher. Updates arriving faster than they are received are
+// coalesced. Load should be called first, so that changes are reported
+// relative to the values it returned.
+func (p *Provider) Watch(ctx context.Context) <-chan mflag.Update {
+	updates := make(chan mflag.Update, 1)
+	send := func(u mflag.Update) {
+		select {
+		case updates <- u:
+		default:
+		}
+	}
+	go func() {
+		defer close(updates)
+		wait := time.Second
+		for ctx.Err() == nil {
+			err := p.watch(ctx, send)
+			if err == nil {
+				wait = time.Second
+				continue
+			}
+			if !errors.Is(err, errExpired) && ctx.Err() == nil {
+				send(mflag.Update{Err: err})
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+			wait = min(2*wait, time.Minute)
+		}
+	}()
+	return updates
+}
+
+// errExpired reports that the resource version being watched is too old.
+var errExpired = errors.New("kubernetes: resource version expired")
+
+// watch runs a single watch request, which the API server ends after a
+// while, and reports changes to send.
+func (p *Provider) watch(ctx context.Context, send func(mflag.Update)) error {
+	if err := p.setup(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	opts := metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", p.name).String(),
+		ResourceVersion: p.resourceVersion,
+	}
+	p.mu.Unlock()
+	var w watch.Interface
+	var err error
+	if p.kind == "secrets" {
+		w, err = p.client.CoreV1().Secrets(p.namespace).Watch(ctx, opts)
+	} else {
+		w, err = p.client.CoreV1().ConfigMaps(p.namespace).Watch(ctx, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("kubernetes: watching %s: %w", p, err)
+	}
+	defer w.Stop()
+
+	for {
+		var ev watch.Event
+		var ok bool
+		select {
+		case ev, ok = <-w.ResultChan():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok {
+			return ctx.Err()
+		}
+		switch ev.Type {
+		case watch.Added, watch.Modified, watch.Deleted:
+			if obj, ok := ev.Object.(metav1.Object); ok {
+				p.mu.Lock()
+				p.resourceVersion = obj.GetResourceVersion()
+				p.mu.Unlock()
+			}
+			send(mflag.Update{})
+		case watch.Error:
+			// The only error expected on a watch is 410 Gone for an
+			// expired resource version: start over from the current one,
+			// reporting a change since some may have been missed.
+			p.mu.Lock()
+			p.resourceVersion = ""
+			p.mu.Unlock()
+			send(mflag.Update{})
+			return errExpired
+		}
+	}
+}
+
+// String returns the kind, namespace and name of the object.
+func (p *Provider) String() string {
+	kind := "ConfigMap"
+	if p.kind == "secrets" {
+		kind = "Secret"
+	}
+	return fmt.Sprintf("%s %s/%s", kind, p.namespace, p.name)
+}
@@ -0,0 +1,124 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hypedn/mflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ mflag.Watcher = (*Provider)(nil)
+
+func meta(name, version string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: "default", ResourceVersion: version}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   func(string, ...Option) *Provider
+		opts   []Option
+		object runtime.Object
+		want   map[string]interface{}
+	}{
+		{
+			name: "configmap entries",
+			kind: ConfigMap,
+			object: &corev1.ConfigMap{
+				ObjectMeta: meta("app", "1"),
+				Data:       map[string]string{"port": "8080", "database.host": "db"},
+				BinaryData: map[string][]byte{"blob": []byte("hi")},
+			},
+			want: map[string]interface{}{
+				"port":     "8080",
+				"database": map[string]interface{}{"host": "db"},
+				"blob":     "hi",
+			},
+		},
+		{
+			name: "configmap document",
+			kind: ConfigMap,
+			opts: []Option{WithKey("config.yaml")},
+			object: &corev1.ConfigMap{
+				ObjectMeta: meta("app", "1"),
+				Data:       map[string]string{"config.yaml": "port: 8080\nfeatures: [a]\n"},
+			},
+			want: map[string]interface{}{"port": 8080, "features": []interface{}{"a"}},
+		},
+		{
+			name: "secret",
+			kind: Secret,
+			object: &corev1.Secret{
+				ObjectMeta: meta("creds", "1"),
+				Data:       map[string][]byte{"password": []byte("hunter2")},
+			},
+			want: map[string]interface{}{"password": "hunter2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.object.(metav1.Object).GetName()
+			opts := append([]Option{WithClient(fake.NewClientset(tt.object)), WithNamespace("default")}, tt.opts...)
+			got, err := tt.kind(name, opts...).Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	client := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: meta("app", "1"),
+		Data:       map[string]string{"other": "x"},
+	})
+	p := ConfigMap("app", WithClient(client), WithNamespace("default"), WithKey("config.yaml"))
+	if _, err := p.Load(context.Background()); err == nil {
+		t.Error("Expected an error for a missing entry")
+	}
+	p.name = "missing"
+	if _, err := p.Load(context.Background()); err == nil {
+		t.Error("Expected an error for a missing object")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	client := fake.NewClientset(&corev1.ConfigMap{ObjectMeta: meta("app", "1")})
+	versions := make(chan string, 10)
+	client.PrependWatchReactor("configmaps", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		opts := action.(k8stesting.WatchActionImpl).ListOptions
+		versions <- opts.ResourceVersion
+		w := watch.NewFake()
+		go w.Modify(&corev1.ConfigMap{ObjectMeta: meta("app", "2")})
+		return true, w, nil
+	})
+	p := ConfigMap("app", WithClient(client), WithNamespace("default"))
+	if _, err := p.Load(context.Background()); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := p.Watch(ctx)
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change to be reported")
+	}
+	if v := <-versions; v != "1" {
+		t.Errorf("Expected the watch to start at the loaded version, got %q", v)
+	}
+	cancel()
+	for range changes {
+	}
+}
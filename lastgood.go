@@ -0,0 +1,161 @@
+package mflag
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// lastGoodFile is the name of the snapshot written by
+// WithFallbackToLastGood.
+const lastGoodFile = "last-good.yaml"
+
+// lastKnownGood is the state of WithFallbackToLastGood, nil while disabled.
+var lastKnownGood *lastKnownGoodState
+
+type lastKnownGoodState struct {
+	path       string
+	onFallback func(error)
+	// inUse reports whether the current configuration came from the
+	// snapshot, which must then not be saved over itself.
+	inUse bool
+	// cause is the error that made the configuration fall back to the
+	// snapshot while in use.
+	cause error
+}
+
+// WithFallbackToLastGood makes mflag keep the last good configuration in a
+// snapshot in dir, and fall back to it when a bad configuration is rolled
+// out or its source is unavailable, so that the application keeps running
+// rather than starting with defaults only. Each provider needs its own dir.
+//
+// The snapshot holds the effective configuration of the last successful
+// Parse, or applied Reload: defaults, configuration source, environment
+// and flags merged, with file references and encrypted values resolved. It
+// is only readable by its owner. The values of secret keys are only saved
+// encrypted with the key set with SetSnapshotKey: without a key,
+// configurations holding any are not saved.
+//
+// mflag falls back to the snapshot when InitContext fails to load p, which
+// then returns an error wrapping ErrStaleConfig and the cause of the
+// failure, and when the merged configuration fails validation in Parse. The
+// snapshot then replaces the values of the configuration source, under the
+// environment and the flags of the current run. See OnFallback to be told
+// about every fallback.
+func WithFallbackToLastGood(dir string) InitOption {
+	return func(o *initOptions) {
+		o.lastGoodDir = dir
+	}
+}
+
+// OnFallback makes mflag call fn with the error wrapping ErrStaleConfig
+// every time it falls back to the snapshot of WithFallbackToLastGood,
+// including when Parse does so for a configuration failing validation.
+func OnFallback(fn func(error)) InitOption {
+	return func(o *initOptions) {
+		o.onFallback = fn
+	}
+}
+
+// enableLastKnownGood sets up the snapshot for the options of InitContext,
+// disabling it if they do not ask for one.
+func enableLastKnownGood(o initOptions) {
+	lastKnownGood = nil
+	if o.lastGoodDir != "" {
+		lastKnownGood = &lastKnownGoodState{path: filepath.Join(o.lastGoodDir, lastGoodFile), onFallback: o.onFallback}
+	}
+}
+
+// loadLastKnownGood loads the snapshot into the config layer in place of a
+// configuration that failed to load with cause. It returns cause if there
+// is no usable snapshot, and an error wrapping ErrStaleConfig otherwise.
+func loadLastKnownGood(cause error) error {
+	if lastKnownGood == nil {
+		return cause
+	}
+	snapshot, err := readSnapshot(lastKnownGood.path)
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	setConfig(snapshot)
+	return lastKnownGood.use(cause)
+}
+
+// parseLastKnownGood merges the snapshot in place of the configuration
+// source values that made the merged configuration invalid with cause, and
+// validates the result. It returns cause if there is no usable snapshot or
+// if it does not help.
+func parseLastKnownGood(cause error) error {
+	if lastKnownGood == nil || lastKnownGood.inUse {
+		return cause
+	}
+	snapshot, err := readSnapshot(lastKnownGood.path)
+	if err != nil {
+		return cause
+	}
+
+	previous := config.data
+	setConfig(snapshot)
+	finalConfig = mergeLayers(config, flagConfig)
+	if err := resolveValues(finalConfig, config); err == nil {
+		err = validate(finalConfig)
+	}
+	if err != nil {
+		setConfig(previous)
+		return errors.Join(cause, fmt.Errorf("last known good configuration: %w", err))
+	}
+	finalConfig.buildIndex()
+	lastKnownGood.use(cause)
+	return nil
+}
+
+// saveLastKnownGood saves m, the effective configuration after a
+// successful Parse or an applied Reload. Saving is best effort: failing to
+// do so must not prevent the application from running.
+func saveLastKnownGood(m *mapManager) {
+	if lastKnownGood == nil || lastKnownGood.inUse {
+		return
+	}
+	_ = writeSnapshot(lastKnownGood.path, sealSecrets(m))
+}
+
+// sealSecrets returns the values of m with those of its secret keys that
+// are set turned back into Secret values, so that writeSnapshot saves them
+// as secrets. The maps and lists holding them are copied.
+func sealSecrets(m *mapManager) map[string]interface{} {
+	sealed, _ := replaceLeaves(m.data, "", func(key string, v interface{}) (interface{}, bool) {
+		if s, ok := v.(string); ok && s != "" && m.isSecret(key) {
+			return NewSecret(s), true
+		}
+		return v, false
+	})
+	return sealed.(map[string]interface{})
+}
+
+// leaveLastKnownGood records that the configuration no longer comes from
+// the snapshot, after a successful Reload.
+func leaveLastKnownGood() {
+	if lastKnownGood != nil {
+		lastKnownGood.inUse, lastKnownGood.cause = false, nil
+	}
+}
+
+// use records that the snapshot replaced a configuration that failed with
+// cause, reports it and returns the error reported.
+func (s *lastKnownGoodState) use(cause error) error {
+	err := fmt.Errorf("%w: %w", ErrStaleConfig, cause)
+	s.inUse, s.cause = true, err
+	if s.onFallback != nil {
+		s.onFallback(err)
+	}
+	return err
+}
+
+// lastKnownGoodCause returns the error that made the configuration fall
+// back to the snapshot, or nil if the snapshot is not in use.
+func lastKnownGoodCause() error {
+	if lastKnownGood == nil || !lastKnownGood.inUse {
+		return nil
+	}
+	return lastKnownGood.cause
+}
@@ -0,0 +1,117 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLastKnownGood(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	var reported []error
+	setup := func(content string) error {
+		testReset(t)
+		SetDefault("pool.size", 10)
+		MarkRequired("db.host")
+		return InitContext(context.Background(), File(createTempYAML(t, content)),
+			WithFallbackToLastGood(dir), OnFallback(func(err error) { reported = append(reported, err) }))
+	}
+
+	// A good configuration is saved once Parse succeeds.
+	if err := setup("db:\n  host: primary\npool:\n  size: 50\n"); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	// The snapshot holds the effective configuration.
+	saved, err := readSnapshot(filepath.Join(dir, lastGoodFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := newSection("", saved); got.GetString("db.host") != "primary" || got.GetInt("pool.size") != 50 {
+		t.Errorf("Expected the effective configuration to be saved, got %v", saved)
+	}
+
+	// Invalid YAML falls back to the snapshot.
+	if err := setup("db: [unclosed\n"); !errors.Is(err, ErrStaleConfig) || !errors.Is(err, ErrInitFailed) {
+		t.Fatalf("Expected InitContext() to fall back, got %v", err)
+	}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if GetString("db.host") != "primary" || GetInt("pool.size") != 50 {
+		t.Errorf("Expected the snapshot values, got %v", finalConfig.data)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrStaleConfig) || !errors.Is(reported[0], ErrInitFailed) {
+		t.Errorf("Expected the InitContext failure to be reported, got %v", reported)
+	}
+
+	// A configuration failing validation falls back too, under flags.
+	reported = nil
+	if err := setup("pool:\n  size: 5\n"); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--pool-size=7"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("Expected ParseWithError() to fall back, got %v", err)
+	}
+	if GetString("db.host") != "primary" || GetInt("pool.size") != 7 {
+		t.Errorf("Expected the snapshot to replace the invalid configuration, got %v", finalConfig.data)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrStaleConfig) || !errors.Is(reported[0], ErrMissingKey) {
+		t.Errorf("Expected the validation failure to be reported, got %v", reported)
+	}
+}
+
+func TestLastKnownGood_ValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	setup := func(content string) error {
+		testReset(t)
+		EnableValidateConfig()
+		MarkRequired("db.host")
+		return InitContext(context.Background(), File(createTempYAML(t, content)), WithFallbackToLastGood(dir))
+	}
+	if err := setup("db:\n  host: primary\n"); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	// The snapshot does not make an invalid configuration pass.
+	if err := setup("port: 1\n"); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--validate-config"}
+	if err := ParseWithError(); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("Expected ErrMissingKey, got %v", err)
+	}
+	if err := setup("db: [unclosed\n"); !errors.Is(err, ErrStaleConfig) {
+		t.Fatalf("Expected InitContext() to fall back, got %v", err)
+	}
+	os.Args = []string{"test", "--validate-config"}
+	if err := ParseWithError(); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected the Init failure, got %v", err)
+	}
+
+	// Loading the configuration again stops using the snapshot.
+	if err := InitContext(context.Background(), File(createTempYAML(t, "db:\n  host: replica\n")), WithFallbackToLastGood(dir)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	saved, err := readSnapshot(filepath.Join(dir, lastGoodFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved["db"]; got == nil || got.(map[string]interface{})["host"] != "replica" {
+		t.Errorf("Expected the new configuration to be saved, got %v", saved)
+	}
+}
@@ -0,0 +1,149 @@
+package mflag
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Names of the built-in layers.
+const (
+	defaultsLayer = "defaults"
+	fileLayer     = "file"
+	envLayer      = "env"
+	flagsLayer    = "flags"
+)
+
+var (
+	// layerOrder holds the names of the layers from lowest to highest
+	// precedence.
+	layerOrder = []string{defaultsLayer, fileLayer, envLayer, flagsLayer}
+	// layers holds the values of the layers added with AddLayer.
+	layers = make(map[string]*mapManager)
+)
+
+// LayerOption configures where AddLayer inserts a layer.
+type LayerOption func(*layerOptions)
+
+type layerOptions struct {
+	above, below string
+}
+
+// Above inserts the layer directly above the layer name, so that it takes
+// precedence over name.
+func Above(name string) LayerOption {
+	return func(o *layerOptions) {
+		o.above = name
+	}
+}
+
+// Below inserts the layer directly below the layer name, so that name takes
+// precedence over it.
+func Below(name string) LayerOption {
+	return func(o *layerOptions) {
+		o.below = name
+	}
+}
+
+// AddLayer loads the values of p into a new layer called name, such as
+// "file:base" for shared settings below the config file of an environment.
+// The layers are merged in order of precedence, starting with the built-in
+// "defaults" layer, followed by the "file" layer loaded by Init and the "env"
+// layer of the variables bound with Env, and ending with the "flags" layer
+// of the command line. Unless placed with Above or Below, a layer is
+// inserted directly below "flags", taking precedence over the layers added
+// before it. Reload loads the "file" layer only.
+// It should be called before Parse.
+func AddLayer(name string, p Provider, opts ...LayerOption) error {
+	var o layerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if slices.Contains(layerOrder, name) {
+		return fmt.Errorf("%w: layer %q already exists", ErrInitFailed, name)
+	}
+	pos := slices.Index(layerOrder, flagsLayer)
+	switch {
+	case o.above != "":
+		if pos = slices.Index(layerOrder, o.above); pos < 0 {
+			return fmt.Errorf("%w: no layer %q to add %q above", ErrInitFailed, o.above, name)
+		}
+		pos++
+	case o.below != "":
+		if pos = slices.Index(layerOrder, o.below); pos < 0 {
+			return fmt.Errorf("%w: no layer %q to add %q below", ErrInitFailed, o.below, name)
+		}
+	}
+
+	data, err := load(context.Background(), p)
+	if err != nil {
+		return err
+	}
+	m := newManager()
+	m.data = convertMap(data)
+	layers[name] = m
+	layerOrder = slices.Insert(layerOrder, pos, name)
+	return nil
+}
+
+// Layers returns the names of the layers from lowest to highest
+// precedence.
+func Layers() []string {
+	return slices.Clone(layerOrder)
+}
+
+// Layer returns a view of the values of the layer called name as loaded,
+// before the layers are merged, or nil if there is no such layer. The
+// "flags" layer holds the values set on the command line once Parse was
+// called.
+func Layer(name string) *Section {
+	m := layerManager(name)
+	if m == nil {
+		return nil
+	}
+	return newSection("", m.data)
+}
+
+// layerManager returns the values of the layer called name.
+func layerManager(name string) *mapManager {
+	switch name {
+	case defaultsLayer:
+		return defaults
+	case fileLayer:
+		return config
+	case envLayer:
+		return envConfig
+	case flagsLayer:
+		return flagConfig
+	}
+	return layers[name]
+}
+
+// mergeLayers merges the layers in order of precedence, with file and flags
+// as the values of the "file" and "flags" layers, and the values set with
+// Set above them. Bare numbers of duration keys declared with a unit are
+// converted to durations.
+func mergeLayers(file, flags *mapManager) *mapManager {
+	return mergeLayersWith(defaults, file, flags)
+}
+
+// mergeLayersWith is mergeLayers with defs as the values of the "defaults"
+// layer.
+func mergeLayersWith(defs, file, flags *mapManager) *mapManager {
+	m := newManager()
+	for _, name := range layerOrder {
+		switch name {
+		case defaultsLayer:
+			m.Merge(defs)
+		case fileLayer:
+			m.Merge(file)
+		case flagsLayer:
+			m.Merge(flags)
+		default:
+			m.Merge(layerManager(name))
+		}
+	}
+	m.Merge(assigned)
+	applyDurationUnits(m)
+	return m
+}
@@ -0,0 +1,139 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// staticProvider is a Provider returning fixed values.
+func staticProvider(values map[string]interface{}) Provider {
+	return providerFunc(func(context.Context) (map[string]interface{}, error) {
+		return values, nil
+	})
+}
+
+func TestAddLayer(t *testing.T) {
+	testReset(t)
+	SetDefault("port", 8080)
+	SetDefault("host", "localhost")
+	SetDefault("level", "info")
+	if err := Init(createTempYAML(t, "port: 9000\nname: app\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := AddLayer("overrides", staticProvider(map[string]interface{}{"port": 9100, "level": "debug"})); err != nil {
+		t.Fatalf("AddLayer() failed: %v", err)
+	}
+	if err := AddLayer("file:base", File(createTempYAML(t, "name: base\nhost: base.example.com\nport: 1\n")), Below(fileLayer)); err != nil {
+		t.Fatalf("AddLayer() failed: %v", err)
+	}
+	if err := AddLayer("enforced", staticProvider(map[string]interface{}{"level": "warn"}), Above(flagsLayer)); err != nil {
+		t.Fatalf("AddLayer() failed: %v", err)
+	}
+
+	want := []string{"defaults", "file:base", "file", "env", "overrides", "flags", "enforced"}
+	if got := Layers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Layers() = %v, want %v", got, want)
+	}
+
+	os.Args = []string{"test", "--level=error"}
+	Parse()
+	if got := GetString("host"); got != "base.example.com" {
+		t.Errorf("Expected host from file:base, got %q", got)
+	}
+	if got := GetString("name"); got != "app" {
+		t.Errorf("Expected the file to take precedence over file:base, got %q", got)
+	}
+	if got := GetInt("port"); got != 9100 {
+		t.Errorf("Expected overrides to take precedence over the file, got %d", got)
+	}
+	if got := GetString("level"); got != "warn" {
+		t.Errorf("Expected enforced to take precedence over flags, got %q", got)
+	}
+	if !IsExplicitlySet("host") {
+		t.Error("Expected a key set by an added layer to be explicitly set")
+	}
+	if got := sourceOf("host"); got != "file:base" {
+		t.Errorf("Expected source file:base, got %q", got)
+	}
+
+	if got := Layer("file:base").GetInt("port"); got != 1 {
+		t.Errorf("Expected the values of the layer as loaded, got %d", got)
+	}
+	if got := Layer(flagsLayer).GetString("level"); got != "error" {
+		t.Errorf("Expected the flags layer to hold the command line values, got %q", got)
+	}
+	if Layer("missing") != nil {
+		t.Error("Expected nil for an unknown layer")
+	}
+}
+
+func TestAddLayer_Errors(t *testing.T) {
+	testReset(t)
+	empty := staticProvider(map[string]interface{}{})
+	if err := AddLayer(fileLayer, empty); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for a duplicate name, got %v", err)
+	}
+	if err := AddLayer("x", empty, Above("missing")); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for an unknown layer, got %v", err)
+	}
+	failing := providerFunc(func(context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("unavailable")
+	})
+	if err := AddLayer("remote", failing); err == nil {
+		t.Error("Expected the load error")
+	}
+	if got := Layers(); len(got) != 4 {
+		t.Errorf("Expected failed layers not to be added, got %v", got)
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	testReset(t)
+	SetDefault("limits.rps", 100)
+	SetDefault("allowed", []string{"10.0.0.1"})
+	SetDefault("host", "localhost")
+	strs := func(v interface{}) []string {
+		if items, ok := v.([]string); ok {
+			return items
+		}
+		var items []string
+		for _, item := range v.([]interface{}) {
+			items = append(items, item.(string))
+		}
+		return items
+	}
+	var keys []string
+	OnConflict(func(key string, dst, src interface{}) interface{} {
+		keys = append(keys, key)
+		switch key {
+		case "limits.rps":
+			return max(dst.(int), src.(int))
+		case "allowed":
+			return slices.Concat(strs(dst), strs(src))
+		}
+		return src
+	})
+	configPath := createTempYAML(t, "limits:\n  rps: 50\nallowed: [10.0.0.2]\nhost: example.com\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := GetInt("limits.rps"); got != 100 {
+		t.Errorf("GetInt() = %d, want the highest value %d", got, 100)
+	}
+	if got, want := GetStringSlice("allowed"), []string{"10.0.0.1", "10.0.0.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetStringSlice() = %v, want the union %v", got, want)
+	}
+	if got := GetString("host"); got != "example.com" {
+		t.Errorf("GetString() = %q, want %q", got, "example.com")
+	}
+	if !slices.Contains(keys, "limits.rps") || slices.Contains(keys, "limits") {
+		t.Errorf("OnConflict was called for %v, want the leaves only", keys)
+	}
+}
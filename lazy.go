@@ -0,0 +1,67 @@
+package mflag
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// lazyParse reports whether getters called before Parse parse the
+	// configuration implicitly, set with SetLazyParse.
+	lazyParse bool
+	// lazyMu serializes the getters waiting for the implicit parse.
+	lazyMu sync.Mutex
+	// lazyDone reports whether the configuration was parsed, implicitly or
+	// not, once lazyMu was taken.
+	lazyDone atomic.Bool
+	// lazyParsing reports whether the implicit parse is in progress.
+	lazyParsing bool
+)
+
+// SetLazyParse makes the first getter called before Parse parse the
+// configuration implicitly instead of panicking, for libraries that may be
+// initialized before the application parses its command line. The implicit
+// parse merges the defaults, the config file given to Init, if it was
+// called, and the environment, but not the command line. If it fails, the
+// getters return the defaults and the error is reported by Warnings. A
+// later call to Parse parses everything again, flags included. Getters
+// called concurrently wait for the implicit parse, so the functions given
+// to SetDefaultFunc and AddValidator must not call them. The implicit
+// parse neither saves the snapshot of WithFallbackToLastGood nor reports
+// to the audit sink.
+// It should be called before any getter.
+func SetLazyParse(enabled bool) {
+	lazyParse = enabled
+}
+
+// parseLazily parses the configuration without the command line, or falls
+// back to the defaults, for a getter called before Parse, unless it was
+// parsed already.
+func parseLazily() {
+	if lazyDone.Load() {
+		return
+	}
+	lazyMu.Lock()
+	defer lazyMu.Unlock()
+	if parsed {
+		lazyDone.Store(true)
+		return
+	}
+	lazyParsing = true
+	defer func() { lazyParsing = false }()
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := parse(fs, nil); err != nil {
+		finalConfig = newManager()
+		finalConfig.data = deepCopyMap(defaults.data)
+		finalConfig.buildIndex()
+		warnings = append(warnings, fmt.Errorf("implicit Parse: %w", err))
+		parsed = true
+	}
+	lazyDone.Store(true)
+}
@@ -0,0 +1,85 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetLazyParse(t *testing.T) {
+	testReset(t)
+	SetLazyParse(true)
+	SetDefault("port", 8080)
+	SetDefault("host", "localhost")
+	configPath := createTempYAML(t, "host: example.com\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--port=9090"}
+
+	// The implicit parse ignores the command line.
+	if got := GetInt("port"); got != 8080 {
+		t.Errorf("GetInt() = %d before Parse, want %d", got, 8080)
+	}
+	if got := GetString("host"); got != "example.com" {
+		t.Errorf("GetString() = %q before Parse, want %q", got, "example.com")
+	}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got := GetInt("port"); got != 9090 {
+		t.Errorf("GetInt() = %d after Parse, want %d", got, 9090)
+	}
+
+	testReset(t)
+	SetLazyParse(true)
+	SetDefault("port", 8080)
+	MarkRequired("token")
+	if got := GetInt("port"); got != 8080 {
+		t.Errorf("GetInt() = %d after a failed implicit parse, want %d", got, 8080)
+	}
+	if warns := Warnings(); len(warns) != 1 || !errors.Is(warns[0], ErrMissingKey) {
+		t.Errorf("Warnings() = %v, want the missing key", warns)
+	}
+
+	// Concurrent getters wait for a single implicit parse, which neither
+	// saves a snapshot nor reports to the audit sink.
+	testReset(t)
+	SetLazyParse(true)
+	SetDefault("port", 8080)
+	dir := t.TempDir()
+	if err := InitContext(context.Background(), File(createTempYAML(t, "name: lazy\n")), WithFallbackToLastGood(dir)); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	var audited atomic.Int32
+	SetAuditSink(func(AuditEvent) { audited.Add(1) })
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := GetInt("port"); got != 8080 {
+				t.Errorf("GetInt() = %d, want %d", got, 8080)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := os.Stat(filepath.Join(dir, lastGoodFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected no snapshot after the implicit parse, got %v", err)
+	}
+	if n := audited.Load(); n != 0 {
+		t.Errorf("Expected no audit events after the implicit parse, got %d", n)
+	}
+
+	testReset(t)
+	defer func() {
+		if recover() == nil {
+			t.Error("GetInt() did not panic before Parse without SetLazyParse")
+		}
+	}()
+	GetInt("port")
+}
@@ -0,0 +1,72 @@
+package mflag
+
+import (
+	"maps"
+	"slices"
+)
+
+var (
+	// lenient reports whether Parse tolerates invalid values, set with
+	// SetLenient.
+	lenient bool
+	// warnings holds the problems tolerated by the last Parse.
+	warnings []error
+)
+
+// SetLenient makes Parse tolerate invalid configuration instead of failing,
+// so that a service can start degraded and log precisely what was wrong:
+// environment variables and --set values that cannot be converted to the
+// type of their key are ignored, keys whose value has the wrong type or is
+// not one of the allowed values fall back to their default, and missing
+// required keys or failed validators are let through. Every problem is
+// reported by Warnings. Errors parsing the command line itself, loading the
+// config file or resolving references still make Parse fail, Reload
+// still rejects invalid configurations and --validate-config still reports
+// every problem as an error.
+// It should be called before Parse.
+func SetLenient(enabled bool) {
+	lenient = enabled
+}
+
+// Warnings returns the problems tolerated by the last Parse, as set with
+// SetLenient, in the order they were found.
+// Must be called after Parse.
+func Warnings() []error {
+	mustBeParsed()
+	return slices.Clone(warnings)
+}
+
+// tolerate records the errors joined in err as warnings and returns nil if
+// Parse is lenient, or else returns err.
+func tolerate(err error) error {
+	if err == nil || !lenient {
+		return err
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		warnings = append(warnings, joined.Unwrap()...)
+	} else {
+		warnings = append(warnings, err)
+	}
+	return nil
+}
+
+// fallBack replaces the values of m that cannot be converted to the type of
+// their key, or are not one of its allowed values, by their defaults.
+func fallBack(m *mapManager) {
+	keys := defaults.AllKeys()
+	keys = append(keys, slices.Collect(maps.Keys(specs))...)
+	slices.Sort(keys)
+	for _, key := range slices.Compact(keys) {
+		value := m.Get(key)
+		if value == nil {
+			continue
+		}
+		invalid := checkType(value, keyType(key)) != nil
+		if s, ok := specs[key]; ok && checkEnum(key, m.GetString(key), s.allowed) != nil {
+			invalid = true
+		}
+		if invalid {
+			m.SetValue(key, defaults.Get(key))
+		}
+	}
+}
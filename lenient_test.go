@@ -0,0 +1,72 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSetLenient(t *testing.T) {
+	testReset(t)
+	SetLenient(true)
+	SetDefault("port", 8080)
+	SetDefault("workers", 4)
+	SetDefaultEnum("level", "info", "debug", "info")
+	MarkRequired("token")
+	BindEnv("workers", "TEST_MFLAG_WORKERS")
+	t.Setenv("TEST_MFLAG_WORKERS", "many")
+	configPath := createTempYAML(t, "port: http\nlevel: loud\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed in lenient mode: %v", err)
+	}
+
+	tests := map[string]interface{}{"port": 8080, "workers": 4, "level": "info"}
+	for key, want := range tests {
+		if got := finalConfig.Get(key); got != want {
+			t.Errorf("%q = %v, want the default %v", key, got, want)
+		}
+	}
+	warns := Warnings()
+	if len(warns) != 4 {
+		t.Fatalf("Warnings() = %v, want 4 warnings", warns)
+	}
+	var missing, invalid int
+	for _, w := range warns {
+		switch {
+		case errors.Is(w, ErrMissingKey):
+			missing++
+		case errors.Is(w, ErrInvalidValue):
+			invalid++
+		}
+	}
+	if missing != 1 || invalid != 3 {
+		t.Errorf("Warnings() = %v, want 1 missing key and 3 invalid values", warns)
+	}
+
+	testReset(t)
+	SetDefault("port", 8080)
+	configPath = createTempYAML(t, "port: http\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("ParseWithError() = %v without lenient mode, want ErrInvalidValue", err)
+	}
+}
+
+func TestSetLenient_ValidateConfig(t *testing.T) {
+	testReset(t)
+	SetLenient(true)
+	EnableValidateConfig()
+	SetDefault("workers", 4)
+	BindEnv("workers", "TEST_MFLAG_WORKERS")
+	t.Setenv("TEST_MFLAG_WORKERS", "many")
+	os.Args = []string{"test", "--validate-config"}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("ParseWithError() = %v, want the tolerated ErrInvalidValue", err)
+	}
+}
@@ -1,12 +1,24 @@
 package mflag
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+	"unsafe"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +27,49 @@ import (
 // It supports nested structures, which can be accessed using dot notation (e.g., "database.host").
 type mapManager struct {
 	data map[string]interface{}
+	// shared reports whether data may share nested maps with other managers,
+	// as it does after Merge. Such maps are copied before being written to.
+	shared bool
+	// owned holds the maps and lists of data that SetValue copied or created
+	// since data was last shared, which it writes to in place rather than
+	// copying them again.
+	owned map[unsafe.Pointer]bool
+	// index maps every dotted key path to its value, so that Get is a single
+	// lookup. It is built by buildIndex and dropped whenever data changes.
+	index map[string]interface{}
+
+	// convs memoizes the results of parsing string values into other types,
+	// once the index is built. It is dropped together with the index.
+	convMu sync.RWMutex
+	convs  map[convKey]interface{}
+
+	// secrets holds the keys whose values were resolved from secrets, such
+	// as encrypted values, which are treated as secret like the keys marked
+	// with MarkSecret.
+	secrets map[string]bool
+}
+
+// convKind identifies the type a string value was converted to.
+type convKind uint8
+
+const (
+	convBool convKind = iota
+	convInt64
+	convUint64
+	convFloat64
+	convDuration
+	convStringSlice
+	convStringMap
+	convRegexp
+	convTemplate
+	convLocation
+	convCron
+)
+
+// convKey identifies a memoized conversion.
+type convKey struct {
+	key  string
+	kind convKind
 }
 
 // newManager creates and returns a new, empty mapManager.
@@ -32,74 +87,202 @@ func (m *mapManager) Clone() *mapManager {
 }
 
 // Merge merges another mapManager into this one. Values in the other manager
-// take precedence by overwriting existing keys.
+// take precedence by overwriting existing keys. Nested maps that only one
+// side has are shared rather than copied, so merging costs in proportion to
+// the keys the two managers have in common, not to their size: a Parse
+// still merges every layer, but copies none of their subtrees. Writing to
+// either manager afterwards copies the maps and lists on the path written
+// to, once. Conflicting values are resolved by the function set with
+// OnConflict, if any.
 func (m *mapManager) Merge(other *mapManager) {
-	m.data = mergeMaps(m.data, other.data)
+	if conflictHook != nil {
+		m.data = overlayConflicts("", m.data, other.data)
+	} else {
+		m.data = overlayMaps(m.data, other.data)
+	}
+	m.shared, other.shared = true, true
+	m.owned, other.owned = nil, nil
+	m.invalidate()
 }
 
 // LoadFile reads a YAML configuration file from the specified path and populates the config.
+// Files with an extension registered with RegisterFormat are parsed in that
+// format instead.
 func (m *mapManager) LoadFile(filename string) error {
+	return m.loadFile(context.Background(), filename, "")
+}
+
+// loadFile is LoadFile parsing the file in the format registered for the
+// extension format, if not empty. The file is recorded for ConfigFilesUsed
+// unless ctx is marked as unrecorded.
+func (m *mapManager) loadFile(ctx context.Context, filename, format string) error {
 	content, err := os.ReadFile(filename)
 	if err != nil {
-		// It's not an error if the file doesn't exist; we just won't load it.
-		if os.IsNotExist(err) {
+		// It's not an error if the file doesn't exist; we just won't load it,
+		// unless the application requires one.
+		if os.IsNotExist(err) && !requireConfigFile {
 			return nil
 		}
 		return fmt.Errorf("%w: failed to read config file %s: %w", ErrInitFailed, filename, err)
 	}
+	if content, err = decryptSnapshot(content); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInitFailed, filename, err)
+	}
+	name, err := m.parse(filename, format, content)
+	if err != nil {
+		return err
+	}
+	recordFileUsed(ctx, filename, name, content, fileKeys(m.data))
+	return nil
+}
 
+// parse replaces the values of m with those of content, the content of the
+// file filename, parsed as loadFile does. It returns the name of the format.
+func (m *mapManager) parse(filename, format string, content []byte) (string, error) {
+	name, unmarshal, err := formatOf(filename, format)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrInitFailed, filename, err)
+	}
 	var parsedData map[string]interface{}
-	if err := yaml.Unmarshal(content, &parsedData); err != nil {
-		return fmt.Errorf("%w: failed to parse yaml: %w", ErrInitFailed, err)
+	if unmarshal != nil {
+		var err error
+		if parsedData, err = unmarshal(content); err != nil {
+			return "", fmt.Errorf("%w: failed to parse %s: %w", ErrInitFailed, name, err)
+		}
+	} else if err := decodeYAML(content, &parsedData); err != nil {
+		return "", fmt.Errorf("%w: failed to parse yaml: %w", ErrInitFailed, err)
+	}
+	if _, ok := parsedData["sops"]; ok {
+		return "", fmt.Errorf("%w: %s is encrypted with sops, which is not supported; decrypt it with sops first", ErrInitFailed, filename)
 	}
 
 	// The YAML library can create map[any]any, which we need to convert.
 	m.data = convertMap(parsedData)
-	return nil
+	if unmarshal == nil && hasHugeFloat(m.data) {
+		preserveBigInts(content, m.data)
+	}
+	m.invalidate()
+	return name, nil
 }
 
 // SetValue sets a value for a given key. The key can be a dot-separated path to create nested maps.
+// Numeric segments index into existing lists, e.g. "endpoints.1.url"; an
+// index one past the end appends to the list. Writes to indexes further
+// past the end are refused, leaving the list unchanged, see checkIndexes.
 func (m *mapManager) SetValue(key string, value interface{}) {
-	keys := strings.Split(key, ".")
-	current := m.data
+	m.invalidate()
+	m.data = m.setIn(m.data, strings.Split(key, "."), value).(map[string]interface{})
+}
 
-	for i, k := range keys {
-		if i == len(keys)-1 {
-			// This is the last key, so set the value.
-			current[k] = value
-		} else {
-			// This is a key in the path.
-			if _, exists := current[k]; !exists {
-				// Create a new map if the key doesn't exist.
-				current[k] = make(map[string]interface{})
+// checkIndexes returns an error if key indexes an item of a list of m more
+// than one past its end, which SetValue refuses to write.
+func (m *mapManager) checkIndexes(key string) error {
+	segments := strings.Split(key, ".")
+	for i := 1; i < len(segments); i++ {
+		index, err := strconv.Atoi(segments[i])
+		if err != nil {
+			continue
+		}
+		list := strings.Join(segments[:i], ".")
+		n := 0
+		switch v := m.Get(list).(type) {
+		case []interface{}:
+			n = len(v)
+		case []string:
+			n = len(v)
+		default:
+			continue
+		}
+		if index > n {
+			return fmt.Errorf("index %d of %q is past the end of its %d items", index, list, n)
+		}
+	}
+	return nil
+}
+
+// setIn returns node with the value at the path keys set to value. Maps and
+// lists along the path are modified in place, or copied if they may be
+// shared and were not copied yet. Missing maps are created, and values that
+// cannot hold the path are replaced by maps. Lists indexed more than one
+// past their end are returned unchanged.
+func (m *mapManager) setIn(node interface{}, keys []string, value interface{}) interface{} {
+	if len(keys) == 0 {
+		return value
+	}
+	k := keys[0]
+	switch n := node.(type) {
+	case []interface{}:
+		i, err := strconv.Atoi(k)
+		if err == nil && i > len(n) {
+			return n
+		}
+		if err == nil && i >= 0 {
+			if (m.shared && !m.owns(n)) || i == len(n) {
+				n = append(make([]interface{}, 0, len(n)+1), n...)
+				m.own(n)
+			}
+			if i == len(n) {
+				n = append(n, nil)
 			}
-			// Move to the next level.
-			if nested, ok := current[k].(map[string]interface{}); ok {
-				current = nested
-			} else {
-				// A value already exists at this path but it's not a map,
-				// so we cannot create a nested key. We'll overwrite it.
-				newMap := make(map[string]interface{})
-				current[k] = newMap
-				current = newMap
+			n[i] = m.setIn(n[i], keys[1:], value)
+			return n
+		}
+	case []string:
+		i, err := strconv.Atoi(k)
+		if err == nil && i > len(n) {
+			return n
+		}
+		if err == nil && i >= 0 {
+			items := make([]interface{}, len(n))
+			for i, s := range n {
+				items[i] = s
 			}
+			return m.setIn(items, keys, value)
+		}
+	case map[string]interface{}:
+		if m.shared && !m.owns(n) {
+			n = copyMap(n)
+			m.own(n)
 		}
+		n[k] = m.setIn(n[k], keys[1:], value)
+		return n
+	}
+	// A value exists at this path but cannot hold the key, or nothing
+	// does: create a map.
+	created := map[string]interface{}{k: m.setIn(nil, keys[1:], value)}
+	m.own(created)
+	return created
+}
+
+// own records that node, a map or list of m created by setIn, is not
+// shared with other managers.
+func (m *mapManager) own(node interface{}) {
+	if !m.shared {
+		return
+	}
+	if m.owned == nil {
+		m.owned = make(map[unsafe.Pointer]bool)
 	}
+	m.owned[reflect.ValueOf(node).UnsafePointer()] = true
+}
+
+// owns reports whether node, a map or list of m, was created by setIn
+// since m was last shared.
+func (m *mapManager) owns(node interface{}) bool {
+	return m.owned[reflect.ValueOf(node).UnsafePointer()]
 }
 
 // Get retrieves a configuration value by key.
 func (m *mapManager) Get(key string) interface{} {
+	if m.index != nil {
+		return m.index[key]
+	}
 	keys := strings.Split(key, ".")
 	var current interface{} = m.data
 
 	for _, k := range keys {
-		currentMap, ok := current.(map[string]interface{})
+		value, ok := child(current, k)
 		if !ok {
-			return nil // Cannot traverse further down a non-map value.
-		}
-
-		value, exists := currentMap[k]
-		if !exists {
 			return nil
 		}
 		current = value
@@ -107,13 +290,35 @@ func (m *mapManager) Get(key string) interface{} {
 	return current
 }
 
+// child returns the entry k of node: the value of key k of a map, or the
+// item at index k of a list.
+func child(node interface{}, k string) (interface{}, bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		value, ok := n[k]
+		return value, ok
+	case []interface{}:
+		if i, err := strconv.Atoi(k); err == nil && i >= 0 && i < len(n) {
+			return n[i], true
+		}
+	case []string:
+		if i, err := strconv.Atoi(k); err == nil && i >= 0 && i < len(n) {
+			return n[i], true
+		}
+	}
+	return nil, false
+}
+
 // GetString returns the value associated with the key as a string.
 func (m *mapManager) GetString(key string) string {
-	val := m.Get(key)
-	if val == nil {
+	switch v := m.Get(key).(type) {
+	case nil:
 		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
 	}
-	return fmt.Sprintf("%v", val)
 }
 
 // GetInt returns the value associated with the key as an integer.
@@ -176,9 +381,12 @@ func (m *mapManager) GetBool(key string) bool {
 	case bool:
 		return v
 	case string:
-		if b, err := strconv.ParseBool(v); err == nil {
-			return b
+		if c, ok := m.loadConv(key, convBool); ok {
+			return c.(bool)
 		}
+		b, _ := strconv.ParseBool(v)
+		m.storeConv(key, convBool, b)
+		return b
 	}
 	return false
 }
@@ -192,18 +400,131 @@ func (m *mapManager) GetFloat64(key string) float64 {
 	switch v := val.(type) {
 	case float64:
 		return v
+	case float32:
+		return float64(v)
 	case int:
 		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
 	case int64:
 		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
 	case string:
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			return f
+		if c, ok := m.loadConv(key, convFloat64); ok {
+			return c.(float64)
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			f = 0
 		}
+		m.storeConv(key, convFloat64, f)
+		return f
 	}
 	return 0.0
 }
 
+// GetFloat32 returns the value associated with the key as a float32.
+func (m *mapManager) GetFloat32(key string) float32 {
+	return float32(m.GetFloat64(key))
+}
+
+// GetComplex128 returns the value associated with the key as a complex128.
+// Strings such as "1+2i" are parsed; numbers yield a complex number with a
+// zero imaginary part.
+func (m *mapManager) GetComplex128(key string) complex128 {
+	switch v := m.Get(key).(type) {
+	case nil:
+		return 0
+	case complex128:
+		return v
+	case string:
+		c, err := strconv.ParseComplex(strings.TrimSpace(v), 128)
+		if err != nil {
+			return 0
+		}
+		return c
+	}
+	return complex(m.GetFloat64(key), 0)
+}
+
+// GetBigInt returns the value associated with the key as a *big.Int, or nil
+// if it is missing or not an integer. Strings are decimal, like those
+// GetInt parses, and may use scientific notation such as "1e30".
+func (m *mapManager) GetBigInt(key string) *big.Int {
+	switch v := m.Get(key).(type) {
+	case *big.Int:
+		return new(big.Int).Set(v)
+	case int:
+		return big.NewInt(int64(v))
+	case int8, int16, int32, int64:
+		return big.NewInt(m.getAsInt64(key))
+	case uint, uint8, uint16, uint32, uint64:
+		return new(big.Int).SetUint64(m.getAsUint64(key))
+	case float64:
+		return bigIntFromFloat(new(big.Float).SetFloat64(v))
+	case string:
+		if i, ok := new(big.Int).SetString(v, 10); ok {
+			return i
+		}
+		f, _, err := big.ParseFloat(v, 10, 512, big.ToNearestEven)
+		if err != nil {
+			return nil
+		}
+		return bigIntFromFloat(f)
+	}
+	return nil
+}
+
+// bigIntFromFloat returns f as a *big.Int, or nil if it is not an integer.
+func bigIntFromFloat(f *big.Float) *big.Int {
+	if f.IsInf() || !f.IsInt() {
+		return nil
+	}
+	i, _ := f.Int(nil)
+	return i
+}
+
+// parseInt parses s as an int64, also accepting scientific notation for
+// integral values, such as "1e6".
+func parseInt(s string) (int64, error) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return i, nil
+	}
+	f, ferr := strconv.ParseFloat(s, 64)
+	if ferr != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, err
+	}
+	return int64(f), nil
+}
+
+// parseUint parses s as a uint64, also accepting scientific notation for
+// integral values, such as "1e6".
+func parseUint(s string) (uint64, error) {
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err == nil {
+		return u, nil
+	}
+	f, ferr := strconv.ParseFloat(s, 64)
+	if ferr != nil || f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+		return 0, err
+	}
+	return uint64(f), nil
+}
+
 // GetDuration returns the value associated with the key as a time.Duration.
 // It can parse duration strings (e.g., "10s", "5m").
 // If the value is a number, it's treated as nanoseconds.
@@ -216,9 +537,15 @@ func (m *mapManager) GetDuration(key string) time.Duration {
 	case time.Duration:
 		return v
 	case string:
-		if d, err := time.ParseDuration(v); err == nil {
-			return d
+		if c, ok := m.loadConv(key, convDuration); ok {
+			return c.(time.Duration)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			d = 0
 		}
+		m.storeConv(key, convDuration, d)
+		return d
 	case int:
 		return time.Duration(v)
 	case int64:
@@ -229,26 +556,138 @@ func (m *mapManager) GetDuration(key string) time.Duration {
 	return 0
 }
 
+// GetLogLevel returns the value associated with the key as a slog.Level.
+// It accepts level names ("debug", "info", "warn" or "warning", "error")
+// case-insensitively, optionally with an offset such as "info+2", as well as
+// numeric levels. Missing or invalid values yield slog.LevelInfo.
+func (m *mapManager) GetLogLevel(key string) slog.Level {
+	switch v := m.Get(key).(type) {
+	case int, int8, int16, int32, int64:
+		return slog.Level(m.getAsInt64(key))
+	case string:
+		s := strings.TrimSpace(v)
+		if n, err := strconv.Atoi(s); err == nil {
+			return slog.Level(n)
+		}
+		if len(s) >= 7 && strings.EqualFold(s[:7], "warning") {
+			s = "warn" + s[7:]
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(s)); err == nil {
+			return level
+		}
+	}
+	return slog.LevelInfo
+}
+
+// GetBytes returns the value associated with the key as a byte slice.
+// Strings prefixed with "base64:" or "hex:" are decoded; other strings are
+// returned as is. Missing values and values that fail to decode yield nil.
+func (m *mapManager) GetBytes(key string) []byte {
+	switch v := m.Get(key).(type) {
+	case []byte:
+		return v
+	case string:
+		if data, ok := strings.CutPrefix(v, "base64:"); ok {
+			b, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil
+			}
+			return b
+		}
+		if data, ok := strings.CutPrefix(v, "hex:"); ok {
+			b, err := hex.DecodeString(data)
+			if err != nil {
+				return nil
+			}
+			return b
+		}
+		return []byte(v)
+	}
+	return nil
+}
+
 // GetStringMapString returns the value associated with the key as a map of strings.
 // If the value is not a map, it returns an empty map. All values in the map
-// are converted to strings.
+// are converted to strings. Nested maps and lists are flattened, with their
+// entries and items under keys joined with dots, such as "limits.cpu" or
+// "hosts.0".
 func (m *mapManager) GetStringMapString(key string) map[string]string {
-	val := m.Get(key)
-	if val == nil {
-		return make(map[string]string)
+	result := make(map[string]string)
+	if v, ok := m.Get(key).(map[string]interface{}); ok {
+		flattenStrings("", v, result)
 	}
+	return result
+}
 
-	result := make(map[string]string)
-	if v, ok := val.(map[string]interface{}); ok {
+// flattenStrings adds the entries of value to result as strings, under keys
+// starting with prefix.
+func flattenStrings(prefix string, value interface{}, result map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
 		for k, item := range v {
+			flattenStrings(joinKey(prefix, k), item, result)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenStrings(joinKey(prefix, strconv.Itoa(i)), item, result)
+		}
+	case []string:
+		for i, item := range v {
+			result[joinKey(prefix, strconv.Itoa(i))] = item
+		}
+	case nil:
+		result[prefix] = ""
+	default:
+		result[prefix] = fmt.Sprintf("%v", v)
+	}
+}
+
+// GetStringMapStringE returns the value associated with the key as a map of
+// strings, like GetStringMapString, but returns an error wrapping
+// ErrInvalidValue instead of converting a value that is not a map or holds
+// nested maps or lists. A missing key yields an empty map.
+func (m *mapManager) GetStringMapStringE(key string) (map[string]string, error) {
+	result := make(map[string]string)
+	val := m.Get(key)
+	if val == nil {
+		return result, nil
+	}
+	v, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w for %q: expected a map, got %T", ErrInvalidValue, key, val)
+	}
+	for k, item := range v {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}, []string:
+			return nil, fmt.Errorf("%w for %q: entry %q is not a scalar", ErrInvalidValue, key, k)
+		case nil:
+			result[k] = ""
+		default:
 			result[k] = fmt.Sprintf("%v", item)
 		}
 	}
-	return result
+	return result, nil
+}
+
+// GetStringMapAny returns a copy of the map associated with the key, with
+// values of their loaded types and nested maps intact. If the value is not
+// a map, it returns an empty map.
+func (m *mapManager) GetStringMapAny(key string) map[string]interface{} {
+	if v, ok := m.Get(key).(map[string]interface{}); ok {
+		return deepCopyMap(v)
+	}
+	return make(map[string]interface{})
 }
 
 // GetStringSlice returns the value associated with the key as a slice of strings.
 func (m *mapManager) GetStringSlice(key string) []string {
+	return m.getStringSliceSep(key, sliceSeparator)
+}
+
+// getStringSliceSep returns the value associated with the key as a slice of
+// strings, splitting a string value on sep.
+func (m *mapManager) getStringSliceSep(key, sep string) []string {
 	val := m.Get(key)
 	if val == nil {
 		return []string{}
@@ -262,21 +701,141 @@ func (m *mapManager) GetStringSlice(key string) []string {
 		}
 		return result
 	case []string:
-		return v
+		// Callers may modify the result, which must not change m.
+		return slices.Clone(v)
 	case string:
-		if strings.Contains(v, ",") {
-			parts := strings.Split(v, ",")
-			result := make([]string, len(parts))
-			for i, part := range parts {
-				result[i] = strings.TrimSpace(part)
-			}
-			return result
-		}
-		return []string{v}
+		return splitList(v, sep)
 	}
 	return []string{}
 }
 
+// GetRegexp returns the value associated with the key compiled as a regular
+// expression, or nil if it is missing or invalid. The compiled expression is
+// memoized.
+func (m *mapManager) GetRegexp(key string) *regexp.Regexp {
+	if c, ok := m.loadConv(key, convRegexp); ok {
+		return c.(*regexp.Regexp)
+	}
+	s, ok := m.Get(key).(string)
+	if !ok {
+		return nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		re = nil
+	}
+	m.storeConv(key, convRegexp, re)
+	return re
+}
+
+// GetLocation returns the time zone named by the value associated with the
+// key. It returns time.UTC if the key is missing and nil if the name is
+// invalid. The loaded location is memoized.
+func (m *mapManager) GetLocation(key string) *time.Location {
+	if c, ok := m.loadConv(key, convLocation); ok {
+		return c.(*time.Location)
+	}
+	var loc *time.Location
+	switch v := m.Get(key).(type) {
+	case nil:
+		loc = time.UTC
+	case string:
+		loc, _ = time.LoadLocation(v)
+	}
+	m.storeConv(key, convLocation, loc)
+	return loc
+}
+
+// GetCron returns the value associated with the key parsed as a cron
+// expression, or nil if it is missing or invalid. The schedule is memoized.
+func (m *mapManager) GetCron(key string) Schedule {
+	if c, ok := m.loadConv(key, convCron); ok {
+		s, _ := c.(Schedule)
+		return s
+	}
+	var schedule Schedule
+	if s, ok := m.Get(key).(string); ok {
+		if parsed, err := cronParser(s); err == nil {
+			schedule = parsed
+		}
+	}
+	m.storeConv(key, convCron, schedule)
+	return schedule
+}
+
+// parsedTemplate is the memoized result of GetTemplate.
+type parsedTemplate struct {
+	tmpl *template.Template
+	err  error
+}
+
+// GetTemplate returns the value associated with the key parsed as a
+// text/template named after the key. Templates without funcs are memoized;
+// those with funcs are parsed on every call, since funcs may differ.
+func (m *mapManager) GetTemplate(key string, funcs template.FuncMap) (*template.Template, error) {
+	if len(funcs) > 0 {
+		p := m.parseTemplate(key, funcs)
+		return p.tmpl, p.err
+	}
+	if c, ok := m.loadConv(key, convTemplate); ok {
+		p := c.(parsedTemplate)
+		return p.tmpl, p.err
+	}
+	p := m.parseTemplate(key, nil)
+	m.storeConv(key, convTemplate, p)
+	return p.tmpl, p.err
+}
+
+// parseTemplate parses the value associated with the key as GetTemplate
+// does.
+func (m *mapManager) parseTemplate(key string, funcs template.FuncMap) parsedTemplate {
+	var p parsedTemplate
+	if s, ok := m.Get(key).(string); !ok {
+		p.err = fmt.Errorf("%w %q", ErrMissingKey, key)
+	} else if p.tmpl, p.err = template.New(key).Funcs(funcs).Parse(s); p.err != nil {
+		p.tmpl, p.err = nil, fmt.Errorf("%w for %q: %w", ErrInvalidValue, key, p.err)
+	}
+	return p
+}
+
+// getStringSliceCached returns GetStringSlice(key), computing it once.
+func (m *mapManager) getStringSliceCached(key string) []string {
+	if c, ok := m.loadConv(key, convStringSlice); ok {
+		return c.([]string)
+	}
+	v := m.GetStringSlice(key)
+	m.storeConv(key, convStringSlice, v)
+	return v
+}
+
+// getStringMapStringCached returns GetStringMapString(key), computing it
+// once.
+func (m *mapManager) getStringMapStringCached(key string) map[string]string {
+	if c, ok := m.loadConv(key, convStringMap); ok {
+		return c.(map[string]string)
+	}
+	v := m.GetStringMapString(key)
+	m.storeConv(key, convStringMap, v)
+	return v
+}
+
+// getItems returns the items of the slice value associated with the key.
+// String values are split on commas, like GetStringSlice does.
+func (m *mapManager) getItems(key string) []interface{} {
+	switch v := m.Get(key).(type) {
+	case []interface{}:
+		return v
+	case []string, string:
+		items := m.GetStringSlice(key)
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			result[i] = item
+		}
+		return result
+	}
+	return nil
+}
+
 // getAsInt64 is a helper to convert various numeric types to int64.
 func (m *mapManager) getAsInt64(key string) int64 {
 	val := m.Get(key)
@@ -307,9 +866,15 @@ func (m *mapManager) getAsInt64(key string) int64 {
 	case float64:
 		return int64(v)
 	case string:
-		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
-			return i
+		if c, ok := m.loadConv(key, convInt64); ok {
+			return c.(int64)
 		}
+		i, err := parseInt(v)
+		if err != nil {
+			i = 0
+		}
+		m.storeConv(key, convInt64, i)
+		return i
 	}
 	return 0
 }
@@ -362,9 +927,15 @@ func (m *mapManager) getAsUint64(key string) uint64 {
 		}
 		return uint64(v)
 	case string:
-		if u, err := strconv.ParseUint(v, 10, 64); err == nil {
-			return u
+		if c, ok := m.loadConv(key, convUint64); ok {
+			return c.(uint64)
+		}
+		u, err := parseUint(v)
+		if err != nil {
+			u = 0
 		}
+		m.storeConv(key, convUint64, u)
+		return u
 	}
 	return 0
 }
@@ -374,6 +945,28 @@ func (m *mapManager) IsSet(key string) bool {
 	return m.Get(key) != nil
 }
 
+// Has reports whether the key is present, even with a null value.
+func (m *mapManager) Has(key string) bool {
+	if m.index != nil {
+		_, ok := m.index[key]
+		return ok
+	}
+	var current interface{} = m.data
+	for k := range strings.SplitSeq(key, ".") {
+		value, ok := child(current, k)
+		if !ok {
+			return false
+		}
+		current = value
+	}
+	return true
+}
+
+// IsNull reports whether the key is present with a null value.
+func (m *mapManager) IsNull(key string) bool {
+	return m.Get(key) == nil && m.Has(key)
+}
+
 // AllKeys returns all keys in the config, flattened with dot notation.
 func (m *mapManager) AllKeys() []string {
 	var keys []string
@@ -382,6 +975,103 @@ func (m *mapManager) AllKeys() []string {
 	return keys
 }
 
+// KeysWithPrefix returns the keys starting with prefix, sorted.
+func (m *mapManager) KeysWithPrefix(prefix string) []string {
+	var keys []string
+	for _, key := range m.AllKeys() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// SubKeys returns the names of the direct children of the map value
+// associated with the key, sorted. It returns nil if the value is not a map.
+func (m *mapManager) SubKeys(key string) []string {
+	nested, ok := m.Get(key).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(nested))
+	for k := range nested {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// invalidate drops the index and the memoized conversions after data
+// changed.
+func (m *mapManager) invalidate() {
+	m.index = nil
+	m.convMu.Lock()
+	m.convs = nil
+	m.convMu.Unlock()
+}
+
+// loadConv returns the memoized conversion of the value of key to kind.
+func (m *mapManager) loadConv(key string, kind convKind) (interface{}, bool) {
+	m.convMu.RLock()
+	defer m.convMu.RUnlock()
+	c, ok := m.convs[convKey{key, kind}]
+	return c, ok
+}
+
+// storeConv memoizes the conversion of the value of key to kind. Nothing is
+// stored until the index is built, as the data may still change.
+func (m *mapManager) storeConv(key string, kind convKind, value interface{}) {
+	if m.index == nil {
+		return
+	}
+	m.convMu.Lock()
+	defer m.convMu.Unlock()
+	if m.convs == nil {
+		m.convs = make(map[convKey]interface{})
+	}
+	m.convs[convKey{key, kind}] = value
+}
+
+// buildIndex flattens data into the index used by Get. It must be called
+// once the data is final, before concurrent reads start.
+func (m *mapManager) buildIndex() {
+	m.invalidate()
+	m.index = make(map[string]interface{})
+	indexMap("", m.data, m.index)
+}
+
+// indexMap is a recursive helper for buildIndex. Keys containing a dot are
+// skipped, since Get cannot reach them either.
+func indexMap(prefix string, data map[string]interface{}, index map[string]interface{}) {
+	for key, value := range data {
+		if strings.Contains(key, ".") {
+			continue
+		}
+		fullKey := key
+		if prefix != "" {
+			fullKey = prefix + "." + key
+		}
+		indexValue(fullKey, value, index)
+	}
+}
+
+// indexValue adds value and everything nested in it to index.
+func indexValue(key string, value interface{}, index map[string]interface{}) {
+	index[key] = value
+	switch v := value.(type) {
+	case map[string]interface{}:
+		indexMap(key, v, index)
+	case []interface{}:
+		for i, item := range v {
+			indexValue(key+"."+strconv.Itoa(i), item, index)
+		}
+	case []string:
+		for i, item := range v {
+			index[key+"."+strconv.Itoa(i)] = item
+		}
+	}
+}
+
 // collectKeys is a recursive helper for AllKeys.
 func collectKeys(prefix string, data map[string]interface{}, keys *[]string) {
 	for key, value := range data {
@@ -400,7 +1090,8 @@ func collectKeys(prefix string, data map[string]interface{}, keys *[]string) {
 
 // convertMap recursively converts map[interface{}]interface{} to map[string]interface{}.
 // The standard YAML library can unmarshal into the former, but we need the latter for
-// structured access.
+// structured access. Merge keys left by other parsers, as in "<<: *base",
+// are merged.
 func convertMap(m map[string]interface{}) map[string]interface{} {
 	res := make(map[string]interface{})
 	for k, v := range m {
@@ -421,9 +1112,75 @@ func convertMap(m map[string]interface{}) map[string]interface{} {
 			res[k] = v
 		}
 	}
+	applyMergeKey(res)
 	return res
 }
 
+// hasHugeFloat reports whether v, or a value of its maps and lists, is a
+// float64 beyond the range of uint64, which is how the YAML library decodes
+// integers too large for it.
+func hasHugeFloat(v interface{}) bool {
+	switch v := v.(type) {
+	case float64:
+		return math.Abs(v) >= math.MaxUint64
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasHugeFloat(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasHugeFloat(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// preserveBigInts replaces the integers of data, in its maps and lists,
+// that the YAML library decoded into lossy float64s with their exact
+// decimal strings, so that GetBigInt returns them unchanged. content is the
+// YAML data was decoded from.
+func preserveBigInts(content []byte, data map[string]interface{}) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 {
+		return
+	}
+	// walk returns the value v, decoded from node, with its integers
+	// preserved.
+	var walk func(node *yaml.Node, v interface{}) interface{}
+	walk = func(node *yaml.Node, v interface{}) interface{} {
+		switch v := v.(type) {
+		case float64:
+			// The YAML library tags such integers as floats, so recognize
+			// them by their literal.
+			literal := strings.ReplaceAll(node.Value, "_", "")
+			if _, ok := new(big.Int).SetString(literal, 10); ok && node.Kind == yaml.ScalarNode {
+				return literal
+			}
+		case map[string]interface{}:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					key := node.Content[i].Value
+					if item, ok := v[key]; ok {
+						v[key] = walk(node.Content[i+1], item)
+					}
+				}
+			}
+		case []interface{}:
+			if node.Kind == yaml.SequenceNode && len(node.Content) == len(v) {
+				for i, item := range v {
+					v[i] = walk(node.Content[i], item)
+				}
+			}
+		}
+		return v
+	}
+	walk(doc.Content[0], data)
+}
+
 // convertSlice recursively converts slices containing maps
 func convertSlice(slice []interface{}) interface{} {
 	if len(slice) == 0 {
@@ -500,21 +1257,84 @@ func deepCopyValue(v interface{}) interface{} {
 	}
 }
 
-// mergeMaps recursively merges two maps. Values in src overwrite values in dst.
-func mergeMaps(dst, src map[string]interface{}) map[string]interface{} {
-	if dst == nil {
-		dst = make(map[string]interface{})
+// overlayMaps recursively merges two maps without modifying them. Values in
+// upper overwrite values in lower. Maps present on one side only are shared
+// with the result rather than copied.
+func overlayMaps(lower, upper map[string]interface{}) map[string]interface{} {
+	if len(upper) == 0 && lower != nil {
+		return lower
 	}
-	for key, srcVal := range src {
-		if dstVal, ok := dst[key]; ok {
-			srcMap, srcOk := srcVal.(map[string]interface{})
-			dstMap, dstOk := dstVal.(map[string]interface{})
-			if srcOk && dstOk {
-				dst[key] = mergeMaps(dstMap, srcMap)
-				continue
-			}
+	if len(lower) == 0 && upper != nil {
+		return upper
+	}
+	res := copyMap(lower)
+	for key, upperVal := range upper {
+		if lowerVal, ok := lower[key]; ok {
+			res[key] = overlayValue(lowerVal, upperVal)
+			continue
 		}
-		dst[key] = srcVal
+		res[key] = upperVal
 	}
-	return dst
+	return res
+}
+
+// overlayValue merges upper over lower. Maps are merged recursively, and a
+// map with numeric keys, as set by overrides such as "endpoints.1.url",
+// merges into a list item by item. Other values replace lower.
+func overlayValue(lower, upper interface{}) interface{} {
+	upperMap, ok := upper.(map[string]interface{})
+	if !ok {
+		return upper
+	}
+	switch l := lower.(type) {
+	case map[string]interface{}:
+		return overlayMaps(l, upperMap)
+	case []interface{}:
+		if items, ok := overlayList(l, upperMap); ok {
+			return items
+		}
+	case []string:
+		items := make([]interface{}, len(l))
+		for i, s := range l {
+			items[i] = s
+		}
+		if items, ok := overlayList(items, upperMap); ok {
+			return items
+		}
+	}
+	return upper
+}
+
+// overlayList merges the items of upper, keyed by index, over a copy of
+// lower. Indexes past the end extend the list. It reports false if upper
+// has keys that are not indexes.
+func overlayList(lower []interface{}, upper map[string]interface{}) ([]interface{}, bool) {
+	res := append([]interface{}(nil), lower...)
+	for key := range upper {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 {
+			return nil, false
+		}
+		for len(res) <= i {
+			res = append(res, nil)
+		}
+	}
+	for key, value := range upper {
+		i, _ := strconv.Atoi(key)
+		if res[i] == nil {
+			res[i] = value
+		} else {
+			res[i] = overlayValue(res[i], value)
+		}
+	}
+	return res, true
+}
+
+// copyMap returns a shallow copy of m.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
 }
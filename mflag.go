@@ -3,47 +3,202 @@
 package mflag
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/big"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
+	"unicode"
 )
 
 var (
-	ErrInitFailed = errors.New("mflag: Init failed")
+	ErrInitFailed   = errors.New("mflag: Init failed")
+	ErrInvalidValue = errors.New("mflag: invalid value")
+	ErrMissingKey   = errors.New("mflag: missing required key")
+	// ErrExitRequested is returned by ParseWithError when a built-in flag,
+	// such as --version, has done its work and the program should exit
+	// successfully. Parse exits with status 0 instead.
+	ErrExitRequested = errors.New("mflag: exit requested")
+	// ErrDecryptionFailed is returned by Parse when an ENC[...] value cannot
+	// be decrypted.
+	ErrDecryptionFailed = errors.New("mflag: decryption failed")
+	// ErrStaleConfig is returned by InitContext, and passed to the function
+	// set with OnFallback, when the last good configuration of
+	// WithFallbackToLastGood was loaded instead of a failing one.
+	ErrStaleConfig = errors.New("mflag: using last good configuration")
 )
 
 var (
 	defaults    = newManager()
 	config      = newManager()
+	flagConfig  = newManager() // values explicitly set on the command line
+	assigned    = newManager() // values set with Set
 	finalConfig = newManager()
 	parsed      = false
+	// defaultFuncs holds the functions computing defaults, set with
+	// SetDefaultFunc.
+	defaultFuncs = make(map[string]func() interface{})
+
+	flagNameMapper = kebabCase
+	// flagKeys maps the names of the generated flags back to their keys.
+	flagKeys = make(map[string]string)
+	// builtinFlags holds the names of the flags mflag adds on its own.
+	builtinFlags = make(map[string]bool)
+
+	// stdout is where built-in flags write their output.
+	stdout io.Writer = os.Stdout
 )
 
 func init() {
 	flag.Usage = func() {
-		flag.PrintDefaults()
+		printUsage(flag.CommandLine)
 	}
 }
 
 // SetDefault sets a default value for a key.
 // Defaults have the lowest precedence and are overridden by config files and flags.
+// Defaults are fixed once parsed: called after Parse, SetDefault does not
+// change what the getters return but queues the default, which the next
+// Reload or Parse applies. A Reload that is rejected or fails keeps it
+// queued.
 // It should be called before Init and Parse.
 func SetDefault(key string, value interface{}) {
+	delete(defaultFuncs, key)
+	if parsed {
+		queueDefault(key, value)
+		return
+	}
 	defaults.SetValue(key, value)
 }
 
+// SetDefaults sets the defaults of every key in values, a nested map laid
+// out like the config file, at once:
+//
+//	mflag.SetDefaults(map[string]interface{}{
+//		"server": map[string]interface{}{"port": 8080, "timeout": "5s"},
+//		"log":    map[string]interface{}{"level": "info"},
+//	})
+//
+// sets "server.port", "server.timeout" and "log.level" as SetDefault does.
+// Nested maps are merged into the defaults already set rather than
+// replacing them; an empty map sets an empty map.
+// It should be called before Init and Parse.
+func SetDefaults(values map[string]interface{}) {
+	setDefaults("", convertMap(values))
+}
+
+// setDefaults sets the defaults of the keys in values below prefix.
+func setDefaults(prefix string, values map[string]interface{}) {
+	for key, value := range values {
+		key = joinKey(prefix, key)
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			setDefaults(key, nested)
+			continue
+		}
+		SetDefault(key, value)
+	}
+}
+
+// Set sets the value of key from the program, such as a setting changed
+// by the user of an application, taking precedence over the config file,
+// the environment and the flags. SaveConfig saves the values set with Set
+// to the config file. Like the --set flag, key may index the items of a
+// list, up to one past its end; writes further past the end are ignored.
+// Must be called after Parse.
+func Set(key string, value interface{}) {
+	mustBeParsed()
+	if finalConfig.checkIndexes(key) != nil {
+		return
+	}
+	assigned.SetValue(key, value)
+	finalConfig.SetValue(key, value)
+}
+
+// SetDefaultFunc sets a default for a key that is computed by fn when Parse
+// is called, for defaults depending on the environment the program runs in:
+//
+//	mflag.SetDefaultFunc("node_id", func() interface{} {
+//		name, _ := os.Hostname()
+//		return name
+//	})
+//
+// fn is called on every Parse, even if the key is set by another source, so
+// it should be cheap. A later SetDefault replaces it.
+// It should be called before Init and Parse.
+func SetDefaultFunc(key string, fn func() interface{}) {
+	defaultFuncs[key] = fn
+}
+
 // Init loads configuration from a YAML file at the given path. It should be
-// called after setting defaults and before parsing flags.
+// called after setting defaults and before parsing flags. Environment
+// variables and a leading ~ in the path are expanded, as in
+// "${CONFIG_DIR}/app.yaml". Sources of providers added with
+// RegisterProvider are accepted too, see Open. See InitContext to bound the
+// time loading may take. In a child started with CommandWithConfig, the
+// file passed by the parent is loaded instead.
 func Init(filename string) error {
-	return config.LoadFile(filename)
+	if path, ok := parentConfig(); ok {
+		filename = path
+	}
+	p, err := Open(filename)
+	if err != nil {
+		return err
+	}
+	return InitContext(context.Background(), p)
 }
 
-// mustBeParsed checks if Parse() has been called and panics if not.
+// InitOptional loads the first of the config files at paths that exists,
+// as Init does, so that a program can look in the usual places:
+//
+//	mflag.InitOptional("./app.yaml", "~/.config/app/app.yaml", "/etc/app/app.yaml")
+//
+// ConfigFilesUsed reports the file that was loaded. Paths referencing unset
+// environment variables are skipped. Finding none of the files is not an
+// error unless RequireConfigFile was called: the configuration then comes
+// from the defaults, the environment and the flags alone, as when Init is
+// not called at all. In a child started with CommandWithConfig, the file
+// passed by the parent is loaded instead.
+func InitOptional(paths ...string) error {
+	if path, ok := parentConfig(); ok {
+		return Init(path)
+	}
+	for _, path := range paths {
+		expanded, err := expandPath(path)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(expanded); err == nil {
+			return Init(path)
+		}
+	}
+	if requireConfigFile {
+		return fmt.Errorf("%w: no config file found at %s", ErrInitFailed, strings.Join(paths, ", "))
+	}
+	source = nil
+	resetFilesUsed()
+	setConfig(map[string]interface{}{})
+	return nil
+}
+
+// mustBeParsed checks if Parse() has been called and panics if not, unless
+// SetLazyParse allows parsing implicitly.
 // This follows the same pattern as the standard flag package.
 func mustBeParsed() {
+	if lazyParse {
+		parseLazily()
+		return
+	}
 	if !parsed {
 		panic("mflag: Parse() must be called before using Get* functions")
 	}
@@ -141,6 +296,33 @@ func GetFloat64(key string) float64 {
 	return finalConfig.GetFloat64(key)
 }
 
+// GetFloat32 returns the value associated with the key as a float32.
+// Must be called after Parse.
+func GetFloat32(key string) float32 {
+	mustBeParsed()
+	return finalConfig.GetFloat32(key)
+}
+
+// GetComplex128 returns the value associated with the key as a complex128.
+// Strings such as "1+2i" are parsed; numbers have a zero imaginary part.
+// Must be called after Parse.
+func GetComplex128(key string) complex128 {
+	mustBeParsed()
+	return finalConfig.GetComplex128(key)
+}
+
+// GetBigInt returns the value associated with the key as a *big.Int, for
+// integers exceeding int64 such as token supplies. Integers too large for
+// the other getters keep all their digits when loaded from YAML, in maps
+// and lists alike. Strings are decimal, as for GetInt, and may use
+// scientific notation such as "1e30".
+// It returns nil if the value is missing or not an integer.
+// Must be called after Parse.
+func GetBigInt(key string) *big.Int {
+	mustBeParsed()
+	return finalConfig.GetBigInt(key)
+}
+
 // GetDuration returns the value associated with the key as a time.Duration.
 // Must be called after Parse.
 func GetDuration(key string) time.Duration {
@@ -148,22 +330,138 @@ func GetDuration(key string) time.Duration {
 	return finalConfig.GetDuration(key)
 }
 
+// GetLogLevel returns the value associated with the key as a slog.Level.
+// It accepts "debug", "info", "warn" (or "warning") and "error", optionally
+// with an offset such as "info+2", and numeric levels. Missing or invalid
+// values yield slog.LevelInfo.
+// Must be called after Parse.
+func GetLogLevel(key string) slog.Level {
+	mustBeParsed()
+	return finalConfig.GetLogLevel(key)
+}
+
+// GetBytes returns the value associated with the key as a byte slice, for
+// binary material such as HMAC keys. Strings prefixed with "base64:" or
+// "hex:" are decoded; other strings are returned as is. Missing values and
+// values that fail to decode yield nil.
+// Must be called after Parse.
+func GetBytes(key string) []byte {
+	mustBeParsed()
+	return finalConfig.GetBytes(key)
+}
+
 // GetStringMapString returns the value associated with the key as a map of strings.
+// Nested maps and lists are flattened under keys joined with dots, such as
+// "limits.cpu"; see GetStringMapAny for the values themselves.
 // Must be called after Parse.
 func GetStringMapString(key string) map[string]string {
 	mustBeParsed()
 	return finalConfig.GetStringMapString(key)
 }
 
+// GetStringMapStringE is like GetStringMapString, but returns an error
+// wrapping ErrInvalidValue if the value is not a map of scalars, instead of
+// converting it.
+// Must be called after Parse.
+func GetStringMapStringE(key string) (map[string]string, error) {
+	mustBeParsed()
+	return finalConfig.GetStringMapStringE(key)
+}
+
+// GetStringMapAny returns a copy of the map associated with the key, with
+// values of their loaded types and nested maps intact.
+// Must be called after Parse.
+func GetStringMapAny(key string) map[string]interface{} {
+	mustBeParsed()
+	return finalConfig.GetStringMapAny(key)
+}
+
+// GetRegexp returns the value associated with the key compiled as a regular
+// expression, or nil if it is missing or invalid. It compiles the pattern
+// once and returns the same *regexp.Regexp afterwards, which is safe for
+// concurrent use. Declare the key with DeclareKey(key, Regexp) so that an
+// invalid pattern makes Parse fail instead of surfacing at first use.
+// Must be called after Parse.
+func GetRegexp(key string) *regexp.Regexp {
+	mustBeParsed()
+	return finalConfig.GetRegexp(key)
+}
+
+// GetLocation returns the time zone named by the value associated with the
+// key, an IANA name such as "America/New_York", "UTC" or "Local". It returns
+// time.UTC if the key is missing and nil if the name is invalid. Declare the
+// key with DeclareKey(key, Location) so that an invalid name makes Parse
+// fail. Systems without a time zone database need to import time/tzdata.
+// Must be called after Parse.
+func GetLocation(key string) *time.Location {
+	mustBeParsed()
+	return finalConfig.GetLocation(key)
+}
+
+// GetCron returns the value associated with the key parsed as a cron
+// expression by ParseCron or the parser set with SetCronParser, or nil if it
+// is missing or invalid. Declare the key with DeclareKey(key, Cron) so that
+// a typo in a schedule makes Parse fail at startup.
+// Must be called after Parse.
+func GetCron(key string) Schedule {
+	mustBeParsed()
+	return finalConfig.GetCron(key)
+}
+
+// GetTemplate returns the value associated with the key parsed as a
+// text/template, for values such as log formats or notification messages.
+// The template is named after the key, so parse and execution errors point
+// at the key. Without funcs, it is parsed on the first call and the same
+// template is returned afterwards; with funcs, it is parsed on every call,
+// so that each caller gets a template using its own funcs.
+// It returns an error wrapping ErrMissingKey if the key is not set to a
+// string, or ErrInvalidValue if the template does not parse.
+// Must be called after Parse.
+func GetTemplate(key string, funcs template.FuncMap) (*template.Template, error) {
+	mustBeParsed()
+	return finalConfig.GetTemplate(key, funcs)
+}
+
 // GetStringSlice returns the value associated with the key as a slice of strings.
+// A string value is split on the separator set with SetSliceSeparator, a
+// comma by default.
 // Must be called after Parse.
 func GetStringSlice(key string) []string {
 	mustBeParsed()
 	return finalConfig.GetStringSlice(key)
 }
 
+// GetStringSliceSep is like GetStringSlice, but splits a string value on sep
+// instead of the separator set with SetSliceSeparator. An empty sep does not
+// split it.
+// Must be called after Parse.
+func GetStringSliceSep(key, sep string) []string {
+	mustBeParsed()
+	return finalConfig.getStringSliceSep(key, sep)
+}
+
+// GetStringMapStringCached is like GetStringMapString, but returns the same
+// map on every call until the configuration changes, so it does not allocate
+// on hot paths. The map is shared and must not be modified.
+// Must be called after Parse.
+func GetStringMapStringCached(key string) map[string]string {
+	mustBeParsed()
+	return finalConfig.getStringMapStringCached(key)
+}
+
+// GetStringSliceCached is like GetStringSlice, but returns the same slice on
+// every call until the configuration changes, so it does not allocate on
+// hot paths. The slice is shared and must not be modified.
+// Must be called after Parse.
+func GetStringSliceCached(key string) []string {
+	mustBeParsed()
+	return finalConfig.getStringSliceCached(key)
+}
+
 // GetStringSet returns the string slice value associated with a key as a map[string]bool (a set).
 // This is useful for efficiently checking for the existence of an item in a list, like a feature flag.
+// Sets are order-insensitive: the order of the configured list does not matter and duplicates collapse.
+// See InSet for membership checks that do not allocate.
 // Must be called after Parse.
 func GetStringSet(key string) map[string]bool {
 	mustBeParsed()
@@ -175,18 +473,177 @@ func GetStringSet(key string) map[string]bool {
 	return m
 }
 
+// GetSet returns the slice value associated with a key as a set of T.
+// Items are converted to T following the same rules as the typed getters,
+// e.g. GetSet[int] accepts both 8080 and "8080"; items that cannot be
+// converted are skipped. Like GetStringSet, it is order-insensitive.
+// Must be called after Parse.
+func GetSet[T comparable](key string) map[T]struct{} {
+	mustBeParsed()
+	items := finalConfig.getItems(key)
+	set := make(map[T]struct{}, len(items))
+	for _, item := range items {
+		if v, ok := convertItem[T](item); ok {
+			set[v] = struct{}{}
+		}
+	}
+	return set
+}
+
+// InSet reports whether member is an item of the slice value associated with
+// a key. Unlike GetStringSet, it does not allocate when the value is a list
+// of strings, numbers or booleans, which makes it suitable for
+// feature-flag style checks in hot paths.
+// Must be called after Parse.
+func InSet(key string, member string) bool {
+	mustBeParsed()
+	switch v := finalConfig.Get(key).(type) {
+	case []string:
+		return slices.Contains(v, member)
+	case []interface{}:
+		for _, item := range v {
+			if itemIs(item, member) {
+				return true
+			}
+		}
+	case string:
+		return slices.Contains(splitList(v, sliceSeparator), member)
+	}
+	return false
+}
+
+// itemIs reports whether item, an item of a list, is formatted as member,
+// formatting strings, numbers and booleans without allocating.
+func itemIs(item interface{}, member string) bool {
+	var buf [64]byte
+	switch v := item.(type) {
+	case string:
+		return v == member
+	case int:
+		return string(strconv.AppendInt(buf[:0], int64(v), 10)) == member
+	case int64:
+		return string(strconv.AppendInt(buf[:0], v, 10)) == member
+	case uint64:
+		return string(strconv.AppendUint(buf[:0], v, 10)) == member
+	case float64:
+		return string(strconv.AppendFloat(buf[:0], v, 'g', -1, 64)) == member
+	case bool:
+		return strconv.FormatBool(v) == member
+	}
+	return fmt.Sprint(item) == member
+}
+
+// convertItem converts a slice item to T, reporting whether it succeeded.
+func convertItem[T comparable](item interface{}) (T, bool) {
+	if v, ok := item.(T); ok {
+		return v, true
+	}
+	var result T
+	var err error
+	switch p := any(&result).(type) {
+	case *string:
+		*p = fmt.Sprintf("%v", item)
+	case *int:
+		*p, err = castToInt(item)
+	case *int64:
+		var i int
+		i, err = castToInt(item)
+		*p = int64(i)
+	case *uint64:
+		*p, err = castToUint64(item)
+	case *uint:
+		var u uint64
+		u, err = castToUint64(item)
+		*p = uint(u)
+	case *float64:
+		*p, err = castToFloat64(item)
+	case *bool:
+		*p, err = castToBool(item)
+	case *time.Duration:
+		*p, err = castToDuration(item)
+	default:
+		return result, false
+	}
+	return result, err == nil
+}
+
 // IsSet checks if a key is set in the configuration.
+// Keys that only have a default value are set too; see IsExplicitlySet.
 // Must be called after Parse.
 func IsSet(key string) bool {
 	mustBeParsed()
 	return finalConfig.IsSet(key)
 }
 
+// IsNull reports whether the key is explicitly set to null, e.g. with
+// "key: null" or "key: ~" in the config file. A null value overrides the
+// values of lower layers, such as the default, and makes the key not set:
+// IsSet returns false and getters return zero values.
+// Must be called after Parse.
+func IsNull(key string) bool {
+	mustBeParsed()
+	return finalConfig.IsNull(key)
+}
+
+// IsExplicitlySet reports whether the operator configured the key, in the
+// config file, another layer or on the command line, as opposed to it only
+// having a default. Keys set through a "_file" key, or set to null, count as
+// configured.
+// Must be called after Parse.
+func IsExplicitlySet(key string) bool {
+	mustBeParsed()
+	for _, name := range layerOrder {
+		layer := layerManager(name)
+		if name != defaultsLayer && (layer.Has(key) || layer.IsSet(key+fileKeySuffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// WasChangedFromDefault reports whether the effective value of the key
+// differs from its default, so that a key explicitly set to its default
+// value is not reported as changed.
+// Must be called after Parse.
+func WasChangedFromDefault(key string) bool {
+	mustBeParsed()
+	return !reflect.DeepEqual(finalConfig.Get(key), defaults.Get(key))
+}
+
 // AllKeys returns all keys in the config, flattened with dot notation.
+// Keys are sorted segment by segment, so that the keys of a section are
+// listed together. Options such as WithSections and WithPrefix include the
+// keys holding maps or filter the keys.
+// Must be called after Parse.
+func AllKeys(opts ...KeysOption) []string {
+	mustBeParsed()
+	return selectKeys(finalConfig, opts)
+}
+
+// KeysWithPrefix returns the keys starting with prefix, flattened with dot
+// notation and sorted. Use a trailing dot, as in "database.", to match the
+// keys below a section only.
+// Must be called after Parse.
+func KeysWithPrefix(prefix string) []string {
+	mustBeParsed()
+	return finalConfig.KeysWithPrefix(prefix)
+}
+
+// HasPrefix reports whether any key starts with prefix.
 // Must be called after Parse.
-func AllKeys() []string {
+func HasPrefix(prefix string) bool {
 	mustBeParsed()
-	return finalConfig.AllKeys()
+	return len(finalConfig.KeysWithPrefix(prefix)) > 0
+}
+
+// SubKeys returns the names of the direct children of the section at key,
+// sorted. For example, with one section per plugin under "plugins",
+// SubKeys("plugins") returns the configured plugin names. It returns nil if
+// the key does not hold a section.
+// Must be called after Parse.
+func SubKeys(key string) []string {
+	mustBeParsed()
+	return finalConfig.SubKeys(key)
 }
 
 // Debug prints all configuration values to standard output.
@@ -202,6 +659,10 @@ func Debug() {
 	for _, key := range keys {
 		value := finalConfig.Get(key)
 		defaultValue := defaults.Get(key)
+		if isSecret(key) {
+			fmt.Printf("  %s: %s (%T)\n", key, secretMask, value)
+			continue
+		}
 		if defaultValue != nil {
 			fmt.Printf("  %s: %v (%T) (default: %v)\n", key, value, value, defaultValue)
 		} else {
@@ -211,122 +672,347 @@ func Debug() {
 	fmt.Println("---------------------------")
 }
 
+// SetFlagNameMapper sets the function deriving flag names from keys.
+// By default dots and underscores are replaced by dashes, so the key
+// "database.max_conns" is exposed as --database-max-conns. A nil mapper
+// uses the keys unchanged. It should be called before Parse.
+func SetFlagNameMapper(mapper func(key string) string) {
+	if mapper == nil {
+		mapper = func(key string) string { return key }
+	}
+	flagNameMapper = mapper
+}
+
+// kebabReplacer replaces the separators of keys by dashes.
+var kebabReplacer = strings.NewReplacer(".", "-", "_", "-")
+
+// kebabCase is the default flag name mapper.
+func kebabCase(key string) string {
+	return kebabReplacer.Replace(key)
+}
+
 // populateFlagSet dynamically creates flags for all known keys on a given flag set.
 // It returns a slice of errors for any invalid default values encountered.
 func populateFlagSet(fs *flag.FlagSet) []error {
 	allKeys := finalConfig.AllKeys()
+	for key, s := range specs {
+		// Maps get a flag of their own besides the flags of their entries.
+		if s.typ != 0 && (!finalConfig.IsSet(key) || s.typ == StringMap) {
+			allKeys = append(allKeys, key)
+		}
+	}
+	slices.Sort(allKeys)
+
+	flagKeys = make(map[string]string, len(allKeys))
+	flagAliases = make(map[string]string)
 	var errs []error
 	for _, key := range allKeys {
-		value := finalConfig.Get(key)
-		usage := fmt.Sprintf("override configuration for '%s'", key)
-
-		switch v := value.(type) {
-		case bool:
-			fs.Bool(key, v, usage)
-		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-			isUint := false
-			if dv := defaults.Get(key); dv != nil {
-				switch dv.(type) {
-				case uint, uint8, uint16, uint32, uint64:
-					isUint = true
-				}
-			}
-
-			if isUint {
-				val, err := castToUint64(v)
-				if err != nil {
-					errs = append(errs, fmt.Errorf("invalid value for uint flag %q: %w", key, err))
-					continue
-				}
-				fs.Uint64(key, val, usage)
-			} else {
-				val, err := castToInt(v)
-				if err != nil {
-					errs = append(errs, fmt.Errorf("invalid default for flag %q: %w", key, err))
-					continue
-				}
-				fs.Int(key, val, usage)
-			}
-		case float64:
-			val, err := castToFloat64(v)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("invalid default for flag %q: %w", key, err))
-				continue
-			}
-			fs.Float64(key, val, usage)
-		case time.Duration:
-			val, err := castToDuration(v)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("invalid default for flag %q: %w", key, err))
-				continue
-			}
-			fs.Duration(key, val, usage)
-		default: // string, slices, maps, etc.
-			fs.String(key, finalConfig.GetString(key), usage)
+		if boundFlags[key] && fs.Lookup(key) != nil {
+			flagKeys[key] = key
+			continue
+		}
+		name := flagNameMapper(key)
+		if other, ok := flagKeys[name]; ok {
+			errs = append(errs, fmt.Errorf("keys %q and %q map to the same flag name %q", other, key, name))
+			continue
+		}
+		if fs.Lookup(name) != nil {
+			errs = append(errs, fmt.Errorf("flag %q for key %q is already defined; use BindStandardFlag to bind it", name, key))
+			continue
+		}
+		flagKeys[name] = key
+		err := defineFlag(fs, name, key, finalConfig)
+		if err != nil && lenient {
+			// validate reports the invalid value and falls back to the
+			// default, which the flag starts from as well.
+			err = defineFlag(fs, name, key, defaults)
+		}
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
+	if fs.Lookup(setFlagName) == nil {
+		builtinFlags[setFlagName] = true
+		fs.Var(&setValue{}, setFlagName, "override any configuration key, as `key=value` (repeatable)")
+	}
 	return errs
 }
 
+// defineFlag defines the flag called name for key on fs. The flag type
+// follows the type of the key and its default is the key's value in m.
+func defineFlag(fs *flag.FlagSet, name, key string, m *mapManager) error {
+	value := m.Get(key)
+	usage := usageFor(key)
+	switch keyType(key) {
+	case Bool:
+		val, err := castToBool(value)
+		if err != nil {
+			return fmt.Errorf("%w for flag %q: %w", ErrInvalidValue, key, err)
+		}
+		fs.Bool(name, val, usage)
+	case Int:
+		val, err := castToInt(value)
+		if err != nil {
+			return fmt.Errorf("%w for flag %q: %w", ErrInvalidValue, key, err)
+		}
+		fs.Int(name, val, usage)
+	case Uint:
+		val, err := castToUint64(value)
+		if err != nil {
+			return fmt.Errorf("%w for uint flag %q: %w", ErrInvalidValue, key, err)
+		}
+		fs.Uint64(name, val, usage)
+	case Float64:
+		val, err := castToFloat64(value)
+		if err != nil {
+			return fmt.Errorf("%w for flag %q: %w", ErrInvalidValue, key, err)
+		}
+		fs.Float64(name, val, usage)
+	case Duration:
+		val, err := castToDuration(value)
+		if err != nil {
+			return fmt.Errorf("%w for flag %q: %w", ErrInvalidValue, key, err)
+		}
+		if unit := durationUnit(key); unit != 0 {
+			fs.Var(&durationValue{d: val, unit: unit}, name, usage)
+			break
+		}
+		fs.Duration(name, val, usage)
+	case StringSlice:
+		if items, ok := value.([]interface{}); ok && len(items) > 0 && typeOf(items[0]) != String {
+			fs.Var(&listValue{elem: typeOf(items[0]), values: slices.Clone(items)}, name, usage)
+			break
+		}
+		fs.Var(newStringSliceValue(m.GetStringSlice(key)), name, usage)
+	case StringMap:
+		current, _ := value.(map[string]interface{})
+		fs.Var(&mapValue{current: current}, name, usage)
+	default: // strings, lists of maps, etc.
+		if items, ok := value.([]interface{}); ok {
+			fs.Var(&listValue{values: slices.Clone(items)}, name, usage)
+			break
+		}
+		fs.String(name, m.GetString(key), usage)
+	}
+	return nil
+}
+
+// parseDurationString parses s if it is a duration with a unit, e.g. "1h30m".
+// Bare numbers are not considered durations.
+func parseDurationString(s string) (time.Duration, bool) {
+	if strings.IndexFunc(s, unicode.IsLetter) < 0 {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil
+}
+
+// applySetFlag applies the key=value pairs given with --set. Values are
+// parsed according to the type of the key. Items are checked against the
+// lists of finalConfig, which is the merged configuration below the flags,
+// and written to it too so that later pairs may append further items.
+func applySetFlag(pairs [][2]string) error {
+	var errs []error
+	for _, pair := range pairs {
+		key, raw := resolveAlias(pair[0]), pair[1]
+		value, err := parseKey(key, raw)
+		if err == nil {
+			err = finalConfig.checkIndexes(key)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w %q for %q: %w", ErrInvalidValue, raw, key, err))
+			continue
+		}
+		flagConfig.SetValue(key, value)
+		finalConfig.SetValue(key, value)
+	}
+	return errors.Join(errs...)
+}
+
 // Parse parses command-line arguments and merges all configuration sources.
 // It MUST be called after setting defaults and calling Init. It dynamically creates
 // command-line flags for all known configuration keys.
-// Precedence: Flags > Config File > Defaults.
+// Precedence: Flags > Environment > Config File > Defaults, see Env and
+// AddLayer.
 func Parse() {
-	// 1. Start with a copy of the defaults.
-	finalConfig = defaults.Clone()
-
-	// 2. Merge config file values on top of defaults.
-	finalConfig.Merge(config)
-
-	// 3. Populate the global command-line flag set.
-	errs := populateFlagSet(flag.CommandLine)
-
-	if len(errs) > 0 {
+	if err := parse(flag.CommandLine, os.Args[1:]); err != nil {
+		if errors.Is(err, ErrExitRequested) {
+			os.Exit(0)
+		}
 		// Mimic the behavior of the standard flag package on error.
-		fmt.Fprintln(flag.CommandLine.Output(), errors.Join(errs...))
+		fmt.Fprintln(flag.CommandLine.Output(), err)
 		os.Exit(1)
 	}
+}
 
-	flag.Parse()
+// ParseOption configures ParseWithError.
+type ParseOption func(*parseOptions)
 
-	// 4. Overwrite finalConfig with values from flags that were explicitly set
-	//    on the command line. This gives them the highest precedence.
-	flag.Visit(func(f *flag.Flag) {
-		getter := f.Value.(flag.Getter)
-		finalConfig.SetValue(f.Name, getter.Get())
-	})
-	parsed = true
+// parseOptions holds the settings of ParseWithError.
+type parseOptions struct {
+	commandLine bool
+}
+
+// WithCommandLine makes ParseWithError parse flag.CommandLine, including the
+// flags registered on it by the application and by libraries, instead of a
+// private flag set. As flag.CommandLine exits on errors, it is replaced by an
+// equivalent flag set carrying over every registered flag with
+// flag.ContinueOnError semantics.
+func WithCommandLine() ParseOption {
+	return func(o *parseOptions) {
+		o.commandLine = true
+	}
 }
 
 // ParseWithError is similar to Parse but returns an error on failure.
 // This allows for more granular error handling.
-// Note: This function creates its own temporary flag set and does not parse
-// flags defined globally via the standard `flag` package.
-func ParseWithError() error {
-	// 1. Start with a copy of the defaults.
-	finalConfig = defaults.Clone()
+// Note: By default this function creates its own temporary flag set and does
+// not parse flags defined globally via the standard `flag` package, unless
+// they are bound with BindStandardFlag. Use WithCommandLine to parse
+// flag.CommandLine instead.
+func ParseWithError(opts ...ParseOption) error {
+	var o parseOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	// 2. Merge config file values on top of defaults.
-	finalConfig.Merge(config)
+	if o.commandLine {
+		fs := flag.NewFlagSet(flag.CommandLine.Name(), flag.ContinueOnError)
+		fs.SetOutput(flag.CommandLine.Output())
+		fs.Usage = flag.CommandLine.Usage
+		flag.CommandLine.VisitAll(func(f *flag.Flag) {
+			fs.Var(f.Value, f.Name, f.Usage)
+		})
+		flag.CommandLine = fs
+		return parse(fs, os.Args[1:])
+	}
 
-	// 3. Dynamically create flags for all known keys on a temporary flag set.
 	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.Usage = func() { printUsage(fs) }
+	return parse(fs, os.Args[1:])
+}
 
-	// 4. Populate the temporary flag set.
-	if errs := populateFlagSet(fs); len(errs) > 0 {
+// parse merges all configuration sources, overrides them with the flags
+// explicitly set in args and validates the result. It is the shared
+// implementation of Parse and ParseWithError.
+func parse(fs *flag.FlagSet, args []string) error {
+	// 1. Defaults set since the last Parse are applied, computed defaults
+	// are evaluated, and standard flags bound to keys provide defaults for
+	// them.
+	applyQueuedDefaults()
+	for _, key := range slices.Sorted(maps.Keys(defaultFuncs)) {
+		defaults.SetValue(key, defaultFuncs[key]())
+	}
+	warnings = nil
+	bindStandardFlags(fs)
+	if err := tolerate(loadEnv()); err != nil {
+		return err
+	}
+
+	// 2. Merge the defaults, the config file, the environment and any other
+	// layer. Merging shares the maps of the layers instead of copying them,
+	// so large defaults cost little here. The flags layer is merged once
+	// the command line is parsed.
+	finalConfig = mergeLayers(config, newManager())
+
+	// 3. Dynamically create flags for all known keys.
+	if err := tolerate(errors.Join(populateFlagSet(fs)...)); err != nil {
+		return err
+	}
+	if errs := registerAliasFlags(fs); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if errs := registerCountFlags(fs); len(errs) > 0 {
 		return errors.Join(errs...)
 	}
 
-	// 5. Parse the command-line arguments.
-	if err := fs.Parse(os.Args[1:]); err != nil {
+	showVersion := registerVersionFlag(fs)
+	dumpConfig := registerDumpConfigFlag(fs)
+	validateConfig := registerValidateConfigFlag(fs)
+	listConfigKeys := registerListConfigKeysFlag(fs)
+
+	// 4. Parse the command-line arguments.
+	if err := fs.Parse(expandIndexFlags(fs, finalConfig, expandCountFlags(fs, args))); err != nil {
 		return err
 	}
+	if showVersion != nil && *showVersion {
+		printVersion(stdout)
+		return ErrExitRequested
+	}
+	if listConfigKeys != nil && *listConfigKeys {
+		if err := printKeys(stdout); err != nil {
+			return err
+		}
+		return ErrExitRequested
+	}
 
+	// 5. Overwrite finalConfig with values from flags that were explicitly set
+	//    on the command line. This gives them the highest precedence.
+	//    Generic --set overrides are applied last.
+	flagConfig = newManager()
+	var sets [][2]string
 	fs.Visit(func(f *flag.Flag) {
-		getter := f.Value.(flag.Getter)
-		finalConfig.SetValue(f.Name, getter.Get())
+		if sv, ok := f.Value.(*setValue); ok {
+			sets = sv.pairs
+			return
+		}
+		key, ok := flagKeys[f.Name]
+		if !ok {
+			return // Not a flag generated by mflag.
+		}
+		flagConfig.SetValue(key, flagValue(f))
 	})
+	if err := tolerate(applySetFlag(sets)); err != nil {
+		return err
+	}
+	// --validate-config checks the configuration as given, without falling
+	// back to the last known good one.
+	validating := validateConfig != nil && *validateConfig
+	finalConfig = mergeLayers(config, flagConfig)
+	if err := resolveValues(finalConfig, config); err != nil {
+		if validating {
+			return err
+		}
+		if err := parseLastKnownGood(err); err != nil {
+			return err
+		}
+	}
+	finalConfig.buildIndex()
+
+	if dumpConfig != nil && *dumpConfig {
+		printConfig(stdout)
+		return ErrExitRequested
+	}
+
+	// 6. Reject values that violate what was declared for their keys.
+	err := validate(finalConfig)
+	if validating {
+		// Problems tolerated by SetLenient make the configuration invalid
+		// too.
+		errs := append([]error{err, lastKnownGoodCause()}, warnings...)
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "configuration is valid")
+		return ErrExitRequested
+	}
+	if err != nil {
+		if err := tolerate(parseLastKnownGood(err)); err != nil {
+			return err
+		}
+		if lenient {
+			fallBack(finalConfig)
+			finalConfig.buildIndex()
+		}
+	}
+	// The implicit parse of SetLazyParse leaves out the command line, so
+	// its configuration is neither saved nor audited.
+	if !lazyParsing {
+		if len(warnings) == 0 {
+			saveLastKnownGood(finalConfig)
+		}
+		auditChanges(defaults, finalConfig, sourceOf)
+	}
 	parsed = true
 	return nil
 }
@@ -334,15 +1020,85 @@ func ParseWithError() error {
 func Reset() {
 	defaults = newManager()
 	config = newManager()
+	flagConfig = newManager()
+	assigned = newManager()
 	finalConfig = newManager()
+	defaultFuncs = make(map[string]func() interface{})
+	layerOrder = []string{defaultsLayer, fileLayer, envLayer, flagsLayer}
+	layers = make(map[string]*mapManager)
 	parsed = false
+	flagNameMapper = kebabCase
+	flagKeys = make(map[string]string)
+	builtinFlags = make(map[string]bool)
+	versionEnabled = false
+	appVersion = ""
+	dumpConfigEnabled = false
+	validateConfigEnabled = false
+	listConfigKeysEnabled = false
+	namespaces = make(map[string]bool)
+	sliceSeparator = ","
+	envConfig = newManager()
+	envAuto, envPrefix, envNameMapper = false, "", defaultEnvName
+	validators = nil
+	countFlags = make(map[string]string)
+	prefixAliases = make(map[string]string)
+	flagAliases = make(map[string]string)
+	boundFlags = make(map[string]bool)
+	stdout = os.Stdout
+	decryptionKey = nil
+	snapshotKey = nil
+	aliasBudget = defaultAliasBudget
+	tlsFilesMu.Lock()
+	tlsFilesInUse = nil
+	tlsFilesMu.Unlock()
+	archiveFileLimit, archiveTotalLimit = defaultArchiveFileLimit, defaultArchiveTotalLimit
+	migrations = make(map[int]migration)
+	versionConstraint, versionClauses = "", nil
+	lastKnownGood = nil
+	auditSink = nil
+	cronParser = ParseCron
+	requireConfigFile = false
+	lenient, warnings = false, nil
+	lazyParse = false
+	lazyDone.Store(false)
+	conflictHook = nil
+	queuedDefaults = nil
+	resetFilesUsed()
+	appliedFile = newManager()
+	source = nil
+	reloadPolicy = ReloadPolicy{}
+	lives = make(map[*Live]struct{})
+	secretHooks = make(map[string][]func(Secret) error)
+	scopes = make(map[string]string)
+	scopeOrder = []string{regionScope, hostnameScope}
+	stable, canary, canaryFile, canaryDefaults, canaryPercent = nil, nil, nil, nil, 0
+	specs = make(map[string]*keySpec)
 
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 }
 
+// castToBool converts an interface{} to a bool.
+func castToBool(v interface{}) (bool, error) {
+	switch val := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return val, nil
+	case string:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return false, fmt.Errorf("cannot cast string %q to bool: %w", val, err)
+		}
+		return b, nil
+	}
+	return false, fmt.Errorf("cannot cast type %T to bool", v)
+}
+
 // castToInt converts an interface{} to an int, handling common numeric types.
 func castToInt(v interface{}) (int, error) {
 	switch val := v.(type) {
+	case nil:
+		return 0, nil
 	case int:
 		return val, nil
 	case int8:
@@ -368,6 +1124,8 @@ func castToInt(v interface{}) (int, error) {
 // castToUint64 converts an interface{} to a uint64.
 func castToUint64(v interface{}) (uint64, error) {
 	switch val := v.(type) {
+	case nil:
+		return 0, nil
 	case uint64:
 		return val, nil
 	case uint:
@@ -406,6 +1164,8 @@ func castToUint64(v interface{}) (uint64, error) {
 // castToFloat64 converts an interface{} to a float64.
 func castToFloat64(v interface{}) (float64, error) {
 	switch val := v.(type) {
+	case nil:
+		return 0, nil
 	case float64:
 		return val, nil
 	case int:
@@ -425,6 +1185,8 @@ func castToFloat64(v interface{}) (float64, error) {
 // castToDuration converts an interface{} to a time.Duration.
 func castToDuration(v interface{}) (time.Duration, error) {
 	switch val := v.(type) {
+	case nil:
+		return 0, nil
 	case time.Duration:
 		return val, nil
 	case string:
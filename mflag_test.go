@@ -1,11 +1,16 @@
 package mflag
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"text/template"
+	"time"
 )
 
 func TestPrecedenceOrder(t *testing.T) {
@@ -31,7 +36,7 @@ features:
 	os.Args = []string{
 		"test_app",
 		"--port=3333",
-		"--db.host=flag.host",
+		"--db-host=flag.host",
 		"--enabled",
 	}
 
@@ -92,6 +97,43 @@ func TestInitNonExistentFile(t *testing.T) {
 	}
 }
 
+func TestInitOptional(t *testing.T) {
+	testReset(t)
+	SetDefault("host", "localhost")
+	path := createTempYAML(t, "host: example.com\n")
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	if err := InitOptional(missing, "$TEST_MFLAG_UNSET/app.yaml", path); err != nil {
+		t.Fatalf("InitOptional() failed: %v", err)
+	}
+	if files := ConfigFilesUsed(); len(files) != 1 || files[0].Path != path {
+		t.Errorf("ConfigFilesUsed() = %v, want %s", files, path)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetString("host"); got != "example.com" {
+		t.Errorf("GetString() = %q, want %q", got, "example.com")
+	}
+
+	testReset(t)
+	SetDefault("host", "localhost")
+	if err := InitOptional(missing); err != nil {
+		t.Fatalf("InitOptional() without any file failed: %v", err)
+	}
+	if files := ConfigFilesUsed(); len(files) != 0 {
+		t.Errorf("ConfigFilesUsed() = %v, want none", files)
+	}
+	Parse()
+	if got := GetString("host"); got != "localhost" {
+		t.Errorf("GetString() = %q, want the default %q", got, "localhost")
+	}
+
+	RequireConfigFile()
+	if err := InitOptional(missing); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("InitOptional() = %v with RequireConfigFile, want ErrInitFailed", err)
+	}
+}
+
 func TestInit_BadYAML(t *testing.T) {
 	testReset(t)
 
@@ -274,6 +316,57 @@ not_a_map: "some_string"
 	}
 }
 
+func TestGetStringMapString_Nested(t *testing.T) {
+	testReset(t)
+	if err := Init(createTempYAML(t, `
+pod:
+  name: web
+  limits: {cpu: 2, memory: 1Gi}
+  hosts: [a, b]
+  ports: [{name: http, port: 80}]
+  empty: null
+`)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	want := map[string]string{
+		"name":          "web",
+		"limits.cpu":    "2",
+		"limits.memory": "1Gi",
+		"hosts.0":       "a",
+		"hosts.1":       "b",
+		"ports.0.name":  "http",
+		"ports.0.port":  "80",
+		"empty":         "",
+	}
+	if got := GetStringMapString("pod"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetStringMapString() = %v, want %v", got, want)
+	}
+
+	if _, err := GetStringMapStringE("pod"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue for nested maps, got %v", err)
+	}
+	if _, err := GetStringMapStringE("pod.name"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue for a string, got %v", err)
+	}
+	if got, err := GetStringMapStringE("pod.limits"); err != nil || got["cpu"] != "2" {
+		t.Errorf("GetStringMapStringE() = %v, %v", got, err)
+	}
+	if got, err := GetStringMapStringE("missing"); err != nil || len(got) != 0 {
+		t.Errorf("Expected an empty map for a missing key, got %v, %v", got, err)
+	}
+
+	raw := GetStringMapAny("pod")
+	if raw["limits"].(map[string]interface{})["cpu"] != 2 {
+		t.Errorf("Expected GetStringMapAny to keep nested values, got %v", raw)
+	}
+	raw["name"] = "changed"
+	if GetString("pod.name") != "web" {
+		t.Error("Expected GetStringMapAny to return a copy")
+	}
+}
+
 func Example() {
 	defer func(oldArgs []string) {
 		os.Args = oldArgs
@@ -356,3 +449,598 @@ func createTempYAML(t *testing.T, content string) string {
 	})
 	return tmpfile.Name()
 }
+
+func TestFlagNameMapper(t *testing.T) {
+	testReset(t)
+
+	SetDefault("app_port", 8080)
+	SetDefault("db.max_conns", 10)
+	os.Args = []string{"test", "--app-port=9090", "--db-max-conns=20"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if v := GetInt("app_port"); v != 9090 {
+		t.Errorf("Expected app_port to be 9090, got %d", v)
+	}
+	if v := GetInt("db.max_conns"); v != 20 {
+		t.Errorf("Expected db.max_conns to be 20, got %d", v)
+	}
+
+	testReset(t)
+	SetFlagNameMapper(nil)
+	SetDefault("db.max_conns", 10)
+	os.Args = []string{"test", "--db.max_conns=30"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() with raw flag names failed: %v", err)
+	}
+	if v := GetInt("db.max_conns"); v != 30 {
+		t.Errorf("Expected db.max_conns to be 30, got %d", v)
+	}
+}
+
+func TestFlagNameMapper_Collision(t *testing.T) {
+	testReset(t)
+
+	SetDefault("db.host", "a")
+	SetDefault("db_host", "b")
+	err := ParseWithError()
+	if err == nil || !strings.Contains(err.Error(), "same flag name") {
+		t.Errorf("Expected a flag name collision error, got: %v", err)
+	}
+}
+
+func TestGetSetAndInSet(t *testing.T) {
+	testReset(t)
+
+	SetDefault("features", []string{"dark_mode", "beta", "dark_mode"})
+	SetDefault("ports", []interface{}{80, "443", "not-a-port"})
+	SetDefault("csv", "a, b")
+	Parse()
+
+	if got, want := GetSet[string]("features"), map[string]struct{}{"dark_mode": {}, "beta": {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSet[string] failed. Expected %v, got %v", want, got)
+	}
+	if got, want := GetSet[int]("ports"), map[int]struct{}{80: {}, 443: {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSet[int] failed. Expected %v, got %v", want, got)
+	}
+
+	tests := []struct {
+		key, member string
+		want        bool
+	}{
+		{"features", "beta", true},
+		{"features", "gamma", false},
+		{"ports", "80", true},
+		{"ports", "443", true},
+		{"csv", "b", true},
+		{"missing", "a", false},
+	}
+	for _, tt := range tests {
+		if got := InSet(tt.key, tt.member); got != tt.want {
+			t.Errorf("InSet(%q, %q) = %v, expected %v", tt.key, tt.member, got, tt.want)
+		}
+	}
+
+	// String values are split like GetStringSlice splits them.
+	testReset(t)
+	SetSliceSeparator(";")
+	SetDefault("hosts", "a,1; b")
+	Parse()
+	if !InSet("hosts", "a,1") || !InSet("hosts", "b") || InSet("hosts", "a") {
+		t.Errorf("Expected InSet to split on the slice separator, got %v", GetStringSlice("hosts"))
+	}
+}
+
+func TestGetDoesNotAllocate(t *testing.T) {
+	testReset(t)
+	SetDefault("server.http.port", 8080)
+	SetDefault("server.http.allowed", []string{"a", "b"})
+	SetDefault("server.http.ports", []interface{}{"80", 8443, 1.5, true})
+	Parse()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = GetInt("server.http.port")
+		_ = InSet("server.http.allowed", "b")
+		_ = InSet("server.http.ports", "8443")
+		_ = InSet("server.http.ports", "true")
+		_ = InSet("server.http.ports", "443")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected lookups not to allocate, got %v allocations", allocs)
+	}
+	if !InSet("server.http.ports", "8443") || !InSet("server.http.ports", "1.5") || !InSet("server.http.ports", "true") || InSet("server.http.ports", "443") {
+		t.Error("Expected InSet to compare numbers and booleans as formatted")
+	}
+	if GetInt("server.http.port") != 8080 || !InSet("server.http.allowed", "b") {
+		t.Error("Unexpected values from the index")
+	}
+}
+
+func TestGetRegexp(t *testing.T) {
+	testReset(t)
+	DeclareKey("routes.allow", Regexp)
+	configPath := createTempYAML(t, "routes:\n  allow: ^/api/v[0-9]+/\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	re := GetRegexp("routes.allow")
+	if re == nil || !re.MatchString("/api/v2/users") || re.MatchString("/admin") {
+		t.Fatalf("Unexpected regexp %v", re)
+	}
+	if GetRegexp("routes.allow") != re {
+		t.Error("Expected the compiled regexp to be reused")
+	}
+	if GetRegexp("routes.missing") != nil {
+		t.Error("Expected nil for a missing key")
+	}
+
+	testReset(t)
+	DeclareKey("routes.allow", Regexp)
+	os.Args = []string{"test", "--set=routes.allow=[unclosed"}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected an invalid pattern to fail Parse, got %v", err)
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, `
+notify:
+  message: "{{ .User | upper }} logged in"
+  broken: "{{ .User "
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	tmpl, err := GetTemplate("notify.message", template.FuncMap{"upper": strings.ToUpper})
+	if err != nil {
+		t.Fatalf("GetTemplate() failed: %v", err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, map[string]string{"User": "ada"}); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+	if out.String() != "ADA logged in" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+	// Later callers get their own funcs.
+	tmpl, err = GetTemplate("notify.message", template.FuncMap{"upper": strings.ToLower})
+	if err != nil {
+		t.Fatalf("GetTemplate() failed: %v", err)
+	}
+	out.Reset()
+	if err := tmpl.Execute(&out, map[string]string{"User": "ADA"}); err != nil || out.String() != "ada logged in" {
+		t.Errorf("Expected the funcs of the second call to be used, got %q, %v", out.String(), err)
+	}
+
+	_, err = GetTemplate("notify.broken", nil)
+	if !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), "notify.broken:1") {
+		t.Errorf("Expected a parse error locating notify.broken, got %v", err)
+	}
+	if _, err := GetTemplate("notify.missing", nil); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("Expected ErrMissingKey, got %v", err)
+	}
+}
+
+func TestNumericGetters(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, `
+token:
+  supply: 123456789012345678901234567890
+  hex: "0xff"
+  grouped: "1_000"
+  sci: 1e21
+  ids: [123456789012345678901234567891, 2]
+  accounts:
+    - balance: 98765432109876543210987654321
+ratio: 0.25
+workers: "1e3"
+signal: "1+2i"
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	if got := GetBigInt("token.supply"); got == nil || got.String() != "123456789012345678901234567890" {
+		t.Errorf("Expected the exact supply, got %v", got)
+	}
+	if got := GetBigInt("token.hex"); got != nil {
+		t.Errorf("Expected nil for a hexadecimal string, as GetInt, got %v", got)
+	}
+	if got := GetBigInt("token.grouped"); got != nil {
+		t.Errorf("Expected nil for digits grouped with underscores, as GetInt, got %v", got)
+	}
+	if got := GetBigInt("token.ids.0"); got == nil || got.String() != "123456789012345678901234567891" {
+		t.Errorf("Expected the exact id in the list, got %v", got)
+	}
+	if got := GetBigInt("token.accounts.0.balance"); got == nil || got.String() != "98765432109876543210987654321" {
+		t.Errorf("Expected the exact balance in the list, got %v", got)
+	}
+	if got := GetBigInt("token.sci"); got == nil || got.String() != "1000000000000000000000" {
+		t.Errorf("Expected 1e21, got %v", got)
+	}
+	if GetBigInt("ratio") != nil || GetBigInt("missing") != nil {
+		t.Error("Expected nil for non-integers and missing keys")
+	}
+	if got := GetFloat32("ratio"); got != 0.25 {
+		t.Errorf("Expected 0.25, got %v", got)
+	}
+	if got := GetInt("workers"); got != 1000 {
+		t.Errorf("Expected scientific notation to be accepted for ints, got %d", got)
+	}
+	if got := GetComplex128("signal"); got != complex(1, 2) {
+		t.Errorf("Expected 1+2i, got %v", got)
+	}
+	if got := GetComplex128("ratio"); got != complex(0.25, 0) {
+		t.Errorf("Expected 0.25+0i, got %v", got)
+	}
+}
+
+func TestGetLocation(t *testing.T) {
+	testReset(t)
+	DeclareKey("reports.timezone", Location)
+	configPath := createTempYAML(t, "reports:\n  timezone: Europe/Paris\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	if loc := GetLocation("reports.timezone"); loc == nil || loc.String() != "Europe/Paris" {
+		t.Errorf("Expected Europe/Paris, got %v", loc)
+	}
+	if loc := GetLocation("reports.missing"); loc != time.UTC {
+		t.Errorf("Expected UTC for a missing key, got %v", loc)
+	}
+
+	testReset(t)
+	DeclareKey("reports.timezone", Location)
+	configPath = createTempYAML(t, "reports:\n  timezone: Mars/Olympus_Mons\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected an unknown zone to fail Parse, got %v", err)
+	}
+}
+
+func TestMemoizedConversions(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, "timeout: 1m30s\nworkers: \"8\"\nratio: \"0.5\"\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = GetDuration("timeout")
+		_ = GetInt("workers")
+		_ = GetFloat64("ratio")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected memoized conversions not to allocate, got %v allocations", allocs)
+	}
+	if GetDuration("timeout") != 90*time.Second || GetInt("workers") != 8 || GetFloat64("ratio") != 0.5 {
+		t.Error("Unexpected memoized values")
+	}
+
+	// Changing the data must drop the memoized conversions.
+	finalConfig.SetValue("timeout", "2s")
+	if got := GetDuration("timeout"); got != 2*time.Second {
+		t.Errorf("Expected the conversion to be redone after a change, got %v", got)
+	}
+}
+
+func TestCachedGetters(t *testing.T) {
+	testReset(t)
+	SetDefault("allowed", []string{"a", "b"})
+	SetDefault("labels", map[string]interface{}{"team": "core", "tier": 1})
+	Parse()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = GetStringSliceCached("allowed")
+		_ = GetStringMapStringCached("labels")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected cached getters not to allocate, got %v allocations", allocs)
+	}
+	if got := GetStringSliceCached("allowed"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Unexpected cached slice %v", got)
+	}
+	if got := GetStringMapStringCached("labels"); !reflect.DeepEqual(got, map[string]string{"team": "core", "tier": "1"}) {
+		t.Errorf("Unexpected cached map %v", got)
+	}
+}
+
+func TestParseSharesLayers(t *testing.T) {
+	testReset(t)
+	SetDefault("plugins.cache.size", 10)
+	SetDefault("db.host", "localhost")
+	configPath := createTempYAML(t, "db:\n  port: 5432\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--db-host=db.internal", "--set=db.user=app"}
+	Parse()
+
+	if GetString("db.host") != "db.internal" || GetInt("db.port") != 5432 || GetString("db.user") != "app" {
+		t.Errorf("Unexpected merged values: %v", finalConfig.data)
+	}
+	// Subtrees that are not overridden are shared, not copied.
+	got := reflect.ValueOf(finalConfig.Get("plugins")).UnsafePointer()
+	want := reflect.ValueOf(defaults.Get("plugins")).UnsafePointer()
+	if got != want {
+		t.Error("Expected the plugins subtree to be shared with the defaults")
+	}
+	// Overrides must not leak into the layers below them.
+	if defaults.GetString("db.host") != "localhost" || config.IsSet("db.user") || config.IsSet("db.host") {
+		t.Errorf("Expected layers to be left untouched, got defaults %v and config %v", defaults.data, config.data)
+	}
+}
+
+func TestGetStringSlice_Copy(t *testing.T) {
+	testReset(t)
+	SetDefaultStringSlice("tags", []string{"a", "b"})
+	os.Args = []string{"test"}
+	Parse()
+	GetStringSlice("tags")[0] = "changed"
+	if got := GetStringSlice("tags"); got[0] != "a" {
+		t.Errorf("Expected modifying the result to leave the configuration untouched, got %v", got)
+	}
+}
+
+func TestSetValueCopiesSharedPathOnce(t *testing.T) {
+	lower := newManager()
+	lower.SetValue("db.host", "localhost")
+	lower.SetValue("endpoints", []interface{}{"a", "b"})
+	m := newManager()
+	m.Merge(lower)
+
+	m.SetValue("db.port", 5432)
+	m.SetValue("endpoints.0", "c")
+	root := reflect.ValueOf(m.data).UnsafePointer()
+	db := reflect.ValueOf(m.data["db"]).UnsafePointer()
+	endpoints := reflect.ValueOf(m.data["endpoints"]).UnsafePointer()
+	if lower.IsSet("db.port") || lower.GetString("endpoints.0") != "a" {
+		t.Fatalf("Expected the shared maps and lists to be copied, got %v", lower.data)
+	}
+
+	// Writing again to the copied path does not copy it again.
+	m.SetValue("db.user", "app")
+	m.SetValue("endpoints.1", "d")
+	if reflect.ValueOf(m.data).UnsafePointer() != root || reflect.ValueOf(m.data["db"]).UnsafePointer() != db ||
+		reflect.ValueOf(m.data["endpoints"]).UnsafePointer() != endpoints {
+		t.Error("Expected the copied path to be written to in place")
+	}
+
+	// Sharing it again copies it again.
+	other := newManager()
+	other.Merge(m)
+	m.SetValue("db.name", "app")
+	if other.IsSet("db.name") {
+		t.Errorf("Expected the maps shared again to be copied, got %v", other.data)
+	}
+}
+
+func TestGetLogLevel(t *testing.T) {
+	testReset(t)
+
+	levels := map[string]interface{}{
+		"debug":   "debug",
+		"upper":   "WARN",
+		"warning": "Warning",
+		"error":   "error",
+		"offset":  "info+2",
+		"numeric": -4,
+		"numstr":  "8",
+		"invalid": "loud",
+	}
+	for key, value := range levels {
+		SetDefault("log."+key, value)
+	}
+	Parse()
+
+	tests := map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"upper":   slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"offset":  slog.LevelInfo + 2,
+		"numeric": slog.LevelDebug,
+		"numstr":  slog.LevelError,
+		"invalid": slog.LevelInfo,
+		"missing": slog.LevelInfo,
+	}
+	for key, want := range tests {
+		if got := GetLogLevel("log." + key); got != want {
+			t.Errorf("GetLogLevel(%q) = %v, expected %v", "log."+key, got, want)
+		}
+	}
+}
+
+func TestIsExplicitlySet(t *testing.T) {
+	testReset(t)
+	SetDefault("port", 8080)
+	SetDefault("host", "localhost")
+	SetDefault("debug", false)
+	SetDefault("password", "")
+	configPath := createTempYAML(t, "host: localhost\npassword_file: /dev/null\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--debug"}
+	Parse()
+
+	tests := []struct {
+		key             string
+		explicit, moved bool
+	}{
+		{"port", false, false},
+		{"host", true, false}, // Set to its default value.
+		{"debug", true, true},
+		{"password", true, false},
+		{"missing", false, false},
+	}
+	for _, tt := range tests {
+		if got := IsExplicitlySet(tt.key); got != tt.explicit {
+			t.Errorf("IsExplicitlySet(%q) = %v, expected %v", tt.key, got, tt.explicit)
+		}
+		if got := WasChangedFromDefault(tt.key); got != tt.moved {
+			t.Errorf("WasChangedFromDefault(%q) = %v, expected %v", tt.key, got, tt.moved)
+		}
+	}
+}
+
+func TestNullValues(t *testing.T) {
+	testReset(t)
+	SetDefault("proxy", "http://proxy:3128")
+	SetDefault("timeout", "5s")
+	SetDefault("db.replica", map[string]interface{}{"host": "replica"})
+	configPath := createTempYAML(t, "proxy: null\ndb:\n  replica: ~\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	if !IsNull("proxy") || IsSet("proxy") || GetString("proxy") != "" {
+		t.Errorf("Expected null to override the default, got %q", GetString("proxy"))
+	}
+	if !IsNull("db.replica") || IsSet("db.replica.host") {
+		t.Error("Expected null to override a whole section")
+	}
+	if IsNull("timeout") || IsNull("missing") {
+		t.Error("Expected only keys set to null to be null")
+	}
+	if !IsExplicitlySet("proxy") || sourceOf("proxy") != "file" {
+		t.Errorf("Expected null values to count as configured in the file, got source %q", sourceOf("proxy"))
+	}
+}
+
+func TestGetBytes(t *testing.T) {
+	testReset(t)
+
+	configPath := createTempYAML(t, `
+keys:
+  b64: base64:aGVsbG8=
+  hex: hex:68656c6c6f
+  raw: hello
+  bad: hex:zz
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	for _, key := range []string{"b64", "hex", "raw"} {
+		if got := GetBytes("keys." + key); string(got) != "hello" {
+			t.Errorf("GetBytes(%q) = %q, expected \"hello\"", "keys."+key, got)
+		}
+	}
+	if got := GetBytes("keys.bad"); got != nil {
+		t.Errorf("Expected nil for an invalid hex value, got %q", got)
+	}
+	if got := GetBytes("keys.missing"); got != nil {
+		t.Errorf("Expected nil for a missing key, got %q", got)
+	}
+}
+
+func TestKeyPrefixes(t *testing.T) {
+	testReset(t)
+
+	configPath := createTempYAML(t, `
+database:
+  host: localhost
+  port: 5432
+database_url: postgres://
+plugins:
+  auth: {enabled: true}
+  cache: {size: 10}
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	if got, want := KeysWithPrefix("database."), []string{"database.host", "database.port"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("KeysWithPrefix(\"database.\") = %v, expected %v", got, want)
+	}
+	if got := KeysWithPrefix("database"); len(got) != 3 {
+		t.Errorf("Expected KeysWithPrefix(\"database\") to also match database_url, got %v", got)
+	}
+	if !HasPrefix("plugins.") || HasPrefix("outputs.") {
+		t.Error("HasPrefix returned unexpected results")
+	}
+	if got, want := SubKeys("plugins"), []string{"auth", "cache"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SubKeys(\"plugins\") = %v, expected %v", got, want)
+	}
+	if got := SubKeys("database.host"); got != nil {
+		t.Errorf("Expected SubKeys of a leaf to be nil, got %v", got)
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	testReset(t)
+	SetDefault("server.host", "localhost")
+	SetDefaults(map[string]interface{}{
+		"server": map[string]interface{}{
+			"port":    8080,
+			"timeout": "5s",
+		},
+		"log":    map[interface{}]interface{}{"level": "info"},
+		"labels": map[string]interface{}{},
+	})
+
+	os.Args = []string{"test", "--server-port=9090"}
+	Parse()
+	tests := map[string]interface{}{
+		"server.host":    "localhost",
+		"server.port":    9090,
+		"server.timeout": "5s",
+		"log.level":      "info",
+	}
+	for key, want := range tests {
+		if got := finalConfig.Get(key); got != want {
+			t.Errorf("%q = %v, want %v", key, got, want)
+		}
+	}
+	if got := GetStringMapString("labels"); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty map for labels, got %v", got)
+	}
+}
+
+func TestSetDefaultFunc(t *testing.T) {
+	testReset(t)
+	calls := 0
+	SetDefaultFunc("node_id", func() interface{} {
+		calls++
+		return "node-1"
+	})
+	SetDefaultFunc("workers", func() interface{} { return 4 })
+	SetDefaultFunc("replaced", func() interface{} { return "computed" })
+	SetDefault("replaced", "static")
+	if err := Init(createTempYAML(t, "workers: 8\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	os.Args = []string{"test", "--node-id=node-2"}
+	Parse()
+	if calls != 1 {
+		t.Errorf("Expected the default to be computed once by Parse, got %d calls", calls)
+	}
+	if got := GetString("node_id"); got != "node-2" {
+		t.Errorf("Expected the flag to override the computed default, got %q", got)
+	}
+	if got := GetInt("workers"); got != 8 {
+		t.Errorf("Expected the file to override the computed default, got %d", got)
+	}
+	if got := GetString("replaced"); got != "static" {
+		t.Errorf("Expected SetDefault to replace the function, got %q", got)
+	}
+	if !IsExplicitlySet("node_id") || sourceOf("workers") != "file" {
+		t.Error("Unexpected source of computed defaults")
+	}
+}
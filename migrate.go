@@ -0,0 +1,183 @@
+package mflag
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// versionKey is the key holding the version of the layout of a
+// configuration.
+const versionKey = "config_version"
+
+// migration upgrades a configuration to the version to.
+type migration struct {
+	to int
+	fn func(tree map[string]interface{}) map[string]interface{}
+}
+
+// migrations holds the migrations registered with RegisterMigration by the
+// version they upgrade from.
+var migrations = make(map[int]migration)
+
+// RegisterMigration registers fn to upgrade configurations whose
+// config_version is from to the layout of version to, so that applications
+// can rename and move keys without breaking existing files:
+//
+//	mflag.RegisterMigration(1, 2, func(tree map[string]interface{}) map[string]interface{} {
+//		if db, ok := tree["database"]; ok {
+//			tree["db"] = db
+//			delete(tree, "database")
+//		}
+//		return tree
+//	})
+//
+// Migrations run in sequence when the configuration is loaded, by Init and
+// Reload, each one receiving a copy of the tree it may modify, and
+// config_version is set to the version reached. Each migration applied is
+// logged with log/slog. Configurations without config_version are at
+// version 0, so that a migration from 0 upgrades files written before
+// versions were introduced. RegisterMigration panics if from is not lower
+// than to, or if a migration from the same version was registered.
+// It should be called before Init.
+func RegisterMigration(from, to int, fn func(tree map[string]interface{}) map[string]interface{}) {
+	if fn == nil {
+		panic("mflag: RegisterMigration function is nil")
+	}
+	if from >= to {
+		panic(fmt.Sprintf("mflag: RegisterMigration from version %d must be lower than version %d", from, to))
+	}
+	if _, dup := migrations[from]; dup {
+		panic(fmt.Sprintf("mflag: RegisterMigration called twice for version %d", from))
+	}
+	migrations[from] = migration{to: to, fn: fn}
+}
+
+// configVersion returns the config_version of data, 0 if it has none.
+func configVersion(data map[string]interface{}) (int, error) {
+	switch v := data[versionKey].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("%q must be an integer, got %v", versionKey, data[versionKey])
+}
+
+// applyMigrations upgrades data with the registered migrations.
+func applyMigrations(data map[string]interface{}) (map[string]interface{}, error) {
+	if len(migrations) == 0 {
+		return data, nil
+	}
+	version, err := configVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		m, ok := migrations[version]
+		if !ok {
+			return data, nil
+		}
+		data = m.fn(deepCopyMap(data))
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		data = convertMap(data)
+		data[versionKey] = m.to
+		slog.Info("mflag: migrated configuration", "from", version, "to", m.to)
+		version = m.to
+	}
+}
+
+// ErrConfigVersion is returned by Parse when the config_version of the
+// configuration does not satisfy RequireConfigVersion.
+var ErrConfigVersion = errors.New("mflag: incompatible config version")
+
+// versionClause is a clause of a version constraint, such as ">=2".
+type versionClause struct {
+	op      string
+	version int
+}
+
+// versionConstraint holds the constraint set with RequireConfigVersion, and
+// its clauses.
+var (
+	versionConstraint string
+	versionClauses    []versionClause
+)
+
+// RequireConfigVersion makes Parse fail with ErrConfigVersion unless the
+// config_version of the configuration satisfies constraint, a
+// comma-separated list of comparisons that must all hold, such as
+// ">=2, <4". Comparisons use ==, !=, <, <=, > or >=, a bare version
+// meaning ==. Configurations without config_version are at version 0. The
+// error tells whether the configuration or the application needs
+// upgrading. RequireConfigVersion panics if constraint is invalid.
+// It should be called before Parse.
+func RequireConfigVersion(constraint string) {
+	var clauses []versionClause
+	for _, part := range strings.Split(constraint, ",") {
+		part = strings.TrimSpace(part)
+		op := strings.TrimRight(part, "0123456789 ")
+		n, err := strconv.Atoi(strings.TrimSpace(part[len(op):]))
+		if op == "" || op == "=" {
+			op = "=="
+		}
+		if err != nil || !slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, op) {
+			panic(fmt.Sprintf("mflag: invalid config version constraint %q", constraint))
+		}
+		clauses = append(clauses, versionClause{op: op, version: n})
+	}
+	versionConstraint, versionClauses = constraint, clauses
+}
+
+// checkConfigVersion checks the config_version of m against the constraint
+// set with RequireConfigVersion.
+func checkConfigVersion(m *mapManager) error {
+	if versionClauses == nil {
+		return nil
+	}
+	version, err := configVersion(m.data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigVersion, err)
+	}
+	for _, c := range versionClauses {
+		var ok bool
+		switch c.op {
+		case "==":
+			ok = version == c.version
+		case "!=":
+			ok = version != c.version
+		case "<":
+			ok = version < c.version
+		case "<=":
+			ok = version <= c.version
+		case ">":
+			ok = version > c.version
+		case ">=":
+			ok = version >= c.version
+		}
+		if ok {
+			continue
+		}
+		// A configuration too recent for the application needs a newer
+		// application, not an older configuration.
+		advice := "upgrade the configuration"
+		if strings.HasPrefix(c.op, "<") || c.op == "==" && version > c.version {
+			advice = "upgrade the application"
+		}
+		return fmt.Errorf("%w: %s %d does not satisfy %q, %s", ErrConfigVersion, versionKey, version, versionConstraint, advice)
+	}
+	return nil
+}
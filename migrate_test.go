@@ -0,0 +1,126 @@
+package mflag
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRegisterMigration(t *testing.T) {
+	testReset(t)
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	RegisterMigration(0, 1, func(tree map[string]interface{}) map[string]interface{} {
+		if host, ok := tree["db_host"]; ok {
+			tree["database"] = map[string]interface{}{"host": host}
+			delete(tree, "db_host")
+		}
+		return tree
+	})
+	RegisterMigration(1, 3, func(tree map[string]interface{}) map[string]interface{} {
+		tree["db"] = tree["database"]
+		delete(tree, "database")
+		return tree
+	})
+	if err := Init(createTempYAML(t, "db_host: db.internal\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := GetString("db.host"); got != "db.internal" {
+		t.Errorf("Expected the migrated key, got %q", got)
+	}
+	if IsSet("db_host") || IsSet("database") {
+		t.Error("Expected the old keys to be gone")
+	}
+	if got := GetInt(versionKey); got != 3 {
+		t.Errorf("Expected config_version 3, got %d", got)
+	}
+	if got := strings.Count(logs.String(), "mflag: migrated configuration"); got != 2 {
+		t.Errorf("Expected 2 migrations logged, got:\n%s", logs.String())
+	}
+
+	// Files at the latest version are left alone.
+	testReset(t)
+	RegisterMigration(1, 2, func(map[string]interface{}) map[string]interface{} {
+		t.Error("Unexpected migration")
+		return nil
+	})
+	if err := Init(createTempYAML(t, "config_version: 2\nport: 1\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	testReset(t)
+	RegisterMigration(1, 2, func(tree map[string]interface{}) map[string]interface{} { return tree })
+	if err := Init(createTempYAML(t, "config_version: two\n")); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for an invalid version, got %v", err)
+	}
+}
+
+func TestRegisterMigration_Panics(t *testing.T) {
+	testReset(t)
+	noop := func(tree map[string]interface{}) map[string]interface{} { return tree }
+	RegisterMigration(1, 2, noop)
+	for name, fn := range map[string]func(){
+		"backwards": func() { RegisterMigration(3, 2, noop) },
+		"duplicate": func() { RegisterMigration(1, 3, noop) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestRequireConfigVersion(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string // substring of the error, "" if valid
+	}{
+		{"config_version: 2\n", ""},
+		{"config_version: 3\n", ""},
+		{"config_version: 1\n", "config_version 1 does not satisfy \">=2, <4\", upgrade the configuration"},
+		{"port: 1\n", "config_version 0 does not satisfy"},
+		{"config_version: 4\n", "upgrade the application"},
+	}
+	for _, tt := range tests {
+		testReset(t)
+		RequireConfigVersion(">=2, <4")
+		if err := Init(createTempYAML(t, tt.content)); err != nil {
+			t.Fatalf("Init() failed: %v", err)
+		}
+		os.Args = []string{"test"}
+		err := ParseWithError()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.content, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrConfigVersion) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected ErrConfigVersion with %q, got %v", tt.content, tt.want, err)
+		}
+	}
+
+	for _, constraint := range []string{"", "~2", ">=two", ">=2,"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for constraint %q", constraint)
+				}
+			}()
+			RequireConfigVersion(constraint)
+		}()
+	}
+}
@@ -0,0 +1,165 @@
+package mflag
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// namespaces holds the names claimed with Namespace.
+var namespaces = make(map[string]bool)
+
+// KeySpace is a section of the configuration owned by a library, returned by
+// Namespace. Keys passed to its methods are relative to the namespace.
+type KeySpace struct {
+	name string
+}
+
+// Namespace claims the keys below name for a library, so that several
+// packages can declare their settings in one configuration without clashing:
+//
+//	var kafka = mflag.Namespace("kafka")
+//
+//	func init() {
+//		kafka.SetDefault("brokers", []string{"localhost:9092"})
+//	}
+//
+// declares "kafka.brokers", set with --kafka-brokers. Namespace panics if
+// name was already claimed, if it is nested in or contains a claimed
+// namespace, or if keys below it were already declared or given defaults,
+// as two packages would then own the same keys.
+// It should be called before Init and Parse, typically in a package-level
+// variable declaration.
+func Namespace(name string) *KeySpace {
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+		panic(fmt.Sprintf("mflag: invalid namespace %q", name))
+	}
+	for claimed := range namespaces {
+		if claimed == name || strings.HasPrefix(name, claimed+".") || strings.HasPrefix(claimed, name+".") {
+			panic(fmt.Sprintf("mflag: namespace %q collides with namespace %q", name, claimed))
+		}
+	}
+	inside := func(key string) bool {
+		return key == name || strings.HasPrefix(key, name+".")
+	}
+	for key := range specs {
+		if inside(key) {
+			panic(fmt.Sprintf("mflag: namespace %q contains the declared key %q", name, key))
+		}
+	}
+	for _, key := range defaults.AllKeys() {
+		if inside(key) {
+			panic(fmt.Sprintf("mflag: namespace %q contains the key %q, which has a default", name, key))
+		}
+	}
+	namespaces[name] = true
+	return &KeySpace{name: name}
+}
+
+// Name returns the name of the namespace.
+func (ns *KeySpace) Name() string {
+	return ns.name
+}
+
+// Key returns the full key of key in the namespace.
+func (ns *KeySpace) Key(key string) string {
+	return ns.name + "." + key
+}
+
+// SetDefault sets a default value for key in the namespace, see SetDefault.
+func (ns *KeySpace) SetDefault(key string, value interface{}) {
+	SetDefault(ns.Key(key), value)
+}
+
+// Register declares key in the namespace, see Register.
+func (ns *KeySpace) Register(key string, opts ...KeyOption) {
+	Register(ns.Key(key), opts...)
+}
+
+// MarkRequired marks keys in the namespace as required, see MarkRequired.
+func (ns *KeySpace) MarkRequired(keys ...string) {
+	for _, key := range keys {
+		MarkRequired(ns.Key(key))
+	}
+}
+
+// MarkSecret marks keys in the namespace as secret, see MarkSecret.
+func (ns *KeySpace) MarkSecret(keys ...string) {
+	for _, key := range keys {
+		MarkSecret(ns.Key(key))
+	}
+}
+
+// GetString returns the value of key in the namespace as a string.
+// Must be called after Parse.
+func (ns *KeySpace) GetString(key string) string {
+	return GetString(ns.Key(key))
+}
+
+// GetInt returns the value of key in the namespace as an integer.
+// Must be called after Parse.
+func (ns *KeySpace) GetInt(key string) int {
+	return GetInt(ns.Key(key))
+}
+
+// GetInt64 returns the value of key in the namespace as an int64.
+// Must be called after Parse.
+func (ns *KeySpace) GetInt64(key string) int64 {
+	return GetInt64(ns.Key(key))
+}
+
+// GetUint returns the value of key in the namespace as a uint.
+// Must be called after Parse.
+func (ns *KeySpace) GetUint(key string) uint {
+	return GetUint(ns.Key(key))
+}
+
+// GetBool returns the value of key in the namespace as a boolean.
+// Must be called after Parse.
+func (ns *KeySpace) GetBool(key string) bool {
+	return GetBool(ns.Key(key))
+}
+
+// GetFloat64 returns the value of key in the namespace as a float64.
+// Must be called after Parse.
+func (ns *KeySpace) GetFloat64(key string) float64 {
+	return GetFloat64(ns.Key(key))
+}
+
+// GetDuration returns the value of key in the namespace as a time.Duration.
+// Must be called after Parse.
+func (ns *KeySpace) GetDuration(key string) time.Duration {
+	return GetDuration(ns.Key(key))
+}
+
+// GetStringSlice returns the value of key in the namespace as a slice of
+// strings.
+// Must be called after Parse.
+func (ns *KeySpace) GetStringSlice(key string) []string {
+	return GetStringSlice(ns.Key(key))
+}
+
+// GetStringMapString returns the value of key in the namespace as a map of
+// strings.
+// Must be called after Parse.
+func (ns *KeySpace) GetStringMapString(key string) map[string]string {
+	return GetStringMapString(ns.Key(key))
+}
+
+// GetSecret returns the value of key in the namespace as a Secret.
+// Must be called after Parse.
+func (ns *KeySpace) GetSecret(key string) Secret {
+	return GetSecret(ns.Key(key))
+}
+
+// IsSet reports whether key in the namespace has a value, see IsSet.
+// Must be called after Parse.
+func (ns *KeySpace) IsSet(key string) bool {
+	return IsSet(ns.Key(key))
+}
+
+// Section returns the configuration of the namespace as a section.
+// Must be called after Parse.
+func (ns *KeySpace) Section() *Section {
+	return Sub(ns.name)
+}
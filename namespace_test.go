@@ -0,0 +1,72 @@
+package mflag
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	testReset(t)
+	kafka := Namespace("kafka")
+	kafka.SetDefault("brokers", []string{"localhost:9092"})
+	kafka.SetDefault("timeout", "5s")
+	kafka.Register("password", Sensitive())
+	SetDefault("timeout", "1s")
+
+	os.Args = []string{"test", "--kafka-timeout=10s"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got := kafka.GetStringSlice("brokers"); len(got) != 1 || got[0] != "localhost:9092" {
+		t.Errorf("Expected the brokers of the namespace, got %v", got)
+	}
+	if got := kafka.GetDuration("timeout").String(); got != "10s" {
+		t.Errorf("Expected the flag of the namespace, got %s", got)
+	}
+	if got := GetString("timeout"); got != "1s" {
+		t.Errorf("Expected the key outside the namespace to be unaffected, got %q", got)
+	}
+	if !isSecret("kafka.password") {
+		t.Error("Expected the key registered in the namespace to be secret")
+	}
+	if got := kafka.Section().GetString("timeout"); got != "10s" {
+		t.Errorf("Expected the section of the namespace, got %q", got)
+	}
+}
+
+func TestNamespace_Collisions(t *testing.T) {
+	testReset(t)
+	Namespace("kafka")
+	for _, name := range []string{"kafka", "kafka.consumer", "", ".x"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected Namespace(%q) to panic", name)
+				}
+			}()
+			Namespace(name)
+		}()
+	}
+	Namespace("kafka2")
+
+	Register("grpc.port")
+	SetDefault("http.port", 8080)
+	for _, name := range []string{"grpc", "http"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected Namespace(%q) to panic for keys set outside it", name)
+				}
+			}()
+			Namespace(name)
+		}()
+	}
+
+	Namespace("metrics.prometheus")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a namespace containing a claimed one to panic")
+		}
+	}()
+	Namespace("metrics")
+}
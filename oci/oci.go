@@ -0,0 +1,462 @@
+// Package oci provides an mflag provider pulling configuration artifacts,
+// such as those pushed with ORAS, from an OCI registry, so that
+// configuration ships through the same registry pipeline as images:
+//
+//	oras push registry.example.com/team/app-config:prod config.yaml
+//
+//	err := mflag.InitContext(ctx, oci.New("registry.example.com/team/app-config:prod"))
+//
+// Every layer of the artifact is a config file, named after its
+// org.opencontainers.image.title annotation, and layers are merged in
+// order. Layers holding a tar, gzipped tar or zip archive are loaded as
+// mflag.InitArchive does. The manifest and the layers are verified against
+// their digests, and a reference pinned to a digest, as in
+// "registry.example.com/team/app-config@sha256:...", only accepts that
+// manifest.
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hypedn/mflag"
+)
+
+const (
+	// titleAnnotation names the file a layer holds.
+	titleAnnotation = "org.opencontainers.image.title"
+	// indexMediaType is the media type of multi-platform image indexes,
+	// which are not configuration artifacts.
+	indexMediaType = "application/vnd.oci.image.index.v1+json"
+	// maxManifestSize bounds the size of manifests, as registries do.
+	maxManifestSize = 4 << 20
+	// maxLayerSize bounds the size of layers, which hold configuration
+	// files rather than images.
+	maxLayerSize = 64 << 20
+)
+
+// manifestTypes are the manifest media types accepted from the registry.
+var manifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Provider pulls a configuration artifact from an OCI registry. It
+// implements mflag.Provider and mflag.Watcher.
+type Provider struct {
+	registry   string
+	repository string
+	reference  string // tag or digest of the manifest
+	digest     string // digest the manifest must have, if pinned
+	refErr     error
+
+	scheme             string
+	client             *http.Client
+	username, password string
+	interval           time.Duration
+
+	mu      sync.Mutex
+	auth    string // Authorization header of the last successful request
+	current string // digest of the last manifest loaded
+}
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithBasicAuth authenticates to the registry with a username and a
+// password or access token, directly or to obtain a bearer token.
+// Anonymous access is used otherwise.
+func WithBasicAuth(username, password string) Option {
+	return func(p *Provider) {
+		p.username, p.password = username, password
+	}
+}
+
+// WithPlainHTTP talks to the registry over HTTP instead of HTTPS, for local
+// registries.
+func WithPlainHTTP() Option {
+	return func(p *Provider) {
+		p.scheme = "http"
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to talk to the registry. It
+// defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// WithRefresh sets how often Watch checks whether the tag points to a new
+// manifest. It defaults to one minute.
+func WithRefresh(interval time.Duration) Option {
+	return func(p *Provider) {
+		p.interval = interval
+	}
+}
+
+// New returns a provider pulling the artifact ref, such as
+// "registry.example.com/team/app-config:prod" or
+// "registry.example.com/team/app-config@sha256:<hex>". The tag defaults to
+// "latest". An invalid reference is reported by Load.
+func New(ref string, opts ...Option) *Provider {
+	p := &Provider{
+		scheme:   "https",
+		client:   http.DefaultClient,
+		interval: time.Minute,
+	}
+	p.registry, p.repository, p.reference, p.digest, p.refErr = parseReference(ref)
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// parseReference splits ref into the registry, the repository, the tag or
+// digest, and the digest if ref is pinned to one.
+func parseReference(ref string) (registry, repository, reference, digest string, err error) {
+	registry, rest, ok := strings.Cut(ref, "/")
+	if !ok || rest == "" || !strings.ContainsAny(registry, ".:") && registry != "localhost" {
+		return "", "", "", "", fmt.Errorf("oci: invalid reference %q: expected registry/repository[:tag][@digest]", ref)
+	}
+	repository = rest
+	if name, d, ok := strings.Cut(rest, "@"); ok {
+		if _, _, err := splitDigest(d); err != nil {
+			return "", "", "", "", fmt.Errorf("oci: invalid reference %q: %w", ref, err)
+		}
+		return registry, name, d, d, nil
+	}
+	reference = "latest"
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		repository, reference = rest[:i], rest[i+1:]
+	}
+	if repository == "" || reference == "" {
+		return "", "", "", "", fmt.Errorf("oci: invalid reference %q", ref)
+	}
+	return registry, repository, reference, "", nil
+}
+
+// splitDigest splits a digest such as "sha256:<hex>" into its algorithm
+// and hex-encoded hash. Only SHA-256 is supported.
+func splitDigest(digest string) (algorithm, hash string, err error) {
+	algorithm, hash, _ = strings.Cut(digest, ":")
+	if algorithm != "sha256" {
+		return "", "", fmt.Errorf("unsupported digest %q, only sha256 is supported", digest)
+	}
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+		return "", "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return algorithm, hash, nil
+}
+
+// verify checks that content has the digest.
+func verify(content []byte, digest string) error {
+	_, want, err := splitDigest(digest)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("digest mismatch: expected %s, got sha256:%s", digest, got)
+	}
+	return nil
+}
+
+// manifest is the part of an OCI image manifest the provider reads.
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// descriptor describes a layer.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// Load pulls the artifact and returns the merged values of its layers.
+func (p *Provider) Load(ctx context.Context) (map[string]interface{}, error) {
+	if p.refErr != nil {
+		return nil, p.refErr
+	}
+	m, digest, err := p.fetchManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Layers) == 0 {
+		return nil, fmt.Errorf("oci: %s has no layers", p)
+	}
+
+	layers := make([]mflag.Provider, 0, len(m.Layers))
+	for _, layer := range m.Layers {
+		content, err := p.fetchBlob(ctx, layer)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Base(layer.Annotations[titleAnnotation])
+		if name == "." || name == "/" {
+			name = "layer.yaml"
+			if isArchive(layer) {
+				name = "layer.tar"
+			}
+		}
+		layers = append(layers, mflag.Content(name, content))
+	}
+	data, err := mflag.Merge(layers...).Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("oci: %s: %w", p, err)
+	}
+
+	p.mu.Lock()
+	p.current = digest
+	p.mu.Unlock()
+	return data, nil
+}
+
+// isArchive reports whether a layer without a title holds an archive, by
+// its media type. Layers with a title are told by its extension, as ORAS
+// gives every file the same generic media type.
+func isArchive(layer descriptor) bool {
+	return strings.Contains(layer.MediaType, "tar") || strings.HasSuffix(layer.MediaType, "zip")
+}
+
+// String returns the reference of the artifact.
+func (p *Provider) String() string {
+	if p.digest != "" {
+		return p.registry + "/" + p.repository + "@" + p.digest
+	}
+	return p.registry + "/" + p.repository + ":" + p.reference
+}
+
+// fetchManifest fetches and verifies the manifest, returning it with its
+// digest.
+func (p *Provider) fetchManifest(ctx context.Context) (manifest, string, error) {
+	var m manifest
+	resp, body, err := p.get(ctx, "manifests/"+p.reference, strings.Join(manifestTypes, ", "), maxManifestSize)
+	if err != nil {
+		return m, "", err
+	}
+	sum := sha256.Sum256(body)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if p.digest != "" && digest != p.digest {
+		return m, "", fmt.Errorf("oci: %s: manifest digest mismatch: got %s", p, digest)
+	}
+	if header := resp.Header.Get("Docker-Content-Digest"); header != "" && header != digest {
+		return m, "", fmt.Errorf("oci: %s: manifest digest mismatch: registry reported %s, got %s", p, header, digest)
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return m, "", fmt.Errorf("oci: %s: invalid manifest: %w", p, err)
+	}
+	if m.MediaType == indexMediaType {
+		return m, "", fmt.Errorf("oci: %s is an image index, not a configuration artifact", p)
+	}
+	return m, digest, nil
+}
+
+// fetchBlob fetches the layer and verifies its digest and size.
+func (p *Provider) fetchBlob(ctx context.Context, layer descriptor) ([]byte, error) {
+	if _, _, err := splitDigest(layer.Digest); err != nil {
+		return nil, fmt.Errorf("oci: %s: %w", p, err)
+	}
+	if layer.Size > maxLayerSize {
+		return nil, fmt.Errorf("oci: layer %s: %d bytes exceed the limit of %d", layer.Digest, layer.Size, maxLayerSize)
+	}
+	limit := int64(maxLayerSize)
+	if layer.Size > 0 {
+		limit = layer.Size
+	}
+	_, body, err := p.get(ctx, "blobs/"+layer.Digest, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	if layer.Size != 0 && int64(len(body)) != layer.Size {
+		return nil, fmt.Errorf("oci: layer %s: expected %d bytes, got %d", layer.Digest, layer.Size, len(body))
+	}
+	if err := verify(body, layer.Digest); err != nil {
+		return nil, fmt.Errorf("oci: layer %s: %w", layer.Digest, err)
+	}
+	return body, nil
+}
+
+// get fetches path below the repository, authenticating when the registry
+// asks to. Responses of more than limit bytes are rejected without being
+// read further.
+func (p *Provider) get(ctx context.Context, path, accept string, limit int64) (*http.Response, []byte, error) {
+	u := p.scheme + "://" + p.registry + "/v2/" + p.repository + "/" + path
+	p.mu.Lock()
+	auth := p.auth
+	p.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oci: %w", err)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("oci: %w", err)
+		}
+		if int64(len(body)) > limit {
+			return nil, nil, fmt.Errorf("oci: GET %s: more than %d bytes", u, limit)
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			if auth, err = p.authorize(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case resp.StatusCode != http.StatusOK:
+			return nil, nil, fmt.Errorf("oci: GET %s: %s", u, resp.Status)
+		}
+		p.mu.Lock()
+		p.auth = auth
+		p.mu.Unlock()
+		return resp, body, nil
+	}
+}
+
+// authorize returns the Authorization header answering the challenge of
+// the registry, fetching a bearer token if it asks for one.
+func (p *Provider) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if p.username == "" {
+			return "", errors.New("oci: the registry requires credentials, use WithBasicAuth")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(p.username+":"+p.password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("oci: unsupported authentication challenge %q", challenge)
+	}
+
+	attrs := parseChallenge(params)
+	realm, err := url.Parse(attrs["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("oci: invalid token realm in challenge %q", challenge)
+	}
+	q := realm.Query()
+	if service := attrs["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := attrs["scope"]
+	if scope == "" {
+		scope = "repository:" + p.repository + ":pull"
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oci: fetching token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oci: fetching token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("oci: fetching token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("oci: fetching token: empty token")
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge parses the comma-separated key="value" parameters of a
+// WWW-Authenticate header.
+func parseChallenge(params string) map[string]string {
+	attrs := make(map[string]string)
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(params, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(params, `"`) {
+			end := strings.Index(params[1:], `"`)
+			if end < 0 {
+				end = len(params) - 1
+			}
+			value, params = params[1:end+1], params[min(end+2, len(params)):]
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		attrs[key] = value
+		params = strings.TrimLeft(params, ", ")
+	}
+	return attrs
+}
+
+// Watch checks every refresh interval whether the tag points to a new
+// manifest, sending an Update when it does. A reference pinned to a digest
+// never changes.
+func (p *Provider) Watch(ctx context.Context) <-chan mflag.Update {
+	updates := make(chan mflag.Update, 1)
+	go func() {
+		defer close(updates)
+		if p.digest != "" {
+			<-ctx.Done()
+			return
+		}
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			_, digest, err := p.fetchManifest(ctx)
+			p.mu.Lock()
+			changed := err == nil && digest != p.current
+			p.mu.Unlock()
+			if !changed && (err == nil || ctx.Err() != nil) {
+				continue
+			}
+			select {
+			case updates <- mflag.Update{Err: err}:
+			default:
+			}
+		}
+	}()
+	return updates
+}
@@ -0,0 +1,227 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hypedn/mflag"
+)
+
+var _ mflag.Watcher = (*Provider)(nil)
+
+// fakeRegistry serves artifacts of the repository "team/config", behind a
+// bearer token challenge.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	url       string
+	manifests map[string][]byte // by tag and digest
+	blobs     map[string][]byte // by digest
+}
+
+func digestOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// push stores an artifact made of files, in order, under tag, and returns
+// the digest of its manifest.
+func (f *fakeRegistry) push(t *testing.T, tag string, files ...[2]string) string {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var m manifest
+	m.MediaType = manifestTypes[0]
+	for _, file := range files {
+		content := []byte(file[1])
+		digest := digestOf(content)
+		f.blobs[digest] = content
+		m.Layers = append(m.Layers, descriptor{
+			MediaType:   "application/vnd.oci.image.layer.v1.tar",
+			Digest:      digest,
+			Size:        int64(len(content)),
+			Annotations: map[string]string{titleAnnotation: file[0]},
+		})
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := digestOf(body)
+	f.manifests[tag] = body
+	f.manifests[digest] = body
+	return digest
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		if r.URL.Query().Get("scope") != "repository:team/config:pull" {
+			http.Error(w, "bad scope", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "test-token"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+f.url+`/token",service="fake",scope="repository:team/config:pull"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ref, ok := strings.CutPrefix(r.URL.Path, "/v2/team/config/manifests/"); ok {
+		body, ok := f.manifests[ref]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", manifestTypes[0])
+		w.Write(body)
+		return
+	}
+	if digest, ok := strings.CutPrefix(r.URL.Path, "/v2/team/config/blobs/"); ok {
+		body, ok := f.blobs[digest]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, string) {
+	f := &fakeRegistry{manifests: make(map[string][]byte), blobs: make(map[string][]byte)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	f.url = srv.URL
+	return f, strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestProvider_Load(t *testing.T) {
+	f, host := newFakeRegistry(t)
+	digest := f.push(t, "prod",
+		[2]string{"base.yaml", "port: 8080\ndb:\n  host: db.internal\n  pool: 10\n"},
+		[2]string{"prod.yaml", "db:\n  pool: 50\n"})
+
+	for _, ref := range []string{host + "/team/config:prod", host + "/team/config@" + digest} {
+		p := New(ref, WithPlainHTTP())
+		data, err := p.Load(context.Background())
+		if err != nil {
+			t.Fatalf("Load(%s) failed: %v", ref, err)
+		}
+		db := data["db"].(map[string]interface{})
+		if data["port"] != 8080 || db["host"] != "db.internal" || db["pool"] != 50 {
+			t.Errorf("Load(%s) = %v", ref, data)
+		}
+	}
+
+	mflag.Reset()
+	defer mflag.Reset()
+	if err := mflag.InitContext(context.Background(), New(host+"/team/config:prod", WithPlainHTTP())); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	if files := mflag.ConfigFilesUsed(); len(files) != 0 {
+		t.Errorf("Expected no config files to be recorded, got %v", files)
+	}
+}
+
+func TestProvider_Verify(t *testing.T) {
+	f, host := newFakeRegistry(t)
+	pinned := f.push(t, "prod", [2]string{"config.yaml", "port: 8080\n"})
+	f.push(t, "prod", [2]string{"config.yaml", "port: 9090\n"})
+
+	// The tag moved, but the digest of the pinned manifest is still served.
+	p := New(host+"/team/config@"+pinned, WithPlainHTTP())
+	if _, err := p.Load(context.Background()); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	// A manifest not matching the pinned digest is rejected.
+	f.mu.Lock()
+	f.manifests[pinned] = f.manifests["prod"]
+	f.mu.Unlock()
+	if _, err := p.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("Expected a manifest digest mismatch, got %v", err)
+	}
+
+	// A tampered layer is rejected.
+	f.mu.Lock()
+	for digest := range f.blobs {
+		f.blobs[digest] = []byte("port: 1\n  ")
+	}
+	f.mu.Unlock()
+	p = New(host+"/team/config:prod", WithPlainHTTP())
+	if _, err := p.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "layer") {
+		t.Errorf("Expected a layer verification error, got %v", err)
+	}
+
+	// A layer larger than the manifest declares is not read past its size.
+	f.mu.Lock()
+	for digest := range f.blobs {
+		f.blobs[digest] = []byte(strings.Repeat("#", 1<<20))
+	}
+	f.mu.Unlock()
+	if _, err := p.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "more than 11 bytes") {
+		t.Errorf("Expected the layer to be rejected once past its size, got %v", err)
+	}
+}
+
+func TestProvider_Watch(t *testing.T) {
+	f, host := newFakeRegistry(t)
+	f.push(t, "prod", [2]string{"config.yaml", "port: 8080\n"})
+	p := New(host+"/team/config:prod", WithPlainHTTP(), WithRefresh(10*time.Millisecond))
+	if _, err := p.Load(context.Background()); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := p.Watch(ctx)
+
+	f.push(t, "prod", [2]string{"config.yaml", "port: 9090\n"})
+	select {
+	case u := <-updates:
+		if u.Err != nil {
+			t.Fatalf("Unexpected error: %v", u.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an update after the tag moved")
+	}
+	data, err := p.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if data["port"] != 9090 {
+		t.Errorf("Expected the new port, got %v", data["port"])
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref, registry, repository, reference string
+		wantErr                              bool
+	}{
+		{ref: "ghcr.io/team/config:prod", registry: "ghcr.io", repository: "team/config", reference: "prod"},
+		{ref: "localhost:5000/config", registry: "localhost:5000", repository: "config", reference: "latest"},
+		{ref: "team/config:prod", wantErr: true},
+		{ref: "ghcr.io/team/config@md5:abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		registry, repository, reference, _, err := parseReference(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseReference(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if registry != tt.registry || repository != tt.repository || reference != tt.reference {
+			t.Errorf("parseReference(%q) = %q, %q, %q", tt.ref, registry, repository, reference)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package mflag
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// GetPath returns the value associated with the key as a file path. A
+// relative path set in a config file is resolved against the directory of
+// that file, so that "tls.cert_file: certs/server.pem" next to the config
+// file is found whatever the working directory of the process. Relative
+// paths set by flags, the environment or defaults are relative to the
+// working directory and are returned unchanged.
+// Must be called after Parse.
+func GetPath(key string) string {
+	mustBeParsed()
+	return resolvePath(key, finalConfig.GetString(key))
+}
+
+// GetPath returns the value associated with the key as a file path, as the
+// package-level GetPath does.
+func (s *Section) GetPath(key string) string {
+	return resolvePath(joinKey(s.key, key), s.m.GetString(key))
+}
+
+// resolvePath resolves the path value of key against the directory of the
+// config file it came from.
+func resolvePath(key, value string) string {
+	if value == "" || filepath.IsAbs(value) || sourceOf(key) != "file" {
+		return value
+	}
+	file := fileOf(key)
+	if file == "" {
+		return value
+	}
+	return filepath.Join(filepath.Dir(file), value)
+}
+
+// GetGlob returns the files matching the patterns associated with the key,
+// a single pattern or a list of them such as "conf.d/*.yaml" or
+// ["certs/*.pem", "extra.pem"], with the syntax of filepath.Match. Relative
+// patterns are resolved as GetPath does. Files are returned in the order of
+// the patterns and sorted for each pattern, listing each file once. Invalid
+// patterns match nothing.
+// Must be called after Parse.
+func GetGlob(key string) []string {
+	mustBeParsed()
+	return globFiles(key, finalConfig.Get(key))
+}
+
+// GetGlob returns the files matching the patterns associated with the key,
+// as the package-level GetGlob does.
+func (s *Section) GetGlob(key string) []string {
+	return globFiles(joinKey(s.key, key), s.m.Get(key))
+}
+
+// globFiles expands the patterns in value, the value of key.
+func globFiles(key string, value interface{}) []string {
+	var patterns []string
+	switch v := value.(type) {
+	case string:
+		patterns = []string{resolvePath(key, v)}
+	case []string:
+		for i, pattern := range v {
+			patterns = append(patterns, resolvePath(key+"."+strconv.Itoa(i), pattern))
+		}
+	case []interface{}:
+		for i, pattern := range v {
+			patterns = append(patterns, resolvePath(key+"."+strconv.Itoa(i), fmt.Sprint(pattern)))
+		}
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		matches, _ := filepath.Glob(pattern) // Sorted; the only error is a bad pattern.
+		for _, file := range matches {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
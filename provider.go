@@ -0,0 +1,474 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provider loads configuration values from a source, such as a file or a
+// remote configuration server. Load returns the values as a nested map and
+// should give up once ctx is done. Values of secrets, such as those of a
+// secret manager, are returned as Secret, so that their keys are treated as
+// secret, as with MarkSecret.
+type Provider interface {
+	Load(ctx context.Context) (map[string]interface{}, error)
+}
+
+// Watcher is implemented by providers able to tell when their values
+// change. Watch sends an Update on every change until ctx is done, when it
+// closes the channel. Callers typically call Reload for every Update.
+type Watcher interface {
+	Watch(ctx context.Context) <-chan Update
+}
+
+// Update reports that the values of a provider changed. Err is set instead
+// when watching failed; the watcher keeps trying until ctx is done.
+type Update struct {
+	Err error
+}
+
+// SetPath sets the value at path in m, creating the intermediate maps, for
+// providers whose sources hold flat entries such as "database.host":
+//
+//	mflag.SetPath(values, strings.Split(name, "."), value)
+//
+// Values on the way that are not maps are replaced by maps.
+func SetPath(m map[string]interface{}, path []string, value interface{}) {
+	for _, segment := range path[:len(path)-1] {
+		next, ok := m[segment].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[segment] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
+
+// ProviderFactory creates a provider for a source given to Init as
+// "name://location", receiving the location.
+type ProviderFactory func(location string) (Provider, error)
+
+var (
+	providersMu sync.RWMutex
+	// providers holds the factories registered with RegisterProvider.
+	providers = make(map[string]ProviderFactory)
+)
+
+// RegisterProvider makes Init and Open accept sources of the form
+// "name://location", created by factory, so that packages can add sources
+// such as object stores or control planes. It is typically called from the
+// init function of such a package, and panics if name is registered twice.
+// Registrations are kept across Reset.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if factory == nil {
+		panic("mflag: RegisterProvider factory is nil")
+	}
+	if _, dup := providers[name]; dup || name == "file" {
+		panic("mflag: RegisterProvider called twice for provider " + name)
+	}
+	providers[name] = factory
+}
+
+// Open returns the provider for source. A source of the form
+// "name://location" is created by the factory registered for name, with
+// "file://path" standing for the file at path. Any other source is the
+// path of a file.
+func Open(source string) (Provider, error) {
+	name, location, ok := strings.Cut(source, "://")
+	if !ok || !isScheme(name) {
+		return File(source), nil
+	}
+	if name == "file" {
+		return File(location), nil
+	}
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown provider %q in %q", ErrInitFailed, name, source)
+	}
+	p, err := factory(location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInitFailed, err)
+	}
+	return p, nil
+}
+
+// isScheme reports whether s is a valid URL scheme.
+func isScheme(s string) bool {
+	for i, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// requireConfigFile reports whether RequireConfigFile was called.
+var requireConfigFile = false
+
+// RequireConfigFile makes Init and File fail when the config file does not
+// exist, for deployments that expect one, so that a mistyped path is not
+// silently replaced with defaults. It should be called before Init.
+func RequireConfigFile() {
+	requireConfigFile = true
+}
+
+// File returns a Provider reading the YAML file at path, or a file in a
+// format added with RegisterFormat. As with Init, a missing file is not an
+// error and yields no values. Environment variables in path, written $VAR
+// or ${VAR}, and a leading ~ are expanded when the file is loaded;
+// referencing an unset variable is an error.
+func File(path string, opts ...FileOption) Provider {
+	p := fileProvider{path: path}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+type fileProvider struct {
+	path   string
+	format string
+}
+
+func (p fileProvider) Load(ctx context.Context) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := expandPath(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInitFailed, err)
+	}
+	m := newManager()
+	if err := m.loadFile(ctx, path, p.format); err != nil {
+		return nil, err
+	}
+	return m.data, nil
+}
+
+// Content returns a Provider parsing content as the config file name would
+// be parsed, for providers fetching config files from elsewhere, such as a
+// registry. Names ending in .tar, .tgz, .tar.gz or .zip are loaded as an
+// archive, as Archive does. Nothing is read from disk, and name is not
+// recorded in ConfigFilesUsed.
+func Content(name string, content []byte, opts ...FileOption) Provider {
+	p := fileProvider{path: name}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return contentProvider{name: name, format: p.format, content: content}
+}
+
+type contentProvider struct {
+	name    string
+	format  string
+	content []byte
+}
+
+func (p contentProvider) Load(ctx context.Context) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p.format == "" && isArchiveName(p.name) {
+		data, _, err := loadArchive(p.content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInitFailed, p.name, err)
+		}
+		return data, nil
+	}
+	content, err := decryptSnapshot(p.content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInitFailed, p.name, err)
+	}
+	m := newManager()
+	if _, err := m.parse(p.name, p.format, content); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+	return m.data, nil
+}
+
+// Merge returns a Provider loading providers in order and merging their
+// values, later providers overriding earlier ones as the layers of the
+// configuration do: maps are merged recursively and other values replaced.
+// As with InitDir, the migrations, when blocks and overrides blocks of each
+// provider are applied before merging it, its conditions seeing the values
+// of the providers before it.
+func Merge(providers ...Provider) Provider {
+	return mergeProvider(providers)
+}
+
+type mergeProvider []Provider
+
+func (p mergeProvider) Load(ctx context.Context) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for _, provider := range p {
+		values, err := provider.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		layer, err := prepareLayer(values, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInitFailed, err)
+		}
+		data = overlayMaps(data, layer)
+	}
+	return data, nil
+}
+
+// InitOption configures InitContext.
+type InitOption func(*initOptions)
+
+type initOptions struct {
+	attempts    int
+	backoff     time.Duration
+	lastGoodDir string
+	onFallback  func(error)
+}
+
+// WithRetry makes InitContext try loading up to attempts times, waiting
+// backoff before the first retry and doubling the wait after each one.
+func WithRetry(attempts int, backoff time.Duration) InitOption {
+	return func(o *initOptions) {
+		o.attempts = attempts
+		o.backoff = backoff
+	}
+}
+
+// expandPath expands environment variables and a leading ~ in path.
+func expandPath(path string) (string, error) {
+	var missing []string
+	path = os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("config path %q: environment variable %s is not set", path, strings.Join(missing, ", "))
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("config path %q: %w", path, err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return path, nil
+}
+
+// InitContext loads configuration from p, like Init does from a file. It
+// returns once ctx is done even if p does not honour ctx, so that a slow
+// network mount or configuration server cannot hang startup indefinitely.
+// It should be called after setting defaults and before parsing flags.
+func InitContext(ctx context.Context, p Provider, opts ...InitOption) error {
+	source = p
+	resetFilesUsed()
+	o := initOptions{attempts: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	enableLastKnownGood(o)
+
+	data, err := loadWithRetry(ctx, p, o)
+	if err != nil {
+		return loadLastKnownGood(err)
+	}
+	setConfig(data)
+	return nil
+}
+
+// setConfig replaces the values loaded from the configuration source.
+func setConfig(data map[string]interface{}) {
+	config.data = convertMap(data)
+	config.invalidate()
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	appliedFile = &mapManager{data: config.data}
+}
+
+// loadWithRetry calls load up to o.attempts times, backing off in between.
+func loadWithRetry(ctx context.Context, p Provider, o initOptions) (map[string]interface{}, error) {
+	wait := o.backoff
+	for attempt := 1; ; attempt++ {
+		data, err := load(ctx, p)
+		if err == nil || attempt >= o.attempts || ctx.Err() != nil {
+			return data, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+		wait *= 2
+	}
+}
+
+// secretTag tags the values of a snapshot that providers returned as
+// secrets, so that they are secrets again once the snapshot is loaded.
+const secretTag = "!secret"
+
+// snapshotSecret is the value of a Secret as written to a snapshot.
+type snapshotSecret string
+
+func (s snapshotSecret) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: secretTag, Value: string(s)}, nil
+}
+
+// readSnapshot reads a snapshot written by writeSnapshot. Values tagged as
+// secrets are returned as Secret values, as their providers returned them.
+func readSnapshot(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no last good configuration: %w", ErrInitFailed, err)
+	}
+	if content, err = decryptSnapshot(content); err != nil {
+		return nil, fmt.Errorf("%w: invalid last good configuration %s: %w", ErrInitFailed, path, err)
+	}
+	var doc yaml.Node
+	if err := decodeYAML(content, &doc); err != nil {
+		return nil, fmt.Errorf("%w: invalid last good configuration %s: %w", ErrInitFailed, path, err)
+	}
+	var secrets []string
+	untagSecrets(&doc, "", &secrets)
+	var data map[string]interface{}
+	if err := doc.Decode(&data); err != nil {
+		return nil, fmt.Errorf("%w: invalid last good configuration %s: %w", ErrInitFailed, path, err)
+	}
+	m := &mapManager{data: convertMap(data)}
+	for _, key := range secrets {
+		m.SetValue(key, NewSecret(m.GetString(key)))
+	}
+	return m.data, nil
+}
+
+// untagSecrets removes the secret tags of n, found at key, adding the keys
+// of the values they tagged to keys.
+func untagSecrets(n *yaml.Node, key string, keys *[]string) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			untagSecrets(c, key, keys)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			untagSecrets(n.Content[i+1], joinKey(key, n.Content[i].Value), keys)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			untagSecrets(c, joinKey(key, strconv.Itoa(i)), keys)
+		}
+	case yaml.ScalarNode:
+		if n.Tag == secretTag {
+			n.Tag = "!!str"
+			*keys = append(*keys, key)
+		}
+	}
+}
+
+// writeSnapshot atomically saves data to path, encrypted with the key set
+// with SetSnapshotKey if any. The Secret values of providers are saved
+// tagged as secrets, and only to an encrypted snapshot: without a key,
+// data holding any is not saved.
+func writeSnapshot(path string, data map[string]interface{}) error {
+	hasSecrets := false
+	tagged, _ := replaceSecrets(data, "", func(_ string, s Secret) interface{} {
+		hasSecrets = true
+		return snapshotSecret(s.value)
+	})
+	if hasSecrets && snapshotKey == nil {
+		return errors.New("the configuration holds secrets, which are only saved with a key set with SetSnapshotKey")
+	}
+	content, err := yaml.Marshal(tagged)
+	if err != nil {
+		return err
+	}
+	if content, err = encryptSnapshot(content); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content)
+}
+
+// writeFileAtomic replaces the file at path with content, readable by its
+// owner only, creating its directory if needed.
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// prepareLayer applies the migrations, conditional blocks and scoped
+// overrides of data, the values of one file or provider, so that sources
+// merged together each get theirs applied before a later one replaces
+// them. Conditions also see base, the values merged below data.
+func prepareLayer(data, base map[string]interface{}) (map[string]interface{}, error) {
+	data, err := applyMigrations(convertMap(data))
+	if err == nil {
+		data, err = applyConditions(data, base)
+	}
+	if err == nil {
+		data, err = applyOverrides(data)
+	}
+	return data, err
+}
+
+// load runs p.Load, abandoning it when ctx is done, and applies the
+// migrations, conditional blocks and scoped overrides of the values it
+// returns.
+func load(ctx context.Context, p Provider) (map[string]interface{}, error) {
+	type result struct {
+		data map[string]interface{}
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := p.Load(ctx)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && !errors.Is(r.err, ErrInitFailed) {
+			return nil, fmt.Errorf("%w: %w", ErrInitFailed, r.err)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		data, err := prepareLayer(r.data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInitFailed, err)
+		}
+		return data, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrInitFailed, context.Cause(ctx))
+	}
+}
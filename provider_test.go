@@ -0,0 +1,544 @@
+package mflag
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// providerFunc adapts a function to the Provider interface.
+type providerFunc func(ctx context.Context) (map[string]interface{}, error)
+
+func (f providerFunc) Load(ctx context.Context) (map[string]interface{}, error) {
+	return f(ctx)
+}
+
+func TestInitContext(t *testing.T) {
+	testReset(t)
+	SetDefault("server.port", 80)
+	remote := providerFunc(func(ctx context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"server": map[string]interface{}{"port": 8080}}, nil
+	})
+	if err := InitContext(context.Background(), remote); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	Parse()
+	if got := GetInt("server.port"); got != 8080 {
+		t.Errorf("Expected the provider's value 8080, got %d", got)
+	}
+
+	testReset(t)
+	configPath := createTempYAML(t, "name: from-file\n")
+	if err := InitContext(context.Background(), File(configPath)); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	Parse()
+	if got := GetString("name"); got != "from-file" {
+		t.Errorf("Expected the file's value, got %q", got)
+	}
+}
+
+func TestInitContext_Secrets(t *testing.T) {
+	testReset(t)
+	remote := providerFunc(func(ctx context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"db":   map[string]interface{}{"password": NewSecret("hunter2")},
+			"keys": []interface{}{NewSecret("key")},
+		}, nil
+	})
+	if err := InitContext(context.Background(), remote); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	Parse()
+	if got := GetString("db.password"); got != "hunter2" {
+		t.Errorf("Expected the value of the secret, got %q", got)
+	}
+	if got := GetStringSlice("keys"); len(got) != 1 || got[0] != "key" {
+		t.Errorf("Expected the value of the secret in the list, got %v", got)
+	}
+	if !isSecret("db.password") || !isSecret("keys.0") {
+		t.Error("Expected the keys of the secrets to be secret")
+	}
+
+	// Snapshots keep secrets only when encrypted, and keep them secret.
+	dir := t.TempDir()
+	failing := providerFunc(func(context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("unavailable")
+	})
+	testReset(t)
+	if err := InitContext(context.Background(), remote, WithFallbackToLastGood(dir)); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	Parse()
+	if _, err := os.Stat(filepath.Join(dir, lastGoodFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected no plaintext snapshot of secrets, got %v", err)
+	}
+
+	testReset(t)
+	SetSnapshotKey(make([]byte, 32))
+	if err := InitContext(context.Background(), remote, WithFallbackToLastGood(dir)); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	Parse()
+	testReset(t)
+	SetSnapshotKey(make([]byte, 32))
+	if err := InitContext(context.Background(), failing, WithFallbackToLastGood(dir)); !errors.Is(err, ErrStaleConfig) {
+		t.Fatalf("Expected ErrStaleConfig, got %v", err)
+	}
+	Parse()
+	if got := GetString("db.password"); got != "hunter2" || !isSecret("db.password") || !isSecret("keys.0") {
+		t.Errorf("Expected the secrets of the snapshot to stay secret, got %q", got)
+	}
+}
+
+func TestInitContext_Timeout(t *testing.T) {
+	testReset(t)
+	hanging := providerFunc(func(context.Context) (map[string]interface{}, error) {
+		select {} // A provider that ignores its context.
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := InitContext(ctx, hanging)
+	if !errors.Is(err, ErrInitFailed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ErrInitFailed wrapping DeadlineExceeded, got %v", err)
+	}
+
+	failing := providerFunc(func(context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+	if err := InitContext(context.Background(), failing); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed, got %v", err)
+	}
+}
+
+func TestInitContext_Retry(t *testing.T) {
+	testReset(t)
+	calls := 0
+	flaky := providerFunc(func(context.Context) (map[string]interface{}, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("temporarily unavailable")
+		}
+		return map[string]interface{}{"ok": true}, nil
+	})
+	if err := InitContext(context.Background(), flaky, WithRetry(3, time.Millisecond)); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+
+	calls = 0
+	if err := InitContext(context.Background(), flaky, WithRetry(2, time.Millisecond)); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed once attempts are exhausted, got %v", err)
+	}
+}
+
+func TestInitContext_FallbackToLastGood(t *testing.T) {
+	testReset(t)
+	dir := t.TempDir()
+	var fail bool
+	remote := providerFunc(func(context.Context) (map[string]interface{}, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return map[string]interface{}{"pool": map[string]interface{}{"size": 20}}, nil
+	})
+	if err := InitContext(context.Background(), remote, WithFallbackToLastGood(dir)); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	Parse()
+
+	testReset(t)
+	fail = true
+	err := InitContext(context.Background(), remote, WithFallbackToLastGood(dir))
+	if !errors.Is(err, ErrStaleConfig) {
+		t.Fatalf("Expected ErrStaleConfig, got %v", err)
+	}
+	Parse()
+	if got := GetInt("pool.size"); got != 20 {
+		t.Errorf("Expected the last good value 20, got %d", got)
+	}
+
+	testReset(t)
+	if err := InitContext(context.Background(), remote, WithFallbackToLastGood(t.TempDir())); errors.Is(err, ErrStaleConfig) || !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed without a snapshot, got %v", err)
+	}
+}
+
+func TestInit_ExpandsPath(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, "name: expanded\n")
+	t.Setenv("MFLAG_TEST_DIR", filepath.Dir(configPath))
+	if err := Init("${MFLAG_TEST_DIR}/" + filepath.Base(configPath)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+	if got := GetString("name"); got != "expanded" {
+		t.Errorf("Expected the file to be found through the variable, got %q", got)
+	}
+
+	t.Setenv("HOME", filepath.Dir(configPath))
+	if path, err := expandPath("~/" + filepath.Base(configPath)); err != nil || path != configPath {
+		t.Errorf("Expected ~ to expand to the home directory, got %q, %v", path, err)
+	}
+
+	testReset(t)
+	if err := Init("$MFLAG_TEST_UNSET/app.yaml"); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for an unset variable, got %v", err)
+	}
+}
+
+func TestRequireConfigFile(t *testing.T) {
+	testReset(t)
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if err := Init(missing); err != nil {
+		t.Errorf("Expected a missing file to be ignored by default, got %v", err)
+	}
+
+	testReset(t)
+	RequireConfigFile()
+	if err := Init(missing); !errors.Is(err, ErrInitFailed) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrInitFailed wrapping ErrNotExist, got %v", err)
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	testReset(t)
+	RegisterProvider("memory", func(location string) (Provider, error) {
+		if location == "bad" {
+			return nil, errors.New("bad location")
+		}
+		return providerFunc(func(context.Context) (map[string]interface{}, error) {
+			return map[string]interface{}{"name": location}, nil
+		}), nil
+	})
+	t.Cleanup(func() {
+		providersMu.Lock()
+		delete(providers, "memory")
+		providersMu.Unlock()
+	})
+
+	if err := Init("memory://app"); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+	if got := GetString("name"); got != "app" {
+		t.Errorf("Expected the registered provider to be used, got %q", got)
+	}
+
+	if _, err := Open("memory://bad"); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed from the factory, got %v", err)
+	}
+	if err := Init("unknown://x"); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for an unknown provider, got %v", err)
+	}
+	for _, source := range []string{"config.yaml", "file://config.yaml", "./odd://name.yaml"} {
+		if p, err := Open(source); err != nil {
+			t.Errorf("Open(%q) failed: %v", source, err)
+		} else if _, ok := p.(fileProvider); !ok {
+			t.Errorf("Expected Open(%q) to return a file provider, got %T", source, p)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a name twice to panic")
+		}
+	}()
+	RegisterProvider("memory", func(string) (Provider, error) { return nil, nil })
+}
+
+func TestInitDir(t *testing.T) {
+	testReset(t)
+	SetDefault("port", 80)
+	SetDefault("db.host", "localhost")
+	SetDefault("db.pool", 5)
+	dir := t.TempDir()
+	files := map[string]string{
+		"10-base.yaml":   "port: 8080\ndb:\n  host: db.internal\n  pool: 10\n",
+		"50-local.json":  `{"db": {"pool": 20}}`,
+		"20-extra.yml":   "log_level: debug\n",
+		"99-ignored.txt": "port: 1\n",
+		".hidden.yaml":   "port: 2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InitDir(dir); err != nil {
+		t.Fatalf("InitDir() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := GetInt("port"); got != 8080 {
+		t.Errorf("Expected port 8080, got %d", got)
+	}
+	if got := GetString("db.host"); got != "db.internal" {
+		t.Errorf("Expected db.host from 10-base.yaml, got %q", got)
+	}
+	if got := GetInt("db.pool"); got != 20 {
+		t.Errorf("Expected db.pool from 50-local.json, got %d", got)
+	}
+	if got := sourceOf("db.pool"); got != "file" {
+		t.Errorf("Expected source file, got %q", got)
+	}
+	if got := len(ConfigFilesUsed()); got != 3 {
+		t.Errorf("Expected 3 files used, got %d", got)
+	}
+
+	testReset(t)
+	if err := InitDir(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("Expected no error for a missing directory, got %v", err)
+	}
+	RequireConfigFile()
+	if err := InitDir(filepath.Join(dir, "missing")); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for a required missing directory, got %v", err)
+	}
+}
+
+func TestInitDir_Conditions(t *testing.T) {
+	testReset(t)
+	SetDefault("replicas", 0)
+	SetDefault("debug", false)
+	dir := t.TempDir()
+	files := map[string]string{
+		"10-base.yaml":  "env: prod\nwhen:\n  - if: env == \"prod\"\n    then: {replicas: 5}\n",
+		"50-local.yaml": "when:\n  - if: env == \"prod\"\n    then: {debug: true}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InitDir(dir); err != nil {
+		t.Fatalf("InitDir() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := GetInt("replicas"); got != 5 {
+		t.Errorf("Expected the block of 10-base.yaml to apply, got replicas %d", got)
+	}
+	if !GetBool("debug") {
+		t.Error("Expected the block of 50-local.yaml to see env from 10-base.yaml")
+	}
+}
+
+func TestInitArchive(t *testing.T) {
+	files := []struct{ name, content string }{
+		{"base.yaml", "port: 8080\ndb:\n  host: db.internal\n  pool: 10\n"},
+		{"regions/eu.yaml", "db:\n  pool: 20\n"},
+		{"zz-unused.yaml", "port: 1\n"},
+		{"manifest.yaml", "files: [base.yaml, ./regions/eu.yaml]\n"},
+	}
+	var tgz bytes.Buffer
+	gz := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + f.name, Mode: 0o644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, f := range files[:3] { // No manifest: lexical order.
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		wantPort int
+	}{
+		{"config.tgz", tgz.Bytes(), 8080},
+		{"config.zip", zipped.Bytes(), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testReset(t)
+			path := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(path, tt.content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := InitArchive(path); err != nil {
+				t.Fatalf("InitArchive() failed: %v", err)
+			}
+			os.Args = []string{"test"}
+			Parse()
+			if got := GetInt("port"); got != tt.wantPort {
+				t.Errorf("Expected port %d, got %d", tt.wantPort, got)
+			}
+			if got := GetInt("db.pool"); got != 20 {
+				t.Errorf("Expected db.pool from regions/eu.yaml, got %d", got)
+			}
+		})
+	}
+
+	testReset(t)
+	path := filepath.Join(t.TempDir(), "bad.tar")
+	if err := os.WriteFile(path, []byte("not an archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitArchive(path); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for an invalid archive, got %v", err)
+	}
+}
+
+func TestLoadArchive_Conditions(t *testing.T) {
+	testReset(t)
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, f := range []struct{ name, content string }{
+		{"10-base.yaml", "env: prod\nwhen:\n  - if: env == \"prod\"\n    then: {replicas: 5}\n"},
+		{"50-local.yaml", "when:\n  - if: env == \"prod\"\n    then: {debug: true}\n"},
+	} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _, err := loadArchive(zipped.Bytes())
+	if err != nil {
+		t.Fatalf("loadArchive() failed: %v", err)
+	}
+	if data["replicas"] != 5 || data["debug"] != true {
+		t.Errorf("Expected the blocks of both files to apply, got %v", data)
+	}
+}
+
+func TestSetArchiveLimits(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		content := "padding: " + strings.Repeat("x", 100) + "\n"
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.tar")
+	if err := os.WriteFile(path, archive.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		perFile, total int64
+		wantErr        string
+	}{
+		{"within limits", 200, 400, ""},
+		{"file too large", 50, 400, "per file"},
+		{"archive too large", 200, 150, "in total"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testReset(t)
+			SetArchiveLimits(tt.perFile, tt.total)
+			err := InitArchive(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("InitArchive() failed: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInitFailed) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected ErrInitFailed exceeding the limit %s, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestContent(t *testing.T) {
+	testReset(t)
+	p := Merge(
+		Content("base.yaml", []byte("port: 8080\ndb:\n  host: db.internal\n  pool: 10\n")),
+		Content("prod.json", []byte(`{"db": {"pool": 50}}`)),
+	)
+	if err := InitContext(context.Background(), p); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if GetInt("port") != 8080 || GetString("db.host") != "db.internal" || GetInt("db.pool") != 50 {
+		t.Errorf("Expected the contents to be merged in order, got port %d, db.host %q, db.pool %d", GetInt("port"), GetString("db.host"), GetInt("db.pool"))
+	}
+	if files := ConfigFilesUsed(); len(files) != 0 {
+		t.Errorf("Expected no config files to be recorded, got %v", files)
+	}
+
+	// The blocks of each content apply, seeing the contents before it.
+	testReset(t)
+	p = Merge(
+		Content("base.yaml", []byte("env: prod\nwhen:\n  - if: env == \"prod\"\n    then: {replicas: 5}\n")),
+		Content("local.yaml", []byte("when:\n  - if: env == \"prod\"\n    then: {debug: true}\n")),
+	)
+	if err := InitContext(context.Background(), p); err != nil {
+		t.Fatalf("InitContext() failed: %v", err)
+	}
+	Parse()
+	if GetInt("replicas") != 5 || !GetBool("debug") {
+		t.Errorf("Expected the blocks of both contents to apply, got replicas %d and debug %t", GetInt("replicas"), GetBool("debug"))
+	}
+
+	_, err := Merge(Content("base.yaml", []byte("port: 1\n")), Content("bad.tar", []byte("not an archive"))).Load(context.Background())
+	if !errors.Is(err, ErrInitFailed) || !strings.Contains(err.Error(), "bad.tar") {
+		t.Errorf("Expected ErrInitFailed naming bad.tar, got %v", err)
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	m := map[string]interface{}{"db": "flat"}
+	SetPath(m, []string{"db", "host"}, "localhost")
+	SetPath(m, []string{"db", "port"}, 5432)
+	SetPath(m, []string{"name"}, "app")
+	want := map[string]interface{}{
+		"db":   map[string]interface{}{"host": "localhost", "port": 5432},
+		"name": "app",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("SetPath() built %v, want %v", m, want)
+	}
+}
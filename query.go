@@ -0,0 +1,83 @@
+package mflag
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// GetAll returns the values of the keys matching pattern by key, for reads
+// across sections such as every host configured under "servers":
+//
+//	servers:
+//	  eu: {host: eu.example.com}
+//	  us: {host: us.example.com, replicas: [{host: us-2.example.com}]}
+//
+// GetAll("servers.*.host") returns "servers.eu.host" and "servers.us.host",
+// and GetAll("servers.**.host") also returns "servers.us.replicas.0.host".
+// Segments of pattern are matched as in path.Match, against the keys of
+// maps and the indexes of lists; "**" matches any number of segments. The
+// values are copies, which the caller may modify.
+// Must be called after Parse.
+func GetAll(pattern string) map[string]interface{} {
+	mustBeParsed()
+	return finalConfig.GetAll(pattern)
+}
+
+// GetAll returns the values of the keys in the section matching pattern,
+// as the package-level GetAll does.
+func (s *Section) GetAll(pattern string) map[string]interface{} {
+	return s.m.GetAll(pattern)
+}
+
+// GetAll returns the values of the keys matching pattern.
+func (m *mapManager) GetAll(pattern string) map[string]interface{} {
+	result := make(map[string]interface{})
+	matchKeys("", m.data, strings.Split(pattern, "."), result)
+	return result
+}
+
+// matchKeys adds the values below node, at key prefix, whose keys match
+// the segments of a pattern to result.
+func matchKeys(prefix string, node interface{}, segments []string, result map[string]interface{}) {
+	if len(segments) == 0 {
+		if prefix != "" {
+			result[prefix] = deepCopyValue(node)
+		}
+		return
+	}
+	segment := segments[0]
+	if segment == "**" {
+		matchKeys(prefix, node, segments[1:], result)
+	}
+	for name, child := range children(node) {
+		if segment == "**" {
+			matchKeys(joinKey(prefix, name), child, segments, result)
+			continue
+		}
+		if matched, _ := path.Match(segment, name); matched {
+			matchKeys(joinKey(prefix, name), child, segments[1:], result)
+		}
+	}
+}
+
+// children returns the entries of a map, or the items of a list by index.
+func children(node interface{}) map[string]interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		return n
+	case []interface{}:
+		items := make(map[string]interface{}, len(n))
+		for i, item := range n {
+			items[strconv.Itoa(i)] = item
+		}
+		return items
+	case []string:
+		items := make(map[string]interface{}, len(n))
+		for i, item := range n {
+			items[strconv.Itoa(i)] = item
+		}
+		return items
+	}
+	return nil
+}
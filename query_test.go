@@ -0,0 +1,55 @@
+package mflag
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGetAll(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, `
+servers:
+  eu:
+    host: eu.example.com
+    port: 443
+  us:
+    host: us.example.com
+    replicas:
+      - host: us-2.example.com
+      - host: us-3.example.com
+tags: [a, b]
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--servers-eu-host=eu-1.example.com"}
+	Parse()
+
+	tests := []struct {
+		pattern string
+		want    map[string]interface{}
+	}{
+		{"servers.*.host", map[string]interface{}{
+			"servers.eu.host": "eu-1.example.com",
+			"servers.us.host": "us.example.com",
+		}},
+		{"servers.**.host", map[string]interface{}{
+			"servers.eu.host":            "eu-1.example.com",
+			"servers.us.host":            "us.example.com",
+			"servers.us.replicas.0.host": "us-2.example.com",
+			"servers.us.replicas.1.host": "us-3.example.com",
+		}},
+		{"servers.e?.port", map[string]interface{}{"servers.eu.port": 443}},
+		{"tags.1", map[string]interface{}{"tags.1": "b"}},
+		{"servers.*.missing", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		if got := GetAll(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetAll(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+	if got := Sub("servers").GetAll("*.host"); len(got) != 2 || got["eu.host"] != "eu-1.example.com" {
+		t.Errorf("Section.GetAll() = %v", got)
+	}
+}
@@ -0,0 +1,45 @@
+package mflag
+
+import "time"
+
+// Reader is read-only access to configuration. *Section, returned by
+// Snapshot and Sub, and *Live implement it, so that application code can
+// depend on a Reader instead of the package-level getters and tests can
+// pass a fake or a configuration built with Build:
+//
+//	func NewServer(cfg mflag.Reader) *Server {
+//		return &Server{addr: cfg.GetString("addr"), timeout: cfg.GetDuration("timeout")}
+//	}
+//
+//	srv := NewServer(mflag.Snapshot())
+type Reader interface {
+	GetString(key string) string
+	GetInt(key string) int
+	GetInt64(key string) int64
+	GetUint(key string) uint
+	GetUint64(key string) uint64
+	GetBool(key string) bool
+	GetFloat64(key string) float64
+	GetDuration(key string) time.Duration
+	GetStringSlice(key string) []string
+	GetStringMapString(key string) map[string]string
+	IsSet(key string) bool
+	// Sub returns the section at key.
+	Sub(key string) Reader
+	// UnmarshalKey decodes the value at key, or everything if key is
+	// empty, into out.
+	UnmarshalKey(key string, out interface{}) error
+}
+
+var (
+	_ Reader = (*Section)(nil)
+	_ Reader = (*Live)(nil)
+)
+
+// Snapshot returns the effective configuration as a section, taken at call
+// time, for code that depends on a Reader.
+// Must be called after Parse.
+func Snapshot() *Section {
+	mustBeParsed()
+	return newSection("", finalConfig.data)
+}
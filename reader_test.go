@@ -0,0 +1,72 @@
+package mflag
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	testReset(t)
+	SetDefault("server.addr", ":8080")
+	SetDefault("server.timeout", 5*time.Second)
+	os.Args = []string{"test", "--server-addr=:9090"}
+	Parse()
+
+	type server struct {
+		Addr    string
+		Timeout time.Duration
+	}
+	newServer := func(cfg Reader) server {
+		var s server
+		if err := cfg.UnmarshalKey("server", &s); err != nil {
+			t.Fatalf("UnmarshalKey() failed: %v", err)
+		}
+		return s
+	}
+	want := server{Addr: ":9090", Timeout: 5 * time.Second}
+
+	snapshot := Snapshot()
+	if got := newServer(snapshot); got != want {
+		t.Errorf("newServer(Snapshot()) = %+v, want %+v", got, want)
+	}
+	if got := snapshot.Sub("server").(*Section).Key(); got != "server" {
+		t.Errorf("Snapshot().Sub(%q).Key() = %q, want %q", "server", got, "server")
+	}
+	live := NewLive("test")
+	defer live.Close()
+	if got := newServer(live); got != want {
+		t.Errorf("newServer(NewLive()) = %+v, want %+v", got, want)
+	}
+
+	// The snapshot does not follow later changes.
+	finalConfig.SetValue("server.addr", ":7070")
+	if got := snapshot.GetString("server.addr"); got != ":9090" {
+		t.Errorf("Snapshot().GetString() = %q after a change, want %q", got, ":9090")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	b := Build().
+		Set("server.addr", ":8080").
+		Set("server.timeout", 5*time.Second).
+		Set("server.tags", []string{"a", "b"})
+	cfg := b.Reader()
+	b.Set("server.addr", ":9090")
+
+	if got := cfg.GetString("server.addr"); got != ":8080" {
+		t.Errorf("GetString() = %q, want %q", got, ":8080")
+	}
+	if got := cfg.GetDuration("server.timeout"); got != 5*time.Second {
+		t.Errorf("GetDuration() = %v, want %v", got, 5*time.Second)
+	}
+	if got := cfg.Sub("server").GetStringSlice("tags"); len(got) != 2 || got[1] != "b" {
+		t.Errorf("Sub().GetStringSlice() = %v, want [a b]", got)
+	}
+	if cfg.IsSet("client") {
+		t.Error("IsSet() = true for a key that was not set")
+	}
+	if got := b.Reader().GetString("server.addr"); got != ":9090" {
+		t.Errorf("GetString() = %q after Set, want %q", got, ":9090")
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/hypedn/mflag/redis
+
+go 1.24
+
+require (
+	github.com/alicebob/miniredis/v2 v2.37.0
+	github.com/hypedn/mflag v0.0.0-20261016204951-551c88cf9f97
+	github.com/redis/go-redis/v9 v9.12.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
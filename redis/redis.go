@@ -0,0 +1,192 @@
+// Package redis provides an mflag provider reading configuration from Redis,
+// either from the fields of a hash or from a JSON or YAML document stored at
+// a key, and subscribing to a channel on which publishers announce changes.
+//
+//	p := redis.Hash("localhost:6379", "config:app")
+//	err := mflag.InitContext(ctx, p)
+//	...
+//	for range p.Watch(ctx) {
+//		mflag.Reload(ctx)
+//	}
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hypedn/mflag"
+	goredis "github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// Provider reads configuration from Redis. It implements mflag.Provider.
+type Provider struct {
+	key     string
+	hash    bool
+	channel string
+
+	opts   goredis.Options
+	client goredis.UniversalClient
+}
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithAuth authenticates with username and password. An empty username
+// authenticates with the password only, as Redis before version 6 expects.
+func WithAuth(username, password string) Option {
+	return func(p *Provider) {
+		p.opts.Username, p.opts.Password = username, password
+	}
+}
+
+// WithDB selects the logical database db.
+func WithDB(db int) Option {
+	return func(p *Provider) {
+		p.opts.DB = db
+	}
+}
+
+// WithTLS connects over TLS configured by cfg.
+func WithTLS(cfg *tls.Config) Option {
+	return func(p *Provider) {
+		p.opts.TLSConfig = cfg
+	}
+}
+
+// WithChannel sets the channel Watch subscribes to. It defaults to the key.
+func WithChannel(channel string) Option {
+	return func(p *Provider) {
+		p.channel = channel
+	}
+}
+
+// WithClient reads from Redis with client rather than with a client for
+// addr, for example to reach a cluster or to share a connection pool.
+// WithAuth, WithDB and WithTLS have no effect then, and addr is ignored.
+func WithClient(client goredis.UniversalClient) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// Hash returns a provider reading the fields of the hash at key of the
+// server at addr. Field names are keys, with dots denoting nesting, and
+// values are strings.
+func Hash(addr, key string, opts ...Option) *Provider {
+	return newProvider(addr, key, true, opts)
+}
+
+// JSON returns a provider reading the JSON or YAML document stored as a
+// string at key of the server at addr.
+func JSON(addr, key string, opts ...Option) *Provider {
+	return newProvider(addr, key, false, opts)
+}
+
+func newProvider(addr, key string, hash bool, opts []Option) *Provider {
+	p := &Provider{key: key, hash: hash, channel: key, opts: goredis.Options{Addr: addr}}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.client == nil {
+		p.client = goredis.NewClient(&p.opts)
+	}
+	return p
+}
+
+// Load reads the hash or document. A missing key yields no values.
+func (p *Provider) Load(ctx context.Context) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if p.hash {
+		fields, err := p.client.HGetAll(ctx, p.key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis: reading %s: %w", p.key, err)
+		}
+		for name, value := range fields {
+			mflag.SetPath(values, strings.Split(name, "."), value)
+		}
+		return values, nil
+	}
+
+	doc, err := p.client.Get(ctx, p.key).Result()
+	if errors.Is(err, goredis.Nil) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: reading %s: %w", p.key, err)
+	}
+	if err := yaml.Unmarshal([]byte(doc), &values); err != nil {
+		return nil, fmt.Errorf("redis: parsing %s: %w", p.key, err)
+	}
+	return values, nil
+}
+
+// Watch subscribes to the channel and sends an update whenever a message
+// is published to it, until ctx is done. It implements mflag.Watcher.
+// Updates arriving faster than they are received are coalesced. The
+// subscription is re-established after connection failures, which are
+// reported as errors, sending an update each time since messages may have
+// been missed.
+func (p *Provider) Watch(ctx context.Context) <-chan mflag.Update {
+	updates := make(chan mflag.Update, 1)
+	send := func(u mflag.Update) {
+		select {
+		case updates <- u:
+		default:
+		}
+	}
+	go func() {
+		defer close(updates)
+		wait := time.Second
+		for reconnect := false; ctx.Err() == nil; reconnect = true {
+			err := p.subscribe(ctx, send, reconnect)
+			if err == nil {
+				wait = time.Second
+			} else if ctx.Err() == nil {
+				send(mflag.Update{Err: err})
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+			wait = min(2*wait, time.Minute)
+		}
+	}()
+	return updates
+}
+
+// subscribe subscribes to the channel and sends an update for every message
+// until the connection fails or ctx is done. It reports nil if it
+// subscribed successfully.
+func (p *Provider) subscribe(ctx context.Context, send func(mflag.Update), reconnect bool) error {
+	sub := p.client.Subscribe(ctx)
+	defer sub.Close()
+	// Receiving blocks regardless of ctx.
+	stop := context.AfterFunc(ctx, func() { sub.Close() })
+	defer stop()
+	// Subscribing on the PubSub rather than passing the channel to
+	// Subscribe reports the error of the first connection.
+	if err := sub.Subscribe(ctx, p.channel); err != nil {
+		return fmt.Errorf("redis: subscribing to %s: %w", p.channel, err)
+	}
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("redis: subscribing to %s: %w", p.channel, err)
+	}
+	if reconnect {
+		send(mflag.Update{})
+	}
+	for {
+		// The PubSub reconnects on its own after a failure, losing the
+		// messages published meanwhile, so any failure ends the
+		// subscription for Watch to report the change.
+		if _, err := sub.ReceiveMessage(ctx); err != nil {
+			return nil
+		}
+		send(mflag.Update{})
+	}
+}
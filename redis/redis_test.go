@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hypedn/mflag"
+)
+
+var _ mflag.Watcher = (*Provider)(nil)
+
+func TestLoad(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireAuth("secret")
+	s.Select(2)
+	s.HSet("config:app", "port", "8080", "database.host", "db")
+	s.Select(0)
+	s.Set("config:doc", `{"port": 8080, "features": ["a"]}`)
+
+	ctx := context.Background()
+	got, err := Hash(s.Addr(), "config:app", WithAuth("", "secret"), WithDB(2)).Load(ctx)
+	want := map[string]interface{}{"port": "8080", "database": map[string]interface{}{"host": "db"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, %v, want %v", got, err, want)
+	}
+
+	got, err = JSON(s.Addr(), "config:doc", WithAuth("default", "secret")).Load(ctx)
+	want = map[string]interface{}{"port": 8080, "features": []interface{}{"a"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, %v, want %v", got, err, want)
+	}
+
+	got, err = JSON(s.Addr(), "missing", WithAuth("", "secret")).Load(ctx)
+	if err != nil || len(got) != 0 {
+		t.Errorf("Expected no values for a missing key, got %v, %v", got, err)
+	}
+
+	if _, err := Hash(s.Addr(), "config:app").Load(ctx); err == nil {
+		t.Error("Expected an error without authentication")
+	}
+	if _, err := Hash(s.Addr(), "config:app", WithAuth("", "wrong")).Load(ctx); err == nil {
+		t.Error("Expected an error for a wrong password")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := Hash(s.Addr(), "config:app", WithChannel("config-changed")).Watch(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Publish("config-changed", "1") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected Watch to subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change to be reported")
+	}
+	cancel()
+	for range changes {
+	}
+}
@@ -0,0 +1,104 @@
+package mflag
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// KeyOption declares one property of a key registered with Register.
+type KeyOption func(key string, s *keySpec)
+
+// Register declares key with everything known about it in one place: its
+// default, usage text, whether it is required or secret, the environment
+// variable it is read from and how its value is validated. Flag generation,
+// Keys, GenerateDocs, JSONSchema and Validate all consume this declaration,
+// so that none of them drifts from the others.
+//
+//	mflag.Register("db.password",
+//		mflag.Usage("Password of the database user."),
+//		mflag.Required(),
+//		mflag.Sensitive(),
+//		mflag.Env("DB_PASSWORD"))
+//
+// Registering a key again adds to its declaration.
+// It should be called before Init and Parse.
+func Register(key string, opts ...KeyOption) {
+	s := specFor(key)
+	s.registered = true
+	for _, opt := range opts {
+		opt(key, s)
+	}
+}
+
+// Default sets the default value of the key, as SetDefault does.
+func Default(value interface{}) KeyOption {
+	return func(key string, _ *keySpec) {
+		SetDefault(key, value)
+	}
+}
+
+// Usage sets the description of the key, as Describe does.
+func Usage(description string) KeyOption {
+	return func(_ string, s *keySpec) {
+		s.description = description
+	}
+}
+
+// Required makes Parse fail if the key is not set, as MarkRequired does.
+func Required() KeyOption {
+	return func(_ string, s *keySpec) {
+		s.required = true
+	}
+}
+
+// Sensitive marks the key as holding a secret, as MarkSecret does.
+func Sensitive() KeyOption {
+	return func(_ string, s *keySpec) {
+		s.secret = true
+	}
+}
+
+// As declares the type of the key, as DeclareKey does.
+func As(typ Type) KeyOption {
+	return func(_ string, s *keySpec) {
+		s.typ = typ
+	}
+}
+
+// Env reads the key from the first of the environment variables names that
+// is set, such as Env("PGHOST", "POSTGRES_HOST"), instead of the variable
+// named by SetEnvPrefix. Values from the environment take precedence over
+// the config file and are overridden by flags, and are converted to the
+// type of the key.
+func Env(names ...string) KeyOption {
+	return func(_ string, s *keySpec) {
+		s.env = names
+	}
+}
+
+// Validator adds a function checking the value of the key whenever it is
+// set. An error it returns makes Parse fail with ErrInvalidValue.
+func Validator(fn func(value interface{}) error) KeyOption {
+	return func(_ string, s *keySpec) {
+		s.validators = append(s.validators, fn)
+	}
+}
+
+// validateKeys runs the validators registered with Validator on the keys
+// that are set in m.
+func validateKeys(m *mapManager) []error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(specs)) {
+		if len(specs[key].validators) == 0 || !m.IsSet(key) {
+			continue
+		}
+		value := m.Get(key)
+		for _, fn := range specs[key].validators {
+			if err := fn(value); err != nil {
+				errs = append(errs, fmt.Errorf("%w %v for %q: %w", ErrInvalidValue, displayValue(key, value), key, err))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,101 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	testReset(t)
+	Register("server.port",
+		Default(8080),
+		Usage("Port to listen on."),
+		Env("TEST_MFLAG_PORT"),
+		Validator(func(v interface{}) error {
+			if v.(int) < 1024 {
+				return errors.New("privileged port")
+			}
+			return nil
+		}))
+	Register("db.password", Required(), Sensitive(), As(String), Env("TEST_MFLAG_DB_PASSWORD"))
+	t.Setenv("TEST_MFLAG_PORT", "9090")
+	t.Setenv("TEST_MFLAG_DB_PASSWORD", "hunter2")
+
+	os.Args = []string{"test"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got := GetInt("server.port"); got != 9090 {
+		t.Errorf("Expected the port from the environment, got %d", got)
+	}
+	if got := sourceOf("server.port"); got != "env" {
+		t.Errorf("Expected source env, got %q", got)
+	}
+	if !IsExplicitlySet("db.password") {
+		t.Error("Expected a key set from the environment to be explicitly set")
+	}
+	if got := usageFor("server.port"); got != "Port to listen on." {
+		t.Errorf("Expected the usage of the registration, got %q", got)
+	}
+
+	keys := Keys()
+	if len(keys) != 2 {
+		t.Fatalf("Expected both registered keys, got %+v", keys)
+	}
+	if k := keys[0]; k.Key != "db.password" || !k.Required || !k.Secret || k.Env != "TEST_MFLAG_DB_PASSWORD" {
+		t.Errorf("Unexpected key info %+v", k)
+	}
+
+	var buf strings.Builder
+	if err := GenerateDocs(&buf, Markdown); err != nil {
+		t.Fatalf("GenerateDocs() failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Port to listen on. Environment variable: `TEST_MFLAG_PORT`.") {
+		t.Errorf("Expected the environment variable in the docs, got:\n%s", buf.String())
+	}
+}
+
+func TestRegister_Flags(t *testing.T) {
+	testReset(t)
+	Register("server.port", Default(8080), Env("TEST_MFLAG_PORT"))
+	t.Setenv("TEST_MFLAG_PORT", "9090")
+
+	os.Args = []string{"test", "--server-port=9100"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got := GetInt("server.port"); got != 9100 {
+		t.Errorf("Expected the flag to take precedence over the environment, got %d", got)
+	}
+}
+
+func TestRegister_Errors(t *testing.T) {
+	testReset(t)
+	Register("server.port", Default(8080), Env("TEST_MFLAG_PORT"))
+	t.Setenv("TEST_MFLAG_PORT", "http")
+	os.Args = []string{"test"}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue for a malformed variable, got %v", err)
+	}
+
+	testReset(t)
+	Register("server.port", Default(8080), Validator(func(v interface{}) error {
+		if v.(int) < 1024 {
+			return errors.New("privileged port")
+		}
+		return nil
+	}))
+	os.Args = []string{"test", "--server-port=80"}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue from the validator, got %v", err)
+	}
+
+	testReset(t)
+	Register("token", Required())
+	os.Args = []string{"test"}
+	if err := ParseWithError(); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("Expected ErrMissingKey for a required key, got %v", err)
+	}
+}
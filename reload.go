@@ -0,0 +1,326 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrReloadRejected is returned by Reload when ReloadPolicy.Approve rejects
+// the new configuration.
+var ErrReloadRejected = errors.New("mflag: reload rejected")
+
+// ReloadPolicy controls how Reload applies new configuration to Live
+// handles, so that risky changes such as pool sizes or timeouts can be
+// staged.
+type ReloadPolicy struct {
+	// Percent is the percentage of Live handles, chosen deterministically by
+	// their ID, that receive new configuration. The others keep the current
+	// configuration until Promote is called. 0 and 100 apply it to all.
+	Percent float64
+	// Approve, if set, is called with the current and the new configuration
+	// before anything is applied. Returning an error rejects the reload.
+	Approve func(current, next *Section) error
+}
+
+var (
+	// source is the provider given to Init or InitContext, loaded again by
+	// Reload.
+	source Provider
+	// reloadPolicy is the policy set with SetReloadPolicy.
+	reloadPolicy ReloadPolicy
+
+	// reloadMu guards lives, stable, canary, appliedFile, defaults once
+	// parsed and queuedDefaults.
+	reloadMu sync.Mutex
+	lives    = make(map[*Live]struct{})
+	// stable is the configuration of every Live handle outside the canary.
+	stable *mapManager
+	// canary is the configuration staged by the last Reload, nil if there is
+	// none.
+	canary         *mapManager
+	canaryFile     *mapManager // the configuration source values of canary
+	canaryDefaults *mapManager // the defaults merged into canary
+	canaryPercent  float64
+	// queuedDefaults holds the defaults set after Parse, which the next
+	// applied Reload or Parse makes the defaults. It is replaced rather
+	// than modified, so that a Reload can merge it unlocked.
+	queuedDefaults *mapManager
+)
+
+// SetReloadPolicy sets the policy used by Reload.
+func SetReloadPolicy(p ReloadPolicy) {
+	reloadPolicy = p
+}
+
+// Live is a handle on configuration that follows Reload. Package-level
+// getters keep returning the values produced by Parse; Live handles are how
+// parts of an application opt into dynamic configuration. It is safe for
+// concurrent use.
+type Live struct {
+	id  string
+	cfg atomic.Pointer[mapManager]
+}
+
+// NewLive returns a Live handle. id identifies it for ReloadPolicy.Percent
+// and should be stable, such as an instance or worker name. Call Close once
+// the handle is no longer used.
+// Must be called after Parse.
+func NewLive(id string) *Live {
+	mustBeParsed()
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if stable == nil {
+		stable = finalConfig
+	}
+	l := &Live{id: id}
+	l.cfg.Store(configFor(id))
+	lives[l] = struct{}{}
+	return l
+}
+
+// Close stops l from following reloads. Its getters keep returning the
+// values it had.
+func (l *Live) Close() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	delete(lives, l)
+}
+
+// configFor returns the configuration a Live handle with id should see.
+func configFor(id string) *mapManager {
+	if canary != nil && float64(bucket(canaryBucket, "reload", id)) < canaryPercent*100 {
+		return canary
+	}
+	return stable
+}
+
+// Reload loads the configuration again from the provider given to Init or
+// InitContext, merges it with the defaults and the flags of the command
+// line, validates it and applies it to Live handles according to the
+// ReloadPolicy. An invalid configuration is not applied. It also loads the
+// files of the configs returned by GetTLSConfig again, so that a watcher
+// can call it when certificates are rotated.
+// Must be called after Parse.
+func Reload(ctx context.Context) error {
+	mustBeParsed()
+	return errors.Join(reloadConfig(ctx), reloadTLSFiles())
+}
+
+// reloadConfig is Reload without the TLS files.
+func reloadConfig(ctx context.Context) error {
+	if source == nil {
+		return fmt.Errorf("%w: nothing to reload, Init was not called", ErrInitFailed)
+	}
+	defs := nextDefaults()
+	data, err := load(ctx, source)
+	if err != nil {
+		return err
+	}
+	file := newManager()
+	file.data = convertMap(data)
+	next := mergeLayersWith(defs, file, flagConfig)
+	if err := resolveValues(next, file); err != nil {
+		return err
+	}
+	if err := validate(next); err != nil {
+		return err
+	}
+	next.buildIndex()
+
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+	prev, applied, err := applyReload(next, file, defs)
+	if err != nil || !applied {
+		return err
+	}
+	return rotateSecrets(prev, next)
+}
+
+// applyReload applies next, loaded from file and merged with the defaults
+// defs, according to the ReloadPolicy. It returns the previous stable
+// configuration and whether next became the stable one.
+func applyReload(next, file, defs *mapManager) (*mapManager, bool, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if stable == nil {
+		stable = finalConfig
+	}
+	policy := reloadPolicy
+	if policy.Approve != nil {
+		if err := policy.Approve(newSection("", stable.data), newSection("", next.data)); err != nil {
+			return nil, false, fmt.Errorf("%w: %w", ErrReloadRejected, err)
+		}
+	}
+	prev := stable
+	applied := policy.Percent <= 0 || policy.Percent >= 100
+	if applied {
+		stable, canary, canaryFile, canaryDefaults = next, nil, nil, nil
+		appliedFile = file
+		commitDefaults(defs)
+		leaveLastKnownGood()
+		saveLastKnownGood(next)
+	} else {
+		canary, canaryFile, canaryDefaults, canaryPercent = next, file, defs, policy.Percent
+	}
+	auditChanges(prev, next, func(key string) string { return sourceIn(file, key) })
+	applyLive()
+	return prev, applied, nil
+}
+
+// Promote applies the configuration staged by a partial Reload to every
+// Live handle.
+func Promote() {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+	reloadMu.Lock()
+	prev, next := stable, canary
+	if canary != nil {
+		stable, canary = canary, nil
+		appliedFile, canaryFile = canaryFile, nil
+		commitDefaults(canaryDefaults)
+		canaryDefaults = nil
+		leaveLastKnownGood()
+		saveLastKnownGood(stable)
+		applyLive()
+	}
+	reloadMu.Unlock()
+	if next != nil {
+		_ = rotateSecrets(prev, next)
+	}
+}
+
+// Rollback reverts the Live handles that received the configuration staged
+// by a partial Reload.
+func Rollback() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if canary != nil {
+		canary, canaryFile, canaryDefaults = nil, nil, nil
+		applyLive()
+	}
+}
+
+// queueDefault sets the default of key to value from the next applied
+// Reload or Parse on, leaving the defaults merged by the last one
+// untouched.
+func queueDefault(key string, value interface{}) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	next := defaults
+	if queuedDefaults != nil {
+		next = queuedDefaults
+	}
+	next = next.Clone()
+	next.SetValue(key, value)
+	queuedDefaults = next
+}
+
+// nextDefaults returns the defaults the next Reload merges: those set with
+// SetDefault since the last applied Reload or Parse, if any.
+func nextDefaults() *mapManager {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if queuedDefaults != nil {
+		return queuedDefaults
+	}
+	return defaults
+}
+
+// commitDefaults makes defs, merged by an applied Reload, the defaults.
+// Defaults queued since defs was merged stay queued. reloadMu must be held.
+func commitDefaults(defs *mapManager) {
+	defaults = defs
+	if queuedDefaults == defs {
+		queuedDefaults = nil
+	}
+}
+
+// applyQueuedDefaults replaces the defaults by those set with SetDefault
+// since the last applied Reload or Parse, if any.
+func applyQueuedDefaults() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if queuedDefaults != nil {
+		defaults, queuedDefaults = queuedDefaults, nil
+	}
+}
+
+// applyLive points every Live handle at the configuration it should see.
+// reloadMu must be held.
+func applyLive() {
+	for l := range lives {
+		l.cfg.Store(configFor(l.id))
+	}
+}
+
+// GetString returns the value associated with the key as a string.
+func (l *Live) GetString(key string) string {
+	return l.cfg.Load().GetString(key)
+}
+
+// GetInt returns the value associated with the key as an integer.
+func (l *Live) GetInt(key string) int {
+	return l.cfg.Load().GetInt(key)
+}
+
+// GetInt64 returns the value associated with the key as an int64.
+func (l *Live) GetInt64(key string) int64 {
+	return l.cfg.Load().GetInt64(key)
+}
+
+// GetUint returns the value associated with the key as an unsigned integer.
+func (l *Live) GetUint(key string) uint {
+	return l.cfg.Load().GetUint(key)
+}
+
+// GetUint64 returns the value associated with the key as an uint64.
+func (l *Live) GetUint64(key string) uint64 {
+	return l.cfg.Load().GetUint64(key)
+}
+
+// GetBool returns the value associated with the key as a boolean.
+func (l *Live) GetBool(key string) bool {
+	return l.cfg.Load().GetBool(key)
+}
+
+// GetFloat64 returns the value associated with the key as a float64.
+func (l *Live) GetFloat64(key string) float64 {
+	return l.cfg.Load().GetFloat64(key)
+}
+
+// GetDuration returns the value associated with the key as a time.Duration.
+func (l *Live) GetDuration(key string) time.Duration {
+	return l.cfg.Load().GetDuration(key)
+}
+
+// GetStringSlice returns the value associated with the key as a slice of strings.
+func (l *Live) GetStringSlice(key string) []string {
+	return l.cfg.Load().GetStringSlice(key)
+}
+
+// GetStringMapString returns the value associated with the key as a map of strings.
+func (l *Live) GetStringMapString(key string) map[string]string {
+	return l.cfg.Load().GetStringMapString(key)
+}
+
+// IsSet checks if a key is set in the configuration.
+func (l *Live) IsSet(key string) bool {
+	return l.cfg.Load().IsSet(key)
+}
+
+// Sub returns the section at key of the configuration l currently sees, a
+// *Section.
+func (l *Live) Sub(key string) Reader {
+	return newSection(key, l.cfg.Load().Get(key))
+}
+
+// UnmarshalKey decodes the value associated with the key in the
+// configuration l currently sees into out, as the package-level
+// UnmarshalKey does.
+func (l *Live) UnmarshalKey(key string, out interface{}) error {
+	return l.cfg.Load().UnmarshalKey(key, out)
+}
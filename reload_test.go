@@ -0,0 +1,150 @@
+package mflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestReloadCanary(t *testing.T) {
+	testReset(t)
+	MarkRequired("pool.size")
+	configPath := createTempYAML(t, "pool:\n  size: 10\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	var handles []*Live
+	for i := range 100 {
+		handles = append(handles, NewLive(fmt.Sprintf("worker-%d", i)))
+	}
+	countSize := func(size int) int {
+		n := 0
+		for _, l := range handles {
+			if l.GetInt("pool.size") == size {
+				n++
+			}
+		}
+		return n
+	}
+	writeConfig := func(content string) {
+		if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("pool:\n  size: 20\n")
+	SetReloadPolicy(ReloadPolicy{Percent: 30})
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if n := countSize(20); n < 10 || n > 50 {
+		t.Errorf("Expected about 30 handles to get the new size, got %d", n)
+	}
+	if got := GetInt("pool.size"); got != 10 {
+		t.Errorf("Expected package-level getters to keep the parsed value, got %d", got)
+	}
+
+	Rollback()
+	if n := countSize(10); n != 100 {
+		t.Errorf("Expected every handle to be rolled back, got %d", n)
+	}
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	Promote()
+	if n := countSize(20); n != 100 {
+		t.Errorf("Expected every handle to get the promoted size, got %d", n)
+	}
+}
+
+func TestReloadRejected(t *testing.T) {
+	testReset(t)
+	MarkRequired("pool.size")
+	configPath := createTempYAML(t, "pool:\n  size: 10\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+	l := NewLive("api")
+	defer l.Close()
+
+	SetReloadPolicy(ReloadPolicy{Approve: func(current, next *Section) error {
+		if next.GetInt("pool.size") > 2*current.GetInt("pool.size") {
+			return errors.New("pool size may at most double")
+		}
+		return nil
+	}})
+	if err := os.WriteFile(configPath, []byte("pool:\n  size: 100\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(context.Background()); !errors.Is(err, ErrReloadRejected) {
+		t.Errorf("Expected ErrReloadRejected, got %v", err)
+	}
+
+	// Invalid configuration is never applied.
+	if err := os.WriteFile(configPath, []byte("other: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(context.Background()); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("Expected ErrMissingKey, got %v", err)
+	}
+	if got := l.GetInt("pool.size"); got != 10 {
+		t.Errorf("Expected the handle to keep size 10, got %d", got)
+	}
+}
+
+func TestSetDefault_AfterParse(t *testing.T) {
+	testReset(t)
+	SetDefault("pool.size", 10)
+	configPath := createTempYAML(t, "host: example.com\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	live := NewLive("test")
+	defer live.Close()
+
+	SetDefault("pool.size", 20)
+	SetDefault("pool.idle", 5)
+	if got := GetInt("pool.size"); got != 10 {
+		t.Errorf("GetInt() = %d after SetDefault, want the parsed %d", got, 10)
+	}
+	if got := Layer("defaults").GetInt("pool.size"); got != 10 {
+		t.Errorf("Layer(defaults).GetInt() = %d before Reload, want %d", got, 10)
+	}
+
+	// A Reload that fails keeps the defaults queued.
+	if err := os.WriteFile(configPath, []byte("host: [unclosed\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(context.Background()); err == nil {
+		t.Fatal("Expected Reload() to fail")
+	}
+	if got := Layer("defaults").GetInt("pool.size"); got != 10 {
+		t.Errorf("Layer(defaults).GetInt() = %d after a failed Reload, want %d", got, 10)
+	}
+	if err := os.WriteFile(configPath, []byte("host: example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if got := live.GetInt("pool.size"); got != 20 {
+		t.Errorf("Live.GetInt() = %d after Reload, want the queued default %d", got, 20)
+	}
+	if got := live.GetInt("pool.idle"); got != 5 {
+		t.Errorf("Live.GetInt() = %d after Reload, want the queued default %d", got, 5)
+	}
+	if got := GetInt("pool.size"); got != 10 {
+		t.Errorf("GetInt() = %d after Reload, want the parsed %d", got, 10)
+	}
+	if got := Layer("defaults").GetInt("pool.size"); got != 20 {
+		t.Errorf("Layer(defaults).GetInt() = %d after Reload, want %d", got, 20)
+	}
+}
@@ -0,0 +1,112 @@
+package mflag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Render executes templateText as a text/template with the merged
+// configuration as data, for applications generating the config files of
+// other programs, such as nginx or haproxy, from their own settings:
+//
+//	upstream app {
+//	{{- range .servers }}
+//	    server {{ .host }}:{{ .port | default 80 }};
+//	{{- end }}
+//	}
+//	# {{ get "db.host" | quote }}
+//
+// Besides the built-in functions, templates can use get and has, which
+// read a key in dot notation as the getters and IsSet do; default, which
+// replaces a missing or empty value; required, which fails with its
+// message if the value is missing or empty; and join, quote, upper, lower,
+// indent, toJSON and toYAML. Missing keys of the data are nil, so
+// that default applies to them; use required for the keys that must be set.
+// Secret values are rendered as they are.
+// Must be called after Parse.
+func Render(templateText string) (string, error) {
+	mustBeParsed()
+	tmpl, err := template.New("render").Funcs(renderFuncs(finalConfig)).Parse(templateText)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, deepCopyMap(finalConfig.data)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderFuncs returns the functions available to Render, reading keys of m.
+func renderFuncs(m *mapManager) template.FuncMap {
+	return template.FuncMap{
+		"get": func(key string) interface{} {
+			return deepCopyValue(m.Get(key))
+		},
+		"has": m.IsSet,
+		"default": func(def, value interface{}) interface{} {
+			if isEmpty(value) {
+				return def
+			}
+			return value
+		},
+		"required": func(msg string, value interface{}) (interface{}, error) {
+			if isEmpty(value) {
+				return nil, errors.New(msg)
+			}
+			return value, nil
+		},
+		"join": func(sep string, value interface{}) string {
+			var items []string
+			switch v := value.(type) {
+			case []string:
+				items = v
+			case []interface{}:
+				for _, item := range v {
+					items = append(items, fmt.Sprint(item))
+				}
+			default:
+				return fmt.Sprint(value)
+			}
+			return strings.Join(items, sep)
+		},
+		"quote": func(value interface{}) string {
+			return strconv.Quote(fmt.Sprint(value))
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"indent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+		},
+		"toJSON": func(value interface{}) (string, error) {
+			b, err := json.Marshal(value)
+			return string(b), err
+		},
+		"toYAML": func(value interface{}) (string, error) {
+			b, err := yaml.Marshal(value)
+			return strings.TrimSuffix(string(b), "\n"), err
+		},
+	}
+}
+
+// isEmpty reports whether value is nil or the zero value of its type, or
+// an empty list or map.
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
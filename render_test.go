@@ -0,0 +1,56 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, `
+servers:
+  - host: a.internal
+    port: 8080
+  - host: b.internal
+db:
+  host: db.internal
+  tags: [primary, eu]
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	got, err := Render(`upstream app {
+{{- range .servers }}
+    server {{ .host }}:{{ .port | default 80 }};
+{{- end }}
+}
+# {{ get "db.host" | quote }} {{ join "," .db.tags | upper }} {{ has "db.port" }}
+{{ toYAML .db | indent 2 }}`)
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	want := `upstream app {
+    server a.internal:8080;
+    server b.internal:80;
+}
+# "db.internal" PRIMARY,EU false
+  host: db.internal
+  tags:
+      - primary
+      - eu`
+	if got != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := Render(`{{ required "db.port is required" .db.port }}`); err == nil || !strings.Contains(err.Error(), "db.port is required") {
+		t.Errorf("Render() with a missing required value = %v", err)
+	}
+	if _, err := Render(`{{ .db.host `); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Render() with a malformed template = %v, want ErrInvalidValue", err)
+	}
+}
@@ -0,0 +1,91 @@
+package mflag
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// fileRefPrefix marks values read from the file they point to.
+	fileRefPrefix = "file://"
+	// fileKeySuffix marks keys whose value is the path of a file holding the
+	// value of the key without the suffix.
+	fileKeySuffix = "_file"
+)
+
+// resolveValues replaces the placeholders of the merged configuration m,
+// such as file references, encrypted values and the secrets of providers,
+// with the values they stand for. file is the configuration file layer
+// merged into m.
+func resolveValues(m, file *mapManager) error {
+	if data, ok := revealSecrets(m.data, "", m.markSecret); ok {
+		m.data = data.(map[string]interface{})
+		m.invalidate()
+	}
+	if err := resolveFileRefs(m, file); err != nil {
+		return err
+	}
+	return decryptValues(m)
+}
+
+// resolveFileRefs reads the files referenced by the merged configuration,
+// which is how Docker and Kubernetes hand secrets to containers. A value
+// such as "file:///run/secrets/db_password" is replaced with the content of
+// the file. A key such as "db.password_file" sets "db.password" to the
+// content of the file it names, provided "db.password" has a default or a
+// declared type, so that keys which merely happen to end in "_file" are
+// left alone. Values read from files are treated as secrets, and a single
+// trailing newline is trimmed from them.
+func resolveFileRefs(m, file *mapManager) error {
+	var errs []error
+	for _, key := range m.AllKeys() {
+		s, ok := m.Get(key).(string)
+		if !ok {
+			continue
+		}
+		if path, ok := strings.CutPrefix(s, fileRefPrefix); ok {
+			if err := setFromFile(m, key, path); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		target, ok := strings.CutSuffix(key, fileKeySuffix)
+		if !ok || s == "" || !isFileTarget(target) {
+			continue
+		}
+		if file.IsSet(target) || flagConfig.IsSet(target) {
+			errs = append(errs, fmt.Errorf("%w: both %q and %q are set", ErrInvalidValue, target, key))
+			continue
+		}
+		if err := setFromFile(m, target, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isFileTarget reports whether key can be set through a "_file" key.
+func isFileTarget(key string) bool {
+	if _, isMap := defaults.Get(key).(map[string]interface{}); isMap {
+		return false
+	}
+	if s, ok := specs[key]; ok && s.typ != 0 {
+		return true
+	}
+	return defaults.IsSet(key)
+}
+
+// setFromFile sets key of m to the content of the file at path and marks it
+// as secret in m.
+func setFromFile(m *mapManager, key, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w for %q: %w", ErrInvalidValue, key, err)
+	}
+	value := strings.TrimSuffix(string(content), "\n")
+	m.SetValue(key, strings.TrimSuffix(value, "\r"))
+	m.markSecret(key)
+	return nil
+}
@@ -0,0 +1,71 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileReferences(t *testing.T) {
+	testReset(t)
+	dir := t.TempDir()
+	writeSecret := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	passwordPath := writeSecret("db_password", "hunter2\n")
+	tokenPath := writeSecret("api_token", "tok\n")
+
+	SetDefaultString("api.token", "")
+	configPath := createTempYAML(t, `
+db:
+  password: file://`+passwordPath+`
+api:
+  token_file: `+tokenPath+`
+log_file: /var/log/app.log
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if got := GetString("db.password"); got != "hunter2" {
+		t.Errorf("Expected the file:// reference to be read, got %q", got)
+	}
+	if got := GetString("api.token"); got != "tok" {
+		t.Errorf("Expected api.token to be read from api.token_file, got %q", got)
+	}
+	if got := GetString("log_file"); got != "/var/log/app.log" {
+		t.Errorf("Expected unrelated _file keys to be left alone, got %q", got)
+	}
+	if !isSecret("db.password") || !isSecret("api.token") {
+		t.Error("Expected values read from files to be secret")
+	}
+}
+
+func TestFileReferences_Errors(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, "password: file:///does/not/exist\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue for a missing file, got %v", err)
+	}
+
+	testReset(t)
+	SetDefaultString("password", "")
+	configPath = createTempYAML(t, "password: plain\npassword_file: /run/secrets/password\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue when both forms are set, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package mflag
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// secretHooks holds the functions registered with OnSecretRotate by
+	// key. It is guarded by reloadMu.
+	secretHooks = make(map[string][]func(Secret) error)
+	// rotateMu is held from applying a configuration until its hooks have
+	// run, so that hooks of successive reloads do not interleave and the
+	// last secret passed to them is the applied one. It is acquired before
+	// reloadMu.
+	rotateMu sync.Mutex
+)
+
+// OnSecretRotate registers fn to be called with the new value of the secret
+// at key whenever Reload, or Promote after a partial Reload, applies a
+// configuration in which the value changed, such as a password read from a
+// file or a secret manager that was rotated. It marks key as secret.
+// Errors returned by fn are returned by Reload and ignored by Promote; the
+// configuration is applied regardless. Hooks run one reload at a time, in
+// the order the configurations were applied, and must not call Reload or
+// Promote. See RebuildTLS and the sqlrotate package for common hooks.
+func OnSecretRotate(key string, fn func(Secret) error) {
+	MarkSecret(key)
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	secretHooks[key] = append(secretHooks[key], fn)
+}
+
+// rotateSecrets calls the hooks of the secrets whose value differs between
+// prev and next. rotateMu must be held and reloadMu must not, so that
+// hooks may use Live handles and the applied configuration.
+func rotateSecrets(prev, next *mapManager) error {
+	reloadMu.Lock()
+	hooks := make(map[string][]func(Secret) error, len(secretHooks))
+	for key, fns := range secretHooks {
+		hooks[key] = slices.Clone(fns)
+	}
+	reloadMu.Unlock()
+
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(hooks)) {
+		value := next.GetString(key)
+		if prev.GetString(key) == value {
+			continue
+		}
+		for _, fn := range hooks[key] {
+			if err := fn(NewSecret(value)); err != nil {
+				errs = append(errs, fmt.Errorf("rotating %q: %w", key, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RebuildTLS returns a hook for OnSecretRotate that builds a new TLS
+// configuration from the section at key of the applied configuration, as
+// GetTLSConfig does, and stores it in cfg. It suits keys whose rotation
+// comes with new certificate files; certificates and CA bundles rewritten
+// in place are loaded again by Reload on its own.
+func RebuildTLS(cfg *atomic.Pointer[tls.Config], key string) func(Secret) error {
+	return func(Secret) error {
+		c, err := newTLSConfig(newSection(key, appliedConfig().Get(key)))
+		if err != nil {
+			return err
+		}
+		cfg.Store(c)
+		return nil
+	}
+}
+
+// appliedConfig returns the configuration applied by the last Reload, or
+// the one produced by Parse if there was none.
+func appliedConfig() *mapManager {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if stable == nil {
+		return finalConfig
+	}
+	return stable
+}
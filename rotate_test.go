@@ -0,0 +1,101 @@
+package mflag
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOnSecretRotate(t *testing.T) {
+	testReset(t)
+	dir := t.TempDir()
+	passwordPath := filepath.Join(dir, "db_password")
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(passwordPath, "hunter2\n")
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestCert(t, certFile, keyFile, "first")
+	configPath := createTempYAML(t, "db:\n  password: file://"+passwordPath+"\n  host: db\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	var rotated []string
+	OnSecretRotate("db.password", func(s Secret) error {
+		rotated = append(rotated, s.Reveal())
+		return nil
+	})
+	var tlsConfig atomic.Pointer[tls.Config]
+	OnSecretRotate("db.password", RebuildTLS(&tlsConfig, "db.tls"))
+	os.Args = []string{"test"}
+	Parse()
+	if !isSecret("db.password") {
+		t.Error("Expected OnSecretRotate to mark the key as secret")
+	}
+
+	writeFile(configPath, "db:\n  password: file://"+passwordPath+"\n  host: db2\n")
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if len(rotated) != 0 {
+		t.Errorf("Expected no rotation when the secret is unchanged, got %v", rotated)
+	}
+
+	writeFile(passwordPath, "correct-horse\n")
+	writeFile(configPath, "db:\n  password: file://"+passwordPath+"\n  tls:\n    cert_file: "+certFile+"\n    key_file: "+keyFile+"\n")
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if len(rotated) != 1 || rotated[0] != "correct-horse" {
+		t.Errorf("Expected the hook to get the rotated secret, got %v", rotated)
+	}
+	if cfg := tlsConfig.Load(); cfg == nil || cfg.GetCertificate == nil {
+		t.Error("Expected RebuildTLS to build a config from the applied configuration")
+	}
+
+	OnSecretRotate("db.password", func(Secret) error { return errors.New("pool busy") })
+	writeFile(passwordPath, "battery-staple\n")
+	if err := Reload(context.Background()); err == nil {
+		t.Error("Expected Reload to return the error of a hook")
+	}
+	if len(rotated) != 2 {
+		t.Errorf("Expected the configuration to be applied despite the error, got %v", rotated)
+	}
+}
+
+func TestOnSecretRotate_Promote(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, "token: a\n")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	var rotated []string
+	OnSecretRotate("token", func(s Secret) error {
+		rotated = append(rotated, s.Reveal())
+		return nil
+	})
+	os.Args = []string{"test"}
+	Parse()
+
+	if err := os.WriteFile(configPath, []byte("token: b\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	SetReloadPolicy(ReloadPolicy{Percent: 50})
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if len(rotated) != 0 {
+		t.Errorf("Expected no rotation for a partial reload, got %v", rotated)
+	}
+	Promote()
+	if len(rotated) != 1 || rotated[0] != "b" {
+		t.Errorf("Expected Promote to rotate the secret, got %v", rotated)
+	}
+}
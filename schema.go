@@ -0,0 +1,87 @@
+package mflag
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// jsonSchemaDraft is the JSON Schema dialect JSONSchema produces.
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema returns a JSON Schema describing the config file, built from
+// the keys returned by Keys: their types, defaults, descriptions, allowed
+// values and whether they are required. Editors and CI pipelines can use it
+// to validate config files written by hand. Keys that are not declared are
+// allowed, and defaults of secret keys are omitted.
+func JSONSchema() ([]byte, error) {
+	root := map[string]interface{}{
+		"$schema": jsonSchemaDraft,
+		"type":    "object",
+	}
+	for _, k := range Keys() {
+		parent := root
+		segments := strings.Split(k.Key, ".")
+		for _, segment := range segments[:len(segments)-1] {
+			parent = schemaProperty(parent, segment, map[string]interface{}{"type": "object"})
+		}
+		name := segments[len(segments)-1]
+		prop := schemaProperty(parent, name, typeSchema(k.Type))
+		if k.Description != "" {
+			prop["description"] = k.Description
+		}
+		if len(k.Allowed) > 0 {
+			prop["enum"] = k.Allowed
+		}
+		if k.Default != nil && !k.Secret {
+			prop["default"] = k.Default
+		}
+		if k.Required {
+			required, _ := parent["required"].([]string)
+			parent["required"] = append(required, name)
+		}
+	}
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaProperty returns the schema of the property name of the object
+// schema parent, adding def if it has none.
+func schemaProperty(parent map[string]interface{}, name string, def map[string]interface{}) map[string]interface{} {
+	props, ok := parent["properties"].(map[string]interface{})
+	if !ok {
+		props = make(map[string]interface{})
+		parent["properties"] = props
+	}
+	prop, ok := props[name].(map[string]interface{})
+	if !ok {
+		prop = def
+		props[name] = prop
+	}
+	return prop
+}
+
+// typeSchema returns the schema of values of the type called name, as
+// returned by Type.String. Values that mflag parses from strings, such as
+// numbers given as "8080", are accepted as strings too.
+func typeSchema(name string) map[string]interface{} {
+	switch name {
+	case "bool":
+		return map[string]interface{}{"type": []string{"boolean", "string"}}
+	case "int":
+		return map[string]interface{}{"type": []string{"integer", "string"}}
+	case "uint":
+		return map[string]interface{}{"type": []string{"integer", "string"}, "minimum": 0}
+	case "float":
+		return map[string]interface{}{"type": []string{"number", "string"}}
+	case "duration":
+		return map[string]interface{}{"type": []string{"string", "integer"}}
+	case "list":
+		return map[string]interface{}{"type": []string{"array", "string"}}
+	case "map":
+		return map[string]interface{}{"type": "object"}
+	case "regexp":
+		return map[string]interface{}{"type": "string", "format": "regex"}
+	case "string", "timezone", "cron":
+		return map[string]interface{}{"type": "string"}
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,51 @@
+package mflag
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	testReset(t)
+	SetDefault("server.port", 8080)
+	Describe("server.port", "port to listen on")
+	SetDefault("server.password", "hunter2")
+	MarkSecret("server.password")
+	SetDefaultEnum("level", "info", "debug", "info")
+	DeclareKey("server.token", String)
+	MarkRequired("server.token")
+	DeclareKey("pattern", Regexp)
+
+	out, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() failed: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	var want map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"level": {"type": "string", "enum": ["debug", "info"], "default": "info"},
+			"pattern": {"type": "string", "format": "regex"},
+			"server": {
+				"type": "object",
+				"required": ["token"],
+				"properties": {
+					"password": {"type": "string"},
+					"port": {"type": ["integer", "string"], "default": 8080, "description": "port to listen on"},
+					"token": {"type": "string"}
+				}
+			}
+		}
+	}`), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONSchema() =\n%s", out)
+	}
+}
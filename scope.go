@@ -0,0 +1,148 @@
+package mflag
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// overridesKey is the key of the scoped override sections in a
+// configuration.
+const overridesKey = "overrides"
+
+// Names of the built-in scopes.
+const (
+	regionScope   = "region"
+	hostnameScope = "hostname"
+)
+
+// regionEnvVars are the environment variables the region is detected from,
+// in order of preference.
+var regionEnvVars = []string{"MFLAG_REGION", "AWS_REGION", "AWS_DEFAULT_REGION", "CLOUDSDK_COMPUTE_REGION", "FLY_REGION"}
+
+var (
+	// scopes holds the values set with SetScope.
+	scopes = make(map[string]string)
+	// scopeOrder holds the names of the scopes from least to most specific.
+	scopeOrder = []string{regionScope, hostnameScope}
+)
+
+// SetScope sets the value of the scope name, such as SetScope("region",
+// "eu-west-1"), selecting the override sections applied to the
+// configuration when it is loaded:
+//
+//	pool_size: 10
+//	overrides:
+//	  region:
+//	    eu-west-1:
+//	      endpoint: https://eu.example.com
+//	  hostname:
+//	    web-3:
+//	      pool_size: 50
+//	    "batch-*":
+//	      pool_size: 2
+//
+// Sections are named after the value of their scope, or after a pattern
+// matching it as in path.Match. Without SetScope, "hostname" is the name of
+// the host and "region" is read from MFLAG_REGION, AWS_REGION,
+// AWS_DEFAULT_REGION, CLOUDSDK_COMPUTE_REGION or FLY_REGION. Sections of
+// more specific scopes take precedence: "region", then scopes added with
+// SetScope in order, then "hostname". An empty value disables a scope.
+// It should be called before Init.
+func SetScope(name, value string) {
+	if !slices.Contains(scopeOrder, name) {
+		scopeOrder = slices.Insert(scopeOrder, len(scopeOrder)-1, name)
+	}
+	scopes[name] = value
+}
+
+// scopeValue returns the value of the scope name.
+func scopeValue(name string) string {
+	if value, ok := scopes[name]; ok {
+		return value
+	}
+	switch name {
+	case hostnameScope:
+		host, _ := os.Hostname()
+		return host
+	case regionScope:
+		for _, env := range regionEnvVars {
+			if value := os.Getenv(env); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// applyOverrides merges the override sections of data selected by the
+// scopes over data, and removes them. An "overrides" key none of whose
+// entries is named after a scope is left alone.
+func applyOverrides(data map[string]interface{}) (map[string]interface{}, error) {
+	overrides, ok := data[overridesKey].(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	var unknown []string
+	for name := range overrides {
+		if !slices.Contains(scopeOrder, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	switch {
+	case len(unknown) == len(overrides):
+		return data, nil // An ordinary key that happens to be called overrides.
+	case len(unknown) > 0:
+		slices.Sort(unknown)
+		return nil, fmt.Errorf("%q: unknown scopes %s, known scopes are %s", overridesKey, strings.Join(unknown, ", "), strings.Join(scopeOrder, ", "))
+	}
+	data = copyMap(data)
+	delete(data, overridesKey)
+
+	for _, name := range scopeOrder {
+		sections, ok := overrides[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value := scopeValue(name)
+		if value == "" {
+			continue
+		}
+		// Patterns apply before the section named after the exact value.
+		for _, pattern := range slices.Sorted(maps.Keys(sections)) {
+			matched, err := path.Match(pattern, value)
+			if err != nil {
+				return nil, fmt.Errorf("%q: invalid pattern %q: %w", overridesKey+"."+name, pattern, err)
+			}
+			if !matched || pattern == value {
+				continue
+			}
+			if data, err = overlaySection(data, sections, name, pattern); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := sections[value]; ok {
+			var err error
+			if data, err = overlaySection(data, sections, name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+// overlaySection merges the section sections[value] of the scope name over
+// data.
+func overlaySection(data, sections map[string]interface{}, name, value string) (map[string]interface{}, error) {
+	section, ok := sections[value].(map[string]interface{})
+	if !ok {
+		if sections[value] == nil {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%q: override section must be a map", overridesKey+"."+name+"."+value)
+	}
+	return overlayMaps(data, section), nil
+}
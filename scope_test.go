@@ -0,0 +1,82 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestScopedOverrides(t *testing.T) {
+	testReset(t)
+	t.Setenv("MFLAG_REGION", "eu-west-1")
+	SetScope("hostname", "batch-7")
+	SetScope("zone", "b")
+	if err := Init(createTempYAML(t, `
+pool_size: 10
+endpoint: https://example.com
+overrides:
+  region:
+    eu-west-1:
+      endpoint: https://eu.example.com
+      pool_size: 20
+    us-east-1:
+      endpoint: https://us.example.com
+  zone:
+    b:
+      pool_size: 30
+      zone_only: true
+  hostname:
+    "batch-*":
+      pool_size: 2
+    batch-7:
+      workers: 1
+`)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	if got := GetString("endpoint"); got != "https://eu.example.com" {
+		t.Errorf("Expected the region override, got %q", got)
+	}
+	if got := GetInt("pool_size"); got != 2 {
+		t.Errorf("Expected the hostname pattern to take precedence, got %d", got)
+	}
+	if !GetBool("zone_only") || GetInt("workers") != 1 {
+		t.Errorf("Expected the zone and exact hostname overrides, got %v", finalConfig.data)
+	}
+	if IsSet("overrides") {
+		t.Error("Expected the override sections to be removed")
+	}
+}
+
+func TestScopedOverrides_Disabled(t *testing.T) {
+	testReset(t)
+	t.Setenv("MFLAG_REGION", "eu-west-1")
+	SetScope("region", "")
+	if err := Init(createTempYAML(t, "port: 1\noverrides:\n  region:\n    eu-west-1: {port: 2}\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetInt("port"); got != 1 {
+		t.Errorf("Expected a disabled scope not to apply, got %d", got)
+	}
+}
+
+func TestScopedOverrides_Errors(t *testing.T) {
+	testReset(t)
+	if err := Init(createTempYAML(t, "overrides:\n  region: {}\n  regoin: {}\n")); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed for an unknown scope, got %v", err)
+	}
+
+	testReset(t)
+	if err := Init(createTempYAML(t, "overrides:\n  timeout: 5s\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetString("overrides.timeout"); got != "5s" {
+		t.Errorf("Expected an ordinary overrides key to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,140 @@
+package mflag
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// Secret holds a secret value that is redacted whenever it is printed,
+// logged or encoded, so that it does not leak through a log line or a dump
+// of a config struct. Reveal returns the value itself. Fields of type Secret
+// are filled by UnmarshalKey.
+type Secret struct {
+	value string
+}
+
+// NewSecret returns a Secret holding value.
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+// GetSecret returns the value associated with the key as a Secret. Mark the
+// key with MarkSecret as well, so that --dump-config and the other exports
+// mask it too.
+// Must be called after Parse.
+func GetSecret(key string) Secret {
+	mustBeParsed()
+	return Secret{value: finalConfig.GetString(key)}
+}
+
+// GetSecret returns the value associated with the key as a Secret.
+func (s *Section) GetSecret(key string) Secret {
+	return Secret{value: s.m.GetString(key)}
+}
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+// IsSet reports whether the secret value is not empty.
+func (s Secret) IsSet() bool {
+	return s.value != ""
+}
+
+// String returns a mask instead of the secret value.
+func (s Secret) String() string {
+	return secretMask
+}
+
+// GoString returns a mask instead of the secret value, for the %#v verb.
+func (s Secret) GoString() string {
+	return secretMask
+}
+
+// Format writes a mask instead of the secret value for every verb.
+func (s Secret) Format(f fmt.State, _ rune) {
+	io.WriteString(f, secretMask)
+}
+
+// LogValue returns a mask instead of the secret value for log/slog.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(secretMask)
+}
+
+// MarshalText returns a mask instead of the secret value, which also applies
+// to JSON and YAML encoding.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(secretMask), nil
+}
+
+// UnmarshalText sets the secret value to text.
+func (s *Secret) UnmarshalText(text []byte) error {
+	s.value = string(text)
+	return nil
+}
+
+// revealSecrets returns v, found at key, with the Secret values providers
+// return for the secrets they load replaced by the values they hold, and
+// calls mark with their keys. The maps and lists holding them are copied.
+// It reports whether v had any.
+func revealSecrets(v interface{}, key string, mark func(key string)) (interface{}, bool) {
+	return replaceSecrets(v, key, func(key string, s Secret) interface{} {
+		mark(key)
+		return s.value
+	})
+}
+
+// replaceSecrets returns v, found at key, with its Secret values replaced
+// by what fn returns for them. The maps and lists holding them are copied.
+// It reports whether v had any.
+func replaceSecrets(v interface{}, key string, fn func(key string, s Secret) interface{}) (interface{}, bool) {
+	return replaceLeaves(v, key, func(key string, v interface{}) (interface{}, bool) {
+		if s, ok := v.(Secret); ok {
+			return fn(key, s), true
+		}
+		return v, false
+	})
+}
+
+// replaceLeaves returns v, found at key, with the values that are neither
+// maps nor lists replaced by what fn returns for them, when fn reports it
+// replaced them. The maps and lists holding them are copied. It reports
+// whether fn replaced any.
+func replaceLeaves(v interface{}, key string, fn func(key string, v interface{}) (interface{}, bool)) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		var res map[string]interface{}
+		for k, item := range v {
+			if replaced, ok := replaceLeaves(item, joinKey(key, k), fn); ok {
+				if res == nil {
+					res = maps.Clone(v)
+				}
+				res[k] = replaced
+			}
+		}
+		if res == nil {
+			return v, false
+		}
+		return res, true
+	case []interface{}:
+		var res []interface{}
+		for i, item := range v {
+			if replaced, ok := replaceLeaves(item, joinKey(key, strconv.Itoa(i)), fn); ok {
+				if res == nil {
+					res = slices.Clone(v)
+				}
+				res[i] = replaced
+			}
+		}
+		if res == nil {
+			return v, false
+		}
+		return res, true
+	}
+	return fn(key, v)
+}
@@ -0,0 +1,61 @@
+package mflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGetSecret(t *testing.T) {
+	testReset(t)
+	SetDefault("db.password", "")
+	MarkSecret("db.password")
+	if err := Init(createTempYAML(t, "db:\n  host: localhost\n  password: hunter2\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+
+	s := GetSecret("db.password")
+	if got := s.Reveal(); got != "hunter2" {
+		t.Errorf("Reveal() = %q, want hunter2", got)
+	}
+	if !s.IsSet() || GetSecret("missing").IsSet() {
+		t.Error("Unexpected result of IsSet")
+	}
+	if got := Sub("db").GetSecret("password").Reveal(); got != "hunter2" {
+		t.Errorf("Expected the secret of the section, got %q", got)
+	}
+
+	var config struct {
+		Host     string `yaml:"host" json:"host"`
+		Password Secret `yaml:"password" json:"password"`
+	}
+	if err := UnmarshalKey("db", &config); err != nil {
+		t.Fatalf("UnmarshalKey() failed: %v", err)
+	}
+	if got := config.Password.Reveal(); got != "hunter2" {
+		t.Fatalf("Expected UnmarshalKey to fill the secret, got %q", got)
+	}
+
+	var logged bytes.Buffer
+	slog.New(slog.NewTextHandler(&logged, nil)).Info("config", "password", config.Password)
+	encoded, _ := json.Marshal(config)
+	for _, out := range []string{
+		fmt.Sprint(config.Password),
+		fmt.Sprintf("%v %+v %#v %s %q %x", config, config, config, config.Password, config.Password, config.Password),
+		string(encoded),
+		logged.String(),
+	} {
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("Secret leaked: %s", out)
+		}
+	}
+	if !strings.Contains(string(encoded), `"password":"******"`) {
+		t.Errorf("Expected the secret to be masked in JSON, got %s", encoded)
+	}
+}
@@ -0,0 +1,170 @@
+package mflag
+
+import (
+	"regexp"
+	"time"
+)
+
+// Section is a read-only view of the configuration below a key, such as one
+// of several named instances under "outputs". Keys passed to its getters are
+// relative to the section.
+type Section struct {
+	key string
+	m   *mapManager
+}
+
+// Sub returns the section of the configuration at key. The section is a
+// snapshot taken at call time. If the key does not hold a map, the section
+// is empty.
+// Must be called after Parse.
+func Sub(key string) *Section {
+	mustBeParsed()
+	return newSection(key, finalConfig.Get(key))
+}
+
+// Sections returns the sections below key by name, for configurations with
+// a map of named sections such as:
+//
+//	outputs:
+//	  kafka: {brokers: [...]}
+//	  file: {path: ...}
+//
+// Like any other key, values of a section can be overridden on the command
+// line, e.g. with --outputs-kafka-brokers, and --set can even add sections,
+// e.g. --set outputs.stdout.format=json. Entries that are not maps are
+// skipped.
+// Must be called after Parse.
+func Sections(key string) map[string]*Section {
+	mustBeParsed()
+	return sectionsOf(key, finalConfig.Get(key))
+}
+
+// newSection creates a section holding a copy of value if it is a map.
+func newSection(key string, value interface{}) *Section {
+	s := &Section{key: key, m: newManager()}
+	if nested, ok := value.(map[string]interface{}); ok {
+		s.m.data = deepCopyMap(nested)
+	}
+	s.m.buildIndex()
+	return s
+}
+
+// sectionsOf returns the map entries of value as sections below key.
+func sectionsOf(key string, value interface{}) map[string]*Section {
+	result := make(map[string]*Section)
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return result
+	}
+	for name, v := range nested {
+		if _, ok := v.(map[string]interface{}); ok {
+			result[name] = newSection(key+"."+name, v)
+		}
+	}
+	return result
+}
+
+// Key returns the full key of the section.
+func (s *Section) Key() string {
+	return s.key
+}
+
+// GetString returns the value associated with the key as a string.
+func (s *Section) GetString(key string) string {
+	return s.m.GetString(key)
+}
+
+// GetInt returns the value associated with the key as an integer.
+func (s *Section) GetInt(key string) int {
+	return s.m.GetInt(key)
+}
+
+// GetInt64 returns the value associated with the key as an int64.
+func (s *Section) GetInt64(key string) int64 {
+	return s.m.GetInt64(key)
+}
+
+// GetUint returns the value associated with the key as a uint.
+func (s *Section) GetUint(key string) uint {
+	return s.m.GetUint(key)
+}
+
+// GetUint64 returns the value associated with the key as a uint64.
+func (s *Section) GetUint64(key string) uint64 {
+	return s.m.GetUint64(key)
+}
+
+// GetBool returns the value associated with the key as a boolean.
+func (s *Section) GetBool(key string) bool {
+	return s.m.GetBool(key)
+}
+
+// GetFloat64 returns the value associated with the key as a float64.
+func (s *Section) GetFloat64(key string) float64 {
+	return s.m.GetFloat64(key)
+}
+
+// GetDuration returns the value associated with the key as a time.Duration.
+func (s *Section) GetDuration(key string) time.Duration {
+	return s.m.GetDuration(key)
+}
+
+// GetRegexp returns the value associated with the key compiled as a regular
+// expression, or nil if it is missing or invalid.
+func (s *Section) GetRegexp(key string) *regexp.Regexp {
+	return s.m.GetRegexp(key)
+}
+
+// GetBytes returns the value associated with the key as a byte slice.
+func (s *Section) GetBytes(key string) []byte {
+	return s.m.GetBytes(key)
+}
+
+// GetStringSlice returns the value associated with the key as a slice of strings.
+func (s *Section) GetStringSlice(key string) []string {
+	return s.m.GetStringSlice(key)
+}
+
+// GetStringMapString returns the value associated with the key as a map of strings.
+func (s *Section) GetStringMapString(key string) map[string]string {
+	return s.m.GetStringMapString(key)
+}
+
+// GetStringMapStringE is like GetStringMapString, but returns an error if
+// the value is not a map of scalars.
+func (s *Section) GetStringMapStringE(key string) (map[string]string, error) {
+	return s.m.GetStringMapStringE(key)
+}
+
+// GetStringMapAny returns a copy of the map associated with the key.
+func (s *Section) GetStringMapAny(key string) map[string]interface{} {
+	return s.m.GetStringMapAny(key)
+}
+
+// IsSet checks if a key is set in the section.
+func (s *Section) IsSet(key string) bool {
+	return s.m.IsSet(key)
+}
+
+// AllKeys returns all keys in the section, flattened with dot notation, as
+// the package-level AllKeys does.
+func (s *Section) AllKeys(opts ...KeysOption) []string {
+	return selectKeys(s.m, opts)
+}
+
+// Sub returns the nested section at key, as a Reader so that fakes of
+// Reader can return one. It is a *Section, which the package-level Sub
+// returns directly.
+func (s *Section) Sub(key string) Reader {
+	return s.sub(key)
+}
+
+// sub returns the nested section at key.
+func (s *Section) sub(key string) *Section {
+	return newSection(joinKey(s.key, key), s.m.Get(key))
+}
+
+// Sections returns the nested sections below key by name.
+func (s *Section) Sections(key string) map[string]*Section {
+	return sectionsOf(joinKey(s.key, key), s.m.Get(key))
+}
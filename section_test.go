@@ -0,0 +1,53 @@
+package mflag
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSections(t *testing.T) {
+	testReset(t)
+
+	configPath := createTempYAML(t, `
+outputs:
+  kafka:
+    brokers: [k1, k2]
+    timeout: 5s
+  file:
+    path: /var/log/app.log
+  disabled: false
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--outputs-kafka-brokers=k3", "--set=outputs.stdout.format=json"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	sections := Sections("outputs")
+	if len(sections) != 3 {
+		t.Fatalf("Expected 3 sections, got %d: %v", len(sections), sections)
+	}
+	kafka := sections["kafka"]
+	if kafka.Key() != "outputs.kafka" {
+		t.Errorf("Expected key outputs.kafka, got %q", kafka.Key())
+	}
+	if got := kafka.GetStringSlice("brokers"); !reflect.DeepEqual(got, []string{"k3"}) {
+		t.Errorf("Expected the flag override to apply to the section, got %v", got)
+	}
+	if got := kafka.GetDuration("timeout"); got != 5*time.Second {
+		t.Errorf("Expected timeout 5s, got %v", got)
+	}
+	if got := sections["stdout"].GetString("format"); got != "json" {
+		t.Errorf("Expected the section added with --set to be present, got %q", got)
+	}
+	if got := Sub("outputs").Sub("file").GetString("path"); got != "/var/log/app.log" {
+		t.Errorf("Unexpected nested section value %q", got)
+	}
+	if Sub("missing").IsSet("anything") || len(Sections("outputs.file.path")) != 0 {
+		t.Error("Expected sections of missing or non-map keys to be empty")
+	}
+}
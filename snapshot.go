@@ -0,0 +1,150 @@
+package mflag
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// snapshotHeader starts the content of an encrypted snapshot.
+const snapshotHeader = "MFLAG_ENC[AES256_GCM]\n"
+
+// snapshotKey is the key set with SetSnapshotKey.
+var snapshotKey []byte
+
+// SetSnapshotKey sets the AES-256 key (32 bytes) with which WriteConfig and
+// the last known good snapshots of WithFallbackToLastGood encrypt what they
+// write, so that decrypted secrets are not stored in plaintext. Snapshots
+// holding secrets are only written with a key. Init and InitContext read
+// encrypted files written by WriteConfig as long as the same key is set. A
+// nil key disables encryption.
+func SetSnapshotKey(key []byte) {
+	snapshotKey = key
+}
+
+// WriteConfig writes the effective configuration to path as YAML, replacing
+// the file atomically and making it readable by its owner only. Encrypted
+// values are written decrypted, so use SetSnapshotKey to encrypt the file
+// when the configuration holds secrets. See SaveConfig to save the values
+// set with Set to the config file instead.
+// Must be called after Parse.
+func WriteConfig(path string) error {
+	mustBeParsed()
+	return writeSnapshot(path, finalConfig.data)
+}
+
+// SaveConfig saves the values set with Set to the config file given to
+// Init, such as settings changed by the user of an application. The file is
+// edited rather than rewritten when it is a YAML file and no snapshot key
+// is set: only the values set with Set are changed in it, and its comments,
+// key order, conditional blocks and overrides are kept, so that files
+// maintained by people survive. Defaults and the values of the environment
+// and the flags are not written to it.
+// Must be called after Parse.
+func SaveConfig() error {
+	mustBeParsed()
+	p, ok := source.(fileProvider)
+	if !ok {
+		return fmt.Errorf("%w: SaveConfig needs Init to be called with a config file", ErrInitFailed)
+	}
+	path, err := expandPath(p.path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInitFailed, err)
+	}
+	// The values set with Set are added to the file as written, rather than
+	// to the values loaded from it.
+	file := newManager()
+	if err := file.loadFile(context.WithValue(context.Background(), unrecorded{}, true), path, p.format); err != nil {
+		return err
+	}
+	for _, key := range assigned.AllKeys() {
+		file.SetValue(key, assigned.Get(key))
+	}
+	return writeConfigFile(path, file.data)
+}
+
+// writeConfigFile writes data, the values of the file at path as written
+// with some of them changed, to path, editing the file when it is
+// editable.
+func writeConfigFile(path string, data map[string]interface{}) error {
+	if content, err := os.ReadFile(path); err == nil && editable(path, content) {
+		if content, err = editYAML(content, data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return writeFileAtomic(path, content)
+	}
+	return writeSnapshot(path, data)
+}
+
+// editable reports whether the file at path, holding content, is edited
+// rather than rewritten by SaveConfig: a YAML file that is not encrypted,
+// with no snapshot key set.
+func editable(path string, content []byte) bool {
+	return snapshotKey == nil && !bytes.HasPrefix(content, []byte(snapshotHeader)) && isYAMLFile(path)
+}
+
+// snapshotAEAD returns the AES-GCM cipher for the snapshot key.
+func snapshotAEAD() (cipher.AEAD, error) {
+	if snapshotKey == nil {
+		return nil, errors.New("the file is encrypted but no snapshot key is set, use SetSnapshotKey")
+	}
+	if len(snapshotKey) != 32 {
+		return nil, fmt.Errorf("snapshot key must be 32 bytes, got %d", len(snapshotKey))
+	}
+	block, err := aes.NewCipher(snapshotKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSnapshot encrypts content with the snapshot key, or returns it
+// unchanged if there is none.
+func encryptSnapshot(content []byte) ([]byte, error) {
+	if snapshotKey == nil {
+		return content, nil
+	}
+	aead, err := snapshotAEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, content, []byte(snapshotHeader))
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+	return []byte(snapshotHeader + encoded + "\n"), nil
+}
+
+// decryptSnapshot decrypts content written by encryptSnapshot, or returns
+// it unchanged if it is not encrypted.
+func decryptSnapshot(content []byte) ([]byte, error) {
+	encoded, ok := bytes.CutPrefix(content, []byte(snapshotHeader))
+	if !ok {
+		return content, nil
+	}
+	aead, err := snapshotAEAD()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted file: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted file: too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(snapshotHeader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
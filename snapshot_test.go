@@ -0,0 +1,193 @@
+package mflag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteConfig(t *testing.T) {
+	testReset(t)
+	SetDefault("port", 8080)
+	if err := Init(createTempYAML(t, "db:\n  password: hunter2\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--port=9090"}
+	Parse()
+
+	plain := filepath.Join(t.TempDir(), "plain.yaml")
+	if err := WriteConfig(plain); err != nil {
+		t.Fatalf("WriteConfig() failed: %v", err)
+	}
+	content, err := os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "port: 9090") || !strings.Contains(string(content), "password: hunter2") {
+		t.Errorf("Expected the effective configuration, got:\n%s", content)
+	}
+
+	key := bytes.Repeat([]byte{7}, 32)
+	SetSnapshotKey(key)
+	encrypted := filepath.Join(t.TempDir(), "encrypted.yaml")
+	if err := WriteConfig(encrypted); err != nil {
+		t.Fatalf("WriteConfig() failed: %v", err)
+	}
+	if content, err = os.ReadFile(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), snapshotHeader) || strings.Contains(string(content), "hunter2") {
+		t.Errorf("Expected an encrypted file, got:\n%s", content)
+	}
+
+	// The encrypted file can be loaded with the same key only.
+	testReset(t)
+	SetSnapshotKey(key)
+	if err := Init(encrypted); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetString("db.password"); got != "hunter2" || GetInt("port") != 9090 {
+		t.Errorf("Expected the written configuration, got %v", finalConfig.data)
+	}
+
+	testReset(t)
+	if err := Init(encrypted); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed without a key, got %v", err)
+	}
+	testReset(t)
+	SetSnapshotKey(bytes.Repeat([]byte{8}, 32))
+	if err := Init(encrypted); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed with the wrong key, got %v", err)
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	testReset(t)
+	SetDefault("port", 8080)
+	SetDefault("timeout", "30s")
+	SetDefault("log_level", "info")
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	original := `# Settings of the app.
+port: 8080 # Port to listen on.
+
+# Database settings.
+db:
+    host: "db.internal"
+    pool: 10 # Per instance.
+base: &base
+    retries: 3
+worker:
+    <<: *base
+timeout: 30s
+when:
+    - if: port == 8080
+      then:
+        replicas: 2
+overrides:
+    region:
+        eu-west-1: {port: 9090}
+`
+	if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(path); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--timeout=1m"}
+	Parse()
+	Set("db.pool", 20)
+	Set("name", "app")
+	if got := GetInt("db.pool"); got != 20 {
+		t.Errorf("Expected the value set with Set, got %d", got)
+	}
+	if err := SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig() failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Settings of the app.
+port: 8080 # Port to listen on.
+
+# Database settings.
+db:
+    host: "db.internal"
+    pool: 20 # Per instance.
+base: &base
+    retries: 3
+worker:
+    <<: *base
+timeout: 30s
+when:
+    - if: port == 8080
+      then:
+        replicas: 2
+overrides:
+    region:
+        eu-west-1: {port: 9090}
+name: app
+`
+	if string(content) != want {
+		t.Errorf("Unexpected file, got:\n%s\nwant:\n%s", content, want)
+	}
+
+	// WriteConfig exports the effective configuration, existing file or not.
+	if err := WriteConfig(path); err != nil {
+		t.Fatalf("WriteConfig() failed: %v", err)
+	}
+	testReset(t)
+	if err := Init(path); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetString("timeout"); got != "1m0s" {
+		t.Errorf("Expected the flag value to be exported, got %q", got)
+	}
+	if got := GetString("log_level"); got != "info" {
+		t.Errorf("Expected the default to be exported, got %q", got)
+	}
+
+	testReset(t)
+	Parse()
+	if err := SaveConfig(); !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected ErrInitFailed without a config file, got %v", err)
+	}
+}
+
+func TestLastKnownGood_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, 32)
+	setup := func(content string) error {
+		testReset(t)
+		SetSnapshotKey(key)
+		return InitContext(context.Background(), File(createTempYAML(t, content)), WithFallbackToLastGood(dir))
+	}
+	if err := setup("token: secret-token\n"); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test"}
+	Parse()
+	content, err := os.ReadFile(filepath.Join(dir, lastGoodFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "secret-token") {
+		t.Errorf("Expected the snapshot to be encrypted, got:\n%s", content)
+	}
+
+	if err := setup("token: [unclosed\n"); !errors.Is(err, ErrStaleConfig) {
+		t.Fatalf("Expected InitContext() to fall back, got %v", err)
+	}
+	Parse()
+	if got := GetString("token"); got != "secret-token" {
+		t.Errorf("Expected the decrypted snapshot, got %q", got)
+	}
+}
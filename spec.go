@@ -0,0 +1,91 @@
+package mflag
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// keySpec holds what the application declared about a key beyond its
+// default value, such as the values it is allowed to take.
+type keySpec struct {
+	typ      Type     // declared type, 0 if the type is inferred
+	allowed  []string // permitted values for enum keys
+	secret   bool     // whether the value must be masked when printed
+	required bool     // whether Parse fails if the key is not set
+
+	description string        // shown in the help message and by Keys
+	env         []string      // environment variables the key is read from
+	unit        time.Duration // unit of bare numbers for duration keys
+
+	registered bool                            // whether the key was declared with Register
+	validators []func(value interface{}) error // checks of the value of the key
+}
+
+// specs maps keys to their declared specs.
+var specs = make(map[string]*keySpec)
+
+// specFor returns the spec for key, creating an empty one if needed.
+func specFor(key string) *keySpec {
+	s, ok := specs[key]
+	if !ok {
+		s = &keySpec{}
+		specs[key] = s
+	}
+	return s
+}
+
+// MarkSecret marks keys as holding secrets, so that their values are masked
+// whenever mflag prints or exports the configuration. Marking a key also
+// marks every key nested below it.
+func MarkSecret(keys ...string) {
+	for _, key := range keys {
+		specFor(key).secret = true
+	}
+}
+
+// secretMask replaces the values of secret keys.
+const secretMask = "******"
+
+// isSecret reports whether key or one of its parents is secret in the
+// merged configuration.
+func isSecret(key string) bool {
+	return finalConfig.isSecret(key)
+}
+
+// isSecret reports whether key or one of its parents was marked as secret,
+// or holds a value of m resolved from a secret.
+func (m *mapManager) isSecret(key string) bool {
+	for {
+		if s, ok := specs[key]; (ok && s.secret) || m.secrets[key] {
+			return true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// markSecret marks key as secret in m. Unlike MarkSecret, it leaves the
+// keys of other configurations, such as the one used by the getters while
+// Reload resolves a new one, untouched.
+func (m *mapManager) markSecret(key string) {
+	if m.secrets == nil {
+		m.secrets = make(map[string]bool)
+	}
+	m.secrets[key] = true
+}
+
+// usageFor builds the usage text of the flag generated for key.
+func usageFor(key string) string {
+	usage := fmt.Sprintf("override configuration for '%s'", key)
+	if s, ok := specs[key]; ok && s.description != "" {
+		usage = s.description
+	}
+	if s, ok := specs[key]; ok && len(s.allowed) > 0 {
+		usage += fmt.Sprintf(" (one of: %s)", strings.Join(s.allowed, ", "))
+	}
+	return usage
+}
@@ -0,0 +1,34 @@
+// Package sqlrotate reopens database/sql pools when mflag rotates the
+// secret they connect with, so that applications using mflag.OnSecretRotate
+// do not need to write the swap themselves. It lives in its own package to
+// keep database/sql out of the core.
+//
+//	var db atomic.Pointer[sql.DB]
+//	mflag.OnSecretRotate("db.password", sqlrotate.Reopen(&db, "postgres",
+//		func(password mflag.Secret) string {
+//			return "postgres://app:" + url.QueryEscape(password.Reveal()) + "@db/app"
+//		}))
+package sqlrotate
+
+import (
+	"database/sql"
+	"sync/atomic"
+
+	"github.com/hypedn/mflag"
+)
+
+// Reopen returns a hook for mflag.OnSecretRotate that opens a new database
+// pool with the data source name dsn builds from the rotated secret, stores
+// it in db and closes the previous pool, which lets running queries finish.
+func Reopen(db *atomic.Pointer[sql.DB], driverName string, dsn func(mflag.Secret) string) func(mflag.Secret) error {
+	return func(s mflag.Secret) error {
+		pool, err := sql.Open(driverName, dsn(s))
+		if err != nil {
+			return err
+		}
+		if prev := db.Swap(pool); prev != nil {
+			return prev.Close()
+		}
+		return nil
+	}
+}
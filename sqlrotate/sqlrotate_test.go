@@ -0,0 +1,53 @@
+package sqlrotate
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hypedn/mflag"
+)
+
+// fakeDriver is a database/sql driver that is never connected to.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not connected")
+}
+
+func init() {
+	sql.Register("mflag-fake", fakeDriver{})
+}
+
+func TestReopen(t *testing.T) {
+	var db atomic.Pointer[sql.DB]
+	var dsn string
+	reopen := Reopen(&db, "mflag-fake", func(s mflag.Secret) string {
+		dsn = "app:" + s.Reveal() + "@db"
+		return dsn
+	})
+
+	if err := reopen(mflag.NewSecret("hunter2")); err != nil {
+		t.Fatalf("Reopen() hook failed: %v", err)
+	}
+	first := db.Load()
+	if first == nil || dsn != "app:hunter2@db" {
+		t.Fatalf("Expected a pool opened with the secret, got %q", dsn)
+	}
+
+	if err := reopen(mflag.NewSecret("correct-horse")); err != nil {
+		t.Fatalf("Reopen() hook failed: %v", err)
+	}
+	if db.Load() == first || dsn != "app:correct-horse@db" {
+		t.Errorf("Expected a new pool opened with the rotated secret, got %q", dsn)
+	}
+	if err := first.Ping(); err == nil || err.Error() != "sql: database is closed" {
+		t.Errorf("Expected the previous pool to be closed, got %v", err)
+	}
+
+	if err := Reopen(&db, "mflag-missing", func(mflag.Secret) string { return "" })(mflag.NewSecret("x")); err == nil {
+		t.Error("Expected an error for an unknown driver")
+	}
+}
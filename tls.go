@@ -0,0 +1,218 @@
+package mflag
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"weak"
+)
+
+// tlsVersions maps the accepted min_version values to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// clientAuthTypes maps the accepted client_auth values to policies.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// GetTLSConfig builds a *tls.Config from the section at key, which may set:
+//
+//	cert_file:   PEM certificate chain, used with key_file
+//	key_file:    PEM private key
+//	ca_file:     PEM CA bundle to verify servers and client certificates
+//	min_version: "1.0", "1.1", "1.2" (the default) or "1.3"
+//	client_auth: none, request, require, verify_if_given or require_and_verify
+//
+// Relative paths are resolved as GetPath does. The files are loaded
+// immediately, and loaded again by every Reload, so that rotated
+// certificates and CA bundles are picked up without restarting; a watcher
+// noticing the new files only needs to call Reload. The returned config
+// works for servers and clients.
+// Must be called after Parse.
+func GetTLSConfig(key string) (*tls.Config, error) {
+	mustBeParsed()
+	return newTLSConfig(Sub(key))
+}
+
+// GetTLSConfig builds a *tls.Config from the section at key, as the
+// package-level GetTLSConfig does.
+func (s *Section) GetTLSConfig(key string) (*tls.Config, error) {
+	return newTLSConfig(s.sub(key))
+}
+
+// newTLSConfig builds the config GetTLSConfig returns from the section s.
+// Handshakes take the certificate and the CA pool from a tlsFiles, which
+// Reload refreshes: servers through GetConfigForClient, and clients by
+// verifying the server certificate in VerifyConnection, since RootCAs
+// cannot change once the config is in use.
+func newTLSConfig(s *Section) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if v := s.GetString("min_version"); v != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v), "tls")]
+		if !ok {
+			return nil, fmt.Errorf("%w %q for %q: must be one of 1.0, 1.1, 1.2, 1.3", ErrInvalidValue, v, s.Key()+".min_version")
+		}
+		cfg.MinVersion = version
+	}
+	if v := s.GetString("client_auth"); v != "" {
+		auth, ok := clientAuthTypes[v]
+		if !ok {
+			return nil, fmt.Errorf("%w %q for %q: must be one of none, request, require, verify_if_given, require_and_verify", ErrInvalidValue, v, s.Key()+".client_auth")
+		}
+		cfg.ClientAuth = auth
+	}
+
+	f := &tlsFiles{
+		certFile: s.GetPath("cert_file"),
+		keyFile:  s.GetPath("key_file"),
+		caFile:   s.GetPath("ca_file"),
+	}
+	if f.certFile == "" && f.keyFile == "" && f.caFile == "" {
+		return cfg, nil
+	}
+	if (f.certFile == "") != (f.keyFile == "") {
+		return nil, fmt.Errorf("%w for %q: cert_file and key_file must be set together", ErrInvalidValue, s.Key())
+	}
+	if err := f.load(); err != nil {
+		return nil, fmt.Errorf("%w for %q: %w", ErrInvalidValue, s.Key(), err)
+	}
+
+	if f.certFile != "" {
+		cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return f.cert.Load(), nil
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return f.cert.Load(), nil
+		}
+	}
+	if f.caFile != "" {
+		cfg.ClientCAs, cfg.RootCAs = f.pool.Load(), f.pool.Load()
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = f.verifyServer
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			// Servers take the config as it is now, with the current
+			// pool, and verify clients as crypto/tls does.
+			server := cfg.Clone()
+			server.GetConfigForClient, server.VerifyConnection = nil, nil
+			server.InsecureSkipVerify = false
+			server.ClientCAs = f.pool.Load()
+			return server, nil
+		}
+	}
+	watchTLSFiles(f)
+	return cfg, nil
+}
+
+// tlsFiles holds the certificate and the CA pool of a config returned by
+// GetTLSConfig, loaded from their files.
+type tlsFiles struct {
+	certFile, keyFile, caFile string
+
+	cert atomic.Pointer[tls.Certificate]
+	pool atomic.Pointer[x509.CertPool]
+}
+
+// load loads the files. If a file cannot be loaded, such as one whose
+// rotation is half-written, the previous certificate or pool is kept, so
+// that handshakes keep working.
+func (f *tlsFiles) load() error {
+	var errs []error
+	if f.certFile != "" {
+		if cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile); err != nil {
+			errs = append(errs, err)
+		} else {
+			f.cert.Store(&cert)
+		}
+	}
+	if f.caFile != "" {
+		if pool, err := loadCertPool(f.caFile); err != nil {
+			errs = append(errs, err)
+		} else {
+			f.pool.Store(pool)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadCertPool returns a pool of the certificates of the PEM file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// verifyServer verifies the certificate of a server against the current CA
+// pool, as crypto/tls does against RootCAs.
+func (f *tlsFiles) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         f.pool.Load(),
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+var (
+	tlsFilesMu sync.Mutex
+	// tlsFilesInUse holds the files of the configs returned by
+	// GetTLSConfig. They are weak so that configs no longer in use are
+	// not kept alive.
+	tlsFilesInUse []weak.Pointer[tlsFiles]
+)
+
+// watchTLSFiles makes Reload load f again.
+func watchTLSFiles(f *tlsFiles) {
+	tlsFilesMu.Lock()
+	defer tlsFilesMu.Unlock()
+	tlsFilesInUse = append(tlsFilesInUse, weak.Make(f))
+}
+
+// reloadTLSFiles loads the files of the configs returned by GetTLSConfig
+// again, forgetting those no longer in use.
+func reloadTLSFiles() error {
+	tlsFilesMu.Lock()
+	defer tlsFilesMu.Unlock()
+	var errs []error
+	inUse := tlsFilesInUse[:0]
+	for _, wp := range tlsFilesInUse {
+		f := wp.Value()
+		if f == nil {
+			continue
+		}
+		inUse = append(inUse, wp)
+		if err := f.load(); err != nil {
+			errs = append(errs, fmt.Errorf("reloading TLS files: %w", err))
+		}
+	}
+	clear(tlsFilesInUse[len(inUse):])
+	tlsFilesInUse = inUse
+	return errors.Join(errs...)
+}
@@ -0,0 +1,206 @@
+package mflag
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for name and its key.
+func writeTestCert(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetTLSConfig(t *testing.T) {
+	testReset(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	configPath := createTempYAML(t, `
+server:
+  tls:
+    cert_file: `+certFile+`
+    key_file: `+keyFile+`
+    ca_file: `+certFile+`
+    min_version: "1.3"
+    client_auth: require_and_verify
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	cfg, err := GetTLSConfig("server.tls")
+	if err != nil {
+		t.Fatalf("GetTLSConfig() failed: %v", err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 || cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Unexpected MinVersion %x or ClientAuth %v", cfg.MinVersion, cfg.ClientAuth)
+	}
+	if cfg.ClientCAs == nil || cfg.RootCAs == nil {
+		t.Error("Expected the CA bundle to be loaded")
+	}
+	commonName := func() string {
+		cert, err := cfg.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate() failed: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if got := commonName(); got != "first" {
+		t.Errorf("Expected the first certificate, got %q", got)
+	}
+
+	// Rotate the certificate and the CA bundle; Reload must pick them up.
+	writeTestCert(t, certFile, keyFile, "second")
+	if got := commonName(); got != "first" {
+		t.Errorf("Expected the certificate to be kept until Reload, got %q", got)
+	}
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if got := commonName(); got != "second" {
+		t.Errorf("Expected the rotated certificate, got %q", got)
+	}
+	server, err := cfg.GetConfigForClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.ClientCAs == cfg.ClientCAs || server.VerifyConnection != nil {
+		t.Error("Expected servers to verify clients with the rotated CA bundle")
+	}
+
+	// A broken rotation keeps the previous certificate.
+	if err := os.WriteFile(keyFile, []byte("half-written"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(context.Background()); err == nil {
+		t.Error("Expected Reload to report the broken key")
+	}
+	if got := commonName(); got != "second" {
+		t.Errorf("Expected the previous certificate to be kept, got %q", got)
+	}
+}
+
+func TestGetTLSConfig_Handshake(t *testing.T) {
+	testReset(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestCert(t, certFile, keyFile, "localhost")
+	configPath := createTempYAML(t, `
+tls:
+  cert_file: `+certFile+`
+  key_file: `+keyFile+`
+  ca_file: `+certFile+`
+  client_auth: require_and_verify
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+	cfg, err := GetTLSConfig("tls")
+	if err != nil {
+		t.Fatalf("GetTLSConfig() failed: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	handshake := func(serverName string) error {
+		errs := make(chan error, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+			errs <- tls.Server(conn, cfg).Handshake()
+		}()
+		clientCfg := cfg.Clone()
+		clientCfg.ServerName = serverName
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+		if err == nil {
+			conn.Close()
+		}
+		return errors.Join(err, <-errs)
+	}
+	if err := handshake("localhost"); err != nil {
+		t.Errorf("Expected the handshake to succeed, got %v", err)
+	}
+	if err := handshake("example.com"); err == nil {
+		t.Error("Expected the client to reject a certificate for another name")
+	}
+}
+
+func TestGetTLSConfig_Errors(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, `
+bad_version: {min_version: "1.4"}
+bad_auth: {client_auth: always}
+half: {cert_file: /tmp/tls.crt}
+missing: {cert_file: /does/not/exist, key_file: /does/not/exist}
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	for _, key := range []string{"bad_version", "bad_auth", "half", "missing"} {
+		if _, err := GetTLSConfig(key); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("GetTLSConfig(%q): expected ErrInvalidValue, got %v", key, err)
+		}
+	}
+	cfg, err := GetTLSConfig("unset")
+	if err != nil || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected a default config for a missing section, got %v, %v", cfg, err)
+	}
+}
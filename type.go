@@ -0,0 +1,154 @@
+package mflag
+
+import (
+	"time"
+)
+
+// Type is the type of a configuration key. It determines the type of the
+// key's flag and how values given as strings, e.g. on the command line, are
+// parsed and validated.
+type Type int
+
+const (
+	String Type = iota + 1
+	Bool
+	Int
+	Uint
+	Float64
+	Duration
+	StringSlice
+	StringMap
+	// Regexp is a string holding a regular expression, compiled when the
+	// configuration is validated. See GetRegexp.
+	Regexp
+	// Location is an IANA time zone name, such as "Europe/Paris", loaded
+	// when the configuration is validated. See GetLocation.
+	Location
+	// Cron is a cron expression, parsed when the configuration is
+	// validated. See GetCron.
+	Cron
+)
+
+// String returns the name of the type as shown in help messages.
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Int:
+		return "int"
+	case Uint:
+		return "uint"
+	case Float64:
+		return "float"
+	case Duration:
+		return "duration"
+	case StringSlice:
+		return "list"
+	case StringMap:
+		return "map"
+	case Regexp:
+		return "regexp"
+	case Location:
+		return "timezone"
+	case Cron:
+		return "cron"
+	}
+	return "value"
+}
+
+// DeclareKey declares the type of a key independently of its default value,
+// so that keys without a meaningful default, such as required secrets or
+// optional overrides, still get correctly typed flags and validation.
+// It should be called before Parse.
+func DeclareKey(key string, typ Type) {
+	specFor(key).typ = typ
+}
+
+// SetDefaultString sets a default value for a string key and declares its type.
+func SetDefaultString(key string, value string) {
+	DeclareKey(key, String)
+	SetDefault(key, value)
+}
+
+// SetDefaultBool sets a default value for a bool key and declares its type.
+func SetDefaultBool(key string, value bool) {
+	DeclareKey(key, Bool)
+	SetDefault(key, value)
+}
+
+// SetDefaultInt sets a default value for an int key and declares its type.
+func SetDefaultInt(key string, value int) {
+	DeclareKey(key, Int)
+	SetDefault(key, value)
+}
+
+// SetDefaultUint sets a default value for a uint key and declares its type.
+func SetDefaultUint(key string, value uint) {
+	DeclareKey(key, Uint)
+	SetDefault(key, value)
+}
+
+// SetDefaultFloat64 sets a default value for a float64 key and declares its type.
+func SetDefaultFloat64(key string, value float64) {
+	DeclareKey(key, Float64)
+	SetDefault(key, value)
+}
+
+// SetDefaultDuration sets a default value for a duration key and declares its type.
+func SetDefaultDuration(key string, value time.Duration) {
+	DeclareKey(key, Duration)
+	SetDefault(key, value)
+}
+
+// SetDefaultStringSlice sets a default value for a string slice key and
+// declares its type.
+func SetDefaultStringSlice(key string, value []string) {
+	DeclareKey(key, StringSlice)
+	SetDefault(key, value)
+}
+
+// keyType returns the type of key: the declared type if any, otherwise the
+// type inferred from its default, otherwise the type inferred from its
+// merged value. It returns 0 if the type cannot be determined.
+func keyType(key string) Type {
+	if s, ok := specs[key]; ok && s.typ != 0 {
+		return s.typ
+	}
+	if dv := defaults.Get(key); dv != nil {
+		return typeOf(dv)
+	}
+	return typeOf(finalConfig.Get(key))
+}
+
+// typeOf infers the Type of a value. Strings holding a duration with a unit,
+// such as "30s", are considered durations.
+func typeOf(v interface{}) Type {
+	switch val := v.(type) {
+	case bool:
+		return Bool
+	case int, int8, int16, int32, int64:
+		return Int
+	case uint, uint8, uint16, uint32, uint64:
+		return Uint
+	case float32, float64:
+		return Float64
+	case time.Duration:
+		return Duration
+	case []string:
+		return StringSlice
+	case []interface{}:
+		if _, ok := scalarSliceToStrings(val); ok {
+			return StringSlice
+		}
+	case map[string]interface{}:
+		return StringMap
+	case string:
+		if _, ok := parseDurationString(val); ok {
+			return Duration
+		}
+		return String
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeclareKey(t *testing.T) {
+	testReset(t)
+
+	DeclareKey("port", Int)
+	DeclareKey("timeout", Duration)
+	DeclareKey("hosts", StringSlice)
+	DeclareKey("unset", Bool)
+	os.Args = []string{"test", "--port=8080", "--timeout=3s", "--hosts=a", "--hosts=b"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if v, ok := finalConfig.Get("port").(int); !ok || v != 8080 {
+		t.Errorf("Expected port to be int 8080, got %#v", finalConfig.Get("port"))
+	}
+	if v := GetDuration("timeout"); v != 3*time.Second {
+		t.Errorf("Expected timeout to be 3s, got %v", v)
+	}
+	if v := GetStringSlice("hosts"); !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Errorf("Expected hosts to be [a b], got %v", v)
+	}
+	if IsSet("unset") {
+		t.Error("Expected a declared key without value to remain unset")
+	}
+}
+
+func TestDeclareKey_Validation(t *testing.T) {
+	testReset(t)
+
+	DeclareKey("port", Int)
+	configPath := createTempYAML(t, `port: eighty`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue, got: %v", err)
+	}
+}
+
+func TestTypedSetDefaults(t *testing.T) {
+	testReset(t)
+
+	SetDefaultInt("workers", 4)
+	SetDefaultUint("max", 10)
+	SetDefaultString("name", "svc")
+	SetDefaultBool("debug", false)
+	SetDefaultFloat64("ratio", 0.5)
+	SetDefaultDuration("timeout", time.Second)
+	SetDefaultStringSlice("tags", []string{"a"})
+	configPath := createTempYAML(t, `
+timeout: 5s
+debug: "true"
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--set=max=20", "--ratio=0.25"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	tests := map[string]Type{
+		"workers": Int, "max": Uint, "name": String, "debug": Bool,
+		"ratio": Float64, "timeout": Duration, "tags": StringSlice,
+	}
+	for key, want := range tests {
+		if got := keyType(key); got != want {
+			t.Errorf("Expected %q to have type %v, got %v", key, want, got)
+		}
+	}
+	if v, ok := finalConfig.Get("max").(uint64); !ok || v != 20 {
+		t.Errorf("Expected max to be uint64 20, got %#v", finalConfig.Get("max"))
+	}
+	if !GetBool("debug") || GetDuration("timeout") != 5*time.Second || GetFloat64("ratio") != 0.25 {
+		t.Errorf("Unexpected values: debug=%v timeout=%v ratio=%v", GetBool("debug"), GetDuration("timeout"), GetFloat64("ratio"))
+	}
+}
+
+func TestDeclareDuration(t *testing.T) {
+	testReset(t)
+	DeclareDuration("timeout", time.Second)
+	DeclareDuration("poll", time.Millisecond)
+	DeclareDuration("retry", time.Second)
+	Register("grace", Unit(time.Minute), Env("TEST_MFLAG_GRACE"))
+	SetDefault("plain", 30)
+	t.Setenv("TEST_MFLAG_GRACE", "2")
+	if err := Init(createTempYAML(t, "timeout: 30\npoll: 1.5\nretry: 1m30s\nplain: 30\n")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--poll=250", "--set", "retry=5"}
+	Parse()
+
+	tests := map[string]time.Duration{
+		"timeout": 30 * time.Second,
+		"poll":    250 * time.Millisecond,
+		"retry":   5 * time.Second,
+		"grace":   2 * time.Minute,
+		"plain":   30,
+	}
+	for key, want := range tests {
+		if got := GetDuration(key); got != want {
+			t.Errorf("GetDuration(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
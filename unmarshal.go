@@ -0,0 +1,75 @@
+package mflag
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GetSlice returns the list of maps associated with the key, such as
+// endpoints: [{name: a, url: ...}, ...]. Items that are not maps are
+// skipped. It returns nil if the value is not a list. The maps are copies,
+// which the caller may modify.
+// Must be called after Parse.
+func GetSlice(key string) []map[string]interface{} {
+	mustBeParsed()
+	return finalConfig.GetSlice(key)
+}
+
+// UnmarshalKey decodes the value associated with the key into out, which
+// must be a pointer, e.g. to a struct or a slice of structs. An empty key
+// decodes the whole configuration. Values are decoded as if they were YAML,
+// so struct fields are matched by their yaml tag, or else by their
+// lowercased name, and durations may be strings such as "5s". out is left
+// untouched if the key is not set.
+// Must be called after Parse.
+func UnmarshalKey(key string, out interface{}) error {
+	mustBeParsed()
+	return finalConfig.UnmarshalKey(key, out)
+}
+
+// GetSlice returns the list of maps associated with the key.
+func (s *Section) GetSlice(key string) []map[string]interface{} {
+	return s.m.GetSlice(key)
+}
+
+// UnmarshalKey decodes the value associated with the key into out, as the
+// package-level UnmarshalKey does.
+func (s *Section) UnmarshalKey(key string, out interface{}) error {
+	return s.m.UnmarshalKey(key, out)
+}
+
+// GetSlice returns the list of maps associated with the key, copying them.
+func (m *mapManager) GetSlice(key string) []map[string]interface{} {
+	items, ok := m.Get(key).([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if nested, ok := item.(map[string]interface{}); ok {
+			result = append(result, deepCopyMap(nested))
+		}
+	}
+	return result
+}
+
+// UnmarshalKey decodes the value associated with the key, or all data if
+// the key is empty, into out.
+func (m *mapManager) UnmarshalKey(key string, out interface{}) error {
+	var value interface{} = m.data
+	if key != "" {
+		value = m.Get(key)
+	}
+	if value == nil {
+		return nil
+	}
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%w for %q: %w", ErrInvalidValue, key, err)
+	}
+	if err := yaml.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("%w for %q: %w", ErrInvalidValue, key, err)
+	}
+	return nil
+}
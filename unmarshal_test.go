@@ -0,0 +1,74 @@
+package mflag
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetSliceAndUnmarshalKey(t *testing.T) {
+	testReset(t)
+	configPath := createTempYAML(t, `
+endpoints:
+  - name: primary
+    url: https://a.example.com
+    timeout: 5s
+  - name: backup
+    url: https://b.example.com
+mixed: [a, {name: x}]
+server:
+  port: 8080
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	Parse()
+
+	slice := GetSlice("endpoints")
+	if len(slice) != 2 || slice[1]["name"] != "backup" {
+		t.Errorf("Unexpected slice %v", slice)
+	}
+	if mixed := GetSlice("mixed"); len(mixed) != 1 || mixed[0]["name"] != "x" {
+		t.Errorf("Expected items that are not maps to be skipped, got %v", mixed)
+	}
+	slice[0]["name"] = "modified"
+	if GetSlice("endpoints")[0]["name"] != "primary" {
+		t.Error("Expected GetSlice to return copies")
+	}
+	if GetSlice("server") != nil {
+		t.Error("Expected nil for a map value")
+	}
+
+	type endpoint struct {
+		Name    string
+		URL     string `yaml:"url"`
+		Timeout time.Duration
+	}
+	var endpoints []endpoint
+	if err := UnmarshalKey("endpoints", &endpoints); err != nil {
+		t.Fatalf("UnmarshalKey() failed: %v", err)
+	}
+	want := []endpoint{
+		{Name: "primary", URL: "https://a.example.com", Timeout: 5 * time.Second},
+		{Name: "backup", URL: "https://b.example.com"},
+	}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("Unexpected endpoints %+v", endpoints)
+	}
+
+	var all struct {
+		Server struct{ Port int }
+	}
+	if err := UnmarshalKey("", &all); err != nil || all.Server.Port != 8080 {
+		t.Errorf("Expected the whole configuration to be decoded, got %+v, %v", all, err)
+	}
+	var port struct{ Port int }
+	if err := Sub("server").UnmarshalKey("", &port); err != nil || port.Port != 8080 {
+		t.Errorf("Expected the section to be decoded, got %+v, %v", port, err)
+	}
+	var bad struct{ Port []int }
+	if err := UnmarshalKey("server", &bad); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue for mismatched types, got %v", err)
+	}
+}
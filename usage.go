@@ -0,0 +1,103 @@
+package mflag
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// generalGroup is the help group of keys without a dot-separated prefix.
+const generalGroup = "general"
+
+// otherGroup is the help group of flags not generated by mflag.
+const otherGroup = "other flags"
+
+// printUsage writes the help message of fs to its output. Flags are grouped
+// by the top-level prefix of their key, and groups and flags are sorted.
+func printUsage(fs *flag.FlagSet) {
+	w := fs.Output()
+	if fs.Name() == "" {
+		fmt.Fprintf(w, "Usage:\n")
+	} else {
+		fmt.Fprintf(w, "Usage of %s:\n", fs.Name())
+	}
+
+	groups := make(map[string][]*flag.Flag)
+	fs.VisitAll(func(f *flag.Flag) {
+		group := otherGroup
+		if key, ok := flagKeys[f.Name]; ok {
+			group = generalGroup
+			if prefix, _, found := strings.Cut(key, "."); found {
+				group = prefix
+			}
+		} else if builtinFlags[f.Name] {
+			group = generalGroup
+		}
+		groups[group] = append(groups[group], f)
+	})
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		if name != generalGroup && name != otherGroup {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	names = append([]string{generalGroup}, names...)
+	names = append(names, otherGroup)
+
+	for _, name := range names {
+		flags := groups[name]
+		if len(flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", name)
+		// VisitAll visits flags in lexicographical order already.
+		for _, f := range flags {
+			printFlag(w, f)
+		}
+	}
+}
+
+// printFlag writes the help entry of a single flag.
+func printFlag(w io.Writer, f *flag.Flag) {
+	typeName, usage := flag.UnquoteUsage(f)
+	if _, ok := f.Value.(*stringSliceValue); ok {
+		typeName = "list"
+	}
+
+	var b strings.Builder
+	if len(f.Name) == 1 {
+		fmt.Fprintf(&b, "  -%s", f.Name)
+	} else {
+		fmt.Fprintf(&b, "  --%s", f.Name)
+	}
+	if typeName != "" {
+		fmt.Fprintf(&b, " %s", typeName)
+	}
+	b.WriteString("\n    \t")
+	b.WriteString(strings.ReplaceAll(usage, "\n", "\n    \t"))
+	if !isZeroDefault(f) {
+		if typeName == "string" {
+			fmt.Fprintf(&b, " (default %q)", f.DefValue)
+		} else {
+			fmt.Fprintf(&b, " (default %v)", f.DefValue)
+		}
+	}
+	if key, ok := flagKeys[f.Name]; ok && flagAliases[f.Name] == "" {
+		fmt.Fprintf(&b, "\n    \tcan also be set as '%s' in the config file", key)
+	}
+	fmt.Fprintln(w, b.String())
+}
+
+// isZeroDefault reports whether the default value of f is the zero value of
+// its type, in which case it is omitted from the help message.
+func isZeroDefault(f *flag.Flag) bool {
+	switch f.DefValue {
+	case "", "0", "false", "0s":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package mflag
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestPrintUsage(t *testing.T) {
+	testReset(t)
+
+	SetDefault("port", 8080)
+	SetDefault("database.host", "localhost")
+	SetDefaultEnum("log.format", "json", "json", "text")
+	finalConfig = defaults.Clone()
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.String("external", "", "a flag defined by the application")
+	if errs := populateFlagSet(fs); len(errs) > 0 {
+		t.Fatalf("populateFlagSet() failed: %v", errs)
+	}
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	printUsage(fs)
+	out := buf.String()
+
+	order := []string{"general:", "--port int", "--set key=value", "database:", "--database-host string", "log:", "--log-format string", "other flags:", "--external string"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(out, s)
+		if i < 0 {
+			t.Fatalf("Expected usage to contain %q, got:\n%s", s, out)
+		}
+		if i < last {
+			t.Errorf("Expected %q to appear after the previous entries, got:\n%s", s, out)
+		}
+		last = i
+	}
+	for _, s := range []string{`(default "localhost")`, "(default 8080)", "(one of: json, text)", "can also be set as 'database.host' in the config file"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected usage to contain %q, got:\n%s", s, out)
+		}
+	}
+}
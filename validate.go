@@ -0,0 +1,186 @@
+package mflag
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// validateConfigFlagName is the name of the built-in flag validating the
+// configuration.
+const validateConfigFlagName = "validate-config"
+
+var (
+	// validateConfigEnabled reports whether EnableValidateConfig was called.
+	validateConfigEnabled = false
+	// validators holds the functions registered with AddValidator.
+	validators []func(settings map[string]interface{}) error
+)
+
+// MarkRequired marks keys that must be set by a default, the config file or
+// a flag. Parse fails if any of them is missing.
+func MarkRequired(keys ...string) {
+	for _, key := range keys {
+		specFor(key).required = true
+	}
+}
+
+// AddValidator registers a function validating the merged configuration,
+// e.g. against a schema. It receives the configuration as a nested map, which
+// it must not modify, and any error it returns makes Parse fail.
+func AddValidator(fn func(settings map[string]interface{}) error) {
+	validators = append(validators, fn)
+}
+
+// EnableValidateConfig registers a built-in --validate-config flag which
+// loads, merges and validates the configuration, reports the result and
+// exits. It lets CI pipelines and init containers check a configuration
+// before rolling it out. The configuration is checked as given: it is
+// reported invalid even when WithFallbackToLastGood would fall back to
+// the snapshot. It should be called before Parse.
+func EnableValidateConfig() {
+	validateConfigEnabled = true
+}
+
+// registerValidateConfigFlag adds the --validate-config flag to fs if enabled.
+func registerValidateConfigFlag(fs *flag.FlagSet) *bool {
+	if !validateConfigEnabled || fs.Lookup(validateConfigFlagName) != nil {
+		return nil
+	}
+	builtinFlags[validateConfigFlagName] = true
+	return fs.Bool(validateConfigFlagName, false, "validate the configuration and exit")
+}
+
+// Validate checks the merged configuration: required keys must be set, enum
+// keys must hold an allowed value, values must be convertible to the type of
+// their key, the validators of keys registered with Register must accept
+// their values, and every function registered with AddValidator must accept
+// the configuration. Parse calls it automatically.
+// Must be called after Parse.
+func Validate() error {
+	mustBeParsed()
+	return validate(finalConfig)
+}
+
+// validate is the implementation of Validate, checking m.
+func validate(m *mapManager) error {
+	var errs []error
+	if err := checkConfigVersion(m); err != nil {
+		errs = append(errs, err)
+	}
+	for _, key := range slices.Sorted(maps.Keys(specs)) {
+		if specs[key].required && !m.IsSet(key) {
+			errs = append(errs, fmt.Errorf("%w %q", ErrMissingKey, key))
+		}
+	}
+	errs = append(errs, validateEnums(m)...)
+	errs = append(errs, validateTypes(m)...)
+	errs = append(errs, validateKeys(m)...)
+	for _, fn := range validators {
+		if err := fn(m.data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateTypes checks that every key with a default or a declared type
+// holds a value convertible to that type.
+func validateTypes(m *mapManager) []error {
+	keys := defaults.AllKeys()
+	for key, s := range specs {
+		if s.typ != 0 {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var errs []error
+	for _, key := range slices.Compact(keys) {
+		value := m.Get(key)
+		if value == nil {
+			continue
+		}
+		if err := checkType(value, keyType(key)); err != nil {
+			errs = append(errs, fmt.Errorf("%w %v for %q: %w", ErrInvalidValue, value, key, err))
+		}
+	}
+	return errs
+}
+
+// checkType returns an error if value cannot be converted to typ.
+func checkType(value interface{}, typ Type) error {
+	s, isString := value.(string)
+	switch typ {
+	case Bool:
+		if isString {
+			_, err := strconv.ParseBool(s)
+			return err
+		}
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected a bool")
+		}
+	case Int, Uint, Float64:
+		if isString {
+			_, err := strconv.ParseFloat(s, 64)
+			return err
+		}
+		if !isNumber(value) {
+			return fmt.Errorf("expected a number")
+		}
+	case Duration:
+		if isString {
+			_, err := time.ParseDuration(s)
+			return err
+		}
+		if !isNumber(value) {
+			return fmt.Errorf("expected a duration")
+		}
+	case StringSlice:
+		switch value.(type) {
+		case []string, []interface{}, string:
+		default:
+			return fmt.Errorf("expected a list")
+		}
+	case StringMap:
+		if _, ok := value.(map[string]interface{}); !ok {
+			return fmt.Errorf("expected a map")
+		}
+	case Regexp:
+		if !isString {
+			return fmt.Errorf("expected a regular expression")
+		}
+		_, err := regexp.Compile(s)
+		return err
+	case Location:
+		if !isString {
+			return fmt.Errorf("expected a time zone name")
+		}
+		_, err := time.LoadLocation(s)
+		return err
+	case Cron:
+		if !isString {
+			return fmt.Errorf("expected a cron expression")
+		}
+		_, err := cronParser(s)
+		return err
+	}
+	return nil
+}
+
+// isNumber reports whether v holds a finite number.
+func isNumber(v interface{}) bool {
+	switch n := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, time.Duration:
+		return true
+	case float64:
+		return !math.IsNaN(n) && !math.IsInf(n, 0)
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package mflag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidate_RequiredKeys(t *testing.T) {
+	testReset(t)
+
+	MarkRequired("db.password", "db.host")
+	SetDefault("db.host", "localhost")
+
+	err := ParseWithError()
+	if !errors.Is(err, ErrMissingKey) {
+		t.Fatalf("Expected ErrMissingKey, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), `"db.password"`) || strings.Contains(err.Error(), `"db.host"`) {
+		t.Errorf("Expected only db.password to be reported, got: %v", err)
+	}
+
+	testReset(t)
+	MarkRequired("db.password")
+	os.Args = []string{"test", "--set=db.password=secret"}
+	if err := ParseWithError(); err != nil {
+		t.Errorf("Expected required key set by a flag to pass validation, got: %v", err)
+	}
+}
+
+func TestValidate_Types(t *testing.T) {
+	testReset(t)
+
+	SetDefault("port", 8080)
+	SetDefault("debug", false)
+	SetDefault("timeout", "5s")
+	configPath := createTempYAML(t, `
+port: "not a number"
+debug: "yes please"
+timeout: 10s
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	err := ParseWithError()
+	if !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("Expected ErrInvalidValue, got: %v", err)
+	}
+	for _, key := range []string{`"port"`, `"debug"`} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected error to mention %s, got: %v", key, err)
+		}
+	}
+}
+
+func TestValidate_Validators(t *testing.T) {
+	testReset(t)
+
+	SetDefault("replicas", 3)
+	AddValidator(func(settings map[string]interface{}) error {
+		if settings["replicas"] != 3 {
+			return fmt.Errorf("replicas must be 3")
+		}
+		return nil
+	})
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	testReset(t)
+	SetDefault("replicas", 3)
+	AddValidator(func(settings map[string]interface{}) error {
+		return fmt.Errorf("schema violation")
+	})
+	if err := ParseWithError(); err == nil || !strings.Contains(err.Error(), "schema violation") {
+		t.Errorf("Expected the validator error, got: %v", err)
+	}
+}
+
+func TestValidateConfigFlag(t *testing.T) {
+	testReset(t)
+
+	var buf bytes.Buffer
+	stdout = &buf
+	EnableValidateConfig()
+	SetDefault("port", 8080)
+	os.Args = []string{"test", "--validate-config"}
+
+	if err := ParseWithError(); !errors.Is(err, ErrExitRequested) {
+		t.Fatalf("Expected ErrExitRequested, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "configuration is valid") {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+
+	testReset(t)
+	EnableValidateConfig()
+	MarkRequired("password")
+	os.Args = []string{"test", "--validate-config"}
+	if err := ParseWithError(); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("Expected ErrMissingKey, got: %v", err)
+	}
+}
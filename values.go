@@ -0,0 +1,393 @@
+package mflag
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stringSliceValue is a repeatable flag.Value for slice-valued keys.
+// The first occurrence on the command line replaces the configured slice and
+// every further occurrence appends to it, so `--features=a --features=b`
+// yields [a b]. Comma-separated values are split into several elements, and
+// a value that parses as a JSON or YAML list, such as ["a", "b"], is taken
+// as one. Other values starting with "[", such as [::1]:8080, are split.
+type stringSliceValue struct {
+	values []string
+	set    bool
+}
+
+// newStringSliceValue creates a stringSliceValue holding a copy of defaults.
+func newStringSliceValue(defaults []string) *stringSliceValue {
+	return &stringSliceValue{values: append([]string(nil), defaults...)}
+}
+
+func (v *stringSliceValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(v.values, ",")
+}
+
+func (v *stringSliceValue) Set(s string) error {
+	if !v.set {
+		v.values = []string{}
+		v.set = true
+	}
+	if s == "" {
+		return nil
+	}
+	if items, err := unmarshalList(s); err == nil {
+		for _, item := range items {
+			v.values = append(v.values, fmt.Sprint(item))
+		}
+		return nil
+	}
+	v.values = append(v.values, splitList(s, sliceSeparator)...)
+	return nil
+}
+
+func (v *stringSliceValue) Get() interface{} {
+	return v.values
+}
+
+// listValue is a repeatable flag.Value for list-valued keys whose items are
+// not all strings, such as ports or endpoints. Like stringSliceValue, the
+// first occurrence replaces the configured list and further ones append to
+// it. A value that parses as a JSON or YAML list is taken as one, e.g.
+// --endpoints='[{"url": "https://a.example.com"}]'. Otherwise it is split
+// like a string slice and its items are parsed as elem, so that --ports=80
+// yields [80] rather than ["80"].
+type listValue struct {
+	elem   Type
+	values []interface{}
+	set    bool
+}
+
+func (v *listValue) String() string {
+	if v == nil || len(v.values) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(v.values)
+	if err != nil {
+		return fmt.Sprint(v.values)
+	}
+	return string(b)
+}
+
+func (v *listValue) Set(s string) error {
+	items, err := parseList(s, v.elem)
+	if err != nil {
+		return err
+	}
+	if !v.set {
+		v.values = []interface{}{}
+		v.set = true
+	}
+	v.values = append(v.values, items...)
+	return nil
+}
+
+// Get returns the list as loaded from a file would be: a []string if all
+// items are strings.
+func (v *listValue) Get() interface{} {
+	return convertSlice(v.values)
+}
+
+// parseList parses s as a list of items of type elem: a JSON or YAML list
+// if it parses as one, and otherwise items split on the slice separator.
+// Lists of maps and lists of unknown items must be given as JSON or YAML.
+func parseList(s string, elem Type) ([]interface{}, error) {
+	items, err := unmarshalList(s)
+	if err == nil {
+		return items, nil
+	}
+	if s == "" {
+		return nil, nil
+	}
+	if elem == 0 || elem == StringMap {
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return nil, fmt.Errorf("invalid list: %w", err)
+		}
+		return nil, fmt.Errorf("expected a list such as [...], got %q", s)
+	}
+	for _, raw := range splitList(s, sliceSeparator) {
+		item, err := parseAs(raw, elem)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// unmarshalList parses s as a JSON or YAML list. It fails for values that
+// merely start with "[", such as the IPv6 address in [::1]:8080.
+func unmarshalList(s string) ([]interface{}, error) {
+	if !strings.HasPrefix(strings.TrimSpace(s), "[") {
+		return nil, fmt.Errorf("not a list: %q", s)
+	}
+	var items []interface{}
+	if err := yaml.Unmarshal([]byte(s), &items); err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		switch item := item.(type) {
+		case map[string]interface{}:
+			items[i] = convertMap(item)
+		case []interface{}:
+			items[i] = convertSlice(item)
+		}
+	}
+	return items, nil
+}
+
+// mapValue is a repeatable flag.Value for map-valued keys. Each occurrence
+// sets entries given as key=value pairs, split like a string slice, or as a
+// JSON or YAML map starting with "{". The entries are merged over the
+// configured map, and values of existing entries keep their type.
+type mapValue struct {
+	current map[string]interface{}
+	values  map[string]interface{}
+}
+
+func (v *mapValue) String() string {
+	if v == nil || len(v.values) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(v.values)
+	if err != nil {
+		return fmt.Sprint(v.values)
+	}
+	return string(b)
+}
+
+func (v *mapValue) Set(s string) error {
+	entries, err := parseMap(s, v.current)
+	if err != nil {
+		return err
+	}
+	if v.values == nil {
+		v.values = make(map[string]interface{})
+	}
+	maps.Copy(v.values, entries)
+	return nil
+}
+
+func (v *mapValue) Get() interface{} {
+	return v.values
+}
+
+// parseMap parses s as map entries: a JSON or YAML map if it starts with
+// "{", and otherwise key=value pairs split on the slice separator, whose
+// values are parsed as the type of the entry in current, if any.
+func parseMap(s string, current map[string]interface{}) (map[string]interface{}, error) {
+	if strings.HasPrefix(strings.TrimSpace(s), "{") {
+		var entries map[string]interface{}
+		if err := yaml.Unmarshal([]byte(s), &entries); err != nil {
+			return nil, fmt.Errorf("invalid map: %w", err)
+		}
+		return convertMap(entries), nil
+	}
+	entries := make(map[string]interface{})
+	if s == "" {
+		return entries, nil
+	}
+	for _, pair := range splitList(s, sliceSeparator) {
+		key, raw, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		value, err := parseAs(raw, typeOf(current[key]))
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %w", key, err)
+		}
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+// scalarSliceToStrings converts a slice of scalar values to strings.
+// It reports false if any element is a map or a slice, as such lists cannot
+// be expressed as repeated flag values.
+func scalarSliceToStrings(slice []interface{}) ([]string, bool) {
+	result := make([]string, len(slice))
+	for i, item := range slice {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}, []string:
+			return nil, false
+		}
+		result[i] = fmt.Sprintf("%v", item)
+	}
+	return result, true
+}
+
+// setFlagName is the name of the generic flag overriding arbitrary keys.
+const setFlagName = "set"
+
+// setValue is the flag.Value of the repeatable --set flag. It collects
+// key=value pairs, which are applied after all dedicated flags.
+type setValue struct {
+	pairs [][2]string
+}
+
+func (v *setValue) String() string {
+	return ""
+}
+
+func (v *setValue) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	v.pairs = append(v.pairs, [2]string{key, value})
+	return nil
+}
+
+func (v *setValue) Get() interface{} {
+	return v.pairs
+}
+
+// expandIndexFlags rewrites flags overriding items of the lists of m, such
+// as --endpoints.1.url=https://..., into the equivalent --set flags, since
+// flags are only generated for keys outside lists. The values of flags that
+// take one, such as the -5 of --offset -5, are left untouched, as are the
+// arguments from the first one that is not a flag on, which the flag
+// package does not parse either.
+func expandIndexFlags(fs *flag.FlagSet, m *mapManager, args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !isFlag(arg) {
+			return append(expanded, args[i:]...)
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if f := fs.Lookup(name); f != nil {
+			expanded = append(expanded, arg)
+			if !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+				i++
+				expanded = append(expanded, args[i])
+			}
+			continue
+		}
+		if !isIndexKey(m, name) {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		expanded = append(expanded, "--"+setFlagName+"="+name+"="+value)
+	}
+	return expanded
+}
+
+// isFlag reports whether arg is parsed as a flag by the flag package, which
+// stops at the first argument that is not.
+func isFlag(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-'
+}
+
+// isBoolFlag reports whether f is a boolean flag, which takes no separate
+// value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// isIndexKey reports whether the dotted key addresses an item of a list of
+// m, such as "endpoints.1.url": the segments before its first numeric one
+// must name a list.
+func isIndexKey(m *mapManager, key string) bool {
+	segments := strings.Split(key, ".")
+	for i, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil {
+			if i == 0 {
+				return false
+			}
+			switch m.Get(strings.Join(segments[:i], ".")).(type) {
+			case []interface{}, []string, []map[string]interface{}:
+				return true
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// parseAs parses raw as a value of type typ, so that values given as strings
+// on the command line keep the type of the key they override. Strings and
+// keys of unknown type are returned unchanged.
+func parseAs(raw string, typ Type) (interface{}, error) {
+	switch typ {
+	case Bool:
+		return strconv.ParseBool(raw)
+	case Int:
+		return strconv.Atoi(raw)
+	case Uint:
+		return strconv.ParseUint(raw, 10, 64)
+	case Float64:
+		return strconv.ParseFloat(raw, 64)
+	case Duration:
+		return time.ParseDuration(raw)
+	case StringSlice:
+		v := &stringSliceValue{}
+		_ = v.Set(raw)
+		return v.values, nil
+	case StringMap:
+		return parseMap(raw, nil)
+	case Regexp:
+		_, err := regexp.Compile(raw)
+		return raw, err
+	case Location:
+		_, err := time.LoadLocation(raw)
+		return raw, err
+	case Cron:
+		_, err := cronParser(raw)
+		return raw, err
+	}
+	return raw, nil
+}
+
+// sliceSeparator is the separator set with SetSliceSeparator.
+var sliceSeparator = ","
+
+// SetSliceSeparator sets the separator on which string values of list keys
+// are split, both in the configuration and in the values of list flags: with
+// the default comma, "a, b" is the list [a b]. Repeating a flag adds items
+// regardless. An empty separator disables splitting, so that a value such as
+// a URL with a comma in its query string stays one item; see
+// DisableCSVSplitting.
+// It should be called before Parse.
+func SetSliceSeparator(sep string) {
+	sliceSeparator = sep
+}
+
+// DisableCSVSplitting stops string values of list keys from being split on
+// commas. Lists are then given as YAML lists in files and by repeating the
+// flag on the command line. It is SetSliceSeparator("").
+// It should be called before Parse.
+func DisableCSVSplitting() {
+	SetSliceSeparator("")
+}
+
+// splitList splits s on sep, trimming the spaces around the items. s is not
+// split if sep is empty.
+func splitList(s, sep string) []string {
+	if sep == "" || !strings.Contains(s, sep) {
+		return []string{s}
+	}
+	parts := strings.Split(s, sep)
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return parts
+}
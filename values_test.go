@@ -0,0 +1,328 @@
+package mflag
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepeatableSliceFlags(t *testing.T) {
+	testReset(t)
+
+	SetDefault("features", []string{"dark_mode"})
+	configPath := createTempYAML(t, `
+ports: [80, 443]
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	os.Args = []string{"test", "--features=beta", "--features=gamma,delta", "--ports=8080"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if got, want := GetStringSlice("features"), []string{"beta", "gamma", "delta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected features to be %v, got %v", want, got)
+	}
+	if got, want := GetStringSlice("ports"), []string{"8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected ports to be %v, got %v", want, got)
+	}
+}
+
+func TestRepeatableSliceFlags_IPv6(t *testing.T) {
+	testReset(t)
+	SetDefault("listen", []string{"127.0.0.1:80"})
+	SetDefault("peers", []string{})
+
+	os.Args = []string{"test", "--listen=[::1]:8080", "--peers=[::1]:7000,[fe80::1]:7000", `--peers=["a:1"]`}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got, want := GetStringSlice("listen"), []string{"[::1]:8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the IPv6 address to be kept, got %v", got)
+	}
+	if got, want := GetStringSlice("peers"), []string{"[::1]:7000", "[fe80::1]:7000", "a:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected IPv6 addresses split and lists parsed, got %v", got)
+	}
+}
+
+func TestSliceSeparator(t *testing.T) {
+	testReset(t)
+	DisableCSVSplitting()
+	SetDefault("callbacks", []string{})
+	SetDefault("url", "https://example.com/?tags=a,b")
+	SetDefault("paths", "/bin:/usr/bin")
+
+	os.Args = []string{"test", "--callbacks=https://a.example.com/?x=1,2", "--callbacks=https://b.example.com"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got, want := GetStringSlice("callbacks"), []string{"https://a.example.com/?x=1,2", "https://b.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected flag values not to be split, got %v", got)
+	}
+	if got := GetStringSlice("url"); len(got) != 1 {
+		t.Errorf("Expected the URL to stay one item, got %v", got)
+	}
+	if got, want := GetStringSliceSep("paths", ":"), []string{"/bin", "/usr/bin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetStringSliceSep() = %v, want %v", got, want)
+	}
+
+	testReset(t)
+	SetSliceSeparator(";")
+	SetDefault("hosts", "a; b")
+	os.Args = []string{"test"}
+	Parse()
+	if got, want := GetStringSlice("hosts"), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected hosts split on the separator, got %v", got)
+	}
+}
+
+func TestTypedCollectionFlags(t *testing.T) {
+	testReset(t)
+	DeclareKey("labels", StringMap)
+	DeclareKey("annotations", StringMap)
+	if err := Init(createTempYAML(t, `
+ports: [80, 443]
+ratios: [0.5]
+tags: [a]
+labels: {team: core, replicas: 2}
+endpoints:
+  - url: https://a.example.com
+`)); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	os.Args = []string{"test",
+		"--ports=8080,8443", "--ports=9090",
+		"--ratios=[0.1, 0.2]",
+		`--tags=["x", "y"]`,
+		"--labels=replicas=3,env=prod", `--labels={"tier": "web"}`,
+		"--annotations=owner=ops",
+		`--endpoints=[{"url": "https://b.example.com", "weight": 2}]`,
+	}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	for key, want := range map[string]interface{}{
+		"ports":       []interface{}{8080, 8443, 9090},
+		"ratios":      []interface{}{0.1, 0.2},
+		"tags":        []string{"x", "y"},
+		"labels":      map[string]interface{}{"team": "core", "replicas": 3, "env": "prod", "tier": "web"},
+		"annotations": map[string]interface{}{"owner": "ops"},
+		"endpoints":   []interface{}{map[string]interface{}{"url": "https://b.example.com", "weight": 2}},
+	} {
+		if got := finalConfig.Get(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s to be %#v, got %#v", key, want, got)
+		}
+	}
+	if got := GetSlice("endpoints"); len(got) != 1 || got[0]["weight"] != 2 {
+		t.Errorf("Expected the overridden list of maps, got %v", got)
+	}
+
+	for _, arg := range []string{"--ports=http", "--labels=team", "--endpoints=https://c.example.com", "--ratios=[unclosed"} {
+		testReset(t)
+		DeclareKey("labels", StringMap)
+		if err := Init(createTempYAML(t, "ports: [80]\nratios: [0.5]\nendpoints: [{url: a}]\n")); err != nil {
+			t.Fatalf("Init() failed: %v", err)
+		}
+		os.Args = []string{"test", arg}
+		if err := ParseWithError(); err == nil {
+			t.Errorf("Expected an error for %s", arg)
+		}
+	}
+}
+
+func TestRepeatableSliceFlags_NotSet(t *testing.T) {
+	testReset(t)
+
+	SetDefault("features", []string{"dark_mode", "beta"})
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if got, want := GetStringSlice("features"), []string{"dark_mode", "beta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected features to keep their default %v, got %v", want, got)
+	}
+}
+
+func TestSetFlag(t *testing.T) {
+	testReset(t)
+
+	SetDefault("db.port", 5432)
+	SetDefault("db.pool.timeout", time.Second)
+	SetDefault("tls", false)
+	os.Args = []string{
+		"test",
+		"--set", "db.port=6543",
+		"--set=db.pool.timeout=5s",
+		"--set=tls=true",
+		"--set=brand.new.key=hello",
+	}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if v, ok := finalConfig.Get("db.port").(int); !ok || v != 6543 {
+		t.Errorf("Expected db.port to be int 6543, got %#v", finalConfig.Get("db.port"))
+	}
+	if v := GetDuration("db.pool.timeout"); v != 5*time.Second {
+		t.Errorf("Expected db.pool.timeout to be 5s, got %v", v)
+	}
+	if !GetBool("tls") {
+		t.Error("Expected tls to be true")
+	}
+	if v := GetString("brand.new.key"); v != "hello" {
+		t.Errorf("Expected brand.new.key to be 'hello', got %q", v)
+	}
+}
+
+func TestSetFlag_InvalidValue(t *testing.T) {
+	testReset(t)
+
+	SetDefault("db.port", 5432)
+	os.Args = []string{"test", "--set=db.port=not-a-number"}
+	if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue, got: %v", err)
+	}
+}
+
+func TestDurationFlagsForDurationStrings(t *testing.T) {
+	testReset(t)
+
+	SetDefault("name", "service")
+	SetDefault("typed", 2*time.Second)
+	configPath := createTempYAML(t, `
+timeout: 30s
+typed: 1m
+name: 5s
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--timeout=1m30s", "--typed=2m"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+
+	if v, ok := finalConfig.Get("timeout").(time.Duration); !ok || v != 90*time.Second {
+		t.Errorf("Expected timeout to be overridden by a Duration flag, got %#v", finalConfig.Get("timeout"))
+	}
+	if v := GetDuration("typed"); v != 2*time.Minute {
+		t.Errorf("Expected typed to be 2m, got %v", v)
+	}
+
+	testReset(t)
+	SetDefault("name", "service")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--timeout=oops"}
+	if err := ParseWithError(); err == nil {
+		t.Error("Expected an invalid duration flag to be rejected")
+	}
+
+	testReset(t)
+	SetDefault("name", "service")
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--name=not-a-duration"}
+	if err := ParseWithError(); err != nil {
+		t.Errorf("Expected a string key to keep a string flag, got: %v", err)
+	}
+}
+
+func TestListItemOverrides(t *testing.T) {
+	testReset(t)
+	SetDefault("offset", 0)
+	SetDefault("verbose", false)
+	configPath := createTempYAML(t, `
+endpoints:
+  - name: primary
+    url: https://a.example.com
+  - name: backup
+    url: https://b.example.com
+hosts: [a, b]
+`)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test",
+		"--endpoints.1.url=https://c.example.com",
+		"--endpoints.2.name", "extra",
+		"--set=hosts.0=z",
+		"--offset", "-5",
+		"--verbose",
+	}
+	Parse()
+
+	if got := GetString("endpoints.1.url"); got != "https://c.example.com" {
+		t.Errorf("Expected the overridden url, got %q", got)
+	}
+	if got := GetString("endpoints.1.name"); got != "backup" {
+		t.Errorf("Expected the other fields of the item to be kept, got %q", got)
+	}
+	if got := GetString("endpoints.2.name"); got != "extra" {
+		t.Errorf("Expected an item to be appended, got %q", got)
+	}
+	if got := GetStringSlice("hosts"); !reflect.DeepEqual(got, []string{"z", "b"}) {
+		t.Errorf("Expected hosts [z b], got %v", got)
+	}
+	if GetInt("offset") != -5 || !GetBool("verbose") {
+		t.Errorf("Expected a negative flag value to be kept, got offset %d and verbose %t", GetInt("offset"), GetBool("verbose"))
+	}
+	if got := sourceOf("endpoints.1.url"); got != "flag" {
+		t.Errorf("Expected the override to come from a flag, got %q", got)
+	}
+	if got := config.GetString("endpoints.1.url"); got != "https://b.example.com" {
+		t.Errorf("Expected the file layer to be untouched, got %q", got)
+	}
+
+	// Items past the end of a list are refused, and so are arguments after
+	// the first positional one left to the application.
+	for _, args := range [][]string{{"--set=endpoints.3.url=x"}, {"--endpoints.2.name=a", "--endpoints.4.name=b"}} {
+		testReset(t)
+		if err := Init(configPath); err != nil {
+			t.Fatalf("Init() failed: %v", err)
+		}
+		os.Args = append([]string{"test"}, args...)
+		if err := ParseWithError(); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("Expected ErrInvalidValue for %v, got %v", args, err)
+		}
+	}
+	testReset(t)
+	if err := Init(configPath); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	os.Args = []string{"test", "--endpoints.2.name=a", "--endpoints.3.name=b", "run", "--endpoints.0.url=x"}
+	if err := ParseWithError(); err != nil {
+		t.Fatalf("ParseWithError() failed: %v", err)
+	}
+	if got := GetString("endpoints.3.name"); got != "b" {
+		t.Errorf("Expected items to be appended one after the other, got %q", got)
+	}
+	if got := GetString("endpoints.0.url"); got != "https://a.example.com" {
+		t.Errorf("Expected the arguments after a positional one to be left alone, got %q", got)
+	}
+
+	Set("endpoints.9.url", "https://e.example.com")
+	if got := GetSlice("endpoints"); len(got) != 4 {
+		t.Errorf("Expected Set to ignore items past the end, got %v", got)
+	}
+	finalConfig.SetValue("endpoints.9.url", "https://e.example.com")
+	if got := GetSlice("endpoints"); len(got) != 4 {
+		t.Errorf("Expected SetValue to refuse items past the end, got %v", got)
+	}
+
+	finalConfig.SetValue("endpoints.0.url", "https://d.example.com")
+	if got := finalConfig.GetString("endpoints.0.url"); got != "https://d.example.com" {
+		t.Errorf("Expected SetValue to write into the list, got %q", got)
+	}
+	if got := config.GetString("endpoints.0.url"); got != "https://a.example.com" {
+		t.Errorf("Expected SetValue not to write into shared lists, got %q", got)
+	}
+}
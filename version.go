@@ -0,0 +1,62 @@
+package mflag
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// versionFlagName is the name of the built-in flag printing the version.
+const versionFlagName = "version"
+
+var (
+	// versionEnabled reports whether SetVersion was called.
+	versionEnabled = false
+	// appVersion is the version set with SetVersion.
+	appVersion = ""
+)
+
+// SetVersion registers a built-in --version flag which prints the given
+// version, along with the VCS commit and build date recorded by the Go
+// toolchain, and exits. If version is empty, the main module version from the
+// build info is used. It should be called before Parse.
+func SetVersion(version string) {
+	versionEnabled = true
+	appVersion = version
+}
+
+// registerVersionFlag adds the --version flag to fs if SetVersion was called.
+func registerVersionFlag(fs *flag.FlagSet) *bool {
+	if !versionEnabled || fs.Lookup(versionFlagName) != nil {
+		return nil
+	}
+	builtinFlags[versionFlagName] = true
+	return fs.Bool(versionFlagName, false, "print version information and exit")
+}
+
+// printVersion writes the version, commit and build date to w.
+func printVersion(w io.Writer) {
+	version, commit, date := appVersion, "unknown", "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "" {
+			version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+			case "vcs.time":
+				date = s.Value
+			case "vcs.modified":
+				if s.Value == "true" {
+					commit += " (modified)"
+				}
+			}
+		}
+	}
+	if version == "" {
+		version = "unknown"
+	}
+	fmt.Fprintf(w, "version: %s\ncommit:  %s\nbuilt:   %s\n", version, commit, date)
+}
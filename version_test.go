@@ -0,0 +1,35 @@
+package mflag
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVersionFlag(t *testing.T) {
+	testReset(t)
+
+	var buf bytes.Buffer
+	stdout = &buf
+	SetVersion("1.2.3")
+	SetDefault("port", 8080)
+	os.Args = []string{"test", "--version"}
+
+	if err := ParseWithError(); !errors.Is(err, ErrExitRequested) {
+		t.Fatalf("Expected ErrExitRequested, got: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "version: 1.2.3") || !strings.Contains(out, "commit:") {
+		t.Errorf("Unexpected version output: %q", out)
+	}
+}
+
+func TestVersionFlag_NotRegisteredByDefault(t *testing.T) {
+	testReset(t)
+
+	os.Args = []string{"test", "--version"}
+	if err := ParseWithError(); err == nil || errors.Is(err, ErrExitRequested) {
+		t.Errorf("Expected an unknown flag error without SetVersion, got: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/hypedn/mflag/winreg
+
+go 1.24
+
+require github.com/hypedn/mflag v0.0.0-20261016204951-551c88cf9f97
+
+require (
+	golang.org/x/sys v0.30.0
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
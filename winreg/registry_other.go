@@ -0,0 +1,14 @@
+//go:build !windows
+
+package winreg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hypedn/mflag"
+)
+
+func (p provider) Load(ctx context.Context) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("%w: cannot read %s: the registry is only available on Windows", mflag.ErrInitFailed, p)
+}
@@ -0,0 +1,117 @@
+//go:build windows
+
+package winreg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hypedn/mflag"
+	"golang.org/x/sys/windows/registry"
+)
+
+func (p provider) Load(ctx context.Context) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	base := registry.LOCAL_MACHINE
+	if p.root == currentUser {
+		base = registry.CURRENT_USER
+	}
+	k, err := registry.OpenKey(base, p.path, registry.READ)
+	if errors.Is(err, registry.ErrNotExist) {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to open %s: %w", mflag.ErrInitFailed, p, err)
+	}
+	defer k.Close()
+
+	values, err := readKey(ctx, k)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read %s: %w", mflag.ErrInitFailed, p, err)
+	}
+	return values, nil
+}
+
+// readKey reads the values and subkeys of k. Their names are lowercased,
+// as the registry ignores case and mflag keys are lower case.
+func readKey(ctx context.Context, k registry.Key) (map[string]interface{}, error) {
+	names, err := k.ReadValueNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if name == "" {
+			continue // The default value of a key has no name to map to.
+		}
+		value, err := readValue(k, name)
+		if err != nil {
+			return nil, fmt.Errorf("value %s: %w", name, err)
+		}
+		if value != nil {
+			values[strings.ToLower(name)] = value
+		}
+	}
+
+	subkeys, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range subkeys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sub, err := registry.OpenKey(k, name, registry.READ)
+		if err != nil {
+			return nil, fmt.Errorf("subkey %s: %w", name, err)
+		}
+		nested, err := readKey(ctx, sub)
+		sub.Close()
+		if err != nil {
+			return nil, fmt.Errorf("subkey %s: %w", name, err)
+		}
+		values[strings.ToLower(name)] = nested
+	}
+	return values, nil
+}
+
+// readValue reads the value name of k, converted to the types mflag uses
+// for YAML values. Values of types without such a conversion are skipped.
+func readValue(k registry.Key, name string) (interface{}, error) {
+	_, typ, err := k.GetValue(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case registry.SZ, registry.EXPAND_SZ:
+		s, typ, err := k.GetStringValue(name)
+		if err != nil {
+			return nil, err
+		}
+		if typ == registry.EXPAND_SZ {
+			return registry.ExpandString(s)
+		}
+		return s, nil
+	case registry.DWORD, registry.QWORD:
+		n, _, err := k.GetIntegerValue(name)
+		if err != nil {
+			return nil, err
+		}
+		return int(n), nil
+	case registry.MULTI_SZ:
+		strs, _, err := k.GetStringsValue(name)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, len(strs))
+		for i, s := range strs {
+			items[i] = s
+		}
+		return items, nil
+	}
+	return nil, nil
+}
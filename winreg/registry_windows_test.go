@@ -0,0 +1,56 @@
+//go:build windows
+
+package winreg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+func TestLoad(t *testing.T) {
+	const path = `Software\mflag-test`
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, path+`\Database`, registry.ALL_ACCESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		registry.DeleteKey(registry.CURRENT_USER, path+`\Database`)
+		registry.DeleteKey(registry.CURRENT_USER, path)
+	})
+	defer k.Close()
+	if err := k.SetStringValue("Host", "db"); err != nil {
+		t.Fatal(err)
+	}
+	root, err := registry.OpenKey(registry.CURRENT_USER, path, registry.ALL_ACCESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	if err := root.SetDWordValue("Port", 8080); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.SetStringsValue("Features", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := CurrentUser(path).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"port":     8080,
+		"features": []interface{}{"a", "b"},
+		"database": map[string]interface{}{"host": "db"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, want %v", got, want)
+	}
+
+	got, err = CurrentUser(`Software\mflag-test-missing`).Load(context.Background())
+	if err != nil || len(got) != 0 {
+		t.Errorf("Expected no values for a missing key, got %v, %v", got, err)
+	}
+}
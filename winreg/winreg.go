@@ -0,0 +1,50 @@
+// Package winreg provides an mflag provider reading configuration from a
+// subtree of the Windows registry, the conventional place for the settings
+// of Windows services:
+//
+//	err := mflag.InitContext(ctx, winreg.LocalMachine(`Software\MyApp`))
+//
+// Values become keys and subkeys become nested maps, with their names
+// lowercased, so the value Host of the subkey Database sets
+// "database.host". String values are strings, with environment variables
+// expanded in REG_EXPAND_SZ values, REG_DWORD and REG_QWORD values are
+// integers and REG_MULTI_SZ values are lists. It is a separate module so
+// that mflag itself does not depend on x/sys. On other platforms, loading
+// fails.
+package winreg
+
+import "github.com/hypedn/mflag"
+
+// root identifies a predefined registry key.
+type root int
+
+const (
+	localMachine root = iota
+	currentUser
+)
+
+// LocalMachine returns a provider reading the subtree at path below
+// HKEY_LOCAL_MACHINE, such as `Software\MyApp`. As with mflag.File, a
+// missing key yields no values.
+func LocalMachine(path string) mflag.Provider {
+	return provider{root: localMachine, path: path}
+}
+
+// CurrentUser returns a provider reading the subtree at path below
+// HKEY_CURRENT_USER.
+func CurrentUser(path string) mflag.Provider {
+	return provider{root: currentUser, path: path}
+}
+
+type provider struct {
+	root root
+	path string
+}
+
+// String returns the full name of the key.
+func (p provider) String() string {
+	if p.root == currentUser {
+		return `HKEY_CURRENT_USER\` + p.path
+	}
+	return `HKEY_LOCAL_MACHINE\` + p.path
+}
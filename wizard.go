@@ -0,0 +1,147 @@
+package mflag
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// RunWizard asks for the value of every declared key on w, reading the
+// answers from r, and saves them to the config file given to Init, for the
+// first-run setup of command-line tools:
+//
+//	Port to listen on.
+//	port [8080]: 9090
+//	log_level (debug, info, warn) [info]:
+//
+// Declared keys are those given a type, allowed values, a registration or
+// marked as required. An empty answer keeps the value shown in brackets,
+// from the file or the defaults, and is refused for required keys without
+// one. Answers are parsed and validated as values of the key would be, and
+// asked again when invalid. The answers are added to the file, which is
+// edited as SaveConfig does, and the file is loaded again for Parse.
+// It should be called after Init and before Parse.
+func RunWizard(w io.Writer, r io.Reader) error {
+	p, ok := source.(fileProvider)
+	if !ok {
+		return fmt.Errorf("%w: RunWizard needs Init to be called with a config file", ErrInitFailed)
+	}
+	path, err := expandPath(p.path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInitFailed, err)
+	}
+
+	// The answers are added to the file as written, rather than to the
+	// values loaded from it, so that its conditional blocks and overrides
+	// are kept.
+	file := newManager()
+	if err := file.loadFile(context.Background(), path, ""); err != nil {
+		return err
+	}
+	in := bufio.NewScanner(r)
+	for _, key := range wizardKeys() {
+		value, answered, err := askKey(w, in, key)
+		if err != nil {
+			return err
+		}
+		if answered {
+			file.SetValue(key, value)
+		}
+	}
+
+	if err := writeConfigFile(path, file.data); err != nil {
+		return fmt.Errorf("%w: failed to write %s: %w", ErrInitFailed, path, err)
+	}
+	data, err := load(context.Background(), source)
+	if err != nil {
+		return err
+	}
+	setConfig(data)
+	return nil
+}
+
+// wizardKeys returns the declared keys RunWizard asks for, sorted.
+func wizardKeys() []string {
+	var keys []string
+	for _, key := range slices.Sorted(maps.Keys(specs)) {
+		s := specs[key]
+		if s.typ != 0 || s.registered || s.required || len(s.allowed) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// askKey asks for the value of key until a valid answer is given. It
+// reports whether there was an answer other than an empty line.
+func askKey(w io.Writer, in *bufio.Scanner, key string) (interface{}, bool, error) {
+	s := specs[key]
+	current := config.Get(key)
+	if current == nil {
+		current = defaults.Get(key)
+	}
+
+	prompt := key
+	if len(s.allowed) > 0 {
+		prompt += " (" + strings.Join(s.allowed, ", ") + ")"
+	}
+	if current != nil {
+		prompt += " [" + wizardValue(key, current) + "]"
+	}
+	if s.description != "" {
+		fmt.Fprintln(w, s.description)
+	}
+	for {
+		fmt.Fprintf(w, "%s: ", prompt)
+		if !in.Scan() {
+			if err := in.Err(); err != nil {
+				return nil, false, err
+			}
+			return nil, false, fmt.Errorf("no answer for %q: %w", key, io.ErrUnexpectedEOF)
+		}
+		raw := strings.TrimSpace(in.Text())
+		if raw == "" {
+			if current != nil || !s.required {
+				return nil, false, nil
+			}
+			fmt.Fprintln(w, "A value is required.")
+			continue
+		}
+		value, err := checkAnswer(key, raw)
+		if err != nil {
+			fmt.Fprintf(w, "Invalid value: %v\n", err)
+			continue
+		}
+		return value, true, nil
+	}
+}
+
+// checkAnswer parses raw as a value of key and validates it.
+func checkAnswer(key, raw string) (interface{}, error) {
+	value, err := parseKey(key, raw)
+	if err != nil {
+		return nil, err
+	}
+	s := specs[key]
+	if err := checkEnum(key, raw, s.allowed); err != nil {
+		return nil, err
+	}
+	for _, fn := range s.validators {
+		if err := fn(value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// wizardValue formats value, the current value of key, for a prompt.
+func wizardValue(key string, value interface{}) string {
+	if s, ok := value.(string); ok && !isSecret(key) {
+		return s
+	}
+	return displayValue(key, value)
+}
@@ -0,0 +1,77 @@
+package mflag
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunWizard(t *testing.T) {
+	testReset(t)
+	Register("port", Default(8080), Usage("Port to listen on."), Validator(func(v interface{}) error {
+		if v.(int) < 1024 {
+			return errors.New("privileged port")
+		}
+		return nil
+	}))
+	SetDefaultEnum("log_level", "info", "debug", "info", "warn")
+	Register("db.password", Required(), Sensitive())
+	SetDefault("untouched", "x")
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte("# Written by hand.\nname: demo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(path); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	var out strings.Builder
+	answers := strings.Join([]string{
+		"",        // db.password: required
+		"hunter2", // db.password
+		"trace",   // log_level: not allowed
+		"",        // log_level: keep the default
+		"80",      // port: rejected by the validator
+		"nine",    // port: not an integer
+		"9090",    // port
+	}, "\n")
+	if err := RunWizard(&out, strings.NewReader(answers)); err != nil {
+		t.Fatalf("RunWizard() failed: %v", err)
+	}
+	for _, want := range []string{
+		"db.password: A value is required.",
+		"log_level (debug, info, warn) [info]: Invalid value:",
+		"Port to listen on.\nport [8080]: Invalid value: privileged port",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the prompts, got:\n%s", want, out.String())
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Written by hand.\nname: demo\ndb:\n  password: hunter2\nport: 9090\n"
+	if string(content) != want {
+		t.Errorf("Unexpected file, got:\n%s\nwant:\n%s", content, want)
+	}
+
+	os.Args = []string{"test"}
+	Parse()
+	if got := GetInt("port"); got != 9090 {
+		t.Errorf("Expected the answered port, got %d", got)
+	}
+
+	testReset(t)
+	Register("token", Required())
+	if err := Init(filepath.Join(t.TempDir(), "new.yaml")); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	if err := RunWizard(io.Discard, strings.NewReader("")); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF without answers, got %v", err)
+	}
+}
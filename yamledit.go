@@ -0,0 +1,189 @@
+package mflag
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isYAMLFile reports whether the file at path is parsed as YAML.
+func isYAMLFile(path string) bool {
+	_, unmarshal, _ := formatOf(path, "")
+	return unmarshal == nil
+}
+
+// editYAML returns the YAML document content edited to hold data: values
+// that changed are replaced, keys that are missing are added and keys that
+// are gone are removed, leaving comments, key order and unchanged values
+// as they are.
+func editYAML(content []byte, data map[string]interface{}) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return yaml.Marshal(data)
+	}
+	if err := editMapping(doc.Content[0], data); err != nil {
+		return nil, err
+	}
+	untagMergeKeys(&doc)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indentOf(content))
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return restoreBlankLines(content, buf.Bytes()), nil
+}
+
+// untagMergeKeys clears the tag of the merge keys below n, which the YAML
+// library would otherwise write as "!!merge <<".
+func untagMergeKeys(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i < len(n.Content); i += 2 {
+			if key := n.Content[i]; key.Value == mergeKey && key.Tag == "!!merge" {
+				key.Tag = ""
+			}
+		}
+	}
+	for _, child := range n.Content {
+		untagMergeKeys(child)
+	}
+}
+
+// restoreBlankLines adds the blank lines of original, which the YAML
+// library drops, to edited: before the lines of edited that follow a blank
+// line in original, in order.
+func restoreBlankLines(original, edited []byte) []byte {
+	var before []string // lines preceded by blank lines in original
+	blank := false
+	for _, line := range strings.Split(string(original), "\n") {
+		if strings.TrimSpace(line) == "" {
+			blank = true
+			continue
+		}
+		if blank {
+			before = append(before, strings.TrimSpace(line))
+			blank = false
+		}
+	}
+	var buf bytes.Buffer
+	for i, line := range strings.Split(string(edited), "\n") {
+		if i > 0 {
+			buf.WriteByte('\n')
+			// Lines of original that are gone are skipped.
+			if j := slices.Index(before, strings.TrimSpace(line)); j >= 0 {
+				buf.WriteByte('\n')
+				before = before[j+1:]
+			}
+		}
+		buf.WriteString(line)
+	}
+	return buf.Bytes()
+}
+
+// editMapping edits the mapping node n to hold data.
+func editMapping(n *yaml.Node, data map[string]interface{}) error {
+	// current holds the values of the mapping, including those it gets
+	// from merge keys.
+	var current map[string]interface{}
+	if err := n.Decode(&current); err != nil {
+		return err
+	}
+	current = convertMap(current)
+
+	content := make([]*yaml.Node, 0, len(n.Content))
+	explicit := make(map[string]bool)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if key.Value == mergeKey {
+			content = append(content, key, value)
+			continue
+		}
+		want, ok := data[key.Value]
+		if !ok {
+			continue // Removed.
+		}
+		explicit[key.Value] = true
+		if err := editValue(value, current[key.Value], want); err != nil {
+			return err
+		}
+		content = append(content, key, value)
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(data)) {
+		if explicit[k] {
+			continue
+		}
+		if inherited, ok := current[k]; ok && sameValue(inherited, data[k]) {
+			continue // Set by a merge key.
+		}
+		var key, value yaml.Node
+		if err := key.Encode(k); err != nil {
+			return err
+		}
+		if err := value.Encode(yamlValue(data[k])); err != nil {
+			return err
+		}
+		content = append(content, &key, &value)
+	}
+	n.Content = content
+	return nil
+}
+
+// editValue edits the node n, holding have, to hold want.
+func editValue(n *yaml.Node, have, want interface{}) error {
+	if sameValue(have, want) {
+		return nil
+	}
+	if nested, ok := want.(map[string]interface{}); ok && n.Kind == yaml.MappingNode {
+		return editMapping(n, nested)
+	}
+	var value yaml.Node
+	if err := value.Encode(yamlValue(want)); err != nil {
+		return fmt.Errorf("encoding %v: %w", want, err)
+	}
+	value.HeadComment, value.LineComment, value.FootComment = n.HeadComment, n.LineComment, n.FootComment
+	if value.Kind == yaml.ScalarNode && n.Kind == yaml.ScalarNode && value.Tag == n.Tag {
+		value.Style = n.Style
+	}
+	*n = value
+	return nil
+}
+
+// yamlValue returns v as written to a file, with durations written as
+// "1m30s" rather than as nanoseconds.
+func yamlValue(v interface{}) interface{} {
+	if d, ok := v.(time.Duration); ok {
+		return d.String()
+	}
+	return v
+}
+
+// sameValue reports whether a value read from a file and a value of the
+// configuration are the same, such as the string "30s" and a duration.
+func sameValue(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b) || fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// indentOf returns the indentation of the nested blocks of the YAML
+// document content, 2 if there are none.
+func indentOf(content []byte) int {
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		trimmed := bytes.TrimLeft(line, " ")
+		if indent := len(line) - len(trimmed); indent > 0 && len(trimmed) > 0 && trimmed[0] != '#' {
+			return indent
+		}
+	}
+	return 2
+}